@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	log "github.com/sirupsen/logrus"
+)
+
+// canaryPollInterval is how often a service's tasks are checked while waiting
+// for them to run with a new secret version
+const canaryPollInterval = 2 * time.Second
+
+// verifyCanary waits until a task of ROTATION_CANARY_SERVICE runs with the new
+// secret version. Rotations that do not touch the canary are not checked.
+func (d *SecretsDriver) verifyCanary(newSecretName, newSecretID string) error {
+	canary := d.config.RotationCanaryService
+	if canary == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.RotationCanaryTimeout)
+	defer cancel()
+
+	services, err := d.store.ListServices(ctx, []string{canary})
+	d.recordDockerAPICall("ServiceList", err)
+	if err != nil {
+		return fmt.Errorf("failed to list canary service %s: %v", canary, err)
+	}
+	usesSecret := false
+	for _, service := range services {
+		if service.Spec.Name == canary && serviceReferencesSecret(service.Spec.TaskTemplate.ContainerSpec, newSecretID) {
+			usesSecret = true
+		}
+	}
+	if !usesSecret {
+		log.Debugf("Canary service %s does not use %s, skipping canary check", canary, newSecretName)
+		return nil
+	}
+
+	log.Printf("Waiting up to %v for canary service %s to run with %s", d.config.RotationCanaryTimeout, canary, newSecretName)
+
+	if _, err := d.runningTasksWith(ctx, canary, newSecretID); err != nil {
+		return fmt.Errorf("canary service %s did not run with %s within %v", canary, newSecretName, d.config.RotationCanaryTimeout)
+	}
+	log.Printf("Canary service %s is running with %s", canary, newSecretName)
+	return nil
+}
+
+// runningTasksWith polls a service until some of its tasks run with the
+// secret and returns those tasks, or fails once ctx is done
+func (d *SecretsDriver) runningTasksWith(ctx context.Context, serviceName, secretID string) ([]swarm.Task, error) {
+	ticker := time.NewTicker(canaryPollInterval)
+	defer ticker.Stop()
+	for {
+		tasks, err := d.store.ListTasks(ctx, serviceName)
+		d.recordDockerAPICall("TaskList", err)
+		if err != nil {
+			log.Warnf("Failed to list tasks of service %s: %v", serviceName, err)
+		}
+		var running []swarm.Task
+		for _, task := range tasks {
+			if task.Status.State == swarm.TaskStateRunning && serviceReferencesSecret(task.Spec.ContainerSpec, secretID) {
+				running = append(running, task)
+			}
+		}
+		if len(running) > 0 {
+			return running, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// serviceReferencesSecret reports whether a container spec mounts the secret
+func serviceReferencesSecret(spec *swarm.ContainerSpec, secretID string) bool {
+	if spec == nil {
+		return false
+	}
+	for _, secretRef := range spec.Secrets {
+		if secretRef.SecretID == secretID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// pathFromLabel names another plugin secret whose value is the backend path
+// of this one, optionally followed by "#field"
+const pathFromLabel = "path_from"
+
+// maxPathFromDepth bounds how many path_from references are followed
+const maxPathFromDepth = 5
+
+// resolvePathFrom replaces the path_from label of req with the path, and
+// field, read from the referenced secret. References are followed through
+// the referenced secret's own labels, so chains resolve innermost first.
+// Every secret of the chain is read with the plugin's own provider, so
+// neither it nor the referenced secrets may select another one.
+func (d *SecretsDriver) resolvePathFrom(ctx context.Context, req secrets.Request, chain []string) (secrets.Request, error) {
+	ref, exists := req.SecretLabels[pathFromLabel]
+	if !exists {
+		return req, nil
+	}
+
+	chain = append(chain, req.SecretName)
+	for _, name := range chain {
+		if name == ref {
+			return req, &providers.ConfigError{Err: fmt.Errorf("%s cycle: %s -> %s", pathFromLabel, strings.Join(chain, " -> "), ref)}
+		}
+	}
+	if len(chain) > maxPathFromDepth {
+		return req, &providers.ConfigError{Err: fmt.Errorf("%s chain is longer than %d secrets: %s", pathFromLabel, maxPathFromDepth, strings.Join(chain, " -> "))}
+	}
+
+	refReq, err := d.referencedRequest(ctx, ref)
+	if err != nil {
+		return req, err
+	}
+	if _, exists := refReq.SecretLabels[providerAliasLabel]; exists {
+		return req, &providers.ConfigError{Err: fmt.Errorf("%s secret %s selects a provider alias, only secrets of the plugin's provider can be referenced", pathFromLabel, ref)}
+	}
+	if _, exists := refReq.SecretLabels[providerTypeLabel]; exists {
+		return req, &providers.ConfigError{Err: fmt.Errorf("%s secret %s sets secrets_provider, only secrets of the plugin's provider can be referenced", pathFromLabel, ref)}
+	}
+	if refReq, err = d.resolvePathFrom(ctx, refReq, chain); err != nil {
+		return req, err
+	}
+
+	value, err := d.provider.GetSecret(ctx, refReq)
+	if d.monitor != nil {
+		d.monitor.RecordProviderRead(d.provider.GetProviderName())
+	}
+	if err != nil {
+		return req, fmt.Errorf("failed to read %s secret %s: %w", pathFromLabel, ref, err)
+	}
+
+	path, field, _ := strings.Cut(strings.TrimSpace(string(value)), "#")
+	if path == "" {
+		return req, &providers.ConfigError{Err: fmt.Errorf("%s secret %s holds no path", pathFromLabel, ref)}
+	}
+
+	resolved := req
+	resolved.SecretLabels = copyLabels(req.SecretLabels)
+	delete(resolved.SecretLabels, pathFromLabel)
+	resolved.SecretLabels[d.provider.PathLabelKey()] = path
+	if field != "" {
+		resolved.SecretLabels[d.provider.FieldLabelKey()] = field
+	}
+	return resolved, nil
+}
+
+// referencedRequest builds the request of a plugin secret from its labels
+func (d *SecretsDriver) referencedRequest(ctx context.Context, name string) (secrets.Request, error) {
+	secretList, err := d.store.ListSecrets(ctx, name)
+	d.recordDockerAPICall("SecretList", err)
+	if err != nil {
+		return secrets.Request{}, fmt.Errorf("failed to list secrets: %v", err)
+	}
+
+	// The name filter matches by prefix, so the exact name is checked
+	for _, secret := range secretList {
+		if secret.Spec.Name == name {
+			return secrets.Request{
+				SecretName:   name,
+				SecretLabels: resolveLabels(copyLabels(secret.Spec.Labels), d.config.LabelPrefix),
+			}, nil
+		}
+	}
+	return secrets.Request{}, &providers.ConfigError{Err: fmt.Errorf("%s secret %s not found", pathFromLabel, name)}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestPathFromChain(t *testing.T) {
+	docker := &fakeDocker{secrets: []swarm.Secret{
+		testSecret("locator", "db_locator", map[string]string{pathFromLabel: "db_root"}),
+		testSecret("root", "db_root", nil),
+		testSecret("a", "loop_a", map[string]string{pathFromLabel: "loop_b"}),
+		testSecret("b", "loop_b", map[string]string{pathFromLabel: "loop_a"}),
+	}}
+	// A chain one secret longer than maxPathFromDepth allows
+	for i := 1; i <= maxPathFromDepth; i++ {
+		name := fmt.Sprintf("hop_%d", i)
+		docker.secrets = append(docker.secrets, testSecret(name, name, map[string]string{pathFromLabel: fmt.Sprintf("hop_%d", i+1)}))
+	}
+	provider := &fieldProvider{&fakeProvider{values: map[string]string{
+		"db_root":     "locators/db",
+		"locators/db": "backends/db#password",
+		"backends/db": `{"username": "app", "password": "hunter2"}`,
+	}}}
+	driver := newTestDriver(provider, docker)
+	driver.config.EnableRotation = false
+
+	// db reads its path from db_locator, which reads its own from db_root
+	response := driver.Get(secrets.Request{SecretName: "db", SecretLabels: map[string]string{pathFromLabel: "db_locator"}})
+	if response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	if string(response.Value) != "hunter2" {
+		t.Errorf("Get() = %q, expected the password field of backends/db", response.Value)
+	}
+
+	tests := []struct {
+		name    string
+		ref     string
+		wantErr string
+	}{
+		{"cycle", "loop_a", "path_from cycle: db -> loop_a -> loop_b -> loop_a"},
+		{"missing reference", "db_missing", "path_from secret db_missing not found"},
+		{"chain too long", "hop_1", "path_from chain is longer than 5 secrets"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := driver.Get(secrets.Request{SecretName: "db", SecretLabels: map[string]string{pathFromLabel: tt.ref}})
+			if !strings.HasPrefix(response.Err, "config: ") || !strings.Contains(response.Err, tt.wantErr) {
+				t.Errorf("Get() error = %q, expected a configuration error containing %q", response.Err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPathFromRequiresPluginProvider(t *testing.T) {
+	docker := &fakeDocker{secrets: []swarm.Secret{
+		testSecret("root", "db_root", nil),
+		testSecret("aliased", "aliased_root", map[string]string{providerAliasLabel: "vault-b"}),
+		testSecret("labelled", "labelled_root", map[string]string{providerTypeLabel: "vault"}),
+	}}
+	provider := &fakeProvider{values: map[string]string{"db_root": "backends/db", "backends/db": "hunter2"}}
+	driver := newTestDriver(provider, docker)
+	driver.config.EnableRotation = false
+	driver.config.AllowLabelProviders = true
+	driver.aliasProviders = map[string]*aliasProvider{
+		"vault-b": {alias: providerAlias{name: "vault-b"}, provider: &fakeProvider{}, ready: true},
+	}
+
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr string
+	}{
+		{"alias", map[string]string{pathFromLabel: "db_root", providerAliasLabel: "vault-b"}, "path_from cannot be combined with provider"},
+		{"secrets_provider", map[string]string{pathFromLabel: "db_root", providerTypeLabel: "vault"}, "path_from cannot be combined with secrets_provider"},
+		{"reference selects an alias", map[string]string{pathFromLabel: "aliased_root"}, "path_from secret aliased_root selects a provider alias"},
+		{"reference sets secrets_provider", map[string]string{pathFromLabel: "labelled_root"}, "path_from secret labelled_root sets secrets_provider"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := driver.Get(secrets.Request{SecretName: "db", SecretLabels: tt.labels})
+			if !strings.HasPrefix(response.Err, "config: ") || !strings.Contains(response.Err, tt.wantErr) {
+				t.Errorf("Get() error = %q, expected a configuration error containing %q", response.Err, tt.wantErr)
+			}
+		})
+	}
+
+	// Without another provider the reference resolves as usual
+	response := driver.Get(secrets.Request{SecretName: "db", SecretLabels: map[string]string{pathFromLabel: "db_root"}})
+	if response.Err != "" || string(response.Value) != "hunter2" {
+		t.Errorf("Get() = %q, %q, expected %q", response.Value, response.Err, "hunter2")
+	}
+}
@@ -2,9 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"os"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -13,76 +19,235 @@ import (
 	dockerclient "github.com/docker/docker/client"
 	"github.com/docker/go-plugins-helpers/secrets"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/sugar-org/vault-swarm-plugin/monitoring"
 	"github.com/sugar-org/vault-swarm-plugin/providers"
 )
 
+// Labels added to rotated secret versions
+const (
+	rotatedAtLabel   = "secrets.rotated.at"
+	rotatedFromLabel = "secrets.rotated.from"
+	providerLabel    = "secrets.provider"
+	checksumLabel    = "secrets.checksum.sha256"
+)
+
+// maxSecretNameLength is Docker's limit on secret names. Rotated versions
+// append "-<unix nanoseconds>" padded to versionSuffixDigits, which takes 20
+// of them.
+const (
+	versionSuffixDigits    = 19
+	maxSecretNameLength    = 64
+	maxRotatableNameLength = maxSecretNameLength - versionSuffixDigits - 1
+)
+
 // SecretsDriver implements the secrets.Driver interface with multi-provider support
 type SecretsDriver struct {
 	provider      providers.SecretsProvider
 	config        *SecretsConfig
-	dockerClient  *dockerclient.Client
+	store         SecretStore
 	secretTracker map[string]*providers.SecretInfo // key: docker secret name
 	trackerMutex  sync.RWMutex
 	monitorCtx    context.Context
 	monitorCancel context.CancelFunc
 	monitor       *monitoring.Monitor
 	webInterface  *monitoring.WebInterface
+	metricsServer *monitoring.MetricsServer
+	staleValues   *staleCache // last-known values, set with ALLOW_STALE_ON_ERROR
+	// Providers configured through secret labels, keyed by settings fingerprint
+	labelProviders      map[string]providers.SecretsProvider
+	labelProvidersMutex sync.Mutex
+	labelProviderInits  singleflight.Group // initializations in flight, by fingerprint
+	// Own update policy of the services a rotation rollout is overriding
+	rolloutOriginals map[string]*swarm.UpdateConfig
+	rolloutMutex     sync.Mutex
+	// Named provider instances from PROVIDER_ALIASES, selected by the provider label
+	aliasProviders map[string]*aliasProvider
+	// Signs secrets with emit_signature=true, set with SIGNING_KEY_PATH
+	signingKey ed25519.PrivateKey
+	// Clock spacing the warm-up reads, time.After outside of tests
+	after func(time.Duration) <-chan time.Time
+	// rotation_exec commands still running, waited for on Stop
+	rotationExecs sync.WaitGroup
 }
 
 // SecretsConfig holds the configuration for the multi-provider driver
 type SecretsConfig struct {
-	ProviderType     string
-	EnableRotation   bool
-	RotationInterval time.Duration
-	EnableMonitoring bool
-	MonitoringPort   int
-	Settings         map[string]string
+	ProviderType       string
+	EnableRotation     bool
+	RotationInterval   time.Duration
+	EnableMonitoring   bool
+	MonitoringPort     int
+	MetricsPort        int // serves Prometheus metrics on their own port when set
+	StartupCanary      bool
+	RotationWebhookURL string // notified after every successful rotation
+	TrackerStateFile   string // persists tracked secrets across restarts when set
+	TrackerStateKey    string // encrypts the tracker state file when set
+	UpdateServices     bool   // point services at rotated secrets and remove old versions
+	FieldDiff          bool   // report which fields changed on rotation
+	DisableDoNotReuse  bool   // never ask Swarm to treat a delivered secret as single-use
+	AllowReuseOverride bool   // let vault_reuse=false still win over DisableDoNotReuse
+	LabelPrefix        string // namespace of the labels the plugin recognizes, e.g. "es."
+	// Check secrets on the rotation cadence declared in the backend
+	FollowBackendSchedule bool
+	// Periodically write the tracked secrets, without values, to this file
+	InventoryExportPath     string
+	InventoryExportInterval time.Duration
+	// Serve the last-known value when the backend read fails transiently
+	AllowStaleOnError bool
+	// Limits of the last-known value cache, 0 means unbounded
+	CacheMaxEntries int
+	CacheMaxBytes   int64
+	// How long a last-known value may be served after it was read, 0 means forever
+	StaleValueTTL time.Duration
+	// Only secrets carrying this key=value (or bare key) label are rotated
+	ManagedSecretLabel string
+	// Only services whose rotation_group label matches are moved to new versions
+	RotationActiveGroup string
+	// Only services carrying this key=value (or bare key) label are checked
+	// for references to a rotated secret, all services when empty
+	RotationServiceLabel string
+	// Service that must run with a rotated version before the old one is dropped
+	RotationCanaryService string
+	RotationCanaryTimeout time.Duration
+	// Let secrets configure their own provider through secrets_provider labels
+	AllowLabelProviders bool
+	// How long a rotation_exec command may take, including waiting for tasks
+	RotationExecTimeout time.Duration
+	// Backend read timeouts of secret requests and rotations, and of the
+	// monitor's change checks
+	RequestTimeout     time.Duration
+	ChangeCheckTimeout time.Duration
+	// Spread the first check of restored secrets over this window
+	WarmupWindow time.Duration
+	// Longest wait for a backend's own rotation before rotating anyway
+	BackendRotationMaxDefer time.Duration
+	// Refresh the label-derived configuration of tracked secrets this often
+	RetrackInterval time.Duration
+	// Initialize provider aliases on first use instead of at startup
+	LazyAliasInit bool
+	// Retry lazy aliases whose initialization failed this often
+	AliasRetryInterval time.Duration
+	// Key picked from secrets labeled env_select=true
+	DeployEnv string
+	Settings  map[string]string
 }
 
 // NewDriver creates a new Driver instance with multi-provider support
 func NewDriver() (*SecretsDriver, error) {
 	// Collect all configuration from environment variables
-	settings := make(map[string]string)
+	settings := environmentSettings()
 
 	// Get provider type (default to vault for backward compatibility)
 	providerType := getEnvOrDefault("SECRETS_PROVIDER", "vault")
 
-	// Collect all environment variables for provider configuration
-	for _, env := range os.Environ() {
-		pair := strings.SplitN(env, "=", 2)
-		if len(pair) == 2 {
-			settings[pair[0]] = pair[1]
+	config := &SecretsConfig{
+		ProviderType:            providerType,
+		EnableRotation:          getEnvOrDefault("ENABLE_ROTATION", "true") == "true",
+		RotationInterval:        parseDurationOrDefault(getEnvOrDefault("ROTATION_INTERVAL", "10s")),
+		EnableMonitoring:        getEnvOrDefault("ENABLE_MONITORING", "true") == "true",
+		MonitoringPort:          parseIntOrDefault(getEnvOrDefault("MONITORING_PORT", "8080")),
+		MetricsPort:             parseIntWithDefault(getEnvOrDefault("METRICS_PORT", ""), 0),
+		StartupCanary:           getEnvOrDefault("STARTUP_CANARY", "false") == "true",
+		RotationWebhookURL:      getEnvOrDefault("ROTATION_WEBHOOK_URL", ""),
+		TrackerStateFile:        getEnvOrDefault("TRACKER_STATE_FILE", ""),
+		TrackerStateKey:         getEnvOrDefault("TRACKER_STATE_KEY", ""),
+		UpdateServices:          getEnvOrDefault("ROTATION_UPDATE_SERVICES", "true") == "true",
+		FieldDiff:               getEnvOrDefault("ROTATION_FIELD_DIFF", "false") == "true",
+		DisableDoNotReuse:       getEnvOrDefault("DISABLE_DO_NOT_REUSE", "false") == "true",
+		AllowReuseOverride:      getEnvOrDefault("ALLOW_REUSE_OVERRIDE", "false") == "true",
+		LabelPrefix:             getEnvOrDefault("LABEL_PREFIX", ""),
+		FollowBackendSchedule:   getEnvOrDefault("FOLLOW_BACKEND_SCHEDULE", "false") == "true",
+		InventoryExportPath:     getEnvOrDefault("INVENTORY_EXPORT_PATH", ""),
+		InventoryExportInterval: parseDurationWithDefault(getEnvOrDefault("INVENTORY_EXPORT_INTERVAL", "1m"), time.Minute),
+		AllowStaleOnError:       getEnvOrDefault("ALLOW_STALE_ON_ERROR", "false") == "true",
+		CacheMaxEntries:         parseIntWithDefault(getEnvOrDefault("SECRET_CACHE_MAX_ENTRIES", ""), 0),
+		CacheMaxBytes:           int64(parseIntWithDefault(getEnvOrDefault("SECRET_CACHE_MAX_BYTES", ""), 0)),
+		StaleValueTTL:           parseDurationWithDefault(getEnvOrDefault("STALE_VALUE_TTL", "1h"), time.Hour),
+		ManagedSecretLabel:      getEnvOrDefault("MANAGED_SECRET_LABEL", ""),
+		RotationActiveGroup:     getEnvOrDefault("ROTATION_ACTIVE_GROUP", ""),
+		RotationServiceLabel:    getEnvOrDefault("ROTATION_SERVICE_LABEL", ""),
+		RotationCanaryService:   getEnvOrDefault("ROTATION_CANARY_SERVICE", ""),
+		RotationCanaryTimeout:   parseDurationWithDefault(getEnvOrDefault("ROTATION_CANARY_TIMEOUT", "2m"), 2*time.Minute),
+		AllowLabelProviders:     getEnvOrDefault("ALLOW_LABEL_PROVIDERS", "false") == "true",
+		WarmupWindow:            parseDurationWithDefault(getEnvOrDefault("WARMUP_WINDOW", ""), 0),
+		RotationExecTimeout:     parseDurationWithDefault(getEnvOrDefault("ROTATION_EXEC_TIMEOUT", "30s"), 30*time.Second),
+		RequestTimeout:          parseDurationWithDefault(getEnvOrDefault("REQUEST_TIMEOUT", "30s"), 30*time.Second),
+		ChangeCheckTimeout:      parseDurationWithDefault(getEnvOrDefault("CHANGE_CHECK_TIMEOUT", "10s"), 10*time.Second),
+		DeployEnv:               getEnvOrDefault("DEPLOY_ENV", ""),
+		RetrackInterval:         parseDurationWithDefault(getEnvOrDefault("RETRACK_INTERVAL", ""), 0),
+		LazyAliasInit:           getEnvOrDefault("LAZY_ALIAS_INIT", "false") == "true",
+		AliasRetryInterval:      parseDurationWithDefault(getEnvOrDefault("ALIAS_RETRY_INTERVAL", "1m"), time.Minute),
+		BackendRotationMaxDefer: parseDurationWithDefault(getEnvOrDefault("BACKEND_ROTATION_MAX_DEFER", "1h"), time.Hour),
+		Settings:                settings,
+	}
+
+	if config.RotationWebhookURL != "" {
+		if err := validateWebhookURL(config.RotationWebhookURL); err != nil {
+			return nil, fmt.Errorf("invalid ROTATION_WEBHOOK_URL: %v", err)
 		}
 	}
 
-	config := &SecretsConfig{
-		ProviderType:     providerType,
-		EnableRotation:   getEnvOrDefault("ENABLE_ROTATION", "true") == "true",
-		RotationInterval: parseDurationOrDefault(getEnvOrDefault("ROTATION_INTERVAL", "10s")),
-		EnableMonitoring: getEnvOrDefault("ENABLE_MONITORING", "true") == "true",
-		MonitoringPort:   parseIntOrDefault(getEnvOrDefault("MONITORING_PORT", "8080")),
-		Settings:         settings,
+	if config.ManagedSecretLabel != "" && strings.HasPrefix(config.ManagedSecretLabel, "=") {
+		return nil, fmt.Errorf("invalid MANAGED_SECRET_LABEL %q: expected key=value or key", config.ManagedSecretLabel)
+	}
+
+	var signingKey ed25519.PrivateKey
+	if keyPath := getEnvOrDefault("SIGNING_KEY_PATH", ""); keyPath != "" {
+		key, err := loadSigningKey(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SIGNING_KEY_PATH: %v", err)
+		}
+		signingKey = key
+	}
+
+	// Key change detection hashes before any secret is tracked
+	providers.SetChangeHashKey(getEnvOrDefault("CHANGE_HASH_HMAC_KEY", ""))
+
+	// Create Docker client, also handed to providers reading from Docker
+	dockerClient, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
+	if err != nil {
+		log.Errorf("failed to create docker client: %v", err)
+		return nil, fmt.Errorf("failed to create docker client: %v", err)
 	}
 
 	// Create the appropriate provider
 	provider, err := providers.CreateProvider(config.ProviderType)
 	if err != nil {
+		_ = dockerClient.Close()
 		return nil, fmt.Errorf("failed to create provider: %v", err)
 	}
+	useDockerClient(provider, dockerClient)
 
-	// Initialize the provider
-	if err := provider.Initialize(settings); err != nil {
+	// Initialize the provider, retrying transient backend failures
+	maxRetries := parseIntWithDefault(getEnvOrDefault("INIT_MAX_RETRIES", "3"), 3)
+	retryBackoff := parseDurationWithDefault(getEnvOrDefault("INIT_RETRY_BACKOFF", "2s"), 2*time.Second)
+	if err := initializeProvider(provider, settings, maxRetries, retryBackoff); err != nil {
+		_ = dockerClient.Close()
 		log.Errorf("failed to initialize %s provider: %v", config.ProviderType, err)
 		return nil, fmt.Errorf("failed to initialize %s provider: %v", config.ProviderType, err)
 	}
 
-	// Create Docker client
-	dockerClient, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
+	aliases, err := parseProviderAliases(getEnvOrDefault("PROVIDER_ALIASES", ""))
 	if err != nil {
-		log.Errorf("failed to create docker client: %v", err)
-		return nil, fmt.Errorf("failed to create docker client: %v", err)
+		_ = dockerClient.Close()
+		return nil, fmt.Errorf("invalid PROVIDER_ALIASES: %v", err)
+	}
+	aliasProviders, err := initializeAliases(aliases, settings, dockerClient, config.LazyAliasInit, maxRetries, retryBackoff)
+	if err != nil {
+		_ = dockerClient.Close()
+		log.Errorf("failed to initialize provider aliases: %v", err)
+		return nil, fmt.Errorf("failed to initialize provider aliases: %v", err)
+	}
+
+	// Optionally prove the full read and extract path works before serving requests
+	if config.StartupCanary {
+		if err := runStartupCanary(provider, settings); err != nil {
+			_ = dockerClient.Close()
+			log.Errorf("startup canary failed: %v", err)
+			return nil, fmt.Errorf("startup canary failed: %v", err)
+		}
 	}
 
 	// Create context for monitoring
@@ -91,29 +256,77 @@ func NewDriver() (*SecretsDriver, error) {
 	driver := &SecretsDriver{
 		provider:      provider,
 		config:        config,
-		dockerClient:  dockerClient,
+		store:         newDockerSecretStore(dockerClient),
 		secretTracker: make(map[string]*providers.SecretInfo),
 		monitorCtx:    monitorCtx,
 		monitorCancel: monitorCancel,
+
+		labelProviders: make(map[string]providers.SecretsProvider),
+		aliasProviders: aliasProviders,
+		signingKey:     signingKey,
+		after:          time.After,
 	}
 
-	// Initialize monitoring if enabled
-	if config.EnableMonitoring {
+	if config.AllowStaleOnError {
+		driver.staleValues = newStaleCache(config.CacheMaxEntries, config.CacheMaxBytes, config.StaleValueTTL)
+	}
+
+	if err := driver.loadTrackerState(); err != nil {
+		monitorCancel()
+		_ = dockerClient.Close()
+		log.Errorf("failed to load tracker state: %v", err)
+		return nil, fmt.Errorf("failed to load tracker state: %v", err)
+	}
+
+	// Initialize monitoring if the web interface or the metrics port is enabled
+	if config.EnableMonitoring || config.MetricsPort > 0 {
 		driver.monitor = monitoring.NewMonitor(30 * time.Second) // Monitor every 30 seconds
 		driver.monitor.SetRotationInterval(config.RotationInterval)
+		driver.monitor.SetAuthSource(driver.providerAuth)
 		driver.monitor.Start()
+	}
+
+	if config.MetricsPort > 0 {
+		driver.metricsServer = monitoring.NewMetricsServer(driver.monitor, config.MetricsPort)
+		if err := driver.metricsServer.Start(); err != nil {
+			log.Warnf("Failed to start metrics server: %v", err)
+		}
+	}
 
+	if config.EnableMonitoring {
 		// Start web interface
 		driver.webInterface = monitoring.NewWebInterface(driver.monitor, config.MonitoringPort)
+		if config.MetricsPort > 0 {
+			driver.webInterface.DisablePrometheus()
+		}
+		driver.webInterface.SetSecretsSource(driver.secretStatuses)
+		driver.webInterface.SetVerifySource(driver.verifyTrackedSecrets)
+		driver.webInterface.SetEvictHandler(getEnvOrDefault("MONITORING_ADMIN_TOKEN", ""), driver.evictSecret)
+		driver.webInterface.AddHealthCheck("provider", driver.provider.HealthCheck)
+		driver.webInterface.AddHealthCheck("docker", driver.pingDocker)
 		if err := driver.webInterface.Start(); err != nil {
 			log.Warnf("Failed to start web monitoring interface: %v", err)
 		}
 	}
 
+	if config.LazyAliasInit && len(aliasProviders) > 0 && config.AliasRetryInterval > 0 {
+		go driver.startAliasRetries()
+	}
+
+	if config.InventoryExportPath != "" {
+		if config.InventoryExportInterval <= 0 {
+			config.InventoryExportInterval = time.Minute
+		}
+		go driver.startInventoryExport()
+	}
+
 	// Start monitoring if rotation is enabled and provider supports it
 	if config.EnableRotation && provider.SupportsRotation() {
 		log.Printf("Starting secret rotation monitoring with interval: %v", config.RotationInterval)
 		go driver.startMonitoring()
+		if config.RetrackInterval > 0 {
+			go driver.startRetracking()
+		}
 	} else if config.EnableRotation {
 		log.Printf("Secret rotation is enabled but provider %s does not support rotation", config.ProviderType)
 	} else {
@@ -124,48 +337,327 @@ func NewDriver() (*SecretsDriver, error) {
 	return driver, nil
 }
 
+// useDockerClient hands the driver's Docker client to a provider that reads
+// from Docker, so it shares the plugin's connection instead of opening its own
+func useDockerClient(provider providers.SecretsProvider, client providers.SwarmConfigAPI) {
+	if user, ok := provider.(providers.DockerClientUser); ok {
+		user.UseDockerClient(client)
+	}
+}
+
+// initializeProvider initializes the provider, retrying with exponential backoff
+// unless the provider reports a configuration error that retrying cannot fix
+func initializeProvider(provider providers.SecretsProvider, settings map[string]string, maxRetries int, backoff time.Duration) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = provider.Initialize(settings)
+		if err == nil {
+			return nil
+		}
+
+		var configErr *providers.ConfigError
+		if errors.As(err, &configErr) || attempt >= maxRetries {
+			return err
+		}
+
+		log.Warnf("Initializing %s provider failed (attempt %d/%d), retrying in %v: %v",
+			provider.GetProviderName(), attempt+1, maxRetries+1, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// runStartupCanary reads the configured canary secret and fails if no value comes back
+func runStartupCanary(provider providers.SecretsProvider, settings map[string]string) error {
+	canaryPath := settings["STARTUP_CANARY_PATH"]
+	if canaryPath == "" {
+		return fmt.Errorf("STARTUP_CANARY_PATH is required when STARTUP_CANARY is enabled")
+	}
+
+	req := secrets.Request{
+		SecretName:   "startup-canary",
+		SecretLabels: make(map[string]string),
+	}
+
+	// Point the request at the canary using the provider's own labels
+	req.SecretLabels[provider.PathLabelKey()] = canaryPath
+	if canaryField := settings["STARTUP_CANARY_FIELD"]; canaryField != "" {
+		req.SecretLabels[provider.FieldLabelKey()] = canaryField
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	value, err := provider.GetSecret(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to read canary secret %s: %v", canaryPath, err)
+	}
+	if len(value) == 0 {
+		return fmt.Errorf("canary secret %s returned an empty value", canaryPath)
+	}
+
+	log.Printf("Startup canary secret %s read successfully", canaryPath)
+	return nil
+}
+
 // Get method implements the secrets.Driver interface
 func (d *SecretsDriver) Get(req secrets.Request) secrets.Response {
-	log.Printf("Received secret request for: %s using provider: %s", req.SecretName, d.provider.GetProviderName())
+	// Tag every line logged for this request, here and in the provider
+	requestID := newRequestID()
+	logger := log.WithField("request_id", requestID)
+	logger.Printf("Received secret request for: %s using provider: %s", req.SecretName, d.provider.GetProviderName())
 
 	if req.SecretName == "" {
 		return secrets.Response{
-			Err: "secret name is required",
+			Err: fmt.Sprintf("%s: secret name is required (request_id=%s)", providers.ErrorKindConfig, requestID),
+		}
+	}
+
+	// Docker omits labels entirely for secrets created without any, so make
+	// sure downstream lookups and tracking always see a usable map
+	if req.SecretLabels == nil {
+		req.SecretLabels = make(map[string]string)
+	}
+	req.SecretLabels = resolveLabels(req.SecretLabels, d.config.LabelPrefix)
+	req, requestScoped, err := withRequestMetadata(req, d.config.LabelPrefix)
+	if err != nil {
+		logger.Printf("Error applying request metadata to labels: %v", err)
+		return secrets.Response{
+			Err: fmt.Sprintf("%s: invalid secret labels (request_id=%s): %v", providers.ErrorKindConfig, requestID, err),
 		}
 	}
+	if _, err := providers.ContentType(req.SecretLabels); err != nil {
+		return secrets.Response{
+			Err: fmt.Sprintf("%s: invalid secret labels (request_id=%s): %v", providers.ErrorKindConfig, requestID, err),
+		}
+	}
+	// A mistyped policy must not silently turn into fail or a fallback
+	if _, _, err := parseOnError(req.SecretLabels[onErrorLabel]); err != nil {
+		return secrets.Response{
+			Err: fmt.Sprintf("%s: invalid secret labels (request_id=%s): %v", providers.ErrorKindConfig, requestID, err),
+		}
+	}
+	req = templateRequest(req)
+	traceRequest(logger, req)
 
 	// Add context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(providers.WithRequestID(context.Background(), requestID), d.config.RequestTimeout)
 	defer cancel()
 
+	// Secrets may bring their own backend through secrets_provider labels
+	provider, instance, err := d.providerFor(ctx, req)
+	if err != nil {
+		logger.Printf("Error configuring provider from labels: %v", err)
+		return onErrorResponse(logger, req, fmt.Sprintf("%s: failed to configure provider (request_id=%s): %v", providers.KindOf(err), requestID, err))
+	}
+
+	// Secrets whose path is stored in another secret resolve it first
+	req, err = d.resolvePathFrom(ctx, req, nil)
+	if err != nil {
+		logger.Printf("Error resolving %s: %v", pathFromLabel, err)
+		return onErrorResponse(logger, req, fmt.Sprintf("%s: failed to resolve secret path (request_id=%s): %v", providers.KindOf(err), requestID, err))
+	}
+
+	req, err = d.withEnvSelect(req, provider)
+	if err != nil {
+		logger.Printf("Error selecting environment: %v", err)
+		return onErrorResponse(logger, req, fmt.Sprintf("%s: invalid secret labels (request_id=%s): %v", providers.ErrorKindConfig, requestID, err))
+	}
+	req = d.withDefaultField(req, provider)
+
+	if logger.Logger.IsLevelEnabled(log.TraceLevel) {
+		logger.WithFields(log.Fields{
+			"path":  provider.BuildPath(req),
+			"field": req.SecretLabels[provider.FieldLabelKey()],
+		}).Trace("Resolved provider path")
+	}
+
 	// Get secret from the provider
-	value, err := d.provider.GetSecret(ctx, req)
+	value, err := provider.GetSecret(ctx, req)
+	if d.monitor != nil {
+		d.monitor.RecordProviderRead(instance)
+	}
+	d.reportProviderRegion()
+	d.reportProviderThrottles()
+	stale := false
 	if err != nil {
-		log.Printf("Error getting secret from provider: %v", err)
-		return secrets.Response{
-			Err: fmt.Sprintf("failed to get secret: %v", err),
+		cached, ok := d.staleValue(req, err)
+		if !ok {
+			logger.Printf("Error getting secret from provider: %v", err)
+			return onErrorResponse(logger, req, fmt.Sprintf("%s: failed to get secret (request_id=%s): %v", providers.KindOf(err), requestID, err))
+		}
+		logger.Warnf("Serving stale value of secret %s, provider read failed: %v", req.SecretName, err)
+		if d.monitor != nil {
+			d.monitor.RecordStaleRead()
+		}
+		value, stale = cached, true
+	} else {
+		logger.Printf("Successfully retrieved secret from %s provider", provider.GetProviderName())
+		if d.staleValues != nil {
+			d.staleValues.store(req, value)
+			d.reportCacheStats()
 		}
 	}
 
-	log.Printf("Successfully retrieved secret from %s provider", d.provider.GetProviderName())
+	// Changes are tracked on the secret object, the template is applied on delivery
+	secretValue, err := renderSecretTemplate(req, value)
+	if err != nil {
+		logger.Printf("Error rendering secret template: %v", err)
+		return onErrorResponse(logger, req, fmt.Sprintf("%s: failed to render secret (request_id=%s): %v", providers.ErrorKindConfig, requestID, err))
+	}
+	secretValue, err = encodeSecretValue(req, secretValue)
+	if err != nil {
+		logger.Printf("Error encoding secret: %v", err)
+		return onErrorResponse(logger, req, fmt.Sprintf("%s: failed to encode secret (request_id=%s): %v", providers.ErrorKindConfig, requestID, err))
+	}
 
-	// Track this secret for monitoring if rotation is enabled
-	if d.config.EnableRotation && d.provider.SupportsRotation() {
-		d.trackSecret(req, value)
+	// Services verifying provenance read the signature from <name>-sig
+	if !stale && d.wantsSignature(req.SecretLabels) {
+		if err := d.publishSignature(ctx, req.SecretName, secretValue); err != nil {
+			logger.Errorf("Failed to publish signature of secret %s: %v", req.SecretName, err)
+		}
+	}
+
+	// Track this secret for monitoring if rotation is enabled. A stale value
+	// is not what the backend holds, so it must not become the tracked hash.
+	// Secrets outside MANAGED_SECRET_LABEL are served but never rotated.
+	// Secrets served by an alias or their own secrets_provider labels are
+	// checked and rotated with that provider. Secrets whose labels come from
+	// the requesting service or task are not rotated either: a rotated
+	// version holds one value, which every service would be moved to.
+	if requestScoped && d.config.EnableRotation {
+		logger.Debugf("Secret %s resolves its labels per request, serving it without rotation", req.SecretName)
+	}
+	if d.config.EnableRotation && provider.SupportsRotation() && !stale && !requestScoped && d.isManagedSecret(req.SecretLabels) {
+		d.trackSecret(req, value, provider, instance)
+		d.trackSplitTargets(ctx, req, provider)
+		if d.config.FieldDiff {
+			d.trackFieldHashes(ctx, req, provider)
+		}
+		d.trackWatchHash(ctx, req, provider)
+		d.applySchedule(ctx, req.SecretName, provider)
+		d.saveTrackerState()
 	}
 
 	// Determine if secret should be reusable
 	doNotReuse := d.shouldNotReuse(req)
 
-	log.Printf("Successfully returning secret value")
+	if d.monitor != nil {
+		d.monitor.RecordSecretSize(len(secretValue))
+	}
+
+	logger.WithFields(log.Fields{
+		"value_bytes":  len(secretValue),
+		"stale":        stale,
+		"do_not_reuse": doNotReuse,
+	}).Trace("Secret response")
+	logger.Printf("Successfully returning secret value")
 	return secrets.Response{
-		Value:      value,
+		Value:      secretValue,
 		DoNotReuse: doNotReuse,
 	}
 }
 
+// withEnvSelect picks the DEPLOY_ENV key of secrets labeled env_select=true,
+// which hold one value per environment, e.g. {"prod": "...", "staging": "..."}.
+// The key is set as the field label, so a missing environment fails like a
+// missing field and rotation compares the same key.
+func (d *SecretsDriver) withEnvSelect(req secrets.Request, provider providers.SecretsProvider) (secrets.Request, error) {
+	if strings.ToLower(req.SecretLabels["env_select"]) != "true" {
+		return req, nil
+	}
+	if d.config.DeployEnv == "" {
+		return req, fmt.Errorf("env_select requires DEPLOY_ENV to be set")
+	}
+	if _, exists := req.SecretLabels[provider.FieldLabelKey()]; exists {
+		return req, fmt.Errorf("env_select cannot be combined with %s", provider.FieldLabelKey())
+	}
+	if strings.ToLower(req.SecretLabels["all_fields"]) == "true" {
+		return req, fmt.Errorf("env_select cannot be combined with all_fields")
+	}
+
+	selected := req
+	selected.SecretLabels = copyLabels(req.SecretLabels)
+	selected.SecretLabels[provider.FieldLabelKey()] = d.config.DeployEnv
+	return selected, nil
+}
+
+// withDefaultField selects <PROVIDER>_DEFAULT_FIELD, e.g. VAULT_DEFAULT_FIELD,
+// for requests that name no field. It is set as the field label so delivery,
+// tracking and rotation checks all use the same field.
+func (d *SecretsDriver) withDefaultField(req secrets.Request, provider providers.SecretsProvider) secrets.Request {
+	field := d.config.Settings[strings.ToUpper(provider.GetProviderName())+"_DEFAULT_FIELD"]
+	if field == "" || strings.ToLower(req.SecretLabels["all_fields"]) == "true" {
+		return req
+	}
+	if _, exists := req.SecretLabels[provider.FieldLabelKey()]; exists {
+		return req
+	}
+
+	defaulted := req
+	defaulted.SecretLabels = copyLabels(req.SecretLabels)
+	defaulted.SecretLabels[provider.FieldLabelKey()] = field
+	return defaulted
+}
+
+// traceRequest logs the shape of a secret request at trace level. Requests
+// carry names and labels only, the secret value is never part of them.
+func traceRequest(logger *log.Entry, req secrets.Request) {
+	if !logger.Logger.IsLevelEnabled(log.TraceLevel) {
+		return
+	}
+	logger.WithFields(log.Fields{
+		"secret":         req.SecretName,
+		"labels":         req.SecretLabels,
+		"service_id":     req.ServiceID,
+		"service":        req.ServiceName,
+		"hostname":       req.ServiceHostname,
+		"service_labels": req.ServiceLabels,
+		"task_id":        req.TaskID,
+		"task":           req.TaskName,
+		"image":          req.TaskImage,
+	}).Trace("Secret request")
+}
+
+// staleValue returns the last-known value of a secret when serving it is
+// allowed. Only transient failures qualify, a secret that was deleted or is
+// misconfigured must keep failing.
+func (d *SecretsDriver) staleValue(req secrets.Request, err error) ([]byte, bool) {
+	if d.staleValues == nil || providers.KindOf(err) != providers.ErrorKindTransient {
+		return nil, false
+	}
+	return d.staleValues.load(req)
+}
+
+// reportCacheStats publishes the size of the last-known value cache
+func (d *SecretsDriver) reportCacheStats() {
+	if d.monitor == nil {
+		return
+	}
+	entries, bytes, evictions := d.staleValues.stats()
+	d.monitor.SetCacheStats(entries, bytes, evictions)
+}
+
+// newRequestID returns a short random id correlating the log lines of one request
+func newRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
+
 // shouldNotReuse determines if the secret should not be reused
 func (d *SecretsDriver) shouldNotReuse(req secrets.Request) bool {
+	// Replayed Get calls for the same task must not churn tasks, so the
+	// global switch overrides the label unless overriding is allowed
+	if d.config.DisableDoNotReuse {
+		if d.config.AllowReuseOverride {
+			return strings.ToLower(req.SecretLabels["vault_reuse"]) == "false"
+		}
+		return false
+	}
+
 	// Check for explicit label
 	if reuse, exists := req.SecretLabels["vault_reuse"]; exists {
 		return strings.ToLower(reuse) == "false"
@@ -182,51 +674,22 @@ func (d *SecretsDriver) shouldNotReuse(req secrets.Request) bool {
 }
 
 // trackSecret adds or updates a secret in the tracking system
-func (d *SecretsDriver) trackSecret(req secrets.Request, value []byte) {
+func (d *SecretsDriver) trackSecret(req secrets.Request, value []byte, provider providers.SecretsProvider, instance string) {
 	d.trackerMutex.Lock()
 	defer d.trackerMutex.Unlock()
 
 	// Calculate hash for change detection
-	hash := fmt.Sprintf("%x", sha256.Sum256(value))
-
-	// Extract secret field from labels based on provider
-	var secretField string
-	switch d.provider.GetProviderName() {
-	case "vault":
-		secretField = req.SecretLabels["vault_field"]
-	case "aws":
-		secretField = req.SecretLabels["aws_field"]
-	case "gcp":
-		secretField = req.SecretLabels["gcp_field"]
-	case "azure":
-		secretField = req.SecretLabels["azure_field"]
-	case "openbao":
-		secretField = req.SecretLabels["openbao_field"]
-	}
+	hash := providers.HashValue(value)
 
+	// Extract secret field and path using the provider's own label conventions
+	secretField := req.SecretLabels[provider.FieldLabelKey()]
 	if secretField == "" {
 		secretField = "value" // default field
 	}
+	secretPath := provider.BuildPath(req)
 
-	// Build secret path using provider-specific logic
-	var secretPath string
-	switch d.provider.GetProviderName() {
-	case "vault":
-		secretPath = d.buildVaultSecretPath(req)
-	case "aws":
-		secretPath = d.buildAWSSecretName(req)
-	case "gcp":
-		secretPath = d.buildGCPSecretName(req)
-	case "azure":
-		secretPath = d.buildAzureSecretName(req)
-	case "openbao":
-		secretPath = d.buildOpenBaoSecretPath(req)
-	default:
-		secretPath = req.SecretName
-	}
-
-	log.Printf("Current provider %s tracking secret: %s at path: %s with field: %s",
-		d.provider.GetProviderName(), req.SecretName, secretPath, secretField)
+	log.Printf("Provider %s tracking secret: %s at path: %s with field: %s",
+		instance, req.SecretName, secretPath, secretField)
 
 	secretInfo := &providers.SecretInfo{
 		DockerSecretName: req.SecretName,
@@ -235,7 +698,39 @@ func (d *SecretsDriver) trackSecret(req secrets.Request, value []byte) {
 		ServiceNames:     []string{req.ServiceName}, // Start with current service
 		LastHash:         hash,
 		LastUpdated:      time.Now(),
-		Provider:         d.provider.GetProviderName(),
+		Provider:         instance,
+		Labels:           copyLabels(req.SecretLabels),
+		AllFields:        strings.ToLower(req.SecretLabels["all_fields"]) == "true",
+		WatchFields:      parseWatchFields(req.SecretLabels[watchFieldsLabel]),
+	}
+
+	// Invalid per-secret webhooks are rejected here rather than at rotation time
+	if webhookURL, exists := req.SecretLabels["rotation_webhook"]; exists {
+		if err := validateWebhookURL(webhookURL); err != nil {
+			log.Errorf("Ignoring rotation_webhook for secret %s: %v", req.SecretName, err)
+		} else {
+			secretInfo.WebhookURL = webhookURL
+			if rawHeaders, exists := req.SecretLabels["rotation_webhook_headers"]; exists {
+				headers, err := parseWebhookHeaders(rawHeaders)
+				if err != nil {
+					log.Errorf("Ignoring rotation_webhook_headers for secret %s: %v", req.SecretName, err)
+				} else {
+					secretInfo.WebhookHeaders = headers
+				}
+			}
+		}
+	}
+
+	// An entry of another provider, e.g. restored from a state file written
+	// with a different SECRETS_PROVIDER, starts over instead of mixing the
+	// paths and hashes of two backends
+	if existing, exists := d.secretTracker[req.SecretName]; exists && existing.Provider != secretInfo.Provider {
+		log.Warnf("Secret %s was tracked for the %s provider and is now served by %s, tracking it anew",
+			req.SecretName, existing.Provider, secretInfo.Provider)
+		delete(d.secretTracker, req.SecretName)
+		if d.monitor != nil {
+			d.monitor.RecordProviderCollision()
+		}
 	}
 
 	// If already tracking, update service names
@@ -253,12 +748,102 @@ func (d *SecretsDriver) trackSecret(req secrets.Request, value []byte) {
 		}
 		existing.LastHash = hash
 		existing.LastUpdated = time.Now()
+		existing.Labels = secretInfo.Labels
+		existing.WebhookURL = secretInfo.WebhookURL
+		existing.WebhookHeaders = secretInfo.WebhookHeaders
+		existing.WatchFields = secretInfo.WatchFields
+		d.applyLease(provider, existing)
+		d.applyVersion(provider, existing)
 	} else {
+		d.applyLease(provider, secretInfo)
+		d.applyVersion(provider, secretInfo)
 		d.secretTracker[req.SecretName] = secretInfo
 	}
 
+	if len(req.SecretName) > maxRotatableNameLength {
+		log.Warnf("Secret %s cannot be rotated, its name is longer than %d characters", req.SecretName, maxRotatableNameLength)
+	}
+
 	log.Printf("Tracking secret: %s -> %s (provider: %s, services: %v)",
-		req.SecretName, secretPath, d.provider.GetProviderName(), secretInfo.ServiceNames)
+		req.SecretName, secretPath, instance, secretInfo.ServiceNames)
+}
+
+// untrackMovedSecret stops tracking a secret whose labels now select another
+// provider instance and reports whether it did, the next request tracks it
+// anew with that provider. Docker secret names can be reused by removing a
+// secret and creating it again with other labels.
+func (d *SecretsDriver) untrackMovedSecret(secretName, instance string) bool {
+	d.trackerMutex.Lock()
+	existing, exists := d.secretTracker[secretName]
+	moved := exists && existing.Provider != instance
+	if moved {
+		delete(d.secretTracker, secretName)
+	}
+	d.trackerMutex.Unlock()
+	if !moved {
+		return false
+	}
+
+	log.Warnf("Secret %s was tracked for the %s provider and is now served by %s, tracking it anew on its next request",
+		secretName, existing.Provider, instance)
+	if d.monitor != nil {
+		d.monitor.RecordProviderCollision()
+	}
+	d.saveTrackerState()
+	return true
+}
+
+// evictSecret stops tracking a secret and drops its cached values, and
+// reports whether there was anything to drop. A later request for the secret
+// tracks it again.
+func (d *SecretsDriver) evictSecret(secretName string) bool {
+	d.trackerMutex.Lock()
+	_, tracked := d.secretTracker[secretName]
+	delete(d.secretTracker, secretName)
+	d.trackerMutex.Unlock()
+
+	cached := false
+	if d.staleValues != nil {
+		cached = d.staleValues.forget(secretName)
+		d.reportCacheStats()
+	}
+	if !tracked && !cached {
+		return false
+	}
+
+	log.Printf("Evicted secret %s from tracking and the value cache", secretName)
+	if tracked {
+		d.saveTrackerState()
+	}
+	return true
+}
+
+// trackSplitTargets records the companion secrets described by the split label
+// along with the current hash of each companion field
+func (d *SecretsDriver) trackSplitTargets(ctx context.Context, req secrets.Request, provider providers.SecretsProvider) {
+	label, exists := req.SecretLabels["split"]
+	if !exists {
+		return
+	}
+
+	targets, err := parseSplitLabel(label)
+	if err != nil {
+		log.Errorf("Ignoring split label for secret %s: %v", req.SecretName, err)
+		return
+	}
+
+	values, err := d.readSplitValues(ctx, req, targets, provider)
+	if err != nil {
+		log.Errorf("Failed to read split fields for secret %s: %v", req.SecretName, err)
+		return
+	}
+
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	if secretInfo, exists := d.secretTracker[req.SecretName]; exists {
+		secretInfo.SplitTargets = targets
+		secretInfo.SplitHashes = splitHashes(values)
+	}
 }
 
 // startMonitoring starts the background monitoring goroutine
@@ -268,6 +853,10 @@ func (d *SecretsDriver) startMonitoring() {
 
 	log.Printf("Secret monitoring started with interval: %v", d.config.RotationInterval)
 
+	if d.config.WarmupWindow > 0 {
+		d.warmUpRestoredSecrets()
+	}
+
 	for {
 		select {
 		case <-d.monitorCtx.Done():
@@ -278,7 +867,26 @@ func (d *SecretsDriver) startMonitoring() {
 			if d.monitor != nil {
 				d.monitor.UpdateTickerHeartbeat()
 			}
-			d.checkForSecretChanges()
+			d.runSecretCheck()
+		}
+	}
+}
+
+// runSecretCheck runs one change check, recovering from a panic so a provider
+// bug costs one cycle instead of stopping rotation for good
+func (d *SecretsDriver) runSecretCheck() {
+	defer d.recoverCheckPanic("checking secrets for changes")
+	d.renewProviderTokens()
+	d.checkForSecretChanges()
+}
+
+// recoverCheckPanic recovers from a panic in a change check and counts it.
+// It must be deferred directly.
+func (d *SecretsDriver) recoverCheckPanic(task string) {
+	if r := recover(); r != nil {
+		log.Errorf("Recovered from panic while %s: %v\n%s", task, r, debug.Stack())
+		if d.monitor != nil {
+			d.monitor.RecordMonitorPanic()
 		}
 	}
 }
@@ -299,179 +907,563 @@ func (d *SecretsDriver) checkForSecretChanges() {
 
 	log.Printf("Checking %d tracked secrets for changes", len(secrets))
 
+	stamps := d.changeTimestamps(secrets)
+
+	due := make([]*providers.SecretInfo, 0, len(secrets))
 	for secretName, secretInfo := range secrets {
-		if d.hasSecretChanged(secretInfo) {
-			log.Printf("Detected change in secret: %s", secretName)
-			if err := d.rotateSecret(secretInfo); err != nil {
-				log.Errorf("Failed to rotate secret %s: %v", secretName, err)
-				if d.monitor != nil {
-					d.monitor.IncrementRotationErrors()
-				}
-			} else {
-				if d.monitor != nil {
-					d.monitor.IncrementSecretRotations()
-				}
+		d.trackerMutex.RLock()
+		leased := secretInfo.LeaseID != ""
+		lastChanged := secretInfo.LastChanged
+		managed := d.isManagedSecret(secretInfo.Labels)
+		byDefault := usesDefaultProvider(secretInfo.Labels)
+		d.trackerMutex.RUnlock()
+
+		// Restored tracker state can still list secrets outside MANAGED_SECRET_LABEL
+		if !managed {
+			continue
+		}
+
+		// Every read of a dynamic secret issues new credentials, so leased
+		// secrets are renewed instead of compared
+		if leased {
+			reissued, err := d.maintainLease(secretInfo)
+			if err != nil {
+				log.Errorf("Failed to maintain lease of secret %s: %v", secretName, err)
+			}
+			d.setLastError(secretInfo, err)
+			if reissued && d.monitor != nil {
+				d.monitor.RecordRotation(secretName, err)
 			}
+			continue
+		}
+
+		// Secrets whose backend change time did not advance need no read. The
+		// change times come from the plugin's own provider.
+		stamp, stamped := stamps[secretInfo.SecretPath]
+		if byDefault && stamped && !lastChanged.IsZero() && !stamp.After(lastChanged) {
+			continue
+		}
+
+		// Secrets following a backend rotation schedule wait for their next check
+		if !d.scheduleDue(secretInfo) {
+			continue
 		}
+		due = append(due, secretInfo)
+	}
+
+	batched := d.batchChanges(due)
+
+	for _, secretInfo := range due {
+		err := d.checkDueSecret(secretInfo, batched)
+
+		// A failed read or rotation keeps the old change time so it is retried
+		d.trackerMutex.Lock()
+		if stamp, stamped := stamps[secretInfo.SecretPath]; stamped && err == nil && usesDefaultProvider(secretInfo.Labels) {
+			secretInfo.LastChanged = stamp
+		}
+		d.trackerMutex.Unlock()
 	}
 }
 
-// hasSecretChanged checks if a secret has changed using the provider
-func (d *SecretsDriver) hasSecretChanged(secretInfo *providers.SecretInfo) bool {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// checkDueSecret checks a secret due for a change check, unless the batch
+// read already compared it, and rotates it when it changed. It returns the
+// error of the read or of the rotation.
+func (d *SecretsDriver) checkDueSecret(secretInfo *providers.SecretInfo, batched map[string]bool) error {
+	changed, checked := batched[secretInfo.DockerSecretName]
+	if !checked {
+		var err error
+		changed, err = d.hasSecretChanged(secretInfo)
+		// A failed read is retried on the next check, the change it may hide
+		// must not be skipped by the change time or the schedule
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if changed {
+		err = d.rotateChangedSecret(secretInfo)
+	}
+
+	// A rotation deferred while the backend rotates is retried on the next
+	// check rather than at the next scheduled one
+	if !errors.Is(err, errBackendRotating) {
+		d.advanceSchedule(secretInfo)
+	}
+	return err
+}
+
+// rotateChangedSecret rotates a secret found to have changed and records the outcome
+func (d *SecretsDriver) rotateChangedSecret(secretInfo *providers.SecretInfo) error {
+	secretName := secretInfo.DockerSecretName
+	log.Printf("Detected change in secret: %s", secretName)
+
+	// Kept until a rotation succeeds, so /api/pending shows the backlog
+	d.trackerMutex.Lock()
+	if secretInfo.ChangeDetectedAt.IsZero() {
+		secretInfo.ChangeDetectedAt = time.Now()
+	}
+	d.trackerMutex.Unlock()
+
+	if d.backendRotating(secretInfo) {
+		return errBackendRotating
+	}
+
+	err := d.rotateSecret(secretInfo)
+	if err != nil {
+		log.Errorf("Failed to rotate secret %s: %v", secretName, err)
+	}
+	d.setLastError(secretInfo, err)
+	if d.monitor != nil {
+		d.monitor.RecordRotation(secretName, err)
+	}
+	return err
+}
+
+// batchChanges compares the due secrets in one batch read when the plugin's
+// provider supports it. Watched and split secrets compare more than the
+// tracked field and secrets of other providers read another backend, so they
+// are always checked one by one.
+func (d *SecretsDriver) batchChanges(due []*providers.SecretInfo) map[string]bool {
+	checker, ok := d.provider.(providers.BatchChangeChecker)
+	if !ok {
+		return nil
+	}
+
+	d.trackerMutex.RLock()
+	candidates := make([]*providers.SecretInfo, 0, len(due))
+	for _, secretInfo := range due {
+		if secretInfo.WatchHash == "" && len(secretInfo.SplitTargets) == 0 && usesDefaultProvider(secretInfo.Labels) {
+			candidates = append(candidates, secretInfo)
+		}
+	}
+	d.trackerMutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.ChangeCheckTimeout)
+	defer cancel()
+
+	changed, err := checker.CheckSecretsChanged(ctx, candidates)
+	d.reportProviderThrottles()
+	if err != nil {
+		log.Warnf("Batch secret read failed, reading every secret: %v", err)
+		return nil
+	}
+	return changed
+}
+
+// changeTimestamps reads the backend change time of every tracked secret of
+// the plugin's provider in one batch when it supports it. Secrets missing from
+// the result, or every secret when it is nil, are read and compared as usual.
+func (d *SecretsDriver) changeTimestamps(secrets map[string]*providers.SecretInfo) map[string]time.Time {
+	detector, ok := d.provider.(providers.BatchChangeDetector)
+	if !ok {
+		return nil
+	}
+
+	d.trackerMutex.RLock()
+	paths := make([]string, 0, len(secrets))
+	for _, secretInfo := range secrets {
+		if secretInfo.LeaseID == "" && usesDefaultProvider(secretInfo.Labels) {
+			paths = append(paths, secretInfo.SecretPath)
+		}
+	}
+	d.trackerMutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.ChangeCheckTimeout)
 	defer cancel()
 
-	changed, err := d.provider.CheckSecretChanged(ctx, secretInfo)
+	stamps, err := detector.ChangeTimestamps(ctx, paths)
+	if err != nil {
+		log.Warnf("Batch change detection failed, reading every secret: %v", err)
+		return nil
+	}
+	return stamps
+}
+
+// hasSecretChanged checks if a secret has changed using its provider
+func (d *SecretsDriver) hasSecretChanged(secretInfo *providers.SecretInfo) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.ChangeCheckTimeout)
+	defer cancel()
+
+	provider, err := d.trackedProvider(ctx, secretInfo)
+	if err != nil {
+		log.Errorf("Error resolving the provider of secret %s: %v", secretInfo.DockerSecretName, err)
+		d.setLastError(secretInfo, err)
+		return false, err
+	}
+
+	// With rotation_watch_fields only the watched fields are compared
+	d.trackerMutex.RLock()
+	watched := secretInfo.WatchHash != ""
+	d.trackerMutex.RUnlock()
+
+	var changed bool
+	if watched {
+		changed, err = d.hasWatchedFieldChanged(ctx, secretInfo, provider)
+	} else {
+		changed, err = provider.CheckSecretChanged(ctx, secretInfo)
+	}
+	d.reportProviderRegion()
+	d.reportProviderThrottles()
 	if err != nil {
 		log.Errorf("Error checking secret change for %s: %v", secretInfo.DockerSecretName, err)
-		return false
+		d.setLastError(secretInfo, err)
+		return false, err
 	}
 
-	return changed
+	// Companion secrets rotate together with their source, so a change in
+	// any split field counts as a change of the source secret
+	if !changed && len(secretInfo.SplitTargets) > 0 {
+		changed = d.hasSplitChanged(ctx, secretInfo, provider)
+	}
+
+	return changed, nil
 }
 
 // rotateSecret handles the secret rotation process
 func (d *SecretsDriver) rotateSecret(secretInfo *providers.SecretInfo) error {
 	log.Printf("Starting rotation for secret: %s", secretInfo.DockerSecretName)
 
-	// Create a dummy request to get the new secret value
-	req := secrets.Request{
-		SecretName:   secretInfo.DockerSecretName,
-		SecretLabels: make(map[string]string),
-	}
+	req := replayRequest(secretInfo)
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.RequestTimeout)
+	defer cancel()
 
-	// Set appropriate field and path labels based on provider
-	switch secretInfo.Provider {
-	case "vault":
-		req.SecretLabels["vault_field"] = secretInfo.SecretField
-		// Extract the specific path part from the full path
-		req.SecretLabels["vault_path"] = strings.TrimPrefix(secretInfo.SecretPath, "secret/data/")
-	case "aws":
-		req.SecretLabels["aws_field"] = secretInfo.SecretField
-		req.SecretLabels["aws_secret_name"] = secretInfo.SecretPath
-	case "gcp":
-		req.SecretLabels["gcp_field"] = secretInfo.SecretField
-		req.SecretLabels["gcp_secret_name"] = secretInfo.SecretPath
-	case "azure":
-		req.SecretLabels["azure_field"] = secretInfo.SecretField
-		req.SecretLabels["azure_secret_name"] = secretInfo.SecretPath
-	case "openbao":
-		req.SecretLabels["openbao_field"] = secretInfo.SecretField
-		req.SecretLabels["openbao_path"] = strings.TrimPrefix(secretInfo.SecretPath, "secret/data/")
+	provider, err := d.trackedProvider(ctx, secretInfo)
+	if err != nil {
+		return fmt.Errorf("failed to resolve provider: %v", err)
 	}
 
 	// Get the new secret value from the provider
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
 
-	newValue, err := d.provider.GetSecret(ctx, req)
+	newValue, err := provider.GetSecret(ctx, req)
 	if err != nil {
 		return fmt.Errorf("failed to get updated secret from provider: %v", err)
 	}
 
+	secretValue, err := renderSecretTemplate(req, newValue)
+	if err != nil {
+		return err
+	}
+	secretValue, err = encodeSecretValue(req, secretValue)
+	if err != nil {
+		return err
+	}
+
+	if d.config.FieldDiff {
+		d.diffFields(ctx, req, secretInfo, provider)
+	}
+	if d.monitor != nil {
+		d.monitor.RecordSecretSize(len(secretValue))
+	}
+
 	// Update Docker secret (this now handles service updates internally)
-	if err := d.updateDockerSecret(secretInfo.DockerSecretName, newValue); err != nil {
+	if err := d.updateDockerSecret(secretInfo.DockerSecretName, secretValue); err != nil {
 		return fmt.Errorf("failed to update docker secret: %v", err)
 	}
 
+	if d.wantsSignature(req.SecretLabels) {
+		if err := d.publishSignature(ctx, secretInfo.DockerSecretName, secretValue); err != nil {
+			return fmt.Errorf("failed to update signature: %v", err)
+		}
+	}
+
+	// Keep companion secrets in sync with the source they were split from
+	if len(secretInfo.SplitTargets) > 0 {
+		if err := d.rotateSplitSecrets(ctx, req, secretInfo, provider); err != nil {
+			return fmt.Errorf("failed to rotate split secrets: %v", err)
+		}
+	}
+
 	// Update tracking information
 	d.trackerMutex.Lock()
-	secretInfo.LastHash = fmt.Sprintf("%x", sha256.Sum256(newValue))
+	secretInfo.LastHash = providers.HashValue(newValue)
 	secretInfo.LastUpdated = time.Now()
+	secretInfo.ChangeDetectedAt = time.Time{}
+	d.applyLease(provider, secretInfo)
+	d.applyVersion(provider, secretInfo)
 	d.trackerMutex.Unlock()
+	d.trackWatchHash(ctx, req, provider)
+	d.applySchedule(ctx, secretInfo.DockerSecretName, provider)
 
 	log.Printf("Successfully rotated secret: %s", secretInfo.DockerSecretName)
+	d.saveTrackerState()
+	d.notifyRotation(secretInfo)
 	return nil
 }
 
+// replayRequest rebuilds the original request of a tracked secret so the
+// provider resolves the same path and field
+func replayRequest(secretInfo *providers.SecretInfo) secrets.Request {
+	req := secrets.Request{
+		SecretName:   secretInfo.DockerSecretName,
+		SecretLabels: copyLabels(secretInfo.Labels),
+	}
+	if len(secretInfo.ServiceNames) > 0 {
+		req.ServiceName = secretInfo.ServiceNames[0]
+	}
+	return req
+}
+
 // updateDockerSecret creates a new version of the Docker secret
 func (d *SecretsDriver) updateDockerSecret(secretName string, newValue []byte) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Leave room for the canary check, the cleanup after it still needs the context
+	timeout := d.config.RequestTimeout
+	if d.config.RotationCanaryService != "" {
+		timeout += d.config.RotationCanaryTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	// List existing secrets to find the one to update
-	secrets, err := d.dockerClient.SecretList(ctx, swarm.SecretListOptions{})
+	// Only fetch candidates, the name filter matches by prefix so it also
+	// returns versions created by earlier rotations
+	secrets, err := d.store.ListSecrets(ctx, secretName)
+	d.recordDockerAPICall("SecretList", err)
 	if err != nil {
 		return fmt.Errorf("failed to list secrets: %v", err)
 	}
 
+	// Use the secret itself or, once rotated, its newest version
 	var existingSecret *swarm.Secret
-	for _, secret := range secrets {
-		if secret.Spec.Name == secretName {
-			existingSecret = &secret
-			break
+	var versions []swarm.Secret
+	for i, secret := range secrets {
+		if secret.Spec.Name != secretName && !isSecretVersion(secretName, secret) {
+			continue
+		}
+		versions = append(versions, secret)
+		if existingSecret == nil || secret.CreatedAt.After(existingSecret.CreatedAt) {
+			existingSecret = &secrets[i]
 		}
 	}
 
 	if existingSecret == nil {
 		return fmt.Errorf("secret %s not found", secretName)
 	}
+	// Tracker state from before MANAGED_SECRET_LABEL was set may still list it
+	secretLabels := resolveLabels(existingSecret.Spec.Labels, d.config.LabelPrefix)
+	if !d.isManagedSecret(secretLabels) {
+		return fmt.Errorf("secret %s does not carry the managed label %s", secretName, d.config.ManagedSecretLabel)
+	}
+	rollout, err := parseRolloutLabels(secretLabels)
+	if err != nil {
+		return fmt.Errorf("secret %s: %v", secretName, err)
+	}
 
 	// Generate a unique name for the new secret version
-	newSecretName := fmt.Sprintf("%s-%d", secretName, time.Now().UnixNano())
+	newSecretName := fmt.Sprintf("%s-%0*d", secretName, versionSuffixDigits, time.Now().UnixNano())
+	if len(newSecretName) > maxSecretNameLength {
+		return fmt.Errorf("secret name %s is too long to rotate: versions add 20 characters and Docker allows %d, rename the secret to at most %d characters",
+			secretName, maxSecretNameLength, maxRotatableNameLength)
+	}
+
+	// Keep the user's labels and record the lineage so docker secret inspect
+	// shows when and from which version the secret was rotated
+	labels := copyLabels(existingSecret.Spec.Labels)
+	labels[rotatedAtLabel] = time.Now().UTC().Format(time.RFC3339)
+	labels[rotatedFromLabel] = existingSecret.Spec.Name
+	labels[providerLabel] = d.providerInstance(secretLabels)
+	delete(labels, checksumLabel)
+	if secretLabels["emit_checksum"] == "true" {
+		labels[checksumLabel] = contentChecksum(newValue)
+	}
 
 	// Create new secret with versioned name and same labels but updated value
 	newSecretSpec := swarm.SecretSpec{
 		Annotations: swarm.Annotations{
 			Name:   newSecretName,
-			Labels: existingSecret.Spec.Labels,
+			Labels: labels,
 		},
 		Data: newValue,
 	}
 
 	// Create the new secret
-	createResponse, err := d.dockerClient.SecretCreate(ctx, newSecretSpec)
+	newSecretID, err := d.store.CreateSecret(ctx, newSecretSpec)
+	d.recordDockerAPICall("SecretCreate", err)
 	if err != nil {
 		return fmt.Errorf("failed to create new secret version: %v", err)
 	}
 
-	log.Printf("Created new version of secret %s with name %s and ID: %s", secretName, newSecretName, createResponse.ID)
+	log.Printf("Created new version of secret %s with name %s and ID: %s", secretName, newSecretName, newSecretID)
+
+	// Make sure the new version is what was written before any service moves to it
+	if err := d.verifyCreatedSecret(ctx, newSecretID, newSecretSpec); err != nil {
+		cleanupErr := d.store.RemoveSecret(ctx, newSecretID)
+		d.recordDockerAPICall("SecretRemove", cleanupErr)
+		if cleanupErr != nil {
+			log.Warnf("failed to remove new secret %s after verification error: %v", newSecretID, cleanupErr)
+		}
+		return fmt.Errorf("failed to verify new secret version: %v", err)
+	}
+
+	// Services are managed externally, so leave them and the old version untouched
+	if !d.config.UpdateServices {
+		log.Warnf("Service updates are disabled: services using %s must be updated manually to use %s", secretName, newSecretName)
+		return nil
+	}
 
 	// Update all services that use this secret to point to the new version
-	if err := d.updateServicesSecretReference(secretName, newSecretName, createResponse.ID); err != nil {
+	oldIDs := make(map[string]bool, len(versions))
+	for _, version := range versions {
+		oldIDs[version.ID] = true
+	}
+	// rotation_restart_tasks=false only drops the rotation label, Swarm
+	// replaces the tasks anyway since their secret reference changes
+	markRotated := strings.ToLower(secretLabels["rotation_restart_tasks"]) != "false"
+	if err := d.updateServicesSecretReference(oldIDs, newSecretName, newSecretID, markRotated, rollout); err != nil {
 		// try to remove the new secret since service update failed
-		if cleanupErr := d.dockerClient.SecretRemove(ctx, createResponse.ID); cleanupErr != nil {
-			log.Warnf("failed to remove new secret %s after service update error: %v", createResponse.ID, cleanupErr)
+		cleanupErr := d.store.RemoveSecret(ctx, newSecretID)
+		d.recordDockerAPICall("SecretRemove", cleanupErr)
+		if cleanupErr != nil {
+			log.Warnf("failed to remove new secret %s after service update error: %v", newSecretID, cleanupErr)
 		}
 		return fmt.Errorf("failed to update services to use new secret: %v", err)
 	}
 
-	// Remove the old secret only after services are updated
-	if err := d.dockerClient.SecretRemove(ctx, existingSecret.ID); err != nil {
-		log.Warnf("Failed to remove old secret version %s: %v", existingSecret.ID, err)
-		// Don't return error as the new secret was created and services updated successfully
+	// Move services back to the version they used if the canary never runs
+	// with the new one; the old version has not been removed yet
+	if err := d.verifyCanary(newSecretName, newSecretID); err != nil {
+		if rollbackErr := d.updateServicesSecretReference(map[string]bool{newSecretID: true}, existingSecret.Spec.Name, existingSecret.ID, markRotated, nil); rollbackErr != nil {
+			log.Errorf("Failed to roll services back to %s after canary failure: %v", existingSecret.Spec.Name, rollbackErr)
+			return fmt.Errorf("canary check failed and services could not be rolled back: %v", err)
+		}
+		cleanupErr := d.store.RemoveSecret(ctx, newSecretID)
+		d.recordDockerAPICall("SecretRemove", cleanupErr)
+		if cleanupErr != nil {
+			log.Warnf("failed to remove new secret %s after canary failure: %v", newSecretID, cleanupErr)
+		}
+		return fmt.Errorf("rotation rolled back: %v", err)
+	}
+
+	// Remove old versions only after services are updated. Besides the one
+	// just replaced, this picks up versions that services of an inactive
+	// rotation group stayed on during earlier rotations.
+	for _, version := range removableVersions(secretName, versions, newSecretID) {
+		// A racing service update can leave a service on the old version even
+		// though the update above succeeded, so confirm before removing it
+		stillUsedBy, err := d.servicesReferencingSecret(ctx, version.ID)
+		if err != nil {
+			log.Warnf("Keeping old secret version %s, could not verify it is unused: %v", version.Spec.Name, err)
+			continue
+		}
+		if len(stillUsedBy) > 0 {
+			log.Warnf("Keeping old secret version %s, still referenced by services: %v", version.Spec.Name, stillUsedBy)
+			continue
+		}
+
+		err = d.store.RemoveSecret(ctx, version.ID)
+		d.recordDockerAPICall("SecretRemove", err)
+		if err != nil {
+			log.Warnf("Failed to remove old secret version %s: %v", version.ID, err)
+			// Don't return error as the new secret was created and services updated successfully
+		}
 	}
 
 	return nil
 }
 
-// updateServicesSecretReference updates all services to use the new secret version
-func (d *SecretsDriver) updateServicesSecretReference(oldSecretName, newSecretName, newSecretID string) error {
+// contentChecksum is the plain hex SHA-256 of the bytes a secret delivers,
+// which consumers can recompute from the mounted file. Unlike the tracked
+// hash it is never keyed with CHANGE_HASH_HMAC_KEY.
+func contentChecksum(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
+
+// removableVersions returns the versions of secretName that cleanup may
+// remove: the secret itself and the versions the plugin created for it,
+// which carry the lineage and provider labels. The version services were
+// just moved to is always kept, so the lineage never ends up empty.
+func removableVersions(secretName string, versions []swarm.Secret, keepID string) []swarm.Secret {
+	var removable []swarm.Secret
+	for _, version := range versions {
+		if version.ID == keepID {
+			continue
+		}
+		if version.Spec.Name == secretName {
+			removable = append(removable, version)
+			continue
+		}
+		if isSecretVersion(secretName, version) && version.Spec.Labels[providerLabel] != "" {
+			removable = append(removable, version)
+		}
+	}
+	return removable
+}
+
+// verifyCreatedSecret reads the created secret back and checks it matches the
+// spec it was created from. Swarm never returns secret data, so the size is
+// only compared when the store does return it
+func (d *SecretsDriver) verifyCreatedSecret(ctx context.Context, id string, spec swarm.SecretSpec) error {
+	created, err := d.store.ListSecrets(ctx, spec.Name)
+	d.recordDockerAPICall("SecretList", err)
+	if err != nil {
+		return fmt.Errorf("failed to read back secret %s: %v", spec.Name, err)
+	}
+
+	for _, secret := range created {
+		if secret.ID != id {
+			continue
+		}
+		if secret.Spec.Name != spec.Name {
+			return fmt.Errorf("created secret %s has name %s, expected %s", id, secret.Spec.Name, spec.Name)
+		}
+		for key, value := range spec.Labels {
+			if secret.Spec.Labels[key] != value {
+				return fmt.Errorf("created secret %s has label %s=%q, expected %q", spec.Name, key, secret.Spec.Labels[key], value)
+			}
+		}
+		if len(secret.Spec.Data) > 0 && len(secret.Spec.Data) != len(spec.Data) {
+			return fmt.Errorf("created secret %s holds %d bytes, expected %d", spec.Name, len(secret.Spec.Data), len(spec.Data))
+		}
+		return nil
+	}
+	return fmt.Errorf("created secret %s (%s) not found", spec.Name, id)
+}
+
+// updateServicesSecretReference updates all services referencing one of
+// oldIDs to use the new secret version. The changed secret reference makes
+// Swarm replace the services' tasks. With markRotated the services are also
+// labeled with the rotation time. A rollout override applies to this update
+// only.
+func (d *SecretsDriver) updateServicesSecretReference(oldIDs map[string]bool, newSecretName, newSecretID string, markRotated bool, rollout *rolloutOverride) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	// List all services
-	services, err := d.dockerClient.ServiceList(ctx, swarm.ServiceListOptions{})
+	// Docker cannot filter services by secret reference, so with
+	// ROTATION_SERVICE_LABEL only the services carrying it are listed
+	services, err := d.store.ListLabeledServices(ctx, d.config.RotationServiceLabel)
+	d.recordDockerAPICall("ServiceList", err)
 	if err != nil {
 		return fmt.Errorf("failed to list services: %v", err)
 	}
 
-	var updatedServices []string
+	var updatedServices, heldServices []string
+	execServices := make(map[string]string) // service name -> rotation_exec command
 
 	for _, service := range services {
+		// During blue/green only the active group moves, the others keep the
+		// version they use until their group becomes active
+		if group, grouped := service.Spec.Labels["rotation_group"]; grouped && d.config.RotationActiveGroup != "" && group != d.config.RotationActiveGroup {
+			heldServices = append(heldServices, service.Spec.Name)
+			continue
+		}
+
 		// Check if service uses this secret and update the reference
 		needsUpdate := false
-		updatedSecrets := make([]*swarm.SecretReference, len(service.Spec.TaskTemplate.ContainerSpec.Secrets))
-
-		for i, secretRef := range service.Spec.TaskTemplate.ContainerSpec.Secrets {
-			if secretRef.SecretName == oldSecretName ||
-				strings.HasPrefix(secretRef.SecretName, oldSecretName+"-") {
-				// Update to use the new secret name and ID
-				updatedSecrets[i] = &swarm.SecretReference{
-					File:       secretRef.File,
-					SecretID:   newSecretID, // Use actual Docker secret ID
-					SecretName: newSecretName,
+		secretRefs := serviceSecrets(service)
+		updatedSecrets := make([]*swarm.SecretReference, len(secretRefs))
+
+		for i, secretRef := range secretRefs {
+			if referencesSecret(secretRef, oldIDs) {
+				// Only swap the underlying secret, the target file name,
+				// ownership and mode stay exactly as the service defined them
+				updatedRef := *secretRef
+				if secretRef.File != nil {
+					file := *secretRef.File
+					updatedRef.File = &file
 				}
+				updatedRef.SecretID = newSecretID // Use actual Docker secret ID
+				updatedRef.SecretName = newSecretName
+				updatedSecrets[i] = &updatedRef
 				needsUpdate = true
 			} else {
 				updatedSecrets[i] = secretRef
@@ -483,33 +1475,238 @@ func (d *SecretsDriver) updateServicesSecretReference(oldSecretName, newSecretNa
 			serviceSpec := service.Spec
 			serviceSpec.TaskTemplate.ContainerSpec.Secrets = updatedSecrets
 
-			// Add/update a label to force the update
-			if serviceSpec.Labels == nil {
-				serviceSpec.Labels = make(map[string]string)
+			// Record the rotation time on the service, unless the secret
+			// opted out or the service reloads through rotation_exec
+			command := service.Spec.Labels[rotationExecLabel]
+			if markRotated && command == "" {
+				if serviceSpec.Labels == nil {
+					serviceSpec.Labels = make(map[string]string)
+				}
+				serviceSpec.Labels["vault.secret.rotated"] = fmt.Sprintf("%d", time.Now().Unix())
+			}
+
+			// A rollout still in flight already holds the service's own
+			// policy, this one joins it instead of taking the override for it
+			var original *swarm.UpdateConfig
+			var joined bool
+			if rollout != nil {
+				original, joined = d.claimRollout(service.Spec.Name, service.Spec.UpdateConfig)
+				serviceSpec.UpdateConfig = rollout.apply(original)
 			}
-			serviceSpec.Labels["vault.secret.rotated"] = fmt.Sprintf("%d", time.Now().Unix())
 
-			updateOptions := swarm.ServiceUpdateOptions{}
-			updateResponse, err := d.dockerClient.ServiceUpdate(ctx, service.ID, service.Version, serviceSpec, updateOptions)
+			warnings, err := d.store.UpdateService(ctx, service, serviceSpec)
+			d.recordDockerAPICall("ServiceUpdate", err)
 			if err != nil {
+				if rollout != nil && !joined {
+					d.releaseRollout(service.Spec.Name)
+				}
 				return fmt.Errorf("failed to update service %s: %v", service.Spec.Name, err)
 			}
+			if rollout != nil && !joined {
+				go d.restoreUpdateConfig(service.Spec.Name, original)
+			}
 
-			if len(updateResponse.Warnings) > 0 {
-				log.Warnf("Service update warnings for %s: %v", service.Spec.Name, updateResponse.Warnings)
+			if len(warnings) > 0 {
+				log.Warnf("Service update warnings for %s: %v", service.Spec.Name, warnings)
 			}
 
 			updatedServices = append(updatedServices, service.Spec.Name)
+			if command != "" {
+				execServices[service.Spec.Name] = command
+			}
 		}
 	}
 
 	if len(updatedServices) > 0 {
 		log.Printf("Updated services to use new secret %s: %v", newSecretName, updatedServices)
 	}
+	if len(heldServices) > 0 {
+		log.Printf("Kept services outside rotation group %s on their current secret: %v", d.config.RotationActiveGroup, heldServices)
+	}
+
+	// The commands wait for the new tasks, which would hold up the rotation
+	// of other secrets, so they run on their own
+	for serviceName, command := range execServices {
+		d.rotationExecs.Add(1)
+		go func() {
+			defer d.rotationExecs.Done()
+			d.runRotationExec(serviceName, newSecretID, command)
+		}()
+	}
 
 	return nil
 }
 
+// applyVersion records the backend version of the value last read for a
+// secret, for providers that expose one. The caller must hold trackerMutex.
+func (d *SecretsDriver) applyVersion(provider providers.SecretsProvider, secretInfo *providers.SecretInfo) {
+	reporter, ok := provider.(providers.VersionReporter)
+	if !ok {
+		return
+	}
+
+	version, _ := reporter.SecretVersion(secretInfo.SecretPath)
+	// A content change alone looks the same as a revert, the version tells them apart
+	if isVersionRevert(secretInfo.Version, version) {
+		log.Warnf("Backend version of secret %s went back from %s to %s, the secret was reverted to an earlier version",
+			secretInfo.DockerSecretName, secretInfo.Version, version)
+		if d.monitor != nil {
+			d.monitor.RecordVersionRevert()
+		}
+	}
+	secretInfo.Version = version
+}
+
+// isVersionRevert reports whether a numbered backend version, such as a KV v2
+// version or the last segment of a GCP version name, went backward. Versions
+// that are not numbers, like AWS version ids, never count as a revert.
+func isVersionRevert(previous, current string) bool {
+	prev, err := strconv.ParseUint(previous[strings.LastIndex(previous, "/")+1:], 10, 64)
+	if err != nil {
+		return false
+	}
+	cur, err := strconv.ParseUint(current[strings.LastIndex(current, "/")+1:], 10, 64)
+	if err != nil {
+		return false
+	}
+	return cur < prev
+}
+
+// servicesReferencingSecret returns the services that still reference a secret
+// ID. Every service is listed, including those outside ROTATION_SERVICE_LABEL
+// that were never moved to the new version.
+func (d *SecretsDriver) servicesReferencingSecret(ctx context.Context, secretID string) ([]string, error) {
+	services, err := d.store.ListLabeledServices(ctx, "")
+	d.recordDockerAPICall("ServiceList", err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %v", err)
+	}
+
+	var referencing []string
+	for _, service := range services {
+		for _, secretRef := range serviceSecrets(service) {
+			if secretRef.SecretID == secretID {
+				referencing = append(referencing, service.Spec.Name)
+				break
+			}
+		}
+	}
+	return referencing, nil
+}
+
+// serviceSecrets returns the secret references of a service. Services that
+// do not run containers, such as plugin services, have no container spec and
+// reference no secrets.
+func serviceSecrets(service swarm.Service) []*swarm.SecretReference {
+	if service.Spec.TaskTemplate.ContainerSpec == nil {
+		return nil
+	}
+	return service.Spec.TaskTemplate.ContainerSpec.Secrets
+}
+
+// pingDocker reports whether the Docker daemon is reachable
+func (d *SecretsDriver) pingDocker(ctx context.Context) error {
+	err := d.store.Ping(ctx)
+	d.recordDockerAPICall("Ping", err)
+	return err
+}
+
+// referencesSecret reports whether a secret reference points at one of the
+// given secret IDs. References are matched by ID rather than name: services
+// deployed with docker stack deploy may name a shared secret after their
+// stack, and another stack's secret of a similar name is a different secret.
+func referencesSecret(secretRef *swarm.SecretReference, secretIDs map[string]bool) bool {
+	return secretIDs[secretRef.SecretID]
+}
+
+// isSecretVersion reports whether secret is a version created by rotating
+// secretName. Besides the name, the lineage label must point back at
+// secretName or one of its versions, so a user secret named like a version
+// is never mistaken for one.
+func isSecretVersion(secretName string, secret swarm.Secret) bool {
+	if !isVersionName(secretName, secret.Spec.Name) {
+		return false
+	}
+	from := secret.Spec.Labels[rotatedFromLabel]
+	return from == secretName || isVersionName(secretName, from)
+}
+
+// isVersionName reports whether name is secretName followed by the
+// "-<unix nanoseconds>" suffix rotation gives new versions
+func isVersionName(secretName, name string) bool {
+	suffix, found := strings.CutPrefix(name, secretName+"-")
+	if !found || len(suffix) != versionSuffixDigits {
+		return false
+	}
+	for _, c := range suffix {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// reportProviderRegion records the provider's active region for providers that fail over between regions
+func (d *SecretsDriver) reportProviderRegion() {
+	if d.monitor == nil {
+		return
+	}
+	if reporter, ok := d.provider.(providers.RegionReporter); ok {
+		d.monitor.SetProviderRegion(reporter.ActiveRegion())
+	}
+}
+
+// reportProviderThrottles records how often the backend throttled the provider
+func (d *SecretsDriver) reportProviderThrottles() {
+	if d.monitor == nil {
+		return
+	}
+	if reporter, ok := d.provider.(providers.ThrottleReporter); ok {
+		d.monitor.SetProviderThrottled(d.provider.GetProviderName(), reporter.ThrottledRequests())
+	}
+}
+
+// providerAuth returns the logins every provider instance made against its
+// backend, including token renewals and logins after a token expired
+func (d *SecretsDriver) providerAuth() map[string]monitoring.AuthMetrics {
+	auth := make(map[string]monitoring.AuthMetrics)
+	for name, provider := range d.providerInstances() {
+		if reporter, ok := provider.(providers.AuthReporter); ok {
+			stats := reporter.AuthStats()
+			auth[name] = monitoring.AuthMetrics{
+				Successes:    stats.Successes,
+				Failures:     stats.Failures,
+				LatencyTotal: stats.LatencyTotal,
+			}
+		}
+	}
+	return auth
+}
+
+// renewProviderTokens keeps the login token of every provider instance alive
+// until the next check
+func (d *SecretsDriver) renewProviderTokens() {
+	for name, provider := range d.providerInstances() {
+		renewer, ok := provider.(providers.TokenRenewer)
+		if !ok {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), d.config.ChangeCheckTimeout)
+		err := renewer.RenewToken(ctx, 2*d.config.RotationInterval)
+		cancel()
+		if err != nil {
+			log.Errorf("Failed to renew the token of provider %s: %v", name, err)
+		}
+	}
+}
+
+// recordDockerAPICall reports a Docker API call to the monitor when monitoring is enabled
+func (d *SecretsDriver) recordDockerAPICall(op string, err error) {
+	if d.monitor != nil {
+		d.monitor.RecordDockerAPICall(op, err)
+	}
+}
+
 // forceServiceUpdate forces a service to update (recreate tasks)
 // TODO - This method is currently not used, check later if needed
 // func (d *SecretsDriver) forceServiceUpdate(service swarm.Service) error {
@@ -545,6 +1742,7 @@ func (d *SecretsDriver) Stop() error {
 	if d.monitorCancel != nil {
 		d.monitorCancel()
 	}
+	d.rotationExecs.Wait()
 
 	if d.monitor != nil {
 		d.monitor.Stop()
@@ -556,137 +1754,96 @@ func (d *SecretsDriver) Stop() error {
 		}
 	}
 
+	if d.metricsServer != nil {
+		if err := d.metricsServer.Stop(); err != nil {
+			log.Warnf("Error stopping metrics server: %v", err)
+		}
+	}
+
 	if d.provider != nil {
 		if err := d.provider.Close(); err != nil {
 			log.Warnf("Error closing provider: %v", err)
 		}
 	}
+	d.closeLabelProviders()
+	d.closeProviderAliases()
 
-	if d.dockerClient != nil {
-		return d.dockerClient.Close()
+	if d.store != nil {
+		return d.store.Close()
 	}
 	return nil
 }
 
-// Helper methods for building provider-specific secret paths/names
-
-func (d *SecretsDriver) buildVaultSecretPath(req secrets.Request) string {
-	// Use custom path from labels if provided
-	if customPath, exists := req.SecretLabels["vault_path"]; exists {
-		return fmt.Sprintf("secret/data/%s", customPath)
-	}
-
-	// Default path structure for KV v2
-	if req.ServiceName != "" {
-		return fmt.Sprintf("secret/data/%s/%s", req.ServiceName, req.SecretName)
-	}
-	return fmt.Sprintf("secret/data/%s", req.SecretName)
-}
-
-func (d *SecretsDriver) buildOpenBaoSecretPath(req secrets.Request) string {
-	// Use custom path from labels if provided
-	if customPath, exists := req.SecretLabels["openbao_path"]; exists {
-		return fmt.Sprintf("secret/data/%s", customPath)
-	}
-
-	// Default path structure for KV v2
-	if req.ServiceName != "" {
-		return fmt.Sprintf("secret/data/%s/%s", req.ServiceName, req.SecretName)
+// isManagedSecret reports whether MANAGED_SECRET_LABEL lets the plugin rotate
+// a secret with these labels; a bare key only has to be present
+func (d *SecretsDriver) isManagedSecret(labels map[string]string) bool {
+	if d.config.ManagedSecretLabel == "" {
+		return true
 	}
-	return fmt.Sprintf("secret/data/%s", req.SecretName)
+	key, value, hasValue := strings.Cut(d.config.ManagedSecretLabel, "=")
+	actual, exists := labels[key]
+	return exists && (!hasValue || actual == value)
 }
 
-func (d *SecretsDriver) buildAWSSecretName(req secrets.Request) string {
-	if customName, exists := req.SecretLabels["aws_secret_name"]; exists {
-		return customName
-	}
-
-	if req.ServiceName != "" {
-		return fmt.Sprintf("%s/%s", req.ServiceName, req.SecretName)
+// copyLabels returns a copy of a label map so tracked state never aliases request data
+func copyLabels(labels map[string]string) map[string]string {
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
 	}
-	return req.SecretName
+	return copied
 }
 
-func (d *SecretsDriver) buildGCPSecretName(req secrets.Request) string {
-	if customName, exists := req.SecretLabels["gcp_secret_name"]; exists {
-		return customName
-	}
-
-	secretName := req.SecretName
-	if req.ServiceName != "" {
-		secretName = fmt.Sprintf("%s-%s", req.ServiceName, req.SecretName)
+// resolveLabels is the single place where LABEL_PREFIX is applied. Prefixed
+// labels are returned under their plain name, so every later lookup of e.g.
+// "vault_field" sees "es.vault_field". A prefixed label wins over the plain
+// one, which is kept as a fallback for compatibility.
+func resolveLabels(labels map[string]string, prefix string) map[string]string {
+	if prefix == "" {
+		return labels
 	}
 
-	return normalizeGCPSecretName(secretName)
-}
-
-// normalizeGCPSecretName ensures the name matches GCP's requirements: [a-zA-Z][a-zA-Z0-9_-]*
-func normalizeGCPSecretName(secretName string) string {
-	if len(secretName) == 0 {
-		return "s"
-	}
-	result := ""
-	for i, char := range secretName {
-		if i == 0 {
-			if (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') {
-				result += string(char)
-			} else {
-				result += "s"
-			}
-		} else {
-			if (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') ||
-				(char >= '0' && char <= '9') || char == '_' || char == '-' {
-				result += string(char)
-			} else {
-				result += "_"
-			}
+	resolved := copyLabels(labels)
+	for k, v := range labels {
+		if name, found := strings.CutPrefix(k, prefix); found && name != "" {
+			resolved[name] = v
 		}
 	}
-	return result
+	return resolved
 }
 
-func (d *SecretsDriver) buildAzureSecretName(req secrets.Request) string {
-	if customName, exists := req.SecretLabels["azure_secret_name"]; exists {
-		return customName
-	}
-
-	secretName := req.SecretName
-	if req.ServiceName != "" {
-		secretName = fmt.Sprintf("%s-%s", req.ServiceName, req.SecretName)
-	}
-
-	// Azure Key Vault secret names must match regex: ^[0-9a-zA-Z-]+$
-	result := ""
-	for _, char := range secretName {
-		if (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') ||
-			(char >= '0' && char <= '9') || char == '-' {
-			result += string(char)
-		} else {
-			result += "-"
-		}
-	}
+// setLastError records the outcome of the last check or rotation of a secret
+func (d *SecretsDriver) setLastError(secretInfo *providers.SecretInfo, err error) {
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
 
-	// Remove consecutive hyphens and leading/trailing hyphens
-	for strings.Contains(result, "--") {
-		result = strings.ReplaceAll(result, "--", "-")
+	if err != nil {
+		secretInfo.LastError = err.Error()
+	} else {
+		secretInfo.LastError = ""
 	}
-	result = strings.Trim(result, "-")
+}
 
-	if result == "" || (result[0] >= '0' && result[0] <= '9') {
-		result = "secret-" + result
+// secretStatuses lists the tracked secrets for the monitoring dashboard
+func (d *SecretsDriver) secretStatuses() []monitoring.SecretStatus {
+	d.trackerMutex.RLock()
+	defer d.trackerMutex.RUnlock()
+
+	statuses := make([]monitoring.SecretStatus, 0, len(d.secretTracker))
+	for name, info := range d.secretTracker {
+		statuses = append(statuses, monitoring.SecretStatus{
+			Name:        name,
+			Provider:    info.Provider,
+			Services:    append([]string(nil), info.ServiceNames...),
+			LastUpdated: info.LastUpdated,
+			LastError:   info.LastError,
+			Version:     info.Version,
+
+			ChangeDetectedAt: info.ChangeDetectedAt,
+		})
 	}
-	return result
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
 }
-
-// func (d *SecretsDriver) buildVaultSecretPath(req secrets.Request) string {
-// 	// Use custom path from labels if provided
-// 	if customPath, exists := req.SecretLabels["vault_path"]; exists {
-// 		return fmt.Sprintf("secret/data/%s", customPath)
-// 	}
-
-// 	// Default path structure for KV v2
-// 	if req.ServiceName != "" {
-// 		return fmt.Sprintf("secret/data/%s/%s", req.ServiceName, req.SecretName)
-// 	}
-// 	return fmt.Sprintf("secret/data/%s", req.SecretName)
-// }
@@ -0,0 +1,2359 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/swarm/runtime"
+	"github.com/docker/go-plugins-helpers/secrets"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+
+	"github.com/sugar-org/vault-swarm-plugin/monitoring"
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// fakeDocker is an in-memory Swarm that records the calls the driver makes
+type fakeDocker struct {
+	mutex        sync.Mutex
+	secrets      []swarm.Secret
+	services     []swarm.Service
+	created      int
+	removed      []string
+	secretLists  []swarm.SecretListOptions
+	serviceLists []swarm.ServiceListOptions
+	createBudget time.Duration // time left on the context of the last SecretCreate
+	updateErr    error         // returned by every ServiceUpdate when set
+	updates      int
+	mangle       func(*swarm.Secret) // alters secrets as SecretCreate stores them
+	taskState    swarm.TaskState     // state of the one task TaskList reports per service, none when empty
+	execs        []string            // "<container> <command>" of every exec started
+	execExitCode int
+}
+
+var _ dockerAPI = (*fakeDocker)(nil)
+
+func (f *fakeDocker) SecretList(ctx context.Context, options swarm.SecretListOptions) ([]swarm.Secret, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.secretLists = append(f.secretLists, options)
+
+	// Like Docker, the name filter matches by prefix
+	names := options.Filters.Get("name")
+	var listed []swarm.Secret
+	for _, secret := range f.secrets {
+		if len(names) > 0 && !hasAnyPrefix(secret.Spec.Name, names) {
+			continue
+		}
+		listed = append(listed, copySecret(secret))
+	}
+	return listed, nil
+}
+
+func (f *fakeDocker) SecretCreate(ctx context.Context, spec swarm.SecretSpec) (swarm.SecretCreateResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if deadline, ok := ctx.Deadline(); ok {
+		f.createBudget = time.Until(deadline)
+	}
+	for _, secret := range f.secrets {
+		if secret.Spec.Name == spec.Name {
+			return swarm.SecretCreateResponse{}, fmt.Errorf("secret %s already exists", spec.Name)
+		}
+	}
+
+	f.created++
+	id := fmt.Sprintf("created-%d", f.created)
+	secret := swarm.Secret{ID: id, Spec: spec}
+	// Newer versions must sort after the seeded ones
+	secret.CreatedAt = time.Now().Add(time.Duration(f.created) * time.Second)
+	if f.mangle != nil {
+		f.mangle(&secret)
+	}
+	f.secrets = append(f.secrets, copySecret(secret))
+	return swarm.SecretCreateResponse{ID: id}, nil
+}
+
+func (f *fakeDocker) SecretRemove(ctx context.Context, id string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for i, secret := range f.secrets {
+		if secret.ID == id {
+			f.secrets = append(f.secrets[:i], f.secrets[i+1:]...)
+			f.removed = append(f.removed, id)
+			return nil
+		}
+	}
+	return fmt.Errorf("secret %s not found", id)
+}
+
+func (f *fakeDocker) ServiceList(ctx context.Context, options swarm.ServiceListOptions) ([]swarm.Service, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.serviceLists = append(f.serviceLists, options)
+
+	names := options.Filters.Get("name")
+	labels := options.Filters.Get("label")
+	var listed []swarm.Service
+	for _, service := range f.services {
+		if len(names) > 0 && !containsString(names, service.Spec.Name) {
+			continue
+		}
+		if !hasLabels(service.Spec.Labels, labels) {
+			continue
+		}
+		listed = append(listed, copyService(service))
+	}
+	return listed, nil
+}
+
+func (f *fakeDocker) ServiceUpdate(ctx context.Context, serviceID string, version swarm.Version, spec swarm.ServiceSpec, options swarm.ServiceUpdateOptions) (swarm.ServiceUpdateResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.updates++
+	if f.updateErr != nil {
+		return swarm.ServiceUpdateResponse{}, f.updateErr
+	}
+	for i, service := range f.services {
+		if service.ID != serviceID {
+			continue
+		}
+		if service.Version.Index != version.Index {
+			return swarm.ServiceUpdateResponse{}, fmt.Errorf("update out of sequence for service %s", serviceID)
+		}
+		f.services[i].Spec = spec
+		f.services[i].Version.Index++
+		return swarm.ServiceUpdateResponse{}, nil
+	}
+	return swarm.ServiceUpdateResponse{}, fmt.Errorf("service %s not found", serviceID)
+}
+
+func (f *fakeDocker) TaskList(ctx context.Context, options swarm.TaskListOptions) ([]swarm.Task, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.taskState == "" {
+		return nil, nil
+	}
+
+	// Each service runs a single task with its current spec
+	var tasks []swarm.Task
+	for _, service := range f.services {
+		if !options.Filters.ExactMatch("service", service.Spec.Name) {
+			continue
+		}
+		tasks = append(tasks, swarm.Task{
+			ID:        service.ID + "-task",
+			ServiceID: service.ID,
+			Spec:      service.Spec.TaskTemplate,
+			Status: swarm.TaskStatus{
+				State:           f.taskState,
+				ContainerStatus: &swarm.ContainerStatus{ContainerID: service.ID + "-container"},
+			},
+		})
+	}
+	return tasks, nil
+}
+
+// Execs finish as soon as they start, with execExitCode
+func (f *fakeDocker) ContainerExecCreate(ctx context.Context, containerID string, options container.ExecOptions) (container.ExecCreateResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.execs = append(f.execs, containerID+" "+strings.Join(options.Cmd, " "))
+	return container.ExecCreateResponse{ID: fmt.Sprintf("exec-%d", len(f.execs))}, nil
+}
+
+func (f *fakeDocker) ContainerExecStart(ctx context.Context, execID string, config container.ExecStartOptions) error {
+	return nil
+}
+
+func (f *fakeDocker) ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return container.ExecInspect{ExecID: execID, ExitCode: f.execExitCode}, nil
+}
+
+func (f *fakeDocker) Ping(ctx context.Context) (types.Ping, error) {
+	return types.Ping{}, nil
+}
+
+func (f *fakeDocker) Close() error {
+	return nil
+}
+
+// secretNamed returns the secret with the given name, if any
+func (f *fakeDocker) secretNamed(name string) (swarm.Secret, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, secret := range f.secrets {
+		if secret.Spec.Name == name {
+			return copySecret(secret), true
+		}
+	}
+	return swarm.Secret{}, false
+}
+
+// secretsWithPrefix returns the secrets whose name starts with prefix
+func (f *fakeDocker) secretsWithPrefix(prefix string) []swarm.Secret {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var found []swarm.Secret
+	for _, secret := range f.secrets {
+		if strings.HasPrefix(secret.Spec.Name, prefix) {
+			found = append(found, copySecret(secret))
+		}
+	}
+	return found
+}
+
+// serviceNamed returns the service with the given name
+func (f *fakeDocker) serviceNamed(t *testing.T, name string) swarm.Service {
+	t.Helper()
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, service := range f.services {
+		if service.Spec.Name == name {
+			return copyService(service)
+		}
+	}
+	t.Fatalf("service %s not found", name)
+	return swarm.Service{}
+}
+
+func copySecret(secret swarm.Secret) swarm.Secret {
+	secret.Spec.Labels = copyLabels(secret.Spec.Labels)
+	secret.Spec.Data = append([]byte(nil), secret.Spec.Data...)
+	return secret
+}
+
+func copyService(service swarm.Service) swarm.Service {
+	service.Spec.Labels = copyLabels(service.Spec.Labels)
+	if spec := service.Spec.TaskTemplate.ContainerSpec; spec != nil {
+		containerSpec := *spec
+		containerSpec.Secrets = nil
+		for _, ref := range spec.Secrets {
+			copied := *ref
+			containerSpec.Secrets = append(containerSpec.Secrets, &copied)
+		}
+		service.Spec.TaskTemplate.ContainerSpec = &containerSpec
+	}
+	return service
+}
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLabels matches Docker's label filter, every key=value or bare key must be present
+func hasLabels(labels map[string]string, filters []string) bool {
+	for _, filter := range filters {
+		key, value, withValue := strings.Cut(filter, "=")
+		current, exists := labels[key]
+		if !exists || (withValue && current != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// testSecret is a Swarm secret as docker secret create leaves it
+func testSecret(id, name string, labels map[string]string) swarm.Secret {
+	secret := swarm.Secret{ID: id}
+	secret.Spec.Name = name
+	secret.Spec.Labels = labels
+	secret.CreatedAt = time.Now().Add(-time.Hour)
+	return secret
+}
+
+// testService is a Swarm service using the given secrets
+func testService(id, name string, labels map[string]string, refs ...*swarm.SecretReference) swarm.Service {
+	service := swarm.Service{ID: id}
+	service.Spec.Name = name
+	service.Spec.Labels = labels
+	service.Spec.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{Secrets: refs}
+	return service
+}
+
+// secretRef references a secret the way docker service create does
+func secretRef(id, name string) *swarm.SecretReference {
+	return &swarm.SecretReference{
+		SecretID:   id,
+		SecretName: name,
+		File:       &swarm.SecretReferenceFileTarget{Name: name, UID: "0", GID: "0", Mode: 0444},
+	}
+}
+
+// fakeProvider serves values from memory, keyed by secret path
+type fakeProvider struct {
+	mutex  sync.Mutex
+	values map[string]string
+}
+
+func (p *fakeProvider) Initialize(config map[string]string) error {
+	return nil
+}
+
+func (p *fakeProvider) GetSecret(ctx context.Context, req secrets.Request) ([]byte, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	value, exists := p.values[p.BuildPath(req)]
+	if !exists {
+		return nil, fmt.Errorf("secret %s not found", p.BuildPath(req))
+	}
+	return []byte(value), nil
+}
+
+func (p *fakeProvider) SupportsRotation() bool {
+	return true
+}
+
+func (p *fakeProvider) CheckSecretChanged(ctx context.Context, secretInfo *providers.SecretInfo) (bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	value, exists := p.values[secretInfo.SecretPath]
+	if !exists {
+		return false, fmt.Errorf("secret %s not found", secretInfo.SecretPath)
+	}
+	return providers.HashValue([]byte(value)) != secretInfo.LastHash, nil
+}
+
+func (p *fakeProvider) GetProviderName() string {
+	return "fake"
+}
+
+func (p *fakeProvider) FieldLabelKey() string {
+	return "fake_field"
+}
+
+func (p *fakeProvider) PathLabelKey() string {
+	return "fake_path"
+}
+
+func (p *fakeProvider) BuildPath(req secrets.Request) string {
+	if path := req.SecretLabels[p.PathLabelKey()]; path != "" {
+		return path
+	}
+	return req.SecretName
+}
+
+func (p *fakeProvider) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+func (p *fakeProvider) Close() error {
+	return nil
+}
+
+// set changes the value the backend holds at path
+func (p *fakeProvider) set(path, value string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.values[path] = value
+}
+
+// newTestDriver builds a driver that rotates against the fake daemon
+func newTestDriver(provider providers.SecretsProvider, docker *fakeDocker) *SecretsDriver {
+	return &SecretsDriver{
+		provider: provider,
+		config: &SecretsConfig{
+			EnableRotation:        true,
+			RotationInterval:      time.Minute,
+			UpdateServices:        true,
+			RequestTimeout:        5 * time.Second,
+			ChangeCheckTimeout:    5 * time.Second,
+			RotationCanaryTimeout: 5 * time.Second,
+			RotationExecTimeout:   5 * time.Second,
+			Settings:              map[string]string{},
+		},
+		store:          newDockerSecretStore(docker),
+		secretTracker:  make(map[string]*providers.SecretInfo),
+		labelProviders: make(map[string]providers.SecretsProvider),
+	}
+}
+
+func TestRotationMovesServicesToNewVersion(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", map[string]string{"fake_path": "db"})},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	provider := &fakeProvider{values: map[string]string{"db": "first"}}
+	driver := newTestDriver(provider, docker)
+
+	response := driver.Get(secrets.Request{
+		SecretName:   "db_password",
+		ServiceName:  "api",
+		SecretLabels: map[string]string{"fake_path": "db"},
+	})
+	if response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	if string(response.Value) != "first" {
+		t.Fatalf("Get returned %q, expected %q", response.Value, "first")
+	}
+
+	provider.set("db", "second")
+	driver.checkForSecretChanges()
+
+	versions := docker.secretsWithPrefix("db_password-")
+	if len(versions) != 1 {
+		t.Fatalf("expected one new version, found %d", len(versions))
+	}
+	version := versions[0]
+	if string(version.Spec.Data) != "second" {
+		t.Errorf("new version holds %q, expected %q", version.Spec.Data, "second")
+	}
+	if from := version.Spec.Labels[rotatedFromLabel]; from != "db_password" {
+		t.Errorf("new version has %s=%q, expected %q", rotatedFromLabel, from, "db_password")
+	}
+
+	refs := docker.serviceNamed(t, "api").Spec.TaskTemplate.ContainerSpec.Secrets
+	if len(refs) != 1 || refs[0].SecretID != version.ID || refs[0].SecretName != version.Spec.Name {
+		t.Fatalf("service still references %s (%s), expected %s (%s)", refs[0].SecretName, refs[0].SecretID, version.Spec.Name, version.ID)
+	}
+	if refs[0].File == nil || refs[0].File.Name != "db_password" {
+		t.Errorf("service secret target changed to %+v", refs[0].File)
+	}
+
+	if _, exists := docker.secretNamed("db_password"); exists {
+		t.Errorf("replaced version db_password was not removed")
+	}
+}
+
+func TestRotationAbortsOnMismatchedSecret(t *testing.T) {
+	tests := []struct {
+		name   string
+		mangle func(*swarm.Secret)
+	}{
+		{"data truncated", func(secret *swarm.Secret) { secret.Spec.Data = secret.Spec.Data[:1] }},
+		{"label lost", func(secret *swarm.Secret) { secret.Spec.Labels = nil }},
+		{"stored under another name", func(secret *swarm.Secret) { secret.Spec.Name += "-copy" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := &fakeDocker{
+				secrets:  []swarm.Secret{testSecret("old", "db_password", nil)},
+				services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+				mangle:   tt.mangle,
+			}
+			provider := &fakeProvider{values: map[string]string{"db_password": "first"}}
+			driver := newTestDriver(provider, docker)
+			if response := driver.Get(secrets.Request{SecretName: "db_password", ServiceName: "api"}); response.Err != "" {
+				t.Fatalf("Get failed: %s", response.Err)
+			}
+
+			provider.set("db_password", "second")
+			if err := driver.rotateSecret(driver.secretTracker["db_password"]); err == nil || !strings.Contains(err.Error(), "failed to verify new secret version") {
+				t.Fatalf("rotateSecret() error = %v, expected a verification failure", err)
+			}
+
+			// The bad version is removed and services keep the old one
+			if docker.created != 1 || len(docker.removed) != 1 {
+				t.Errorf("%d created and %v removed, expected the new version cleaned up", docker.created, docker.removed)
+			}
+			if refs := docker.serviceNamed(t, "api").Spec.TaskTemplate.ContainerSpec.Secrets; refs[0].SecretID != "old" {
+				t.Errorf("service moved to %s, expected it to keep the old version", refs[0].SecretID)
+			}
+			if docker.updates != 0 {
+				t.Errorf("%d service updates, expected none", docker.updates)
+			}
+		})
+	}
+}
+
+func TestRotateOnlyLeavesServicesAlone(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", nil)},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	driver := newTestDriver(&fakeProvider{values: map[string]string{}}, docker)
+	driver.config.UpdateServices = false
+
+	if err := driver.updateDockerSecret("db_password", []byte("second")); err != nil {
+		t.Fatalf("updateDockerSecret() error = %v", err)
+	}
+	if versions := docker.secretsWithPrefix("db_password-"); len(versions) != 1 || string(versions[0].Spec.Data) != "second" {
+		t.Fatalf("expected one new version holding %q, found %d", "second", len(versions))
+	}
+	if docker.updates != 0 {
+		t.Errorf("ServiceUpdate called %d times in rotate-only mode", docker.updates)
+	}
+	if refs := docker.serviceNamed(t, "api").Spec.TaskTemplate.ContainerSpec.Secrets; refs[0].SecretID != "old" {
+		t.Errorf("api was moved to %s", refs[0].SecretName)
+	}
+	if _, exists := docker.secretNamed("db_password"); !exists {
+		t.Errorf("old version was removed in rotate-only mode")
+	}
+}
+
+func TestRotationLineageLabels(t *testing.T) {
+	userLabels := map[string]string{"team": "payments", "fake_path": "db"}
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", userLabels)},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	driver := newTestDriver(&fakeProvider{values: map[string]string{}}, docker)
+
+	before := time.Now().UTC().Truncate(time.Second)
+	if err := driver.updateDockerSecret("db_password", []byte("second")); err != nil {
+		t.Fatalf("updateDockerSecret() error = %v", err)
+	}
+	first := docker.secretsWithPrefix("db_password-")[0]
+	if err := driver.updateDockerSecret("db_password", []byte("third")); err != nil {
+		t.Fatalf("updateDockerSecret() error = %v", err)
+	}
+	var second swarm.Secret
+	for _, version := range docker.secretsWithPrefix("db_password-") {
+		if version.ID != first.ID {
+			second = version
+		}
+	}
+
+	tests := []struct {
+		version swarm.Secret
+		from    string
+	}{
+		{first, "db_password"},
+		{second, first.Spec.Name},
+	}
+	for _, tt := range tests {
+		labels := tt.version.Spec.Labels
+		if labels[rotatedFromLabel] != tt.from {
+			t.Errorf("%s has %s=%q, expected %q", tt.version.Spec.Name, rotatedFromLabel, labels[rotatedFromLabel], tt.from)
+		}
+		if labels[providerLabel] != "fake" {
+			t.Errorf("%s has %s=%q, expected %q", tt.version.Spec.Name, providerLabel, labels[providerLabel], "fake")
+		}
+		rotatedAt, err := time.Parse(time.RFC3339, labels[rotatedAtLabel])
+		if err != nil || rotatedAt.Before(before) {
+			t.Errorf("%s has %s=%q, expected the rotation time", tt.version.Spec.Name, rotatedAtLabel, labels[rotatedAtLabel])
+		}
+		for key, value := range userLabels {
+			if labels[key] != value {
+				t.Errorf("%s lost label %s=%q", tt.version.Spec.Name, key, value)
+			}
+		}
+	}
+}
+
+func TestManagedSecretLabel(t *testing.T) {
+	tests := []struct {
+		name        string
+		setting     string
+		labels      map[string]string
+		wantTracked bool
+	}{
+		{"no setting manages everything", "", map[string]string{}, true},
+		{"matching value", "managed-by=external-secrets", map[string]string{"managed-by": "external-secrets"}, true},
+		{"other value", "managed-by=external-secrets", map[string]string{"managed-by": "terraform"}, false},
+		{"unlabeled", "managed-by=external-secrets", map[string]string{}, false},
+		{"bare key present", "managed-by", map[string]string{"managed-by": "anything"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := &fakeDocker{
+				secrets:  []swarm.Secret{testSecret("old", "db_password", tt.labels)},
+				services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+			}
+			provider := &fakeProvider{values: map[string]string{"db_password": "first"}}
+			driver := newTestDriver(provider, docker)
+			driver.config.ManagedSecretLabel = tt.setting
+
+			// Every secret is served, only managed ones are tracked and rotated
+			response := driver.Get(secrets.Request{SecretName: "db_password", ServiceName: "api", SecretLabels: tt.labels})
+			if response.Err != "" || string(response.Value) != "first" {
+				t.Fatalf("Get() = %q, %q, expected the value", response.Value, response.Err)
+			}
+			if _, tracked := driver.secretTracker["db_password"]; tracked != tt.wantTracked {
+				t.Fatalf("tracked = %v, expected %v", tracked, tt.wantTracked)
+			}
+
+			provider.set("db_password", "second")
+			driver.checkForSecretChanges()
+			if rotated := docker.created > 0; rotated != tt.wantTracked {
+				t.Errorf("rotated = %v, expected %v", rotated, tt.wantTracked)
+			}
+		})
+	}
+
+	// Tracker state restored from before the setting is not rotated either
+	docker := &fakeDocker{secrets: []swarm.Secret{testSecret("old", "db_password", nil)}}
+	provider := &fakeProvider{values: map[string]string{"db_password": "first"}}
+	driver := newTestDriver(provider, docker)
+	driver.trackSecret(secrets.Request{SecretName: "db_password", SecretLabels: map[string]string{}}, []byte("first"), driver.provider, "fake")
+	driver.config.ManagedSecretLabel = "managed-by=external-secrets"
+	provider.set("db_password", "second")
+	driver.checkForSecretChanges()
+	if err := driver.rotateSecret(driver.secretTracker["db_password"]); err == nil || docker.created != 0 {
+		t.Errorf("restored unmanaged secret rotated, error = %v", err)
+	}
+}
+
+func TestRotationCanary(t *testing.T) {
+	tests := []struct {
+		name       string
+		taskState  swarm.TaskState
+		rolledBack bool
+	}{
+		{"canary runs with the new version", swarm.TaskStateRunning, false},
+		{"canary task fails to converge", swarm.TaskStateFailed, true},
+		{"canary has no tasks", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := &fakeDocker{
+				secrets: []swarm.Secret{testSecret("old", "db_password", map[string]string{"fake_path": "db"})},
+				services: []swarm.Service{
+					testService("svc", "api", nil, secretRef("old", "db_password")),
+					testService("canary-svc", "canary", nil, secretRef("old", "db_password")),
+				},
+				taskState: tt.taskState,
+			}
+			provider := &fakeProvider{values: map[string]string{"db": "first"}}
+			driver := newTestDriver(provider, docker)
+			driver.config.RotationCanaryService = "canary"
+			driver.config.RotationCanaryTimeout = 100 * time.Millisecond
+
+			if response := driver.Get(secrets.Request{SecretName: "db_password", SecretLabels: map[string]string{"fake_path": "db"}}); response.Err != "" {
+				t.Fatalf("Get failed: %s", response.Err)
+			}
+			provider.set("db", "second")
+			driver.checkForSecretChanges()
+
+			if docker.created != 1 {
+				t.Fatalf("created %d versions, expected 1", docker.created)
+			}
+			versions := docker.secretsWithPrefix("db_password-")
+			_, oldKept := docker.secretNamed("db_password")
+			for _, name := range []string{"api", "canary"} {
+				ref := docker.serviceNamed(t, name).Spec.TaskTemplate.ContainerSpec.Secrets[0]
+				if tt.rolledBack && ref.SecretID != "old" {
+					t.Errorf("%s references %s after rollback, expected old", name, ref.SecretName)
+				}
+				if !tt.rolledBack && (len(versions) != 1 || ref.SecretID != versions[0].ID) {
+					t.Errorf("%s references %s, expected the new version", name, ref.SecretName)
+				}
+			}
+			if tt.rolledBack && (len(versions) != 0 || !oldKept) {
+				t.Errorf("rollback left versions %v, old kept = %v", versions, oldKept)
+			}
+			if !tt.rolledBack && oldKept {
+				t.Errorf("replaced version db_password was not removed")
+			}
+		})
+	}
+}
+
+func TestRotationNameLengthLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		length  int
+		wantErr bool
+	}{
+		{"longest rotatable name", maxRotatableNameLength, false},
+		{"one character over", maxRotatableNameLength + 1, true},
+		{"docker's own limit", maxSecretNameLength, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secretName := strings.Repeat("s", tt.length)
+			docker := &fakeDocker{
+				secrets:  []swarm.Secret{testSecret("old", secretName, map[string]string{"fake_path": "db"})},
+				services: []swarm.Service{testService("svc", "api", nil, secretRef("old", secretName))},
+			}
+			driver := newTestDriver(&fakeProvider{values: map[string]string{"db": "first"}}, docker)
+
+			err := driver.updateDockerSecret(secretName, []byte("second"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("updateDockerSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), fmt.Sprintf("at most %d characters", maxRotatableNameLength)) {
+					t.Errorf("error %q does not say how long the name may be", err)
+				}
+				if docker.created != 0 {
+					t.Errorf("created %d secrets for a name that cannot be rotated", docker.created)
+				}
+				return
+			}
+			versions := docker.secretsWithPrefix(secretName + "-")
+			if len(versions) != 1 || len(versions[0].Spec.Name) != maxSecretNameLength {
+				t.Errorf("expected one version named with exactly %d characters, found %v", maxSecretNameLength, versions)
+			}
+		})
+	}
+}
+
+func TestProviderDefaultField(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", map[string]string{"fake_path": "db"})},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	provider := &fieldProvider{&fakeProvider{values: map[string]string{"db": `{"password": "p1", "user": "u1"}`}}}
+	driver := newTestDriver(provider, docker)
+	driver.config.Settings["FAKE_DEFAULT_FIELD"] = "password"
+
+	response := driver.Get(secrets.Request{SecretName: "db_password", SecretLabels: map[string]string{"fake_path": "db"}})
+	if response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	if string(response.Value) != "p1" {
+		t.Errorf("Get returned %q, expected the default field %q", response.Value, "p1")
+	}
+	if field := driver.secretTracker["db_password"].SecretField; field != "password" {
+		t.Errorf("tracked field = %q, expected %q", field, "password")
+	}
+
+	// Only the default field is watched for changes
+	provider.set("db", `{"password": "p1", "user": "u2"}`)
+	driver.checkForSecretChanges()
+	if docker.created != 0 {
+		t.Fatalf("rotated after a change to another field")
+	}
+	provider.set("db", `{"password": "p2", "user": "u2"}`)
+	driver.checkForSecretChanges()
+	versions := docker.secretsWithPrefix("db_password-")
+	if len(versions) != 1 || string(versions[0].Spec.Data) != "p2" {
+		t.Fatalf("expected one new version holding %q, found %v", "p2", versions)
+	}
+
+	// Requests naming a field, or all fields, keep their own choice
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   string
+	}{
+		{"field label wins", map[string]string{"fake_path": "db", "fake_field": "user"}, "u2"},
+		{"all fields", map[string]string{"fake_path": "db", "all_fields": "true"}, `{"password": "p2", "user": "u2"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := driver.withDefaultField(secrets.Request{SecretName: "other", SecretLabels: tt.labels}, provider)
+			value, err := provider.GetSecret(context.Background(), req)
+			if err != nil {
+				t.Fatalf("GetSecret failed: %v", err)
+			}
+			if string(value) != tt.want {
+				t.Errorf("GetSecret returned %q, expected %q", value, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotationExec(t *testing.T) {
+	tests := []struct {
+		name     string
+		exitCode int
+		wantLog  string
+	}{
+		{"reload succeeds", 0, "exited with code 0"},
+		{"reload fails", 1, "exited with code 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := logtest.NewGlobal()
+			t.Cleanup(func() { log.StandardLogger().ReplaceHooks(make(log.LevelHooks)) })
+
+			docker := &fakeDocker{
+				secrets: []swarm.Secret{testSecret("old", "tls_cert", map[string]string{"fake_path": "tls"})},
+				services: []swarm.Service{
+					testService("svc", "proxy", map[string]string{rotationExecLabel: "nginx -s reload"}, secretRef("old", "tls_cert")),
+				},
+				taskState:    swarm.TaskStateRunning,
+				execExitCode: tt.exitCode,
+			}
+			provider := &fakeProvider{values: map[string]string{"tls": "cert-1"}}
+			driver := newTestDriver(provider, docker)
+			driver.monitorCtx = context.Background()
+
+			if response := driver.Get(secrets.Request{SecretName: "tls_cert", SecretLabels: map[string]string{"fake_path": "tls"}}); response.Err != "" {
+				t.Fatalf("Get failed: %s", response.Err)
+			}
+			provider.set("tls", "cert-2")
+			driver.checkForSecretChanges()
+			driver.rotationExecs.Wait()
+
+			if want := []string{"svc-container sh -c nginx -s reload"}; !slices.Equal(docker.execs, want) {
+				t.Errorf("execs = %q, expected %q", docker.execs, want)
+			}
+			if _, restarted := docker.serviceNamed(t, "proxy").Spec.Labels["vault.secret.rotated"]; restarted {
+				t.Errorf("service with %s got the rotation label", rotationExecLabel)
+			}
+			logged := false
+			for _, entry := range hook.AllEntries() {
+				logged = logged || strings.Contains(entry.Message, tt.wantLog)
+			}
+			if !logged {
+				t.Errorf("no log entry reports %q", tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestRotationExecDoesNotHoldUpRotation(t *testing.T) {
+	// The task never runs, the command waits for it until cancelled
+	docker := &fakeDocker{
+		secrets: []swarm.Secret{testSecret("old", "tls_cert", map[string]string{"fake_path": "tls"})},
+		services: []swarm.Service{
+			testService("svc", "proxy", map[string]string{rotationExecLabel: "nginx -s reload"}, secretRef("old", "tls_cert")),
+		},
+		taskState: swarm.TaskStatePending,
+	}
+	provider := &fakeProvider{values: map[string]string{"tls": "cert-1"}}
+	driver := newTestDriver(provider, docker)
+	driver.config.RotationExecTimeout = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	driver.monitorCtx = ctx
+
+	if response := driver.Get(secrets.Request{SecretName: "tls_cert", SecretLabels: map[string]string{"fake_path": "tls"}}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	provider.set("tls", "cert-2")
+
+	rotated := make(chan struct{})
+	go func() {
+		driver.checkForSecretChanges()
+		close(rotated)
+	}()
+	select {
+	case <-rotated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("rotation waited for the rotation_exec command")
+	}
+
+	// Stopping the plugin ends the command still waiting for its tasks
+	cancel()
+	driver.rotationExecs.Wait()
+	if len(docker.execs) != 0 {
+		t.Errorf("execs = %q, expected none without a running task", docker.execs)
+	}
+}
+
+func TestChangeDetectedUntilRotated(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:   []swarm.Secret{testSecret("old", "db_password", map[string]string{"fake_path": "db"})},
+		services:  []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+		updateErr: errors.New("update out of sequence"),
+	}
+	provider := &fakeProvider{values: map[string]string{"db": "first"}}
+	driver := newTestDriver(provider, docker)
+
+	if response := driver.Get(secrets.Request{SecretName: "db_password", SecretLabels: map[string]string{"fake_path": "db"}}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	if detected := driver.secretStatuses()[0].ChangeDetectedAt; !detected.IsZero() {
+		t.Fatalf("unchanged secret reports a change detected at %v", detected)
+	}
+
+	provider.set("db", "second")
+	driver.checkForSecretChanges()
+	detected := driver.secretStatuses()[0].ChangeDetectedAt
+	if detected.IsZero() {
+		t.Fatalf("failed rotation does not report the detected change")
+	}
+
+	// A second failed attempt keeps the time the change was first seen
+	driver.checkForSecretChanges()
+	if again := driver.secretStatuses()[0].ChangeDetectedAt; !again.Equal(detected) {
+		t.Errorf("change detected at moved from %v to %v", detected, again)
+	}
+
+	docker.mutex.Lock()
+	docker.updateErr = nil
+	docker.mutex.Unlock()
+	driver.checkForSecretChanges()
+	if pending := driver.secretStatuses()[0].ChangeDetectedAt; !pending.IsZero() {
+		t.Errorf("rotated secret still reports a change detected at %v", pending)
+	}
+}
+
+func TestEvictSecret(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", map[string]string{"fake_path": "db"})},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	provider := &fakeProvider{values: map[string]string{"db": "first", "api": "key"}}
+	driver := newTestDriver(provider, docker)
+	driver.staleValues = newStaleCache(0, 0, time.Hour)
+
+	for _, req := range []secrets.Request{
+		{SecretName: "db_password", SecretLabels: map[string]string{"fake_path": "db"}},
+		{SecretName: "api_key", SecretLabels: map[string]string{"fake_path": "api"}},
+	} {
+		if response := driver.Get(req); response.Err != "" {
+			t.Fatalf("Get failed: %s", response.Err)
+		}
+	}
+
+	if !driver.evictSecret("db_password") {
+		t.Fatalf("evictSecret() = false for a tracked secret")
+	}
+	if _, tracked := driver.secretTracker["db_password"]; tracked {
+		t.Errorf("db_password is still tracked")
+	}
+	if _, cached := driver.staleValues.load(secrets.Request{SecretName: "db_password", SecretLabels: map[string]string{"fake_path": "db"}}); cached {
+		t.Errorf("db_password is still cached")
+	}
+	if _, tracked := driver.secretTracker["api_key"]; !tracked {
+		t.Errorf("evicting db_password dropped api_key")
+	}
+	if driver.evictSecret("db_password") {
+		t.Errorf("evictSecret() = true for a secret already evicted")
+	}
+
+	// An evicted secret is no longer rotated
+	provider.set("db", "second")
+	driver.checkForSecretChanges()
+	if docker.created != 0 {
+		t.Errorf("rotated an evicted secret")
+	}
+}
+
+func TestEnvSelect(t *testing.T) {
+	const perEnv = `{"prod": "prod-password", "staging": "staging-password"}`
+	tests := []struct {
+		name      string
+		deployEnv string
+		labels    map[string]string
+		want      string
+		wantErr   string
+	}{
+		{"prod", "prod", map[string]string{"env_select": "true"}, "prod-password", ""},
+		{"staging", "staging", map[string]string{"env_select": "true"}, "staging-password", ""},
+		{"env key absent", "dev", map[string]string{"env_select": "true"}, "", "field dev not found"},
+		{"DEPLOY_ENV unset", "", map[string]string{"env_select": "true"}, "", "requires DEPLOY_ENV"},
+		{"with a field label", "prod", map[string]string{"env_select": "true", "fake_field": "staging"}, "", "cannot be combined with fake_field"},
+		{"with all_fields", "prod", map[string]string{"env_select": "true", "all_fields": "true"}, "", "cannot be combined with all_fields"},
+		{"not selected", "prod", map[string]string{}, perEnv, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fieldProvider{&fakeProvider{values: map[string]string{"db": perEnv}}}
+			driver := newTestDriver(provider, &fakeDocker{})
+			driver.config.DeployEnv = tt.deployEnv
+			labels := map[string]string{"fake_path": "db"}
+			for key, value := range tt.labels {
+				labels[key] = value
+			}
+
+			response := driver.Get(secrets.Request{SecretName: "db_password", SecretLabels: labels})
+			if tt.wantErr != "" {
+				if !strings.Contains(response.Err, tt.wantErr) {
+					t.Errorf("Get() error = %q, expected it to contain %q", response.Err, tt.wantErr)
+				}
+				return
+			}
+			if response.Err != "" {
+				t.Fatalf("Get failed: %s", response.Err)
+			}
+			if string(response.Value) != tt.want {
+				t.Errorf("Get() = %q, expected %q", response.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvSelectRotatesOnItsOwnKey(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", map[string]string{"fake_path": "db", "env_select": "true"})},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	provider := &fieldProvider{&fakeProvider{values: map[string]string{"db": `{"prod": "p1", "staging": "s1"}`}}}
+	driver := newTestDriver(provider, docker)
+	driver.config.DeployEnv = "prod"
+
+	if response := driver.Get(secrets.Request{SecretName: "db_password", SecretLabels: map[string]string{"fake_path": "db", "env_select": "true"}}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+
+	provider.set("db", `{"prod": "p1", "staging": "s2"}`)
+	driver.checkForSecretChanges()
+	if docker.created != 0 {
+		t.Fatalf("rotated after another environment changed")
+	}
+
+	provider.set("db", `{"prod": "p2", "staging": "s2"}`)
+	driver.checkForSecretChanges()
+	versions := docker.secretsWithPrefix("db_password-")
+	if len(versions) != 1 || string(versions[0].Spec.Data) != "p2" {
+		t.Fatalf("expected one new version holding %q, found %v", "p2", versions)
+	}
+}
+
+func TestSameNameServedByTwoProviders(t *testing.T) {
+	aliased := map[string]string{providerAliasLabel: "vault-b", "fake_path": "db"}
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", map[string]string{"fake_path": "db"})},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	primary := &fakeProvider{values: map[string]string{"db": "primary"}}
+	backend := &fakeProvider{values: map[string]string{"db": "aliased"}}
+	driver := newTestDriver(primary, docker)
+	driver.monitor = monitoring.NewMonitor(time.Minute)
+	driver.aliasProviders = map[string]*aliasProvider{
+		"vault-b": {alias: providerAlias{name: "vault-b"}, provider: backend, ready: true},
+	}
+
+	if response := driver.Get(secrets.Request{SecretName: "db_password", ServiceName: "api", SecretLabels: map[string]string{"fake_path": "db"}}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	// The secret is removed and created again with the same name for the alias
+	response := driver.Get(secrets.Request{SecretName: "db_password", ServiceName: "api", SecretLabels: aliased})
+	if response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	if string(response.Value) != "aliased" {
+		t.Fatalf("Get returned %q, expected %q", response.Value, "aliased")
+	}
+	docker.secrets[0].Spec.Labels = aliased
+
+	secretInfo := driver.secretTracker["db_password"]
+	if secretInfo.Provider != "vault-b" {
+		t.Errorf("db_password tracked for provider %q, expected %q", secretInfo.Provider, "vault-b")
+	}
+	if collisions := driver.monitor.GetMetrics().ProviderCollisions; collisions != 1 {
+		t.Errorf("provider collisions = %d, expected 1", collisions)
+	}
+
+	// A change on the provider that no longer serves the name is not rotated
+	primary.set("db", "primary-2")
+	driver.checkForSecretChanges()
+	if versions := docker.secretsWithPrefix("db_password-"); len(versions) != 0 {
+		t.Fatalf("rotated %d versions from the replaced provider", len(versions))
+	}
+
+	backend.set("db", "aliased-2")
+	driver.checkForSecretChanges()
+	versions := docker.secretsWithPrefix("db_password-")
+	if len(versions) != 1 || string(versions[0].Spec.Data) != "aliased-2" {
+		t.Fatalf("expected one version holding %q, found %d", "aliased-2", len(versions))
+	}
+}
+
+func TestRotationKeepsSecretTargets(t *testing.T) {
+	target := &swarm.SecretReference{
+		SecretID:   "old",
+		SecretName: "db_password",
+		File:       &swarm.SecretReferenceFileTarget{Name: "postgres/password.txt", UID: "999", GID: "998", Mode: 0400},
+	}
+	docker := &fakeDocker{
+		secrets: []swarm.Secret{testSecret("old", "db_password", nil)},
+		services: []swarm.Service{
+			testService("svc-api", "api", nil, target),
+			testService("svc-worker", "worker", nil, secretRef("old", "db_password")),
+		},
+	}
+	driver := newTestDriver(&fakeProvider{values: map[string]string{}}, docker)
+
+	if err := driver.updateDockerSecret("db_password", []byte("second")); err != nil {
+		t.Fatalf("updateDockerSecret() error = %v", err)
+	}
+
+	tests := []struct {
+		service string
+		want    swarm.SecretReferenceFileTarget
+	}{
+		{"api", *target.File},
+		{"worker", *secretRef("old", "db_password").File},
+	}
+	for _, tt := range tests {
+		refs := docker.serviceNamed(t, tt.service).Spec.TaskTemplate.ContainerSpec.Secrets
+		if len(refs) != 1 || refs[0].SecretID == "old" {
+			t.Fatalf("%s still references the old version: %+v", tt.service, refs)
+		}
+		if refs[0].File == nil || *refs[0].File != tt.want {
+			t.Errorf("%s secret target = %+v, expected %+v", tt.service, refs[0].File, tt.want)
+		}
+	}
+}
+
+func TestRetrackPicksUpChangedLabels(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", map[string]string{"fake_path": "db", "fake_field": "user"})},
+		services: []swarm.Service{testService("svc", "api", map[string]string{}, secretRef("old", "db_password"))},
+	}
+	driver := newTestDriver(&fakeProvider{values: map[string]string{"db": "first", "db2": "first"}}, docker)
+	driver.monitorCtx = context.Background()
+
+	response := driver.Get(secrets.Request{
+		SecretName:   "db_password",
+		ServiceName:  "api",
+		SecretLabels: map[string]string{"fake_path": "db", "fake_field": "user"},
+	})
+	if response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	if changed, err := driver.retrackSecret("db_password"); err != nil || changed {
+		t.Fatalf("retrackSecret() = %v, %v with unchanged labels", changed, err)
+	}
+
+	docker.secrets[0].Spec.Labels["fake_field"] = "password"
+	docker.secrets[0].Spec.Labels["fake_path"] = "db2"
+	changed, err := driver.retrackSecret("db_password")
+	if err != nil {
+		t.Fatalf("retrackSecret() error = %v", err)
+	}
+	if !changed {
+		t.Errorf("retrackSecret() did not report the changed labels")
+	}
+	secretInfo := driver.secretTracker["db_password"]
+	if secretInfo.SecretField != "password" || secretInfo.SecretPath != "db2" {
+		t.Errorf("tracking %s field %s, expected db2 field password", secretInfo.SecretPath, secretInfo.SecretField)
+	}
+
+	// A service supplying labels of the secret stops its rotation
+	docker.services[0].Spec.Labels["secrets.db_password.content_type"] = "text/plain"
+	if changed, err := driver.retrackSecret("db_password"); err != nil || !changed {
+		t.Fatalf("retrackSecret() = %v, %v after the service scoped a label", changed, err)
+	}
+	if _, tracked := driver.secretTracker["db_password"]; tracked {
+		t.Errorf("secret with labels from its service is still tracked")
+	}
+}
+
+func TestIsSecretVersion(t *testing.T) {
+	lineage := func(from string) map[string]string {
+		return map[string]string{rotatedFromLabel: from}
+	}
+	tests := []struct {
+		name   string
+		secret string
+		labels map[string]string
+		want   bool
+	}{
+		{"first version", "db_password-1760000000000000000", lineage("db_password"), true},
+		{"later version", "db_password-1760000000000000001", lineage("db_password-1760000000000000000"), true},
+		{"without lineage label", "db_password-1760000000000000000", nil, false},
+		{"lineage of another secret", "db_password-1760000000000000000", lineage("other"), false},
+		{"user secret with a year", "db_password-2024", lineage("db_password"), false},
+		{"twenty digits", "db_password-17600000000000000000", lineage("db_password"), false},
+		{"letters in suffix", "db_password-176000000000000000a", lineage("db_password"), false},
+		{"the secret itself", "db_password", lineage("db_password"), false},
+		{"other secret with the prefix", "db_password_old-1760000000000000000", lineage("db_password_old"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := testSecret("id", tt.secret, tt.labels)
+			if got := isSecretVersion("db_password", secret); got != tt.want {
+				t.Errorf("isSecretVersion(db_password, %s) = %v, expected %v", tt.secret, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotationServiceLabel(t *testing.T) {
+	tests := []struct {
+		name         string
+		serviceLabel string
+		wantFilter   []string
+		wantUpdated  map[string]bool
+	}{
+		{
+			name:        "all services without a label",
+			wantUpdated: map[string]bool{"api": true, "worker": true},
+		},
+		{
+			name:         "only labeled services",
+			serviceLabel: "secrets.rotate=true",
+			wantFilter:   []string{"secrets.rotate=true"},
+			wantUpdated:  map[string]bool{"api": true, "worker": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := &fakeDocker{
+				secrets: []swarm.Secret{testSecret("old", "db_password", nil)},
+				services: []swarm.Service{
+					testService("svc-api", "api", map[string]string{"secrets.rotate": "true"}, secretRef("old", "db_password")),
+					// Never requested the secret itself, e.g. deployed after it was tracked
+					testService("svc-worker", "worker", nil, secretRef("old", "db_password")),
+				},
+			}
+			driver := newTestDriver(&fakeProvider{}, docker)
+			driver.config.RotationServiceLabel = tt.serviceLabel
+
+			if err := driver.updateDockerSecret("db_password", []byte("second")); err != nil {
+				t.Fatalf("updateDockerSecret failed: %v", err)
+			}
+
+			if len(docker.serviceLists) == 0 {
+				t.Fatal("services were never listed")
+			}
+			if got := docker.serviceLists[0].Filters.Get("label"); !slices.Equal(got, tt.wantFilter) {
+				t.Errorf("services listed with label filter %v, expected %v", got, tt.wantFilter)
+			}
+			if names := docker.serviceLists[0].Filters.Get("name"); len(names) > 0 {
+				t.Errorf("services listed by name %v", names)
+			}
+
+			for name, wantUpdated := range tt.wantUpdated {
+				ref := docker.serviceNamed(t, name).Spec.TaskTemplate.ContainerSpec.Secrets[0]
+				if updated := ref.SecretID != "old"; updated != wantUpdated {
+					t.Errorf("service %s updated = %v, expected %v", name, updated, wantUpdated)
+				}
+			}
+		})
+	}
+}
+
+func TestOldVersionKeptWhileReferenced(t *testing.T) {
+	docker := &fakeDocker{
+		secrets: []swarm.Secret{testSecret("old", "db_password", nil)},
+		services: []swarm.Service{
+			testService("svc-api", "api", map[string]string{"secrets.rotate": "true"}, secretRef("old", "db_password")),
+			// Outside ROTATION_SERVICE_LABEL, so it stays on the old version
+			testService("svc-worker", "worker", nil, secretRef("old", "db_password")),
+		},
+	}
+	driver := newTestDriver(&fakeProvider{}, docker)
+	driver.config.RotationServiceLabel = "secrets.rotate=true"
+
+	if err := driver.updateDockerSecret("db_password", []byte("second")); err != nil {
+		t.Fatalf("updateDockerSecret failed: %v", err)
+	}
+
+	if _, exists := docker.secretNamed("db_password"); !exists {
+		t.Fatal("old version was removed while worker still references it")
+	}
+	if len(docker.removed) > 0 {
+		t.Errorf("secrets removed: %v", docker.removed)
+	}
+
+	// The check before removal must not reuse the narrowed listing
+	last := docker.serviceLists[len(docker.serviceLists)-1]
+	if last.Filters.Len() != 0 {
+		t.Errorf("services checked before removal with filters %v, expected all services", last.Filters)
+	}
+}
+
+func TestRemovableVersions(t *testing.T) {
+	version := func(id, name, from string) swarm.Secret {
+		labels := map[string]string{providerLabel: "fake"}
+		if from != "" {
+			labels[rotatedFromLabel] = from
+		}
+		return testSecret(id, name, labels)
+	}
+	tests := []struct {
+		name     string
+		versions []swarm.Secret
+		want     []string
+	}{
+		{
+			name:     "secret and its versions",
+			versions: []swarm.Secret{testSecret("base", "db_password", nil), version("v1", "db_password-1760000000000000000", "db_password")},
+			want:     []string{"base", "v1"},
+		},
+		{
+			name:     "user secret named like a version",
+			versions: []swarm.Secret{testSecret("user", "db_password-1760000000000000000", nil)},
+		},
+		{
+			name:     "version of another lineage",
+			versions: []swarm.Secret{version("other", "db_password-1760000000000000000", "cache_password")},
+		},
+		{
+			name:     "lineage label without provider label",
+			versions: []swarm.Secret{testSecret("copied", "db_password-1760000000000000000", map[string]string{rotatedFromLabel: "db_password"})},
+		},
+		{
+			name:     "new version is kept",
+			versions: []swarm.Secret{version("new", "db_password-1760000000000000001", "db_password-1760000000000000000")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, removable := range removableVersions("db_password", tt.versions, "new") {
+				got = append(got, removable.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("removableVersions() = %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlueGreenRotation(t *testing.T) {
+	docker := &fakeDocker{
+		secrets: []swarm.Secret{
+			testSecret("old", "db_password", nil),
+			testSecret("user", "db_password-2024", nil),
+		},
+		services: []swarm.Service{
+			testService("svc-green", "api-green", map[string]string{"rotation_group": "green"}, secretRef("old", "db_password")),
+			testService("svc-blue", "api-blue", map[string]string{"rotation_group": "blue"}, secretRef("old", "db_password")),
+		},
+	}
+	driver := newTestDriver(&fakeProvider{}, docker)
+	driver.config.RotationActiveGroup = "green"
+
+	if err := driver.updateDockerSecret("db_password", []byte("second")); err != nil {
+		t.Fatalf("updateDockerSecret failed: %v", err)
+	}
+
+	if ref := docker.serviceNamed(t, "api-green").Spec.TaskTemplate.ContainerSpec.Secrets[0]; ref.SecretID == "old" {
+		t.Error("service of the active group was not moved to the new version")
+	}
+	if ref := docker.serviceNamed(t, "api-blue").Spec.TaskTemplate.ContainerSpec.Secrets[0]; ref.SecretID != "old" {
+		t.Errorf("service of the inactive group moved to %s", ref.SecretName)
+	}
+	if len(docker.removed) > 0 {
+		t.Errorf("secrets removed while blue still uses the old version: %v", docker.removed)
+	}
+
+	// Once blue is active and rotated too, the old version goes but the
+	// user's own secret stays
+	driver.config.RotationActiveGroup = "blue"
+	if err := driver.updateDockerSecret("db_password", []byte("third")); err != nil {
+		t.Fatalf("updateDockerSecret failed: %v", err)
+	}
+	if _, exists := docker.secretNamed("db_password"); exists {
+		t.Error("old version was not removed after the groups converged")
+	}
+	if _, exists := docker.secretNamed("db_password-2024"); !exists {
+		t.Error("unrelated secret db_password-2024 was removed")
+	}
+	if remaining := docker.secretsWithPrefix("db_password-"); len(remaining) < 2 {
+		t.Errorf("expected the user secret and at least one version to remain, found %d secrets", len(remaining))
+	}
+}
+
+func TestStackServicesMatchedByID(t *testing.T) {
+	shared := secretRef("old", "db_password")
+	// docker stack deploy names the external secret after the stack
+	shared.SecretName = "shop_db_password"
+
+	docker := &fakeDocker{
+		secrets: []swarm.Secret{
+			testSecret("old", "db_password", nil),
+			testSecret("billing", "billing_db_password", nil),
+		},
+		services: []swarm.Service{
+			testService("svc-shop", "shop_api", map[string]string{"com.docker.stack.namespace": "shop"}, shared),
+			testService("svc-billing", "billing_api", map[string]string{"com.docker.stack.namespace": "billing"}, secretRef("billing", "billing_db_password")),
+		},
+	}
+	driver := newTestDriver(&fakeProvider{}, docker)
+
+	if err := driver.updateDockerSecret("db_password", []byte("second")); err != nil {
+		t.Fatalf("updateDockerSecret failed: %v", err)
+	}
+
+	tests := []struct {
+		service string
+		wantID  string
+	}{
+		{"shop_api", ""},
+		{"billing_api", "billing"},
+	}
+	for _, tt := range tests {
+		ref := docker.serviceNamed(t, tt.service).Spec.TaskTemplate.ContainerSpec.Secrets[0]
+		if tt.wantID == "" {
+			if ref.SecretID == "old" {
+				t.Errorf("service %s was not moved to the new version", tt.service)
+			}
+			continue
+		}
+		if ref.SecretID != tt.wantID {
+			t.Errorf("service %s moved from %s to %s", tt.service, tt.wantID, ref.SecretName)
+		}
+	}
+	if _, exists := docker.secretNamed("billing_db_password"); !exists {
+		t.Error("secret of another stack was removed")
+	}
+}
+
+func TestChecksumLabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		hmacKey string
+		want    string
+	}{
+		{
+			name:   "plain sha-256 of the delivered value",
+			labels: map[string]string{"emit_checksum": "true"},
+			want:   "16367aacb67a4a017c8da8ab95682ccb390863780f7114dda0a0e0c55644c7c4",
+		},
+		{
+			name:    "not keyed with CHANGE_HASH_HMAC_KEY",
+			labels:  map[string]string{"emit_checksum": "true"},
+			hmacKey: "change-key",
+			want:    "16367aacb67a4a017c8da8ab95682ccb390863780f7114dda0a0e0c55644c7c4",
+		},
+		{
+			name:   "only with emit_checksum",
+			labels: map[string]string{},
+		},
+		{
+			name:   "stale label is dropped",
+			labels: map[string]string{checksumLabel: "outdated"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			providers.SetChangeHashKey(tt.hmacKey)
+			defer providers.SetChangeHashKey("")
+
+			docker := &fakeDocker{secrets: []swarm.Secret{testSecret("old", "db_password", tt.labels)}}
+			driver := newTestDriver(&fakeProvider{}, docker)
+			if err := driver.updateDockerSecret("db_password", []byte("second")); err != nil {
+				t.Fatalf("updateDockerSecret failed: %v", err)
+			}
+
+			versions := docker.secretsWithPrefix("db_password-")
+			if len(versions) != 1 {
+				t.Fatalf("expected one new version, found %d", len(versions))
+			}
+			checksum, exists := versions[0].Spec.Labels[checksumLabel]
+			if tt.want == "" {
+				if exists {
+					t.Errorf("unexpected %s=%s", checksumLabel, checksum)
+				}
+				return
+			}
+			if checksum != tt.want {
+				t.Errorf("%s = %s, expected %s", checksumLabel, checksum, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilSecretLabels(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", nil)},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	provider := &fakeProvider{values: map[string]string{"db_password": "first"}}
+	driver := newTestDriver(provider, docker)
+
+	// Docker omits the labels of secrets created without any
+	response := driver.Get(secrets.Request{SecretName: "db_password", ServiceName: "api"})
+	if response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	if string(response.Value) != "first" {
+		t.Fatalf("Get returned %q, expected %q", response.Value, "first")
+	}
+	if _, tracked := driver.secretTracker["db_password"]; !tracked {
+		t.Fatalf("db_password was not tracked")
+	}
+
+	// Tracker state written by older versions has no labels either
+	driver.secretTracker["db_password"].Labels = nil
+	provider.set("db_password", "second")
+	driver.checkForSecretChanges()
+
+	versions := docker.secretsWithPrefix("db_password-")
+	if len(versions) != 1 {
+		t.Fatalf("expected one new version, found %d", len(versions))
+	}
+	if string(versions[0].Spec.Data) != "second" {
+		t.Errorf("new version holds %q, expected %q", versions[0].Spec.Data, "second")
+	}
+	if from := versions[0].Spec.Labels[rotatedFromLabel]; from != "db_password" {
+		t.Errorf("new version has %s=%q, expected %q", rotatedFromLabel, from, "db_password")
+	}
+}
+
+func TestSecretsRotateWithTheirOwnProvider(t *testing.T) {
+	settings := map[string]string{"VAULT_ADDR": "https://vault-b.internal:8200"}
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		instance string
+	}{
+		{"alias", map[string]string{providerAliasLabel: "vault-b", "fake_path": "db"}, "vault-b"},
+		{"label provider", map[string]string{
+			providerTypeLabel:                   "vault",
+			providerSettingLabel + "VAULT_ADDR": "https://vault-b.internal:8200",
+			"fake_path":                         "db",
+		}, labelProviderName("vault", labelProviderKey("vault", settings))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := &fakeDocker{
+				secrets:  []swarm.Secret{testSecret("old", "db_password", tt.labels)},
+				services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+			}
+			// The plugin's own provider does not hold the secret
+			backend := &fakeProvider{values: map[string]string{"db": "first"}}
+			driver := newTestDriver(&fakeProvider{values: map[string]string{}}, docker)
+			driver.config.AllowLabelProviders = true
+			driver.aliasProviders = map[string]*aliasProvider{
+				"vault-b": {alias: providerAlias{name: "vault-b"}, provider: backend, ready: true},
+			}
+			driver.labelProviders[labelProviderKey("vault", settings)] = backend
+
+			response := driver.Get(secrets.Request{SecretName: "db_password", ServiceName: "api", SecretLabels: tt.labels})
+			if response.Err != "" {
+				t.Fatalf("Get failed: %s", response.Err)
+			}
+			secretInfo, tracked := driver.secretTracker["db_password"]
+			if !tracked {
+				t.Fatalf("db_password was not tracked")
+			}
+			if secretInfo.Provider != tt.instance {
+				t.Errorf("db_password tracked for provider %q, expected %q", secretInfo.Provider, tt.instance)
+			}
+
+			backend.set("db", "second")
+			driver.checkForSecretChanges()
+
+			versions := docker.secretsWithPrefix("db_password-")
+			if len(versions) != 1 {
+				t.Fatalf("expected one new version, found %d", len(versions))
+			}
+			if string(versions[0].Spec.Data) != "second" {
+				t.Errorf("new version holds %q, expected %q", versions[0].Spec.Data, "second")
+			}
+			if got := versions[0].Spec.Labels[providerLabel]; got != tt.instance {
+				t.Errorf("new version has %s=%q, expected %q", providerLabel, got, tt.instance)
+			}
+		})
+	}
+}
+
+// fakeAuthProvider reports logins like the Vault and OpenBao providers
+type fakeAuthProvider struct {
+	fakeProvider
+	stats providers.AuthStats
+}
+
+func (p *fakeAuthProvider) AuthStats() providers.AuthStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.stats
+}
+
+func TestProviderAuthReadAtScrape(t *testing.T) {
+	provider := &fakeAuthProvider{stats: providers.AuthStats{Successes: 1}}
+	driver := newTestDriver(provider, &fakeDocker{})
+	driver.monitor = monitoring.NewMonitor(time.Minute)
+	driver.monitor.SetAuthSource(driver.providerAuth)
+
+	if auth := driver.monitor.GetMetrics().ProviderAuth["fake"]; auth.Successes != 1 || auth.Failures != 0 {
+		t.Fatalf("startup auth = %+v, expected one success", auth)
+	}
+
+	// A renewal and a failed login after startup show up on the next scrape
+	provider.mutex.Lock()
+	provider.stats.Successes++
+	provider.stats.Failures++
+	provider.mutex.Unlock()
+	if auth := driver.monitor.GetMetrics().ProviderAuth["fake"]; auth.Successes != 2 || auth.Failures != 1 {
+		t.Errorf("auth = %+v, expected two successes and one failure", auth)
+	}
+}
+
+func TestProviderReadsCountedPerInstance(t *testing.T) {
+	docker := &fakeDocker{}
+	driver := newTestDriver(&fakeProvider{values: map[string]string{"db": "default"}}, docker)
+	driver.config.EnableRotation = false
+	driver.monitor = monitoring.NewMonitor(time.Minute)
+	// The alias is the same provider type as the plugin's own
+	driver.aliasProviders = map[string]*aliasProvider{
+		"vault-b": {alias: providerAlias{name: "vault-b"}, provider: &fakeProvider{values: map[string]string{"db": "aliased"}}, ready: true},
+	}
+
+	reads := []map[string]string{
+		{"fake_path": "db"},
+		{"fake_path": "db"},
+		{providerAliasLabel: "vault-b", "fake_path": "db"},
+	}
+	for _, labels := range reads {
+		if response := driver.Get(secrets.Request{SecretName: "db_password", SecretLabels: labels}); response.Err != "" {
+			t.Fatalf("Get failed: %s", response.Err)
+		}
+	}
+
+	got := driver.monitor.GetMetrics().ProviderReads
+	want := map[string]int64{"fake": 2, "vault-b": 1}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("provider reads = %v, expected %v", got, want)
+	}
+}
+
+func TestRotationSkipsServicesWithoutContainers(t *testing.T) {
+	plugin := testService("plugin", "network-plugin", nil)
+	plugin.Spec.TaskTemplate.ContainerSpec = nil
+	plugin.Spec.TaskTemplate.PluginSpec = &runtime.PluginSpec{Name: "network-plugin"}
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", nil)},
+		services: []swarm.Service{plugin, testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	driver := newTestDriver(&fakeProvider{values: map[string]string{}}, docker)
+
+	if err := driver.updateDockerSecret("db_password", []byte("second")); err != nil {
+		t.Fatalf("updateDockerSecret() error = %v", err)
+	}
+	refs := docker.serviceNamed(t, "api").Spec.TaskTemplate.ContainerSpec.Secrets
+	if len(refs) != 1 || refs[0].SecretID == "old" {
+		t.Errorf("api still references the old version: %+v", refs)
+	}
+}
+
+// deadlineProvider is a fakeProvider that records how long each call had left
+type deadlineProvider struct {
+	*fakeProvider
+	checkBudget, readBudget time.Duration
+}
+
+func (p *deadlineProvider) GetSecret(ctx context.Context, req secrets.Request) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		p.readBudget = time.Until(deadline)
+	}
+	return p.fakeProvider.GetSecret(ctx, req)
+}
+
+func (p *deadlineProvider) CheckSecretChanged(ctx context.Context, secretInfo *providers.SecretInfo) (bool, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		p.checkBudget = time.Until(deadline)
+	}
+	return p.fakeProvider.CheckSecretChanged(ctx, secretInfo)
+}
+
+func TestMonitorTimeouts(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", nil)},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	provider := &deadlineProvider{fakeProvider: &fakeProvider{values: map[string]string{"db_password": "first"}}}
+	driver := newTestDriver(provider, docker)
+	driver.config.ChangeCheckTimeout = 2 * time.Second
+	driver.config.RequestTimeout = time.Hour
+
+	if response := driver.Get(secrets.Request{SecretName: "db_password", ServiceName: "api"}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	provider.set("db_password", "second")
+	driver.checkForSecretChanges()
+
+	tests := []struct {
+		call   string
+		budget time.Duration
+		want   time.Duration
+	}{
+		{"change check", provider.checkBudget, driver.config.ChangeCheckTimeout},
+		{"rotation read", provider.readBudget, driver.config.RequestTimeout},
+		{"secret create", docker.createBudget, driver.config.RequestTimeout},
+	}
+	for _, tt := range tests {
+		if tt.budget <= 0 || tt.budget > tt.want || tt.budget < tt.want-time.Second {
+			t.Errorf("%s had %v left, expected close to %v", tt.call, tt.budget, tt.want)
+		}
+	}
+}
+
+func TestRotationCountsDockerAPICalls(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", nil)},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	driver := newTestDriver(&fakeProvider{values: map[string]string{}}, docker)
+	driver.monitor = monitoring.NewMonitor(time.Minute)
+
+	if err := driver.updateDockerSecret("db_password", []byte("second")); err != nil {
+		t.Fatalf("updateDockerSecret() error = %v", err)
+	}
+	metrics := driver.monitor.GetMetrics()
+	for _, op := range []string{"SecretList", "SecretCreate", "ServiceList", "ServiceUpdate"} {
+		if metrics.DockerAPICalls[op] == 0 {
+			t.Errorf("no %s calls counted: %v", op, metrics.DockerAPICalls)
+		}
+	}
+	if len(metrics.DockerAPIErrors) != 0 {
+		t.Errorf("errors counted for a clean rotation: %v", metrics.DockerAPIErrors)
+	}
+
+	updates := metrics.DockerAPICalls["ServiceUpdate"]
+	docker.updateErr = errors.New("update rejected")
+	driver.updateDockerSecret("db_password", []byte("third"))
+	metrics = driver.monitor.GetMetrics()
+	if metrics.DockerAPICalls["ServiceUpdate"] <= updates {
+		t.Errorf("failed ServiceUpdate was not counted as a call")
+	}
+	if metrics.DockerAPIErrors["ServiceUpdate"] == 0 {
+		t.Errorf("failed ServiceUpdate was not counted as an error: %v", metrics.DockerAPIErrors)
+	}
+}
+
+func TestStartupCanary(t *testing.T) {
+	provider := &fakeProvider{values: map[string]string{"canary": "alive", "empty": ""}}
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{"value read back", "canary", false},
+		{"empty value", "empty", true},
+		{"missing secret", "missing", true},
+		{"no canary path", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runStartupCanary(provider, map[string]string{"STARTUP_CANARY_PATH": tt.path})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("runStartupCanary() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// flakyProvider fails to initialize with err until failures attempts were made
+type flakyProvider struct {
+	*fakeProvider
+	failures, attempts int
+	err                error
+}
+
+func (p *flakyProvider) Initialize(config map[string]string) error {
+	p.attempts++
+	if p.attempts <= p.failures {
+		return p.err
+	}
+	return nil
+}
+
+func TestInitializeProviderRetries(t *testing.T) {
+	transient := errors.New("connection refused")
+	permanent := &providers.ConfigError{Err: errors.New("VAULT_TOKEN is required")}
+	tests := []struct {
+		name         string
+		failures     int
+		err          error
+		wantErr      bool
+		wantAttempts int
+	}{
+		{"first attempt", 0, transient, false, 1},
+		{"transient failure recovers", 2, transient, false, 3},
+		{"retries exhausted", 5, transient, true, 4},
+		{"configuration error fails fast", 5, permanent, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &flakyProvider{fakeProvider: &fakeProvider{}, failures: tt.failures, err: tt.err}
+			err := initializeProvider(provider, map[string]string{}, 3, time.Millisecond)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("initializeProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if provider.attempts != tt.wantAttempts {
+				t.Errorf("Initialize called %d times, expected %d", provider.attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestShouldNotReusePrecedence(t *testing.T) {
+	tests := []struct {
+		name          string
+		disable       bool
+		allowOverride bool
+		secretName    string
+		labels        map[string]string
+		want          bool
+	}{
+		{"default", false, false, "db_password", nil, false},
+		{"dynamic name", false, false, "api_token", nil, true},
+		{"label forbids reuse", false, false, "db_password", map[string]string{"vault_reuse": "false"}, true},
+		{"label allows reuse of dynamic name", false, false, "api_token", map[string]string{"vault_reuse": "true"}, false},
+		{"disabled overrides dynamic name", true, false, "api_token", nil, false},
+		{"disabled overrides label", true, false, "db_password", map[string]string{"vault_reuse": "false"}, false},
+		{"label honored when overriding is allowed", true, true, "db_password", map[string]string{"vault_reuse": "false"}, true},
+		{"no heuristics when overriding is allowed", true, true, "api_token", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := newTestDriver(&fakeProvider{}, &fakeDocker{})
+			driver.config.DisableDoNotReuse = tt.disable
+			driver.config.AllowReuseOverride = tt.allowOverride
+
+			got := driver.shouldNotReuse(secrets.Request{SecretName: tt.secretName, SecretLabels: tt.labels})
+			if got != tt.want {
+				t.Errorf("shouldNotReuse() = %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// stampedProvider is a fakeProvider reporting backend change times in one
+// batch, its next failures body reads fail
+type stampedProvider struct {
+	*fakeProvider
+	stamps   map[string]time.Time
+	checks   int
+	failures int
+}
+
+func (p *stampedProvider) ChangeTimestamps(ctx context.Context, paths []string) (map[string]time.Time, error) {
+	return p.stamps, nil
+}
+
+func (p *stampedProvider) CheckSecretChanged(ctx context.Context, secretInfo *providers.SecretInfo) (bool, error) {
+	p.checks++
+	if p.failures > 0 {
+		p.failures--
+		return false, errors.New("connection reset")
+	}
+	return p.fakeProvider.CheckSecretChanged(ctx, secretInfo)
+}
+
+func TestBatchChangeTimestamps(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", nil)},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	changedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	provider := &stampedProvider{
+		fakeProvider: &fakeProvider{values: map[string]string{"db_password": "first"}},
+		stamps:       map[string]time.Time{"db_password": changedAt},
+	}
+	driver := newTestDriver(provider, docker)
+	if response := driver.Get(secrets.Request{SecretName: "db_password", ServiceName: "api"}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+
+	steps := []struct {
+		name       string
+		value      string
+		stamp      time.Time
+		wantChecks int
+		wantRotate int
+	}{
+		// Without a stored change time the body is compared once
+		{"first check", "first", changedAt, 1, 0},
+		{"change time unchanged", "first", changedAt, 1, 0},
+		{"change time advanced", "second", changedAt.Add(time.Hour), 2, 1},
+		{"rotated change time stored", "second", changedAt.Add(time.Hour), 2, 1},
+	}
+	for _, step := range steps {
+		provider.set("db_password", step.value)
+		provider.stamps["db_password"] = step.stamp
+		driver.checkForSecretChanges()
+
+		if provider.checks != step.wantChecks {
+			t.Errorf("%s: %d body reads, expected %d", step.name, provider.checks, step.wantChecks)
+		}
+		if versions := docker.secretsWithPrefix("db_password-"); len(versions) != step.wantRotate {
+			t.Errorf("%s: %d rotations, expected %d", step.name, len(versions), step.wantRotate)
+		}
+	}
+}
+
+func TestFailedReadKeepsChangeTime(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", nil)},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	changedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	provider := &stampedProvider{
+		fakeProvider: &fakeProvider{values: map[string]string{"db_password": "first"}},
+		stamps:       map[string]time.Time{"db_password": changedAt},
+	}
+	driver := newTestDriver(provider, docker)
+	if response := driver.Get(secrets.Request{SecretName: "db_password", ServiceName: "api"}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	driver.checkForSecretChanges()
+
+	// The read of the changed secret fails, its change time is not stored
+	provider.set("db_password", "second")
+	provider.stamps["db_password"] = changedAt.Add(time.Hour)
+	provider.failures = 1
+	driver.checkForSecretChanges()
+	if versions := docker.secretsWithPrefix("db_password-"); len(versions) != 0 {
+		t.Fatalf("rotated %d versions after a failed read", len(versions))
+	}
+	if lastChanged := driver.secretTracker["db_password"].LastChanged; !lastChanged.Equal(changedAt) {
+		t.Errorf("change time advanced to %v after a failed read", lastChanged)
+	}
+
+	// The next check reads it again and rotates
+	driver.checkForSecretChanges()
+	if versions := docker.secretsWithPrefix("db_password-"); len(versions) != 1 {
+		t.Fatalf("rotated %d versions on the next check, expected 1", len(versions))
+	}
+	if provider.checks != 3 {
+		t.Errorf("%d body reads, expected 3", provider.checks)
+	}
+}
+
+func TestResolveLabels(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		labels map[string]string
+		want   map[string]string
+	}{
+		{"no prefix", "", map[string]string{"es.vault_field": "a", "vault_field": "b"}, map[string]string{"es.vault_field": "a", "vault_field": "b"}},
+		{"prefixed label", "es.", map[string]string{"es.vault_field": "a"}, map[string]string{"es.vault_field": "a", "vault_field": "a"}},
+		{"unprefixed fallback", "es.", map[string]string{"vault_field": "b"}, map[string]string{"vault_field": "b"}},
+		{"prefixed wins", "es.", map[string]string{"es.vault_field": "a", "vault_field": "b"}, map[string]string{"es.vault_field": "a", "vault_field": "a"}},
+		{"bare prefix ignored", "es.", map[string]string{"es.": "a"}, map[string]string{"es.": "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveLabels(tt.labels, tt.prefix); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("resolveLabels() = %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetWithLabelPrefix(t *testing.T) {
+	provider := &fakeProvider{values: map[string]string{"prefixed": "from-prefixed", "plain": "from-plain"}}
+	driver := newTestDriver(provider, &fakeDocker{})
+	driver.config.LabelPrefix = "es."
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   string
+	}{
+		{"prefixed", map[string]string{"es.fake_path": "prefixed"}, "from-prefixed"},
+		{"plain fallback", map[string]string{"fake_path": "plain"}, "from-plain"},
+		{"prefixed over plain", map[string]string{"es.fake_path": "prefixed", "fake_path": "plain"}, "from-prefixed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := driver.Get(secrets.Request{SecretName: "db_password", SecretLabels: tt.labels})
+			if response.Err != "" {
+				t.Fatalf("Get failed: %s", response.Err)
+			}
+			if string(response.Value) != tt.want {
+				t.Errorf("Get returned %q, expected %q", response.Value, tt.want)
+			}
+		})
+	}
+}
+
+// versionedProvider is a fakeProvider reporting a backend version per path
+type versionedProvider struct {
+	*fakeProvider
+	versions map[string]string
+}
+
+func (p *versionedProvider) SecretVersion(path string) (string, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	version, ok := p.versions[path]
+	return version, ok
+}
+
+// setVersion changes the value and version the backend holds at path
+func (p *versionedProvider) setVersion(path, value, version string) {
+	p.set(path, value)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.versions[path] = version
+}
+
+func TestBackendVersionTracked(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", nil)},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	provider := &versionedProvider{
+		fakeProvider: &fakeProvider{values: map[string]string{"db_password": "first"}},
+		versions:     map[string]string{"db_password": "7"},
+	}
+	driver := newTestDriver(provider, docker)
+
+	if response := driver.Get(secrets.Request{SecretName: "db_password", ServiceName: "api"}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	expectVersion := func(step, want string) {
+		t.Helper()
+		if got := driver.secretTracker["db_password"].Version; got != want {
+			t.Errorf("%s: tracked version %q, expected %q", step, got, want)
+		}
+		statuses := driver.secretStatuses()
+		if len(statuses) != 1 || statuses[0].Version != want {
+			t.Errorf("%s: monitor reports %+v, expected version %q", step, statuses, want)
+		}
+	}
+	expectVersion("delivery", "7")
+
+	provider.setVersion("db_password", "second", "8")
+	driver.checkForSecretChanges()
+	expectVersion("rotation", "8")
+}
+
+// failingProvider is a fakeProvider whose reads fail with err, when set
+type failingProvider struct {
+	*fakeProvider
+	err error
+}
+
+func (p *failingProvider) GetSecret(ctx context.Context, req secrets.Request) ([]byte, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.fakeProvider.GetSecret(ctx, req)
+}
+
+func TestGetErrorPrefixes(t *testing.T) {
+	tests := []struct {
+		name       string
+		secretName string
+		labels     map[string]string
+		err        error
+		wantPrefix string
+	}{
+		{"missing secret name", "", nil, nil, "config: "},
+		{"invalid labels", "db", map[string]string{onErrorLabel: "retry-forever"}, nil, "config: "},
+		{"provider misconfigured", "db", nil, &providers.ConfigError{Err: errors.New("VAULT_TOKEN is required")}, "config: "},
+		{"secret not found", "db", nil, &providers.ProviderError{Kind: providers.ErrorKindNotFound, Err: errors.New("secret not found")}, "notfound: "},
+		{"backend unreachable", "db", nil, errors.New("connection refused"), "transient: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &failingProvider{fakeProvider: &fakeProvider{values: map[string]string{}}, err: tt.err}
+			driver := newTestDriver(provider, &fakeDocker{})
+			driver.config.EnableRotation = false
+
+			response := driver.Get(secrets.Request{SecretName: tt.secretName, SecretLabels: tt.labels})
+			if !strings.HasPrefix(response.Err, tt.wantPrefix) {
+				t.Errorf("Get() error = %q, expected the %q prefix", response.Err, tt.wantPrefix)
+			}
+		})
+	}
+}
+
+func TestRotationRestartTasksLabel(t *testing.T) {
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		wantRotated bool
+	}{
+		{"default labels the service", map[string]string{}, true},
+		{"restart requested", map[string]string{"rotation_restart_tasks": "true"}, true},
+		{"restart disabled", map[string]string{"rotation_restart_tasks": "False"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := &fakeDocker{
+				secrets:  []swarm.Secret{testSecret("old", "db_password", tt.labels)},
+				services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+			}
+			provider := &fakeProvider{values: map[string]string{"db_password": "first"}}
+			driver := newTestDriver(provider, docker)
+
+			driver.trackSecret(secrets.Request{SecretName: "db_password", ServiceName: "api", SecretLabels: tt.labels}, []byte("first"), driver.provider, "fake")
+			provider.set("db_password", "second")
+			driver.checkForSecretChanges()
+
+			service := docker.serviceNamed(t, "api")
+			refs := service.Spec.TaskTemplate.ContainerSpec.Secrets
+			if len(refs) != 1 || refs[0].SecretID == "old" {
+				t.Fatalf("service secrets = %+v, expected the new version", refs)
+			}
+			// Swarm replaces the tasks whenever the task template changes,
+			// the label cannot keep them running
+			if reflect.DeepEqual(service.Spec.TaskTemplate, testService("svc", "api", nil, secretRef("old", "db_password")).Spec.TaskTemplate) {
+				t.Error("task template unchanged, Swarm would keep the old tasks")
+			}
+			_, rotated := service.Spec.Labels["vault.secret.rotated"]
+			if rotated != tt.wantRotated {
+				t.Errorf("vault.secret.rotated written = %v, expected %v", rotated, tt.wantRotated)
+			}
+			if service.Spec.TaskTemplate.ForceUpdate != 0 {
+				t.Errorf("ForceUpdate = %d, expected it left unset", service.Spec.TaskTemplate.ForceUpdate)
+			}
+		})
+	}
+}
+
+func TestChangeDetectionWithHMACKey(t *testing.T) {
+	providers.SetChangeHashKey("instance-key")
+	t.Cleanup(func() { providers.SetChangeHashKey("") })
+
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", nil)},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	provider := &fakeProvider{values: map[string]string{"db_password": "first"}}
+	driver := newTestDriver(provider, docker)
+
+	driver.trackSecret(secrets.Request{SecretName: "db_password", ServiceName: "api", SecretLabels: map[string]string{}}, []byte("first"), driver.provider, "fake")
+	secretInfo := driver.secretTracker["db_password"]
+	if secretInfo.LastHash != providers.HashValue([]byte("first")) {
+		t.Fatalf("LastHash = %s, expected the keyed hash of the value", secretInfo.LastHash)
+	}
+	providers.SetChangeHashKey("")
+	if secretInfo.LastHash == providers.HashValue([]byte("first")) {
+		t.Fatal("LastHash is the plain SHA-256 of the value")
+	}
+	providers.SetChangeHashKey("instance-key")
+
+	// An unchanged value is not rotated, a changed one is
+	driver.checkForSecretChanges()
+	if rotated := docker.secretsWithPrefix("db_password-"); len(rotated) != 0 {
+		t.Fatalf("unchanged secret rotated to %v", rotated)
+	}
+	provider.set("db_password", "second")
+	driver.checkForSecretChanges()
+	if rotated := docker.secretsWithPrefix("db_password-"); len(rotated) != 1 {
+		t.Errorf("changed secret rotated to %v, expected one new version", rotated)
+	}
+}
+
+// batchProvider is a fakeProvider comparing secrets in one batch read, it
+// reports only the secrets in results
+type batchProvider struct {
+	*fakeProvider
+	results map[string]bool
+	batched []string
+	checks  []string
+}
+
+func (p *batchProvider) CheckSecretsChanged(ctx context.Context, secretInfos []*providers.SecretInfo) (map[string]bool, error) {
+	for _, secretInfo := range secretInfos {
+		p.batched = append(p.batched, secretInfo.DockerSecretName)
+	}
+	return p.results, nil
+}
+
+func (p *batchProvider) CheckSecretChanged(ctx context.Context, secretInfo *providers.SecretInfo) (bool, error) {
+	p.checks = append(p.checks, secretInfo.DockerSecretName)
+	return p.fakeProvider.CheckSecretChanged(ctx, secretInfo)
+}
+
+func TestBatchReadFallsBackPerSecret(t *testing.T) {
+	docker := &fakeDocker{
+		secrets: []swarm.Secret{testSecret("db-1", "db_password", nil), testSecret("api-1", "api_key", nil)},
+	}
+	provider := &batchProvider{
+		fakeProvider: &fakeProvider{values: map[string]string{"db_password": "first", "api_key": "key-1"}},
+		// The batch read api_key but failed on db_password
+		results: map[string]bool{"api_key": true},
+	}
+	driver := newTestDriver(provider, docker)
+	for _, name := range []string{"db_password", "api_key"} {
+		if response := driver.Get(secrets.Request{SecretName: name}); response.Err != "" {
+			t.Fatalf("Get failed: %s", response.Err)
+		}
+	}
+
+	provider.set("db_password", "second")
+	provider.set("api_key", "key-2")
+	driver.checkForSecretChanges()
+
+	slices.Sort(provider.batched)
+	if !slices.Equal(provider.batched, []string{"api_key", "db_password"}) {
+		t.Errorf("batched %v, expected both secrets", provider.batched)
+	}
+	if !slices.Equal(provider.checks, []string{"db_password"}) {
+		t.Errorf("read individually %v, expected only the secret missing from the batch", provider.checks)
+	}
+	for _, name := range []string{"db_password", "api_key"} {
+		if versions := docker.secretsWithPrefix(name + "-"); len(versions) != 1 {
+			t.Errorf("%s rotated to %d versions, expected 1", name, len(versions))
+		}
+	}
+}
+
+// panickingProvider is a fakeProvider whose first change checks panic
+type panickingProvider struct {
+	*fakeProvider
+	panics atomic.Int32
+}
+
+func (p *panickingProvider) CheckSecretChanged(ctx context.Context, secretInfo *providers.SecretInfo) (bool, error) {
+	if p.panics.Add(-1) >= 0 {
+		panic("provider bug")
+	}
+	return p.fakeProvider.CheckSecretChanged(ctx, secretInfo)
+}
+
+func TestMonitoringSurvivesPanics(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", nil)},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	provider := &panickingProvider{fakeProvider: &fakeProvider{values: map[string]string{"db_password": "first"}}}
+	provider.panics.Store(2)
+	driver := newTestDriver(provider, docker)
+	driver.config.RotationInterval = 10 * time.Millisecond
+	driver.monitor = monitoring.NewMonitor(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	driver.monitorCtx = ctx
+
+	if response := driver.Get(secrets.Request{SecretName: "db_password", ServiceName: "api"}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	provider.set("db_password", "second")
+
+	done := make(chan struct{})
+	go func() {
+		driver.startMonitoring()
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// The checks after the panicking ones still run and rotate the secret
+	deadline := time.Now().Add(5 * time.Second)
+	for len(docker.secretsWithPrefix("db_password-")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("secret never rotated after the provider panicked")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if panics := driver.monitor.GetMetrics().MonitorPanics; panics != 2 {
+		t.Errorf("MonitorPanics = %d, expected 2", panics)
+	}
+}
+
+func TestIsVersionRevert(t *testing.T) {
+	tests := []struct {
+		previous, current string
+		want              bool
+	}{
+		{"3", "2", true},
+		{"3", "4", false},
+		{"3", "3", false},
+		{"projects/p/secrets/db/versions/10", "projects/p/secrets/db/versions/9", true},
+		{"projects/p/secrets/db/versions/9", "projects/p/secrets/db/versions/10", false},
+		{"", "2", false},
+		{"a1b2c3", "0f9e8d", false},
+	}
+	for _, tt := range tests {
+		if got := isVersionRevert(tt.previous, tt.current); got != tt.want {
+			t.Errorf("isVersionRevert(%q, %q) = %v, expected %v", tt.previous, tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestVersionRevertRecorded(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", nil)},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	provider := &versionedProvider{
+		fakeProvider: &fakeProvider{values: map[string]string{"db_password": "second"}},
+		versions:     map[string]string{"db_password": "8"},
+	}
+	driver := newTestDriver(provider, docker)
+	driver.monitor = monitoring.NewMonitor(time.Minute)
+	if response := driver.Get(secrets.Request{SecretName: "db_password", ServiceName: "api"}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+
+	steps := []struct {
+		name        string
+		value       string
+		version     string
+		wantReverts int64
+	}{
+		{"revert to version 7", "first", "7", 1},
+		{"new version 9", "third", "9", 1},
+	}
+	for i, step := range steps {
+		provider.setVersion("db_password", step.value, step.version)
+		driver.checkForSecretChanges()
+
+		// A revert is still a content change and rotates forward to it
+		if docker.created != i+1 {
+			t.Errorf("%s: %d rotations, expected %d", step.name, docker.created, i+1)
+		}
+		if got := driver.secretTracker["db_password"].Version; got != step.version {
+			t.Errorf("%s: tracked version %q, expected %q", step.name, got, step.version)
+		}
+		if reverts := driver.monitor.GetMetrics().VersionReverts; reverts != step.wantReverts {
+			t.Errorf("%s: VersionReverts = %d, expected %d", step.name, reverts, step.wantReverts)
+		}
+	}
+}
+
+func TestTraceLogsShapesWithoutValues(t *testing.T) {
+	provider := &fieldProvider{&fakeProvider{values: map[string]string{"app/db": `{"password": "hunter2"}`}}}
+	driver := newTestDriver(provider, &fakeDocker{})
+	driver.config.EnableRotation = false
+	req := secrets.Request{SecretName: "db", ServiceName: "api", SecretLabels: map[string]string{"fake_path": "app/db", "fake_field": "password"}}
+
+	hook := logtest.NewGlobal()
+	level := log.GetLevel()
+	t.Cleanup(func() {
+		log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+		log.SetLevel(level)
+	})
+
+	// Nothing is traced below trace level
+	log.SetLevel(log.DebugLevel)
+	if response := driver.Get(req); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == log.TraceLevel {
+			t.Errorf("traced %q at debug level", entry.Message)
+		}
+	}
+
+	hook.Reset()
+	log.SetLevel(log.TraceLevel)
+	if response := driver.Get(req); response.Err != "" || string(response.Value) != "hunter2" {
+		t.Fatalf("Get() = %q, %q, expected the password", response.Value, response.Err)
+	}
+	traced := make(map[string]log.Fields)
+	for _, entry := range hook.AllEntries() {
+		line, err := entry.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(line, "hunter2") {
+			t.Errorf("log line contains the secret value: %s", line)
+		}
+		if entry.Level == log.TraceLevel {
+			traced[entry.Message] = entry.Data
+		}
+	}
+
+	if fields := traced["Secret request"]; fields["service"] != "api" || fields["labels"].(map[string]string)["fake_path"] != "app/db" {
+		t.Errorf("request traced with %v, expected its service and labels", fields)
+	}
+	if fields := traced["Resolved provider path"]; fields["path"] != "app/db" || fields["field"] != "password" {
+		t.Errorf("resolution traced with %v, expected path app/db and field password", fields)
+	}
+	if fields := traced["Secret response"]; fields["value_bytes"] != len("hunter2") {
+		t.Errorf("response traced with %v, expected only the value size", fields)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// encodeLabel selects the encoding of the delivered value: none, base64 or hex
+const encodeLabel = "encode"
+
+// encodeSecretValue encodes the value about to be delivered as the encode
+// label asks. It runs last, after field extraction and templates.
+func encodeSecretValue(req secrets.Request, value []byte) ([]byte, error) {
+	switch encoding := strings.ToLower(req.SecretLabels[encodeLabel]); encoding {
+	case "", "none":
+		return value, nil
+	case "base64":
+		return []byte(base64.StdEncoding.EncodeToString(value)), nil
+	case "hex":
+		return []byte(hex.EncodeToString(value)), nil
+	default:
+		return nil, fmt.Errorf("invalid %s label %q, expected none, base64 or hex", encodeLabel, encoding)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+func TestEncodeSecretValue(t *testing.T) {
+	tests := []struct {
+		encoding string
+		want     string
+		wantErr  bool
+	}{
+		{"", "pa$$\x00word", false},
+		{"none", "pa$$\x00word", false},
+		{"base64", "cGEkJAB3b3Jk", false},
+		{"BASE64", "cGEkJAB3b3Jk", false},
+		{"hex", "7061242400776f7264", false},
+		{"rot13", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{}}
+			if tt.encoding != "" {
+				req.SecretLabels[encodeLabel] = tt.encoding
+			}
+			got, err := encodeSecretValue(req, []byte("pa$$\x00word"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("encodeSecretValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("encodeSecretValue() = %q, expected %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetEncodesValue(t *testing.T) {
+	provider := &fakeProvider{values: map[string]string{"db": "hunter2"}}
+	driver := newTestDriver(provider, &fakeDocker{})
+
+	response := driver.Get(secrets.Request{SecretName: "db", SecretLabels: map[string]string{encodeLabel: "hex"}})
+	if response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	if string(response.Value) != "68756e74657232" {
+		t.Errorf("Get() = %q, expected the hex of the value", response.Value)
+	}
+	// Change detection keeps comparing the backend value, not the encoding
+	if hash := driver.secretTracker["db"].LastHash; hash != providers.HashValue([]byte("hunter2")) {
+		t.Error("tracked hash is not the hash of the backend value")
+	}
+
+	response = driver.Get(secrets.Request{SecretName: "db", SecretLabels: map[string]string{encodeLabel: "rot13"}})
+	if !strings.HasPrefix(response.Err, "config: ") {
+		t.Errorf("Get() with an unknown encoding error = %q, expected a configuration error", response.Err)
+	}
+}
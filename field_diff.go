@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// readFieldHashes reads the whole secret object and hashes each top-level
+// field, so a later read can tell which fields changed without keeping values
+func (d *SecretsDriver) readFieldHashes(ctx context.Context, req secrets.Request, provider providers.SecretsProvider) (map[string]string, error) {
+	fullReq := secrets.Request{
+		SecretName:   req.SecretName,
+		ServiceName:  req.ServiceName,
+		SecretLabels: copyLabels(req.SecretLabels),
+	}
+	fullReq.SecretLabels["all_fields"] = "true"
+
+	raw, err := provider.GetSecret(ctx, fullReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read all fields: %v", err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("secret is not a JSON object")
+	}
+
+	hashes := make(map[string]string, len(fields))
+	for name, value := range fields {
+		hashes[name] = providers.HashValue(value)
+	}
+	return hashes, nil
+}
+
+// changedFields returns the sorted names of fields added, removed or changed
+// between two sets of field hashes
+func changedFields(previous, current map[string]string) []string {
+	var changed []string
+	for name, hash := range current {
+		if previous[name] != hash {
+			changed = append(changed, name)
+		}
+	}
+	for name := range previous {
+		if _, exists := current[name]; !exists {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// trackFieldHashes records the per-field hashes of a tracked secret
+func (d *SecretsDriver) trackFieldHashes(ctx context.Context, req secrets.Request, provider providers.SecretsProvider) {
+	hashes, err := d.readFieldHashes(ctx, req, provider)
+	if err != nil {
+		log.Debugf("Field diff unavailable for secret %s: %v", req.SecretName, err)
+		return
+	}
+
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	if secretInfo, exists := d.secretTracker[req.SecretName]; exists {
+		secretInfo.FieldHashes = hashes
+	}
+}
+
+// diffFields records and logs which fields of a secret changed since it was last read
+func (d *SecretsDriver) diffFields(ctx context.Context, req secrets.Request, secretInfo *providers.SecretInfo, provider providers.SecretsProvider) {
+	hashes, err := d.readFieldHashes(ctx, req, provider)
+
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	secretInfo.ChangedFields = nil
+	if err != nil {
+		log.Debugf("Field diff unavailable for secret %s: %v", secretInfo.DockerSecretName, err)
+		return
+	}
+	if secretInfo.FieldHashes != nil {
+		secretInfo.ChangedFields = changedFields(secretInfo.FieldHashes, hashes)
+		log.Printf("Secret %s changed fields: %v", secretInfo.DockerSecretName, secretInfo.ChangedFields)
+	}
+	secretInfo.FieldHashes = hashes
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestChangedFields(t *testing.T) {
+	tests := []struct {
+		name              string
+		previous, current map[string]string
+		want              []string
+	}{
+		{"unchanged", map[string]string{"user": "a", "password": "b"}, map[string]string{"user": "a", "password": "b"}, nil},
+		{"one changed", map[string]string{"user": "a", "password": "b"}, map[string]string{"user": "a", "password": "c"}, []string{"password"}},
+		{"added and removed", map[string]string{"user": "a", "old": "b"}, map[string]string{"user": "a", "new": "c"}, []string{"new", "old"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := changedFields(tt.previous, tt.current); !slices.Equal(got, tt.want) {
+				t.Errorf("changedFields() = %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotationReportsChangedFields(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db", map[string]string{"fake_path": "db"})},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db"))},
+	}
+	provider := &fieldProvider{&fakeProvider{values: map[string]string{"db": `{"host": "db.internal", "password": "first", "user": "app"}`}}}
+	driver := newTestDriver(provider, docker)
+	driver.config.FieldDiff = true
+
+	if response := driver.Get(secrets.Request{SecretName: "db", ServiceName: "api", SecretLabels: map[string]string{"fake_path": "db"}}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	if hashes := driver.secretTracker["db"].FieldHashes; len(hashes) != 3 {
+		t.Fatalf("tracked %d field hashes, expected 3", len(hashes))
+	}
+
+	provider.set("db", `{"host": "db.internal", "password": "second", "user": "app"}`)
+	driver.checkForSecretChanges()
+
+	if versions := docker.secretsWithPrefix("db-"); len(versions) != 1 {
+		t.Fatalf("expected one new version, found %d", len(versions))
+	}
+	if got := driver.secretTracker["db"].ChangedFields; !slices.Equal(got, []string{"password"}) {
+		t.Errorf("changed fields = %v, expected [password]", got)
+	}
+}
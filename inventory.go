@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sugar-org/vault-swarm-plugin/monitoring"
+)
+
+// inventoryReport is the read-only snapshot written to INVENTORY_EXPORT_PATH
+type inventoryReport struct {
+	GeneratedAt time.Time                 `json:"generated_at"`
+	Provider    string                    `json:"provider"`
+	Secrets     []monitoring.SecretStatus `json:"secrets"`
+}
+
+// startInventoryExport periodically writes the tracked secrets, without values,
+// for tooling that reconciles what the plugin manages
+func (d *SecretsDriver) startInventoryExport() {
+	ticker := time.NewTicker(d.config.InventoryExportInterval)
+	defer ticker.Stop()
+
+	log.Printf("Exporting secret inventory to %s every %v", d.config.InventoryExportPath, d.config.InventoryExportInterval)
+
+	for {
+		if err := d.exportInventory(); err != nil {
+			log.Errorf("Failed to export secret inventory: %v", err)
+		}
+
+		select {
+		case <-d.monitorCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// exportInventory writes the current tracker snapshot to the inventory file
+func (d *SecretsDriver) exportInventory() error {
+	raw, err := json.MarshalIndent(inventoryReport{
+		GeneratedAt: time.Now().UTC(),
+		Provider:    d.provider.GetProviderName(),
+		Secrets:     d.secretStatuses(),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode inventory: %v", err)
+	}
+
+	// Readers never see a partial file, the rename replaces it in one step
+	tmp, err := os.CreateTemp(filepath.Dir(d.config.InventoryExportPath), ".inventory-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(raw); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), d.config.InventoryExportPath)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestInventoryExport(t *testing.T) {
+	dir := t.TempDir()
+	provider := &fakeProvider{values: map[string]string{"db_password": "first", "api_key": "second"}}
+	driver := newTestDriver(provider, &fakeDocker{})
+	driver.config.InventoryExportPath = filepath.Join(dir, "inventory.json")
+	driver.config.InventoryExportInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	driver.monitorCtx = ctx
+
+	driver.trackSecret(secrets.Request{SecretName: "db_password", SecretLabels: map[string]string{}}, []byte("first"), driver.provider, "fake")
+	done := make(chan struct{})
+	go func() {
+		driver.startInventoryExport()
+		close(done)
+	}()
+	defer cancel()
+
+	// readInventory waits for the report to list the given number of secrets
+	readInventory := func(count int) (inventoryReport, string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			raw, err := os.ReadFile(driver.config.InventoryExportPath)
+			var report inventoryReport
+			if err == nil && json.Unmarshal(raw, &report) == nil && len(report.Secrets) == count {
+				return report, string(raw)
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("inventory never listed %d secrets, last read %q, %v", count, raw, err)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	first, _ := readInventory(1)
+	if first.Provider != "fake" || first.Secrets[0].Name != "db_password" {
+		t.Errorf("inventory = %+v, expected db_password from the fake provider", first)
+	}
+
+	// A secret tracked later shows up on a following interval
+	driver.trackSecret(secrets.Request{SecretName: "api_key", SecretLabels: map[string]string{}}, []byte("second"), driver.provider, "fake")
+	second, raw := readInventory(2)
+	if !second.GeneratedAt.After(first.GeneratedAt) {
+		t.Errorf("generated_at = %v, expected it after %v", second.GeneratedAt, first.GeneratedAt)
+	}
+	if strings.Contains(raw, "first") || strings.Contains(raw, "second") {
+		t.Errorf("inventory %s contains secret values", raw)
+	}
+
+	// Once stopped only the report is left behind, no temporary files
+	cancel()
+	<-done
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("export directory holds %d files, expected only the report", len(entries))
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// Labels configuring a provider for a single secret, with ALLOW_LABEL_PROVIDERS
+const (
+	providerTypeLabel    = "secrets_provider"
+	providerSettingLabel = "secrets_provider."
+)
+
+// labelProviderKey fingerprints a provider type and its settings, so secrets
+// configured the same way share one initialized provider
+func labelProviderKey(providerType string, settings map[string]string) string {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	_, _ = hash.Write([]byte(providerType))
+	for _, key := range keys {
+		_, _ = hash.Write([]byte("\x00" + key + "=" + settings[key]))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// labelProviderSettings returns the secrets_provider.* settings of a secret.
+// Only the labels configure the provider, the plugin's credentials are never
+// sent to a backend chosen by whoever created the secret.
+func labelProviderSettings(labels map[string]string) map[string]string {
+	settings := make(map[string]string)
+	for key, value := range labels {
+		if name, ok := strings.CutPrefix(key, providerSettingLabel); ok && name != "" {
+			settings[name] = value
+		}
+	}
+	return settings
+}
+
+// labelProviderName names a provider configured through labels by its
+// provider name and the start of its settings fingerprint, e.g.
+// vault@3f2a9c01b7e4, whichever alias of the type the label used
+func labelProviderName(providerType, key string) string {
+	name := strings.ToLower(providerType)
+	if provider, err := providers.CreateProvider(providerType); err == nil {
+		name = provider.GetProviderName()
+	}
+	return name + "@" + key[:12]
+}
+
+// providerInstance names the provider instance that serves secrets with the
+// given labels without setting it up: the alias, the label provider name or
+// the plugin's own provider name
+func (d *SecretsDriver) providerInstance(labels map[string]string) string {
+	if alias, exists := labels[providerAliasLabel]; exists {
+		return alias
+	}
+	if providerType, exists := labels[providerTypeLabel]; exists {
+		return labelProviderName(providerType, labelProviderKey(strings.ToLower(providerType), labelProviderSettings(labels)))
+	}
+	return d.provider.GetProviderName()
+}
+
+// providerFor returns the provider serving a request and the name of that
+// instance: the alias named by its provider label, the one configured by its
+// secrets_provider labels or, without either, the plugin's own provider
+func (d *SecretsDriver) providerFor(ctx context.Context, req secrets.Request) (providers.SecretsProvider, string, error) {
+	if alias, exists := req.SecretLabels[providerAliasLabel]; exists {
+		if _, exists := req.SecretLabels[providerTypeLabel]; exists {
+			return nil, "", &providers.ConfigError{Err: errors.New("provider cannot be combined with secrets_provider")}
+		}
+		// The referenced secret is read with the plugin's own provider
+		if _, exists := req.SecretLabels[pathFromLabel]; exists {
+			return nil, "", &providers.ConfigError{Err: errors.New("path_from cannot be combined with provider")}
+		}
+		entry, exists := d.aliasProviders[alias]
+		if !exists {
+			return nil, "", &providers.ConfigError{Err: fmt.Errorf("unknown provider alias %q, declare it in PROVIDER_ALIASES", alias)}
+		}
+		provider, err := entry.get(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		return provider, alias, nil
+	}
+
+	providerType, exists := req.SecretLabels[providerTypeLabel]
+	if !exists {
+		return d.provider, d.provider.GetProviderName(), nil
+	}
+	if !d.config.AllowLabelProviders {
+		return nil, "", &providers.ConfigError{Err: errors.New("secrets_provider labels require ALLOW_LABEL_PROVIDERS=true")}
+	}
+	// The env provider would hand out the plugin's own environment and the
+	// swarm config provider reads configs with the plugin's Docker access
+	switch strings.ToLower(providerType) {
+	case "env", "swarmconfig", "swarm-config":
+		return nil, "", &providers.ConfigError{Err: fmt.Errorf("the %s provider cannot be configured through labels", providerType)}
+	}
+	if _, exists := req.SecretLabels[pathFromLabel]; exists {
+		return nil, "", &providers.ConfigError{Err: errors.New("path_from cannot be combined with secrets_provider")}
+	}
+
+	settings := labelProviderSettings(req.SecretLabels)
+	if err := providers.CheckLabelSettings(settings); err != nil {
+		return nil, "", err
+	}
+	key := labelProviderKey(strings.ToLower(providerType), settings)
+	name := labelProviderName(providerType, key)
+
+	d.labelProvidersMutex.Lock()
+	provider, exists := d.labelProviders[key]
+	d.labelProvidersMutex.Unlock()
+	if exists {
+		return provider, name, nil
+	}
+
+	// Initializing waits on the backend, so it runs without the lock and once
+	// per settings; the other requests for them wait with their own deadline
+	result := d.labelProviderInits.DoChan(key, func() (interface{}, error) {
+		return d.initLabelProvider(providerType, key, name, settings, req.SecretName)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, "", fmt.Errorf("provider %s is still initializing: %w", name, ctx.Err())
+	case initialized := <-result:
+		if initialized.Err != nil {
+			return nil, "", initialized.Err
+		}
+		return initialized.Val.(providers.SecretsProvider), name, nil
+	}
+}
+
+// initLabelProvider creates and initializes a provider configured through
+// labels and publishes it under its settings fingerprint
+func (d *SecretsDriver) initLabelProvider(providerType, key, name string, settings map[string]string, secretName string) (providers.SecretsProvider, error) {
+	// An initialization that finished since the lookup already published it
+	d.labelProvidersMutex.Lock()
+	provider, exists := d.labelProviders[key]
+	d.labelProvidersMutex.Unlock()
+	if exists {
+		return provider, nil
+	}
+
+	provider, err := providers.CreateProvider(providerType)
+	if err != nil {
+		return nil, &providers.ConfigError{Err: err}
+	}
+	if err := provider.Initialize(providers.Isolated(settings)); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Initialized %s provider %s from the labels of secret %s", provider.GetProviderName(), name, secretName)
+	d.labelProvidersMutex.Lock()
+	d.labelProviders[key] = provider
+	d.labelProvidersMutex.Unlock()
+	return provider, nil
+}
+
+// trackedProvider returns the provider of a tracked secret, resolved from its
+// labels like the request that tracked it. Providers configured through labels
+// are found again by their settings fingerprint, or set up anew after a restart.
+func (d *SecretsDriver) trackedProvider(ctx context.Context, secretInfo *providers.SecretInfo) (providers.SecretsProvider, error) {
+	d.trackerMutex.RLock()
+	req := replayRequest(secretInfo)
+	d.trackerMutex.RUnlock()
+
+	provider, _, err := d.providerFor(ctx, req)
+	return provider, err
+}
+
+// closeLabelProviders closes every provider configured through labels
+func (d *SecretsDriver) closeLabelProviders() {
+	d.labelProvidersMutex.Lock()
+	defer d.labelProvidersMutex.Unlock()
+	for key, provider := range d.labelProviders {
+		if err := provider.Close(); err != nil {
+			log.Warnf("Error closing %s provider: %v", provider.GetProviderName(), err)
+		}
+		delete(d.labelProviders, key)
+	}
+}
+
+// usesDefaultProvider reports whether secrets with the given labels are served
+// by the plugin's own provider rather than an alias or their labels
+func usesDefaultProvider(labels map[string]string) bool {
+	_, aliased := labels[providerAliasLabel]
+	_, configured := labels[providerTypeLabel]
+	return !aliased && !configured
+}
+
+// providerInstances returns every initialized provider by instance name: the
+// plugin's own, the ready aliases and those configured through labels
+func (d *SecretsDriver) providerInstances() map[string]providers.SecretsProvider {
+	instances := map[string]providers.SecretsProvider{d.provider.GetProviderName(): d.provider}
+	for name, entry := range d.aliasProviders {
+		entry.mutex.Lock()
+		if entry.ready {
+			instances[name] = entry.provider
+		}
+		entry.mutex.Unlock()
+	}
+
+	d.labelProvidersMutex.Lock()
+	defer d.labelProvidersMutex.Unlock()
+	for key, provider := range d.labelProviders {
+		instances[labelProviderName(provider.GetProviderName(), key)] = provider
+	}
+	return instances
+}
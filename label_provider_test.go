@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+func TestLabelProviderIsolation(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "plugin-token")
+
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr bool
+	}{
+		{"vault from labels", map[string]string{
+			"secrets_provider":             "vault",
+			"secrets_provider.VAULT_ADDR":  "https://vault.example:8200",
+			"secrets_provider.VAULT_TOKEN": "label-token",
+		}, false},
+		{"plugin token is not inherited", map[string]string{
+			"secrets_provider":            "vault",
+			"secrets_provider.VAULT_ADDR": "https://vault.example:8200",
+		}, true},
+		{"host CA file", map[string]string{
+			"secrets_provider":              "vault",
+			"secrets_provider.VAULT_ADDR":   "https://vault.example:8200",
+			"secrets_provider.VAULT_TOKEN":  "label-token",
+			"secrets_provider.VAULT_CACERT": "/etc/ssl/ca.pem",
+		}, true},
+		{"host credentials file", map[string]string{
+			"secrets_provider": "gcp",
+			"secrets_provider.GOOGLE_APPLICATION_CREDENTIALS": "/root/key.json",
+		}, true},
+		{"env provider", map[string]string{"secrets_provider": "env"}, true},
+		{"swarm config provider", map[string]string{"secrets_provider": "swarmconfig"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := newTestDriver(&fakeProvider{}, &fakeDocker{})
+			driver.config.AllowLabelProviders = true
+
+			provider, instance, err := driver.providerFor(context.Background(), secrets.Request{SecretName: "db_password", SecretLabels: tt.labels})
+			if tt.wantErr {
+				var configErr *providers.ConfigError
+				if !errors.As(err, &configErr) {
+					t.Fatalf("providerFor() error = %v, expected a ConfigError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("providerFor() error = %v", err)
+			}
+			if provider == driver.provider || !strings.HasPrefix(instance, "vault@") {
+				t.Errorf("providerFor() returned the plugin's provider")
+			}
+		})
+	}
+}
+
+func TestLabelProviderInitDoesNotBlock(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	var slowLogins atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var login struct {
+			RoleID string `json:"role_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&login)
+		// The slow backend answers its logins only once released
+		if login.RoleID == "slow" {
+			slowLogins.Add(1)
+			started <- struct{}{}
+			<-release
+		}
+		fmt.Fprint(w, `{"auth":{"client_token":"label-token","lease_duration":3600}}`)
+	}))
+	t.Cleanup(server.Close)
+	labels := func(roleID string) map[string]string {
+		return map[string]string{
+			"secrets_provider":                   "vault",
+			"secrets_provider.VAULT_ADDR":        server.URL,
+			"secrets_provider.VAULT_AUTH_METHOD": "approle",
+			"secrets_provider.VAULT_ROLE_ID":     roleID,
+			"secrets_provider.VAULT_SECRET_ID":   "secret",
+		}
+	}
+
+	driver := newTestDriver(&fakeProvider{}, &fakeDocker{})
+	driver.config.AllowLabelProviders = true
+	slow := secrets.Request{SecretName: "slow_secret", SecretLabels: labels("slow")}
+
+	type result struct {
+		provider providers.SecretsProvider
+		err      error
+	}
+	first := make(chan result, 1)
+	go func() {
+		provider, _, err := driver.providerFor(context.Background(), slow)
+		first <- result{provider, err}
+	}()
+	<-started
+
+	// A second request for the same settings joins the initialization and
+	// gives up at its own deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := driver.providerFor(ctx, slow); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("providerFor() error = %v while initializing, expected the deadline", err)
+	}
+
+	// Other settings are not held up by it
+	other := make(chan error, 1)
+	go func() {
+		_, _, err := driver.providerFor(context.Background(), secrets.Request{SecretName: "fast_secret", SecretLabels: labels("fast")})
+		other <- err
+	}()
+	select {
+	case err := <-other:
+		if err != nil {
+			t.Errorf("providerFor() error = %v for other settings", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("other settings waited for the slow initialization")
+	}
+
+	close(release)
+	initialized := <-first
+	if initialized.err != nil {
+		t.Fatalf("providerFor() error = %v", initialized.err)
+	}
+	if provider, _, err := driver.providerFor(context.Background(), slow); err != nil || provider != initialized.provider {
+		t.Errorf("providerFor() = %v, %v, expected the initialized provider", provider, err)
+	}
+	if n := slowLogins.Load(); n != 1 {
+		t.Errorf("logged in %d times, expected once", n)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// applyLease copies the lease of the last read of a secret onto its tracking
+// info. The caller must hold trackerMutex.
+func (d *SecretsDriver) applyLease(provider providers.SecretsProvider, secretInfo *providers.SecretInfo) {
+	renewer, ok := provider.(providers.LeaseRenewer)
+	if !ok {
+		return
+	}
+
+	leaseID, duration, ok := renewer.LeaseFor(secretInfo.SecretPath)
+	if !ok {
+		secretInfo.LeaseID = ""
+		secretInfo.LeaseDuration = 0
+		secretInfo.LeaseExpiry = time.Time{}
+		return
+	}
+	secretInfo.LeaseID = leaseID
+	secretInfo.LeaseDuration = duration
+	secretInfo.LeaseExpiry = time.Now().Add(duration)
+}
+
+// leaseNeedsRenewal reports whether a lease would run low before the next
+// check, renewing once less than a third of it is left
+func leaseNeedsRenewal(expiry time.Time, duration, checkInterval time.Duration) bool {
+	return time.Until(expiry) < duration/3+checkInterval
+}
+
+// maintainLease renews the lease of a dynamic secret near its expiry. When the
+// lease cannot be renewed for at least another check interval, the secret is
+// re-issued through a regular rotation, reported by the returned bool.
+func (d *SecretsDriver) maintainLease(secretInfo *providers.SecretInfo) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.RequestTimeout)
+	provider, err := d.trackedProvider(ctx, secretInfo)
+	cancel()
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve provider: %v", err)
+	}
+	renewer, ok := provider.(providers.LeaseRenewer)
+	if !ok {
+		return false, nil
+	}
+
+	d.trackerMutex.RLock()
+	leaseID := secretInfo.LeaseID
+	duration := secretInfo.LeaseDuration
+	expiry := secretInfo.LeaseExpiry
+	d.trackerMutex.RUnlock()
+
+	if !leaseNeedsRenewal(expiry, duration, d.config.RotationInterval) {
+		return false, nil
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), d.config.ChangeCheckTimeout)
+	newDuration, err := renewer.RenewLease(ctx, leaseID, duration)
+	cancel()
+
+	if err == nil && newDuration > d.config.RotationInterval {
+		d.trackerMutex.Lock()
+		secretInfo.LeaseDuration = newDuration
+		secretInfo.LeaseExpiry = time.Now().Add(newDuration)
+		d.trackerMutex.Unlock()
+
+		log.Printf("Renewed lease of secret %s for %v", secretInfo.DockerSecretName, newDuration)
+		d.saveTrackerState()
+		return false, nil
+	}
+
+	if err != nil {
+		log.Warnf("Failed to renew lease of secret %s, re-issuing it: %v", secretInfo.DockerSecretName, err)
+	} else {
+		log.Printf("Lease of secret %s reached its maximum TTL, re-issuing it", secretInfo.DockerSecretName)
+	}
+
+	if err := d.rotateSecret(secretInfo); err != nil {
+		return true, fmt.Errorf("failed to re-issue leased secret: %v", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// leasedProvider is a fakeProvider whose secrets carry a lease
+type leasedProvider struct {
+	*fakeProvider
+	duration, renewedFor time.Duration
+	renewErr             error
+	renewals             []string
+}
+
+func (p *leasedProvider) LeaseFor(path string) (string, time.Duration, bool) {
+	return "lease/" + path, p.duration, true
+}
+
+func (p *leasedProvider) RenewLease(ctx context.Context, leaseID string, increment time.Duration) (time.Duration, error) {
+	p.renewals = append(p.renewals, leaseID)
+	return p.renewedFor, p.renewErr
+}
+
+func TestMaintainLease(t *testing.T) {
+	tests := []struct {
+		name         string
+		duration     time.Duration
+		renewedFor   time.Duration
+		renewErr     error
+		wantRenewals int
+		wantReissued bool
+	}{
+		{"lease far from expiry", time.Hour, time.Hour, nil, 0, false},
+		{"lease renewed", 80 * time.Second, time.Hour, nil, 1, false},
+		{"renewal failed", 80 * time.Second, 0, errors.New("lease not found"), 1, true},
+		{"maximum TTL reached", 80 * time.Second, 30 * time.Second, nil, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := &fakeDocker{
+				secrets:  []swarm.Secret{testSecret("old", "db_password", nil)},
+				services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+			}
+			provider := &leasedProvider{
+				fakeProvider: &fakeProvider{values: map[string]string{"db_password": "first"}},
+				duration:     tt.duration,
+				renewedFor:   tt.renewedFor,
+				renewErr:     tt.renewErr,
+			}
+			driver := newTestDriver(provider, docker)
+
+			if response := driver.Get(secrets.Request{SecretName: "db_password", ServiceName: "api"}); response.Err != "" {
+				t.Fatalf("Get failed: %s", response.Err)
+			}
+			secretInfo := driver.secretTracker["db_password"]
+			if secretInfo.LeaseID != "lease/db_password" || secretInfo.LeaseDuration != tt.duration {
+				t.Fatalf("tracked lease %q for %v, expected lease/db_password for %v", secretInfo.LeaseID, secretInfo.LeaseDuration, tt.duration)
+			}
+
+			provider.set("db_password", "reissued")
+			reissued, err := driver.maintainLease(secretInfo)
+			if err != nil {
+				t.Fatalf("maintainLease() error = %v", err)
+			}
+			if len(provider.renewals) != tt.wantRenewals {
+				t.Errorf("renewed %d times, expected %d", len(provider.renewals), tt.wantRenewals)
+			}
+			if reissued != tt.wantReissued {
+				t.Errorf("maintainLease() re-issued = %v, expected %v", reissued, tt.wantReissued)
+			}
+			if versions := docker.secretsWithPrefix("db_password-"); (len(versions) == 1) != tt.wantReissued {
+				t.Errorf("created %d versions, re-issued = %v", len(versions), tt.wantReissued)
+			}
+			if tt.wantRenewals == 1 && !tt.wantReissued && time.Until(secretInfo.LeaseExpiry) < 59*time.Minute {
+				t.Errorf("lease expires at %v after renewal for an hour", secretInfo.LeaseExpiry)
+			}
+		})
+	}
+}
@@ -16,15 +16,31 @@ func main() {
 	var (
 		flVersion = flag.Bool("version", false, "Print version")
 		flDebug   = flag.Bool("debug", false, "Enable debug logging")
+		flVerify  = flag.Bool("verify", false, "Compare the secrets in TRACKER_STATE_FILE with their backends and exit")
+		flCreds   = flag.Bool("verify-creds", false, "Check the provider credentials against the backend and exit")
 	)
 	flag.Parse()
 
 	if *flVersion {
-		fmt.Println("Vault Secrets Provider v1.0.0")
+		fmt.Print(versionInfo())
 		return
 	}
+
+	// --debug is a shorthand for LOG_LEVEL=debug and takes precedence
+	logLevel, err := parseLogLevel(getEnvOrDefault("LOG_LEVEL", "info"))
+	if err != nil {
+		log.Fatalf("Invalid LOG_LEVEL: %v", err)
+	}
 	if *flDebug {
-		log.SetLevel(log.DebugLevel)
+		logLevel = log.DebugLevel
+	}
+	log.SetLevel(logLevel)
+
+	if *flVerify {
+		os.Exit(runVerify())
+	}
+	if *flCreds {
+		os.Exit(runVerifyCreds())
 	}
 
 	// Initialize the Vault driver
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// serviceSecretLabelPrefix scopes a service label to one of its secrets, e.g.
+// secrets.db_password.vault_path on the service sets vault_path of db_password
+const serviceSecretLabelPrefix = "secrets."
+
+// requestMetadata is what secret label values can refer to as templates,
+// e.g. vault_path: "{{.ServiceLabels.environment}}/database"
+type requestMetadata struct {
+	ServiceID       string
+	ServiceName     string
+	ServiceHostname string
+	ServiceLabels   map[string]string
+	TaskID          string
+	TaskName        string
+}
+
+// withRequestMetadata fills in the secret labels a service supplies for the
+// secret and renders label values that refer to the requesting service or task.
+// Labels of the secret itself win over those of the service. It reports
+// whether the labels depend on the request, two services may then read one
+// Docker secret from different paths.
+func withRequestMetadata(req secrets.Request, prefix string) (secrets.Request, bool, error) {
+	serviceLabels := resolveLabels(req.ServiceLabels, prefix)
+	if serviceLabels == nil {
+		serviceLabels = make(map[string]string)
+	}
+
+	labels := copyLabels(req.SecretLabels)
+	scoped := false
+	scope := serviceSecretLabelPrefix + req.SecretName + "."
+	for key, value := range serviceLabels {
+		name, found := strings.CutPrefix(key, scope)
+		if !found || name == "" {
+			continue
+		}
+		if _, exists := labels[name]; !exists {
+			labels[name] = value
+			scoped = true
+		}
+	}
+
+	metadata := requestMetadata{
+		ServiceID:       req.ServiceID,
+		ServiceName:     req.ServiceName,
+		ServiceHostname: req.ServiceHostname,
+		ServiceLabels:   serviceLabels,
+		TaskID:          req.TaskID,
+		TaskName:        req.TaskName,
+	}
+	for key, value := range labels {
+		// The secret template is rendered from the secret's fields instead
+		if key == templateLabel || !strings.Contains(value, "{{") {
+			continue
+		}
+		rendered, err := renderLabel(key, value, metadata)
+		if err != nil {
+			return req, false, err
+		}
+		labels[key] = rendered
+		scoped = true
+	}
+
+	req.SecretLabels = labels
+	return req, scoped, nil
+}
+
+// renderLabel renders one label value with the request metadata. Referring to
+// a service label the service does not have is an error.
+func renderLabel(key, value string, metadata requestMetadata) (string, error) {
+	tmpl, err := template.New(key).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid template in label %s: %v", key, err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, metadata); err != nil {
+		return "", fmt.Errorf("failed to render label %s: %v", key, err)
+	}
+	return out.String(), nil
+}
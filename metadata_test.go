@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+func TestServiceLabelsDriveVaultPath(t *testing.T) {
+	values := map[string]string{
+		"/v1/secret/data/prod/db": "prod-password",
+		"/v1/secret/data/dev/db":  "dev-password",
+		"/v1/secret/data/own/db":  "own-password",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value, exists := values[r.URL.Path]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"data":{"data":{"value":%q},"metadata":{"version":1}}}`, value)
+	}))
+	defer server.Close()
+
+	vault := &providers.VaultProvider{}
+	if err := vault.Initialize(providers.Isolated(map[string]string{"VAULT_ADDR": server.URL, "VAULT_TOKEN": "token"})); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		secretLabels  map[string]string
+		serviceLabels map[string]string
+		want          string
+		wantPath      string
+		wantErr       bool
+	}{
+		// Secrets resolved per service are served but not tracked for rotation
+		{"service label scoped to the secret", nil, map[string]string{"secrets.db_password.vault_path": "prod/db"}, "prod-password", "", false},
+		{"secret label template", map[string]string{"vault_path": "{{.ServiceLabels.environment}}/db"}, map[string]string{"environment": "dev"}, "dev-password", "", false},
+		{"scoped label renders too", nil, map[string]string{"environment": "prod", "secrets.db_password.vault_path": "{{.ServiceLabels.environment}}/db"}, "prod-password", "", false},
+		{"secret label wins", map[string]string{"vault_path": "own/db"}, map[string]string{"secrets.db_password.vault_path": "prod/db"}, "own-password", "secret/data/own/db", false},
+		{"label scoped to another secret", map[string]string{"vault_path": "own/db"}, map[string]string{"secrets.api_key.vault_path": "prod/db"}, "own-password", "secret/data/own/db", false},
+		{"service lacks the templated label", map[string]string{"vault_path": "{{.ServiceLabels.environment}}/db"}, nil, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := newTestDriver(vault, &fakeDocker{})
+			response := driver.Get(secrets.Request{
+				SecretName:    "db_password",
+				SecretLabels:  tt.secretLabels,
+				ServiceName:   "api",
+				ServiceLabels: tt.serviceLabels,
+			})
+			if (response.Err != "") != tt.wantErr {
+				t.Fatalf("Get() error = %q, wantErr %v", response.Err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if string(response.Value) != tt.want {
+				t.Errorf("Get() = %q, expected %q", response.Value, tt.want)
+			}
+			secretInfo, tracked := driver.secretTracker["db_password"]
+			if tracked != (tt.wantPath != "") {
+				t.Fatalf("tracked = %v, expected %v", tracked, tt.wantPath != "")
+			}
+			if tracked && secretInfo.SecretPath != tt.wantPath {
+				t.Errorf("tracked path = %q, expected %q", secretInfo.SecretPath, tt.wantPath)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package monitoring
 
 import (
 	"math"
+	"sort"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -13,3 +14,13 @@ func uint64ToInt64(value uint64) int64 {
 	log.Warnf("Value %d exceeds int64 limit, using max value", value)
 	return math.MaxInt64
 }
+
+// sortedKeys returns the keys of a counter map in a stable order
+func sortedKeys(counters map[string]int64) []string {
+	keys := make([]string, 0, len(counters))
+	for k := range counters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
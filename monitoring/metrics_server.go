@@ -0,0 +1,60 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MetricsServer serves the Prometheus metrics on a port of their own, so
+// network policy can expose them without the dashboard and JSON API
+type MetricsServer struct {
+	monitor *Monitor
+	server  *http.Server
+}
+
+// NewMetricsServer creates a metrics-only listener on the given port
+func NewMetricsServer(monitor *Monitor, port int) *MetricsServer {
+	mux := http.NewServeMux()
+
+	ms := &MetricsServer{
+		monitor: monitor,
+		server: &http.Server{
+			Addr:              fmt.Sprintf(":%d", port),
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}
+
+	mux.HandleFunc("/metrics", ms.handleMetrics)
+
+	return ms
+}
+
+// Start starts the metrics server
+func (ms *MetricsServer) Start() error {
+	go func() {
+		if err := ms.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Metrics server error: %v", err)
+		}
+	}()
+
+	log.Printf("Started Prometheus metrics server on %s", ms.server.Addr)
+	return nil
+}
+
+// Stop stops the metrics server
+func (ms *MetricsServer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return ms.server.Shutdown(ctx)
+}
+
+// handleMetrics serves metrics in Prometheus format
+func (ms *MetricsServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	writePrometheusMetrics(w, ms.monitor.GetMetrics())
+}
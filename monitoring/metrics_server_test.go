@@ -0,0 +1,84 @@
+package monitoring
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsServedOnTheirOwnPort(t *testing.T) {
+	monitor := NewMonitor(time.Minute)
+	ui := NewWebInterface(monitor, 0)
+	ui.DisablePrometheus()
+	uiServer := httptest.NewServer(ui.server.Handler)
+	defer uiServer.Close()
+	metricsServer := httptest.NewServer(NewMetricsServer(monitor, 0).server.Handler)
+	defer metricsServer.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		want     int
+		contains string
+	}{
+		{"prometheus on the metrics port", metricsServer.URL + "/metrics", http.StatusOK, "vault_swarm_plugin_goroutines"},
+		{"no dashboard on the metrics port", metricsServer.URL + "/", http.StatusNotFound, ""},
+		{"no JSON API on the metrics port", metricsServer.URL + "/api/secrets", http.StatusNotFound, ""},
+		{"dashboard on the monitor port", uiServer.URL + "/", http.StatusOK, "<html"},
+		{"no prometheus on the monitor port", uiServer.URL + "/api/metrics", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := http.Get(tt.url)
+			if err != nil {
+				t.Fatalf("GET %s: %v", tt.url, err)
+			}
+			defer response.Body.Close()
+			body, _ := io.ReadAll(response.Body)
+
+			if response.StatusCode != tt.want {
+				t.Errorf("status = %d, expected %d", response.StatusCode, tt.want)
+			}
+			if !strings.Contains(string(body), tt.contains) {
+				t.Errorf("body does not contain %q", tt.contains)
+			}
+		})
+	}
+}
+
+func TestSecretSizeHistogram(t *testing.T) {
+	monitor := NewMonitor(time.Minute)
+	for _, size := range []int{10, 64, 65, 5000, 600000} {
+		monitor.RecordSecretSize(size)
+	}
+
+	metrics := monitor.GetMetrics()
+	want := []int64{2, 1, 0, 0, 1, 0, 0, 0, 1}
+	for i, count := range want {
+		if metrics.SecretSizeCounts[i] != count {
+			t.Errorf("bucket %d = %d, expected %d", i, metrics.SecretSizeCounts[i], count)
+		}
+	}
+	if metrics.SecretSizeSum != 605139 {
+		t.Errorf("sum = %d, expected 605139", metrics.SecretSizeSum)
+	}
+
+	var out strings.Builder
+	writePrometheusMetrics(&out, metrics)
+	for _, line := range []string{
+		`vault_swarm_plugin_secret_value_bytes_bucket{le="64"} 2`,
+		`vault_swarm_plugin_secret_value_bytes_bucket{le="256"} 3`,
+		`vault_swarm_plugin_secret_value_bytes_bucket{le="16384"} 4`,
+		`vault_swarm_plugin_secret_value_bytes_bucket{le="512000"} 4`,
+		`vault_swarm_plugin_secret_value_bytes_bucket{le="+Inf"} 5`,
+		`vault_swarm_plugin_secret_value_bytes_sum 605139`,
+		`vault_swarm_plugin_secret_value_bytes_count 5`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("metrics missing %q", line)
+		}
+	}
+}
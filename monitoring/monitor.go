@@ -3,6 +3,7 @@ package monitoring
 import (
 	"context"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 
@@ -12,18 +13,55 @@ import (
 // Metrics holds various monitoring metrics
 type Metrics struct {
 	mu                   sync.RWMutex
-	NumGoroutines        int           `json:"num_goroutines"`
-	MemAllocBytes        uint64        `json:"mem_alloc_bytes"`
-	MemSysBytes          uint64        `json:"mem_sys_bytes"`
-	MemHeapBytes         uint64        `json:"mem_heap_bytes"`
-	NumGC                uint32        `json:"num_gc"`
-	GCPauseTotal         time.Duration `json:"gc_pause_total"`
-	LastGCTime           time.Time     `json:"last_gc_time"`
-	SecretRotations      int64         `json:"secret_rotations"`
-	SecretRotationErrors int64         `json:"secret_rotation_errors"`
-	TickerHeartbeat      time.Time     `json:"ticker_heartbeat"`
-	MonitoringStartTime  time.Time     `json:"monitoring_start_time"`
-	RotationInterval     time.Duration `json:"rotation_interval"`
+	NumGoroutines        int                    `json:"num_goroutines"`
+	MemAllocBytes        uint64                 `json:"mem_alloc_bytes"`
+	MemSysBytes          uint64                 `json:"mem_sys_bytes"`
+	MemHeapBytes         uint64                 `json:"mem_heap_bytes"`
+	NumGC                uint32                 `json:"num_gc"`
+	GCPauseTotal         time.Duration          `json:"gc_pause_total"`
+	LastGCTime           time.Time              `json:"last_gc_time"`
+	SecretRotations      int64                  `json:"secret_rotations"`
+	SecretRotationErrors int64                  `json:"secret_rotation_errors"`
+	TickerHeartbeat      time.Time              `json:"ticker_heartbeat"`
+	MonitoringStartTime  time.Time              `json:"monitoring_start_time"`
+	RotationInterval     time.Duration          `json:"rotation_interval"`
+	DockerAPICalls       map[string]int64       `json:"docker_api_calls"`
+	DockerAPIErrors      map[string]int64       `json:"docker_api_errors"`
+	ProviderReads        map[string]int64       `json:"provider_reads"`
+	ProviderThrottled    map[string]int64       `json:"provider_throttled"`
+	ProviderAuth         map[string]AuthMetrics `json:"provider_auth"`
+	StaleReads           int64                  `json:"stale_reads"`
+	ProviderCollisions   int64                  `json:"provider_collisions"`
+	MonitorPanics        int64                  `json:"monitor_panics"`
+	VersionReverts       int64                  `json:"version_reverts"`
+	CacheEntries         int                    `json:"cache_entries"`
+	CacheBytes           int64                  `json:"cache_bytes"`
+	CacheEvictions       int64                  `json:"cache_evictions"`
+	SecretSizeCounts     []int64                `json:"secret_size_counts"` // per SecretSizeBuckets bound, then +Inf
+	SecretSizeSum        int64                  `json:"secret_size_sum"`
+	ProviderRegion       string                 `json:"provider_region,omitempty"`
+}
+
+// AuthMetrics counts a provider's logins against its backend
+type AuthMetrics struct {
+	Successes    int64         `json:"successes"`
+	Failures     int64         `json:"failures"`
+	LatencyTotal time.Duration `json:"latency_total"`
+}
+
+// SecretSizeBuckets are the upper bounds, in bytes, of the secret value size
+// histogram, up to Docker's 500 KiB secret size limit
+var SecretSizeBuckets = []int64{64, 256, 1024, 4096, 16384, 65536, 262144, 512000}
+
+// maxRotationHistory bounds the number of rotation events kept for the dashboard
+const maxRotationHistory = 50
+
+// RotationEvent records the outcome of a single secret rotation
+type RotationEvent struct {
+	SecretName string    `json:"secret_name"`
+	Time       time.Time `json:"time"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
 }
 
 // Monitor handles system monitoring and metrics collection
@@ -35,6 +73,8 @@ type Monitor struct {
 	listeners   []chan *Metrics
 	listenersMu sync.RWMutex
 	lastLogTime time.Time
+	history     []RotationEvent // newest last
+	authSource  func() map[string]AuthMetrics
 }
 
 // NewMonitor creates a new monitoring instance
@@ -44,6 +84,12 @@ func NewMonitor(interval time.Duration) *Monitor {
 	return &Monitor{
 		metrics: &Metrics{
 			MonitoringStartTime: time.Now(),
+			DockerAPICalls:      make(map[string]int64),
+			DockerAPIErrors:     make(map[string]int64),
+			ProviderReads:       make(map[string]int64),
+			ProviderThrottled:   make(map[string]int64),
+			ProviderAuth:        make(map[string]AuthMetrics),
+			SecretSizeCounts:    make([]int64, len(SecretSizeBuckets)+1),
 		},
 		ctx:         ctx,
 		cancel:      cancel,
@@ -77,9 +123,41 @@ func (m *Monitor) Stop() {
 
 // GetMetrics returns a copy of current metrics
 func (m *Monitor) GetMetrics() *Metrics {
+	// Auth counters live in the providers and are read on every scrape
+	m.metrics.mu.RLock()
+	authSource := m.authSource
+	m.metrics.mu.RUnlock()
+	if authSource != nil {
+		auth := authSource()
+		m.metrics.mu.Lock()
+		m.metrics.ProviderAuth = auth
+		m.metrics.mu.Unlock()
+	}
+
 	m.metrics.mu.RLock()
 	defer m.metrics.mu.RUnlock()
 
+	dockerCalls := make(map[string]int64, len(m.metrics.DockerAPICalls))
+	for op, count := range m.metrics.DockerAPICalls {
+		dockerCalls[op] = count
+	}
+	dockerErrors := make(map[string]int64, len(m.metrics.DockerAPIErrors))
+	for op, count := range m.metrics.DockerAPIErrors {
+		dockerErrors[op] = count
+	}
+	providerReads := make(map[string]int64, len(m.metrics.ProviderReads))
+	for provider, count := range m.metrics.ProviderReads {
+		providerReads[provider] = count
+	}
+	providerThrottled := make(map[string]int64, len(m.metrics.ProviderThrottled))
+	for provider, count := range m.metrics.ProviderThrottled {
+		providerThrottled[provider] = count
+	}
+	providerAuth := make(map[string]AuthMetrics, len(m.metrics.ProviderAuth))
+	for provider, auth := range m.metrics.ProviderAuth {
+		providerAuth[provider] = auth
+	}
+
 	// Create a copy to avoid race conditions
 	return &Metrics{
 		NumGoroutines:        m.metrics.NumGoroutines,
@@ -94,6 +172,21 @@ func (m *Monitor) GetMetrics() *Metrics {
 		TickerHeartbeat:      m.metrics.TickerHeartbeat,
 		MonitoringStartTime:  m.metrics.MonitoringStartTime,
 		RotationInterval:     m.metrics.RotationInterval,
+		DockerAPICalls:       dockerCalls,
+		DockerAPIErrors:      dockerErrors,
+		ProviderReads:        providerReads,
+		ProviderThrottled:    providerThrottled,
+		ProviderAuth:         providerAuth,
+		StaleReads:           m.metrics.StaleReads,
+		ProviderCollisions:   m.metrics.ProviderCollisions,
+		MonitorPanics:        m.metrics.MonitorPanics,
+		VersionReverts:       m.metrics.VersionReverts,
+		CacheEntries:         m.metrics.CacheEntries,
+		CacheBytes:           m.metrics.CacheBytes,
+		CacheEvictions:       m.metrics.CacheEvictions,
+		SecretSizeCounts:     append([]int64(nil), m.metrics.SecretSizeCounts...),
+		SecretSizeSum:        m.metrics.SecretSizeSum,
+		ProviderRegion:       m.metrics.ProviderRegion,
 	}
 }
 
@@ -111,6 +204,131 @@ func (m *Monitor) IncrementRotationErrors() {
 	m.metrics.SecretRotationErrors++
 }
 
+// RecordRotation counts a rotation attempt and adds it to the rotation history
+func (m *Monitor) RecordRotation(secretName string, err error) {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+
+	event := RotationEvent{
+		SecretName: secretName,
+		Time:       time.Now(),
+		Success:    err == nil,
+	}
+	if err != nil {
+		event.Error = err.Error()
+		m.metrics.SecretRotationErrors++
+	} else {
+		m.metrics.SecretRotations++
+	}
+
+	m.history = append(m.history, event)
+	if len(m.history) > maxRotationHistory {
+		m.history = m.history[len(m.history)-maxRotationHistory:]
+	}
+}
+
+// GetRotationHistory returns recent rotation events, newest first
+func (m *Monitor) GetRotationHistory() []RotationEvent {
+	m.metrics.mu.RLock()
+	defer m.metrics.mu.RUnlock()
+
+	history := make([]RotationEvent, len(m.history))
+	for i, event := range m.history {
+		history[len(m.history)-1-i] = event
+	}
+	return history
+}
+
+// RecordDockerAPICall counts a Docker API call for the given operation and
+// whether it failed
+func (m *Monitor) RecordDockerAPICall(op string, err error) {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	m.metrics.DockerAPICalls[op]++
+	if err != nil {
+		m.metrics.DockerAPIErrors[op]++
+	}
+}
+
+// RecordProviderRead counts a secret read served by the given provider
+// instance: the provider name, an alias or a provider configured by labels
+func (m *Monitor) RecordProviderRead(provider string) {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	m.metrics.ProviderReads[provider]++
+}
+
+// RecordMonitorPanic counts a change check that panicked and was recovered
+func (m *Monitor) RecordMonitorPanic() {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	m.metrics.MonitorPanics++
+}
+
+// RecordVersionRevert counts a secret whose backend version went backward
+func (m *Monitor) RecordVersionRevert() {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	m.metrics.VersionReverts++
+}
+
+// SetCacheStats records the size of the last-known value cache and how many values it evicted
+func (m *Monitor) SetCacheStats(entries int, bytes, evictions int64) {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	m.metrics.CacheEntries = entries
+	m.metrics.CacheBytes = bytes
+	m.metrics.CacheEvictions = evictions
+}
+
+// RecordSecretSize adds the size of a delivered secret value to the size histogram
+func (m *Monitor) RecordSecretSize(size int) {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	bucket := sort.Search(len(SecretSizeBuckets), func(i int) bool {
+		return int64(size) <= SecretSizeBuckets[i]
+	})
+	m.metrics.SecretSizeCounts[bucket]++
+	m.metrics.SecretSizeSum += int64(size)
+}
+
+// RecordStaleRead counts a secret served from the last-known value after a failed read
+func (m *Monitor) RecordStaleRead() {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	m.metrics.StaleReads++
+}
+
+// RecordProviderCollision counts a tracked secret dropped because another
+// provider now serves the same Docker secret name
+func (m *Monitor) RecordProviderCollision() {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	m.metrics.ProviderCollisions++
+}
+
+// SetProviderThrottled records how many requests the backend of a provider throttled
+func (m *Monitor) SetProviderThrottled(provider string, count int64) {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	m.metrics.ProviderThrottled[provider] = count
+}
+
+// SetAuthSource sets the function returning the logins each provider made
+// against its backend, called whenever the metrics are read
+func (m *Monitor) SetAuthSource(source func() map[string]AuthMetrics) {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	m.authSource = source
+}
+
+// SetProviderRegion records the region the provider is currently reading from
+func (m *Monitor) SetProviderRegion(region string) {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	m.metrics.ProviderRegion = region
+}
+
 // UpdateTickerHeartbeat updates the ticker heartbeat timestamp
 func (m *Monitor) UpdateTickerHeartbeat() {
 	m.metrics.mu.Lock()
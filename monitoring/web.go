@@ -2,19 +2,81 @@ package monitoring
 
 import (
 	"context"
+	"crypto/subtle"
+	"embed"
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
+	"math"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var dashboardTemplate = template.Must(template.New("dashboard.html").Funcs(template.FuncMap{
+	"div": func(value uint64, divisor float64) float64 {
+		return float64(value) / divisor
+	},
+}).ParseFS(templateFS, "templates/dashboard.html"))
+
+// SecretStatus describes a tracked secret for the dashboard
+type SecretStatus struct {
+	Name        string    `json:"name"`
+	Provider    string    `json:"provider"`
+	Services    []string  `json:"services"`
+	LastUpdated time.Time `json:"last_updated"`
+	LastError   string    `json:"last_error,omitempty"`
+	Version     string    `json:"version,omitempty"` // backend version of the delivered value
+	// Set while a detected change has not been rotated yet
+	ChangeDetectedAt time.Time `json:"change_detected_at,omitzero"`
+}
+
+// SecretDrift reports whether a tracked secret still matches its backend
+type SecretDrift struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // in_sync, drifted, skipped or error
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthCheck probes one component the plugin depends on
+type HealthCheck func(ctx context.Context) error
+
+// ComponentHealth is the result of a single component probe
+type ComponentHealth struct {
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// healthCheckTimeout bounds each component probe of /healthz
+const healthCheckTimeout = 5 * time.Second
+
+// verifyInterval is how often /api/verify may re-read every tracked secret
+const verifyInterval = 30 * time.Second
+
 // WebInterface provides a simple web interface for monitoring
 type WebInterface struct {
-	monitor *Monitor
-	server  *http.Server
+	monitor       *Monitor
+	server        *http.Server
+	secretsSource func() []SecretStatus
+	verifySource  func(ctx context.Context) []SecretDrift
+	evict         func(name string) bool
+	adminToken    string // bearer token of the maintenance endpoints
+	healthChecks  map[string]HealthCheck
+	sourceMu      sync.RWMutex
+	// When /api/verify last ran, it is refused until verifyInterval has passed
+	verifyMu   sync.Mutex
+	lastVerify time.Time
+	// Whether /api/metrics is served here rather than on a separate metrics port
+	servePrometheus bool
 }
 
 // NewWebInterface creates a new web monitoring interface
@@ -22,7 +84,9 @@ func NewWebInterface(monitor *Monitor, port int) *WebInterface {
 	mux := http.NewServeMux()
 
 	wi := &WebInterface{
-		monitor: monitor,
+		monitor:         monitor,
+		healthChecks:    make(map[string]HealthCheck),
+		servePrometheus: true,
 		server: &http.Server{
 			Addr:              fmt.Sprintf(":%d", port),
 			Handler:           mux,
@@ -34,7 +98,12 @@ func NewWebInterface(monitor *Monitor, port int) *WebInterface {
 	mux.HandleFunc("/", wi.handleDashboard)
 	mux.HandleFunc("/metrics", wi.handleMetrics)
 	mux.HandleFunc("/health", wi.handleHealth)
+	mux.HandleFunc("/healthz", wi.handleHealthz)
 	mux.HandleFunc("/api/metrics", wi.handleAPIMetrics)
+	mux.HandleFunc("/api/secrets", wi.handleAPISecrets)
+	mux.HandleFunc("/api/pending", wi.handleAPIPending)
+	mux.HandleFunc("/api/verify", wi.handleAPIVerify)
+	mux.HandleFunc("DELETE /api/secrets/{name}", wi.handleAPIEvict)
 
 	return wi
 }
@@ -58,23 +127,81 @@ func (wi *WebInterface) Stop() error {
 	return wi.server.Shutdown(ctx)
 }
 
+// DisablePrometheus stops serving /api/metrics, for when a MetricsServer
+// exposes the metrics on their own port
+func (wi *WebInterface) DisablePrometheus() {
+	wi.servePrometheus = false
+}
+
+// SetSecretsSource sets the function used to list tracked secrets on the dashboard
+func (wi *WebInterface) SetSecretsSource(source func() []SecretStatus) {
+	wi.sourceMu.Lock()
+	defer wi.sourceMu.Unlock()
+	wi.secretsSource = source
+}
+
+// SetVerifySource sets the function that compares tracked secrets with their backends
+func (wi *WebInterface) SetVerifySource(source func(ctx context.Context) []SecretDrift) {
+	wi.sourceMu.Lock()
+	defer wi.sourceMu.Unlock()
+	wi.verifySource = source
+}
+
+// SetEvictHandler enables DELETE /api/secrets/{name} for requests carrying
+// the admin token. Without a token the endpoint, like /api/verify, stays
+// disabled.
+func (wi *WebInterface) SetEvictHandler(adminToken string, evict func(name string) bool) {
+	wi.sourceMu.Lock()
+	defer wi.sourceMu.Unlock()
+	wi.adminToken = adminToken
+	wi.evict = evict
+}
+
+// AddHealthCheck registers a component probed by /healthz
+func (wi *WebInterface) AddHealthCheck(component string, check HealthCheck) {
+	wi.sourceMu.Lock()
+	defer wi.sourceMu.Unlock()
+	wi.healthChecks[component] = check
+}
+
+// trackedSecrets returns the tracked secrets, or none when no source is set
+func (wi *WebInterface) trackedSecrets() []SecretStatus {
+	wi.sourceMu.RLock()
+	source := wi.secretsSource
+	wi.sourceMu.RUnlock()
+
+	if source == nil {
+		return nil
+	}
+	return source()
+}
+
 // handleDashboard serves the main dashboard page
 func (wi *WebInterface) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
 	metrics := wi.monitor.GetMetrics()
 	health := wi.monitor.GetHealthStatus()
 
-	tmpl := template.Must(template.New("dashboard").Parse(dashboardTemplate))
-
 	data := struct {
-		Metrics *Metrics
-		Health  map[string]interface{}
+		Metrics    *Metrics
+		Health     map[string]interface{}
+		Secrets    []SecretStatus
+		History    []RotationEvent
+		Prometheus bool
 	}{
-		Metrics: metrics,
-		Health:  health,
+		Metrics:    metrics,
+		Health:     health,
+		Secrets:    wi.trackedSecrets(),
+		History:    wi.monitor.GetRotationHistory(),
+		Prometheus: wi.servePrometheus,
 	}
 
 	w.Header().Set("Content-Type", "text/html")
-	if err := tmpl.Execute(w, data); err != nil {
+	if err := dashboardTemplate.Execute(w, data); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
@@ -99,12 +226,175 @@ func (wi *WebInterface) handleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleAPISecrets serves the tracked secrets as JSON
+func (wi *WebInterface) handleAPISecrets(w http.ResponseWriter, r *http.Request) {
+	secrets := wi.trackedSecrets()
+	if secrets == nil {
+		secrets = []SecretStatus{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(secrets); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleAPIPending lists the tracked secrets whose backend value changed but
+// was not rotated yet, oldest change first
+func (wi *WebInterface) handleAPIPending(w http.ResponseWriter, r *http.Request) {
+	pending := []SecretStatus{}
+	for _, secret := range wi.trackedSecrets() {
+		if !secret.ChangeDetectedAt.IsZero() {
+			pending = append(pending, secret)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].ChangeDetectedAt.Before(pending[j].ChangeDetectedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(pending); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleAPIVerify re-reads every tracked secret from its backend and reports
+// which ones drifted from the tracked value, without rotating them. Each run
+// reads every secret, so it needs the admin token and runs at most once per
+// verifyInterval.
+func (wi *WebInterface) handleAPIVerify(w http.ResponseWriter, r *http.Request) {
+	if !wi.authorizeAdmin(w, r) {
+		return
+	}
+
+	wi.verifyMu.Lock()
+	if wait := verifyInterval - time.Since(wi.lastVerify); !wi.lastVerify.IsZero() && wait > 0 {
+		wi.verifyMu.Unlock()
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "verify ran recently, retry later", http.StatusTooManyRequests)
+		return
+	}
+	wi.lastVerify = time.Now()
+	wi.verifyMu.Unlock()
+
+	wi.sourceMu.RLock()
+	source := wi.verifySource
+	wi.sourceMu.RUnlock()
+
+	report := []SecretDrift{}
+	if source != nil {
+		report = source(r.Context())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleAPIEvict stops tracking a secret and drops its cached values
+func (wi *WebInterface) handleAPIEvict(w http.ResponseWriter, r *http.Request) {
+	if !wi.authorizeAdmin(w, r) {
+		return
+	}
+	wi.sourceMu.RLock()
+	evict := wi.evict
+	wi.sourceMu.RUnlock()
+	if evict == nil {
+		http.Error(w, "secret eviction is not available", http.StatusForbidden)
+		return
+	}
+
+	name := r.PathValue("name")
+	if !evict(name) {
+		http.Error(w, fmt.Sprintf("secret %s is not tracked or cached", name), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeAdmin checks the bearer token of a maintenance endpoint request and
+// answers it when the token is missing, wrong or not configured
+func (wi *WebInterface) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	wi.sourceMu.RLock()
+	adminToken := wi.adminToken
+	wi.sourceMu.RUnlock()
+
+	if adminToken == "" {
+		http.Error(w, "maintenance endpoints are disabled, set MONITORING_ADMIN_TOKEN", http.StatusForbidden)
+		return false
+	}
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// handleHealthz probes every registered component so operators can tell a
+// failing secrets backend apart from an unreachable Docker daemon
+func (wi *WebInterface) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	wi.sourceMu.RLock()
+	checks := make(map[string]HealthCheck, len(wi.healthChecks))
+	for component, check := range wi.healthChecks {
+		checks[component] = check
+	}
+	wi.sourceMu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	components := make(map[string]ComponentHealth, len(checks))
+	for component, check := range checks {
+		wg.Add(1)
+		go func(component string, check HealthCheck) {
+			defer wg.Done()
+			result := ComponentHealth{Healthy: true}
+			if err := check(ctx); err != nil {
+				result = ComponentHealth{Healthy: false, Error: err.Error()}
+			}
+			mu.Lock()
+			components[component] = result
+			mu.Unlock()
+		}(component, check)
+	}
+	wg.Wait()
+
+	healthy := true
+	for _, result := range components {
+		healthy = healthy && result.Healthy
+	}
+
+	status := http.StatusOK
+	if !healthy {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"healthy":    healthy,
+		"components": components,
+	})
+}
+
 // handleAPIMetrics serves metrics in Prometheus format
 func (wi *WebInterface) handleAPIMetrics(w http.ResponseWriter, r *http.Request) {
-	metrics := wi.monitor.GetMetrics()
+	if !wi.servePrometheus {
+		http.NotFound(w, r)
+		return
+	}
 
 	w.Header().Set("Content-Type", "text/plain")
+	writePrometheusMetrics(w, wi.monitor.GetMetrics())
+}
 
+// writePrometheusMetrics writes metrics in the Prometheus text format
+func writePrometheusMetrics(w io.Writer, metrics *Metrics) {
 	// Basic Prometheus-style metrics
 	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_goroutines Current number of goroutines\n")
 	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_goroutines gauge\n")
@@ -124,176 +414,97 @@ func (wi *WebInterface) handleAPIMetrics(w http.ResponseWriter, r *http.Request)
 	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_rotation_errors_total counter\n")
 	_, _ = fmt.Fprintf(w, "vault_swarm_plugin_rotation_errors_total %d\n", metrics.SecretRotationErrors)
 
+	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_docker_api_calls_total Total number of Docker API calls made during rotation\n")
+	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_docker_api_calls_total counter\n")
+	for _, op := range sortedKeys(metrics.DockerAPICalls) {
+		_, _ = fmt.Fprintf(w, "vault_swarm_plugin_docker_api_calls_total{op=\"%s\"} %d\n", op, metrics.DockerAPICalls[op])
+	}
+
+	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_docker_api_errors_total Total number of failed Docker API calls during rotation\n")
+	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_docker_api_errors_total counter\n")
+	for _, op := range sortedKeys(metrics.DockerAPICalls) {
+		_, _ = fmt.Fprintf(w, "vault_swarm_plugin_docker_api_errors_total{op=\"%s\"} %d\n", op, metrics.DockerAPIErrors[op])
+	}
+
+	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_provider_reads_total Total number of secret reads per provider\n")
+	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_provider_reads_total counter\n")
+	for _, provider := range sortedKeys(metrics.ProviderReads) {
+		_, _ = fmt.Fprintf(w, "vault_swarm_plugin_provider_reads_total{provider=\"%s\"} %d\n", provider, metrics.ProviderReads[provider])
+	}
+
+	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_providers_in_use Number of distinct providers that served secret reads\n")
+	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_providers_in_use gauge\n")
+	_, _ = fmt.Fprintf(w, "vault_swarm_plugin_providers_in_use %d\n", len(metrics.ProviderReads))
+
+	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_provider_throttled_total Total number of provider requests throttled by the backend\n")
+	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_provider_throttled_total counter\n")
+	for _, provider := range sortedKeys(metrics.ProviderThrottled) {
+		_, _ = fmt.Fprintf(w, "vault_swarm_plugin_provider_throttled_total{provider=\"%s\"} %d\n", provider, metrics.ProviderThrottled[provider])
+	}
+
+	authProviders := make([]string, 0, len(metrics.ProviderAuth))
+	for provider := range metrics.ProviderAuth {
+		authProviders = append(authProviders, provider)
+	}
+	sort.Strings(authProviders)
+
+	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_provider_auth_total Total number of provider logins by result\n")
+	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_provider_auth_total counter\n")
+	for _, provider := range authProviders {
+		auth := metrics.ProviderAuth[provider]
+		_, _ = fmt.Fprintf(w, "vault_swarm_plugin_provider_auth_total{provider=\"%s\",result=\"success\"} %d\n", provider, auth.Successes)
+		_, _ = fmt.Fprintf(w, "vault_swarm_plugin_provider_auth_total{provider=\"%s\",result=\"failure\"} %d\n", provider, auth.Failures)
+	}
+
+	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_provider_auth_latency_seconds Time spent logging in to the provider backend\n")
+	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_provider_auth_latency_seconds summary\n")
+	for _, provider := range authProviders {
+		auth := metrics.ProviderAuth[provider]
+		_, _ = fmt.Fprintf(w, "vault_swarm_plugin_provider_auth_latency_seconds_sum{provider=\"%s\"} %g\n", provider, auth.LatencyTotal.Seconds())
+		_, _ = fmt.Fprintf(w, "vault_swarm_plugin_provider_auth_latency_seconds_count{provider=\"%s\"} %d\n", provider, auth.Successes+auth.Failures)
+	}
+
+	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_monitor_panics_total Total number of secret change checks that panicked and were recovered\n")
+	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_monitor_panics_total counter\n")
+	_, _ = fmt.Fprintf(w, "vault_swarm_plugin_monitor_panics_total %d\n", metrics.MonitorPanics)
+
+	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_version_reverts_total Total number of secrets whose backend version went backward\n")
+	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_version_reverts_total counter\n")
+	_, _ = fmt.Fprintf(w, "vault_swarm_plugin_version_reverts_total %d\n", metrics.VersionReverts)
+
+	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_secret_value_bytes Size of delivered secret values\n")
+	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_secret_value_bytes histogram\n")
+	var cumulative int64
+	for i, bound := range SecretSizeBuckets {
+		cumulative += metrics.SecretSizeCounts[i]
+		_, _ = fmt.Fprintf(w, "vault_swarm_plugin_secret_value_bytes_bucket{le=\"%d\"} %d\n", bound, cumulative)
+	}
+	cumulative += metrics.SecretSizeCounts[len(SecretSizeBuckets)]
+	_, _ = fmt.Fprintf(w, "vault_swarm_plugin_secret_value_bytes_bucket{le=\"+Inf\"} %d\n", cumulative)
+	_, _ = fmt.Fprintf(w, "vault_swarm_plugin_secret_value_bytes_sum %d\n", metrics.SecretSizeSum)
+	_, _ = fmt.Fprintf(w, "vault_swarm_plugin_secret_value_bytes_count %d\n", cumulative)
+
+	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_stale_reads_total Total number of secrets served from the last-known value after a failed read\n")
+	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_stale_reads_total counter\n")
+	_, _ = fmt.Fprintf(w, "vault_swarm_plugin_stale_reads_total %d\n", metrics.StaleReads)
+
+	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_provider_collisions_total Total number of tracked secrets dropped because another provider serves the same name\n")
+	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_provider_collisions_total counter\n")
+	_, _ = fmt.Fprintf(w, "vault_swarm_plugin_provider_collisions_total %d\n", metrics.ProviderCollisions)
+
+	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_cache_entries Number of last-known secret values cached\n")
+	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_cache_entries gauge\n")
+	_, _ = fmt.Fprintf(w, "vault_swarm_plugin_cache_entries %d\n", metrics.CacheEntries)
+
+	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_cache_bytes Total size of the cached last-known secret values\n")
+	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_cache_bytes gauge\n")
+	_, _ = fmt.Fprintf(w, "vault_swarm_plugin_cache_bytes %d\n", metrics.CacheBytes)
+
+	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_cache_evictions_total Total number of cached values evicted by the cache limits\n")
+	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_cache_evictions_total counter\n")
+	_, _ = fmt.Fprintf(w, "vault_swarm_plugin_cache_evictions_total %d\n", metrics.CacheEvictions)
+
 	_, _ = fmt.Fprintf(w, "# HELP vault_swarm_plugin_gc_total Total number of garbage collections\n")
 	_, _ = fmt.Fprintf(w, "# TYPE vault_swarm_plugin_gc_total counter\n")
 	_, _ = fmt.Fprintf(w, "vault_swarm_plugin_gc_total %d\n", metrics.NumGC)
 }
-
-const dashboardTemplate = `
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Vault Swarm Plugin Monitor</title>
-    <meta http-equiv="refresh" content="30">
-    <style>
-        body { 
-            font-family: Arial, sans-serif; 
-            margin: 20px; 
-            background-color: #f5f5f5;
-        }
-        .container {
-            max-width: 1200px;
-            margin: 0 auto;
-            background-color: white;
-            padding: 20px;
-            border-radius: 8px;
-            box-shadow: 0 2px 4px rgba(0,0,0,0.1);
-        }
-        .header {
-            text-align: center;
-            color: #333;
-            border-bottom: 2px solid #007acc;
-            padding-bottom: 10px;
-            margin-bottom: 20px;
-        }
-        .status {
-            display: inline-block;
-            padding: 5px 10px;
-            border-radius: 4px;
-            color: white;
-            font-weight: bold;
-        }
-        .healthy { background-color: #28a745; }
-        .unhealthy { background-color: #dc3545; }
-        .grid {
-            display: grid;
-            grid-template-columns: repeat(auto-fit, minmax(300px, 1fr));
-            gap: 20px;
-            margin-top: 20px;
-        }
-        .card {
-            background-color: #f8f9fa;
-            padding: 15px;
-            border-radius: 6px;
-            border-left: 4px solid #007acc;
-        }
-        .card h3 {
-            margin-top: 0;
-            color: #333;
-        }
-        .metric {
-            display: flex;
-            justify-content: space-between;
-            margin: 10px 0;
-            padding: 5px 0;
-            border-bottom: 1px solid #e0e0e0;
-        }
-        .metric:last-child {
-            border-bottom: none;
-        }
-        .metric-label {
-            font-weight: bold;
-            color: #555;
-        }
-        .metric-value {
-            color: #007acc;
-        }
-        .footer {
-            text-align: center;
-            margin-top: 20px;
-            color: #666;
-            font-size: 0.9em;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <h1>🔐 Vault Swarm Plugin Monitor</h1>
-            <p>Real-time monitoring of secret provider plugin</p>
-            <span class="status {{if .Health.healthy}}healthy{{else}}unhealthy{{end}}">
-                {{if .Health.healthy}}HEALTHY{{else}}UNHEALTHY{{end}}
-            </span>
-        </div>
-
-        <div class="grid">
-            <div class="card">
-                <h3>📊 System Metrics</h3>
-                <div class="metric">
-                    <span class="metric-label">Goroutines:</span>
-                    <span class="metric-value">{{.Metrics.NumGoroutines}}</span>
-                </div>
-                <div class="metric">
-                    <span class="metric-label">Memory Allocated:</span>
-                    <span class="metric-value">{{printf "%.2f" (div .Metrics.MemAllocBytes 1048576.0)}} MB</span>
-                </div>
-                <div class="metric">
-                    <span class="metric-label">Memory System:</span>
-                    <span class="metric-value">{{printf "%.2f" (div .Metrics.MemSysBytes 1048576.0)}} MB</span>
-                </div>
-                <div class="metric">
-                    <span class="metric-label">Memory Heap:</span>
-                    <span class="metric-value">{{printf "%.2f" (div .Metrics.MemHeapBytes 1048576.0)}} MB</span>
-                </div>
-                <div class="metric">
-                    <span class="metric-label">GC Cycles:</span>
-                    <span class="metric-value">{{.Metrics.NumGC}}</span>
-                </div>
-            </div>
-
-            <div class="card">
-                <h3>🔄 Secret Rotation</h3>
-                <div class="metric">
-                    <span class="metric-label">Total Rotations:</span>
-                    <span class="metric-value">{{.Metrics.SecretRotations}}</span>
-                </div>
-                <div class="metric">
-                    <span class="metric-label">Rotation Errors:</span>
-                    <span class="metric-value">{{.Metrics.SecretRotationErrors}}</span>
-                </div>
-                <div class="metric">
-                    <span class="metric-label">Error Rate:</span>
-                    <span class="metric-value">{{printf "%.2f" .Health.error_rate}}%</span>
-                </div>
-                <div class="metric">
-                    <span class="metric-label">Rotation Interval:</span>
-                    <span class="metric-value">{{.Metrics.RotationInterval}}</span>
-                </div>
-                <div class="metric">
-                    <span class="metric-label">Last Ticker Beat:</span>
-                    <span class="metric-value">{{if .Metrics.TickerHeartbeat.IsZero}}Never{{else}}{{.Metrics.TickerHeartbeat.Format "15:04:05"}}{{end}}</span>
-                </div>
-            </div>
-
-            <div class="card">
-                <h3>⏱️ Uptime & Status</h3>
-                <div class="metric">
-                    <span class="metric-label">Uptime:</span>
-                    <span class="metric-value">{{printf "%.2f" .Health.uptime_seconds}} seconds</span>
-                </div>
-                <div class="metric">
-                    <span class="metric-label">Started At:</span>
-                    <span class="metric-value">{{.Metrics.MonitoringStartTime.Format "2006-01-02 15:04:05"}}</span>
-                </div>
-                <div class="metric">
-                    <span class="metric-label">Ticker Health:</span>
-                    <span class="metric-value">{{if .Health.ticker_healthy}}✅ Healthy{{else}}❌ Unhealthy{{end}}</span>
-                </div>
-                <div class="metric">
-                    <span class="metric-label">Last GC:</span>
-                    <span class="metric-value">{{if .Metrics.LastGCTime.IsZero}}Never{{else}}{{.Metrics.LastGCTime.Format "15:04:05"}}{{end}}</span>
-                </div>
-            </div>
-        </div>
-
-        <div class="footer">
-            <p>Page auto-refreshes every 30 seconds | 
-               <a href="/metrics">JSON Metrics</a> | 
-               <a href="/health">Health Check</a> | 
-               <a href="/api/metrics">Prometheus Metrics</a>
-            </p>
-        </div>
-    </div>
-</body>
-</html>
-`
@@ -0,0 +1,249 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIVerifyRequiresAdminToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		adminToken    string
+		authorization string
+		want          int
+	}{
+		{"no token configured", "", "Bearer secret", http.StatusForbidden},
+		{"missing token", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"not a bearer token", "secret", "Basic secret", http.StatusUnauthorized},
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verified := false
+			wi := NewWebInterface(nil, 0)
+			wi.SetEvictHandler(tt.adminToken, func(string) bool { return false })
+			wi.SetVerifySource(func(ctx context.Context) []SecretDrift {
+				verified = true
+				return nil
+			})
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/api/verify", nil)
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			wi.server.Handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.want {
+				t.Errorf("status = %d, expected %d", recorder.Code, tt.want)
+			}
+			if verified != (tt.want == http.StatusOK) {
+				t.Errorf("backends read = %v on status %d", verified, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestHealthzSeparatesComponents(t *testing.T) {
+	down := errors.New("connection refused")
+	tests := []struct {
+		name         string
+		providerErr  error
+		dockerErr    error
+		want         int
+		wantProvider bool
+		wantDocker   bool
+	}{
+		{"all healthy", nil, nil, http.StatusOK, true, true},
+		{"provider down", down, nil, http.StatusServiceUnavailable, false, true},
+		{"docker down", nil, down, http.StatusServiceUnavailable, true, false},
+		{"both down", down, down, http.StatusServiceUnavailable, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wi := NewWebInterface(nil, 0)
+			wi.AddHealthCheck("provider", func(ctx context.Context) error { return tt.providerErr })
+			wi.AddHealthCheck("docker", func(ctx context.Context) error { return tt.dockerErr })
+
+			recorder := httptest.NewRecorder()
+			wi.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+			var body struct {
+				Healthy    bool                       `json:"healthy"`
+				Components map[string]ComponentHealth `json:"components"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid response %q: %v", recorder.Body, err)
+			}
+			if recorder.Code != tt.want || body.Healthy != (tt.want == http.StatusOK) {
+				t.Errorf("status = %d, healthy = %v, expected %d", recorder.Code, body.Healthy, tt.want)
+			}
+			if body.Components["provider"].Healthy != tt.wantProvider || body.Components["docker"].Healthy != tt.wantDocker {
+				t.Errorf("components = %+v, expected provider %v and docker %v", body.Components, tt.wantProvider, tt.wantDocker)
+			}
+			if !tt.wantDocker && body.Components["docker"].Error != down.Error() {
+				t.Errorf("docker error = %q, expected %q", body.Components["docker"].Error, down)
+			}
+		})
+	}
+}
+
+func TestAPIVerifyRateLimited(t *testing.T) {
+	runs := 0
+	wi := NewWebInterface(nil, 0)
+	wi.SetEvictHandler("secret", func(string) bool { return false })
+	wi.SetVerifySource(func(ctx context.Context) []SecretDrift {
+		runs++
+		return nil
+	})
+
+	verify := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/api/verify", nil)
+		request.Header.Set("Authorization", "Bearer secret")
+		wi.server.Handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if code := verify().Code; code != http.StatusOK {
+		t.Fatalf("first request: status = %d, expected %d", code, http.StatusOK)
+	}
+	limited := verify()
+	if limited.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status = %d, expected %d", limited.Code, http.StatusTooManyRequests)
+	}
+	if limited.Header().Get("Retry-After") == "" {
+		t.Error("rate limited response has no Retry-After header")
+	}
+	if runs != 1 {
+		t.Errorf("backends read %d times, expected once", runs)
+	}
+
+	// Once the interval has passed the endpoint runs again
+	wi.verifyMu.Lock()
+	wi.lastVerify = time.Now().Add(-verifyInterval)
+	wi.verifyMu.Unlock()
+	if code := verify().Code; code != http.StatusOK {
+		t.Errorf("request after the interval: status = %d, expected %d", code, http.StatusOK)
+	}
+}
+
+func TestDashboardRenders(t *testing.T) {
+	tests := []struct {
+		name     string
+		secrets  []SecretStatus
+		rotated  bool
+		contains []string
+	}{
+		{"empty tracker", nil, false, []string{"No secrets are tracked yet", "No rotations yet"}},
+		{"tracked secret", []SecretStatus{{
+			Name:        "db_password",
+			Provider:    "vault",
+			Services:    []string{"api", "worker"},
+			LastUpdated: time.Now(),
+			LastError:   "permission denied",
+		}}, true, []string{"db_password", "api, worker", "permission denied", "Rotated"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := NewMonitor(time.Minute)
+			if tt.rotated {
+				monitor.RecordRotation("db_password", nil)
+			}
+			wi := NewWebInterface(monitor, 0)
+			wi.SetSecretsSource(func() []SecretStatus { return tt.secrets })
+
+			recorder := httptest.NewRecorder()
+			wi.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, expected %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+			}
+			for _, text := range tt.contains {
+				if !strings.Contains(recorder.Body.String(), text) {
+					t.Errorf("dashboard does not contain %q", text)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIPendingListsDetectedChanges(t *testing.T) {
+	detected := time.Now().Add(-time.Minute)
+	wi := NewWebInterface(nil, 0)
+	wi.SetSecretsSource(func() []SecretStatus {
+		return []SecretStatus{
+			{Name: "rotated", Provider: "vault"},
+			{Name: "newer", Provider: "vault", ChangeDetectedAt: detected.Add(30 * time.Second)},
+			{Name: "older", Provider: "aws", ChangeDetectedAt: detected},
+		}
+	})
+
+	recorder := httptest.NewRecorder()
+	wi.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/pending", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, expected %d", recorder.Code, http.StatusOK)
+	}
+
+	var pending []SecretStatus
+	if err := json.NewDecoder(recorder.Body).Decode(&pending); err != nil {
+		t.Fatalf("failed to decode pending secrets: %v", err)
+	}
+	if len(pending) != 2 || pending[0].Name != "older" || pending[1].Name != "newer" {
+		t.Fatalf("pending = %+v, expected older then newer", pending)
+	}
+	if !pending[0].ChangeDetectedAt.Equal(detected) {
+		t.Errorf("change_detected_at = %v, expected %v", pending[0].ChangeDetectedAt, detected)
+	}
+}
+
+func TestAPIEvict(t *testing.T) {
+	tests := []struct {
+		name          string
+		adminToken    string
+		authorization string
+		secret        string
+		want          int
+		wantEvicted   bool
+	}{
+		{"no token configured", "", "Bearer secret", "db_password", http.StatusForbidden, false},
+		{"wrong token", "secret", "Bearer wrong", "db_password", http.StatusUnauthorized, false},
+		{"tracked secret", "secret", "Bearer secret", "db_password", http.StatusNoContent, true},
+		{"unknown secret", "secret", "Bearer secret", "api_key", http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracked := map[string]bool{"db_password": true}
+			wi := NewWebInterface(nil, 0)
+			wi.SetEvictHandler(tt.adminToken, func(name string) bool {
+				if !tracked[name] {
+					return false
+				}
+				delete(tracked, name)
+				return true
+			})
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodDelete, "/api/secrets/"+tt.secret, nil)
+			request.Header.Set("Authorization", tt.authorization)
+			wi.server.Handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.want {
+				t.Errorf("status = %d, expected %d", recorder.Code, tt.want)
+			}
+			if evicted := !tracked["db_password"]; evicted != tt.wantEvicted {
+				t.Errorf("db_password evicted = %v, expected %v", evicted, tt.wantEvicted)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	log "github.com/sirupsen/logrus"
+)
+
+// onErrorLabel selects what a failed read delivers: fail (default), empty,
+// or default:<literal>
+const onErrorLabel = "on_error"
+
+// parseOnError returns the value to deliver instead of failing, and whether
+// the policy delivers one at all
+func parseOnError(policy string) ([]byte, bool, error) {
+	switch {
+	case policy == "" || policy == "fail":
+		return nil, false, nil
+	case policy == "empty":
+		return []byte{}, true, nil
+	case strings.HasPrefix(policy, "default:"):
+		return []byte(strings.TrimPrefix(policy, "default:")), true, nil
+	default:
+		return nil, false, fmt.Errorf("invalid %s label %q: use fail, empty or default:<value>", onErrorLabel, policy)
+	}
+}
+
+// onErrorResponse answers a failed request according to its on_error label.
+// A fallback is never reused for other tasks, so they retry the backend.
+func onErrorResponse(logger *log.Entry, req secrets.Request, message string) secrets.Response {
+	fallback, degrade, _ := parseOnError(req.SecretLabels[onErrorLabel])
+	if !degrade {
+		return secrets.Response{Err: message}
+	}
+
+	logger.Warnf("Serving %s fallback for secret %s: %s", onErrorLabel, req.SecretName, message)
+	return secrets.Response{
+		Value:      fallback,
+		DoNotReuse: true,
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestOnErrorPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		path       string
+		wantErr    bool
+		want       string
+		doNotReuse bool
+	}{
+		{"read succeeds", "default:fallback", "db", false, "stored", false},
+		{"fail by default", "", "missing", true, "", false},
+		{"fail", "fail", "missing", true, "", false},
+		{"empty", "empty", "missing", false, "", true},
+		{"default literal", "default:fallback", "missing", false, "fallback", true},
+		{"default literal keeps colons", "default:host:5432", "missing", false, "host:5432", true},
+		{"empty default literal", "default:", "missing", false, "", true},
+		{"invalid policy", "retry-forever", "db", true, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := newTestDriver(&fakeProvider{values: map[string]string{"db": "stored"}}, &fakeDocker{})
+			labels := map[string]string{"fake_path": tt.path}
+			if tt.policy != "" {
+				labels[onErrorLabel] = tt.policy
+			}
+
+			response := driver.Get(secrets.Request{SecretName: "db_password", SecretLabels: labels})
+			if (response.Err != "") != tt.wantErr {
+				t.Fatalf("Get() error = %q, wantErr %v", response.Err, tt.wantErr)
+			}
+			if string(response.Value) != tt.want {
+				t.Errorf("Get() = %q, expected %q", response.Value, tt.want)
+			}
+			if response.DoNotReuse != tt.doNotReuse {
+				t.Errorf("DoNotReuse = %v, expected %v", response.DoNotReuse, tt.doNotReuse)
+			}
+		})
+	}
+}
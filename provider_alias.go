@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// providerAliasLabel selects one of the PROVIDER_ALIASES for a secret
+const providerAliasLabel = "provider"
+
+// providerAlias is a named provider instance declared in PROVIDER_ALIASES
+type providerAlias struct {
+	name         string
+	providerType string
+	prefix       string // settings are the variables with this prefix, stripped
+}
+
+// parseProviderAliases parses PROVIDER_ALIASES, a comma separated list of
+// alias=type:PREFIX_ entries, e.g. "vault-a=vault:VAULT_A_,vault-b=vault:VAULT_B_".
+// The aliases are returned in the declared order, which is also the order they
+// are initialized in.
+func parseProviderAliases(raw string) ([]providerAlias, error) {
+	var aliases []providerAlias
+	declared := make(map[string]bool)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, spec, found := strings.Cut(entry, "=")
+		providerType, prefix, hasPrefix := strings.Cut(spec, ":")
+		name, providerType, prefix = strings.TrimSpace(name), strings.TrimSpace(providerType), strings.TrimSpace(prefix)
+		if !found || !hasPrefix || name == "" || providerType == "" || prefix == "" {
+			return nil, fmt.Errorf("invalid entry %q, expected alias=type:PREFIX_", entry)
+		}
+		if declared[name] {
+			return nil, fmt.Errorf("alias %s is declared twice", name)
+		}
+		declared[name] = true
+		aliases = append(aliases, providerAlias{name: name, providerType: providerType, prefix: prefix})
+	}
+	return aliases, nil
+}
+
+// aliasSettings returns the settings of an alias: every variable starting with
+// its prefix, under the name without it
+func aliasSettings(settings map[string]string, prefix string) map[string]string {
+	aliased := make(map[string]string)
+	for key, value := range settings {
+		if name, found := strings.CutPrefix(key, prefix); found && name != "" {
+			aliased[name] = value
+		}
+	}
+	return aliased
+}
+
+// aliasProvider is the provider of one alias. With LAZY_ALIAS_INIT it is
+// initialized by the first request for the alias instead of at startup.
+type aliasProvider struct {
+	alias        providerAlias
+	settings     map[string]string
+	mutex        sync.Mutex
+	provider     providers.SecretsProvider
+	ready        bool
+	lastErr      error              // last failed initialization, retried in the background
+	initializing singleflight.Group // the initialization in flight, shared by its callers
+}
+
+// get returns the initialized provider, trying once to initialize it if
+// needed. Callers arriving during an initialization wait for it until ctx ends.
+func (a *aliasProvider) get(ctx context.Context) (providers.SecretsProvider, error) {
+	a.mutex.Lock()
+	ready := a.ready
+	a.mutex.Unlock()
+	if ready {
+		return a.provider, nil
+	}
+
+	result := a.initializing.DoChan(a.alias.name, func() (interface{}, error) {
+		return nil, a.initialize(0, 0)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("provider alias %s is still initializing: %w", a.alias.name, ctx.Err())
+	case initialized := <-result:
+		if initialized.Err != nil {
+			return nil, fmt.Errorf("provider alias %s is not available: %w", a.alias.name, initialized.Err)
+		}
+		return a.provider, nil
+	}
+}
+
+// initialize initializes the provider without holding the mutex, so the
+// readers of the alias are not held up by a slow backend. Only one
+// initialization runs at a time: at startup, or through get.
+func (a *aliasProvider) initialize(maxRetries int, backoff time.Duration) error {
+	err := initializeProvider(a.provider, a.settings, maxRetries, backoff)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if err != nil {
+		a.lastErr = err
+		return err
+	}
+	log.Printf("Initialized provider alias %s (%s) from %s* settings", a.alias.name, a.provider.GetProviderName(), a.alias.prefix)
+	a.ready = true
+	a.lastErr = nil
+	return nil
+}
+
+// failed reports whether the last initialization of the alias failed
+func (a *aliasProvider) failed() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return !a.ready && a.lastErr != nil
+}
+
+// initializeAliases creates the provider of every alias, in the order they are
+// declared, and initializes it unless lazy is set. Unknown provider types fail
+// even when lazy, so typos are still caught at startup.
+func initializeAliases(aliases []providerAlias, settings map[string]string, dockerClient providers.SwarmConfigAPI, lazy bool, maxRetries int, backoff time.Duration) (map[string]*aliasProvider, error) {
+	created := make(map[string]*aliasProvider, len(aliases))
+	closeAll := func() {
+		for _, entry := range created {
+			if entry.ready {
+				_ = entry.provider.Close()
+			}
+		}
+	}
+
+	for _, alias := range aliases {
+		provider, err := providers.CreateProvider(alias.providerType)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("provider alias %s: %v", alias.name, err)
+		}
+		useDockerClient(provider, dockerClient)
+		// Isolated, so neither the plugin's own variables nor the credentials
+		// the SDKs find on the host reach another instance
+		entry := &aliasProvider{
+			alias:    alias,
+			settings: providers.Isolated(aliasSettings(settings, alias.prefix)),
+			provider: provider,
+		}
+		created[alias.name] = entry
+		if lazy {
+			continue
+		}
+		if err := entry.initialize(maxRetries, backoff); err != nil {
+			closeAll()
+			return nil, fmt.Errorf("provider alias %s: %v", alias.name, err)
+		}
+	}
+	return created, nil
+}
+
+// startAliasRetries periodically retries the lazy aliases whose last
+// initialization failed, so a recovered backend is ready before it is needed
+func (d *SecretsDriver) startAliasRetries() {
+	ticker := time.NewTicker(d.config.AliasRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.monitorCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, entry := range d.aliasProviders {
+			if !entry.failed() {
+				continue
+			}
+			if _, err := entry.get(d.monitorCtx); err != nil {
+				log.Warnf("Background retry failed: %v", err)
+			}
+		}
+	}
+}
+
+// closeProviderAliases closes the provider of every initialized alias
+func (d *SecretsDriver) closeProviderAliases() {
+	for name, entry := range d.aliasProviders {
+		entry.mutex.Lock()
+		if entry.ready {
+			if err := entry.provider.Close(); err != nil {
+				log.Warnf("Error closing provider alias %s: %v", name, err)
+			}
+		}
+		entry.mutex.Unlock()
+	}
+}
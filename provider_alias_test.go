@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestVaultAliases(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "plugin-token")
+
+	aliases, err := parseProviderAliases("vault-a=vault:VAULT_A_, vault-b=vault:VAULT_B_")
+	if err != nil {
+		t.Fatalf("parseProviderAliases() error = %v", err)
+	}
+	settings := map[string]string{
+		"VAULT_ADDR":          "https://vault.plugin:8200",
+		"VAULT_TOKEN":         "plugin-token",
+		"VAULT_A_VAULT_ADDR":  "https://vault-a.internal:8200",
+		"VAULT_A_VAULT_TOKEN": "token-a",
+		"VAULT_B_VAULT_ADDR":  "https://vault-b.internal:8200",
+		"VAULT_B_VAULT_TOKEN": "token-b",
+	}
+
+	entries, err := initializeAliases(aliases, settings, nil, false, 0, 0)
+	if err != nil {
+		t.Fatalf("initializeAliases() error = %v", err)
+	}
+	if entries["vault-a"].provider == entries["vault-b"].provider {
+		t.Fatalf("both aliases share one provider")
+	}
+
+	tests := []struct {
+		alias string
+		addr  string
+		token string
+	}{
+		{"vault-a", "https://vault-a.internal:8200", "token-a"},
+		{"vault-b", "https://vault-b.internal:8200", "token-b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alias, func(t *testing.T) {
+			entry := entries[tt.alias]
+			if got := entry.settings["VAULT_ADDR"]; got != tt.addr {
+				t.Errorf("VAULT_ADDR = %q, expected %q", got, tt.addr)
+			}
+			if got := entry.settings["VAULT_TOKEN"]; got != tt.token {
+				t.Errorf("VAULT_TOKEN = %q, expected %q", got, tt.token)
+			}
+
+			driver := newTestDriver(&fakeProvider{}, &fakeDocker{})
+			driver.aliasProviders = entries
+			provider, instance, err := driver.providerFor(context.Background(), secrets.Request{
+				SecretName:   "db_password",
+				SecretLabels: map[string]string{providerAliasLabel: tt.alias},
+			})
+			if err != nil {
+				t.Fatalf("providerFor() error = %v", err)
+			}
+			if instance != tt.alias || provider != entry.provider {
+				t.Errorf("providerFor() did not return the provider of %s", tt.alias)
+			}
+		})
+	}
+}
+
+func TestAliasDoesNotInheritPluginCredentials(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "plugin-token")
+
+	aliases, err := parseProviderAliases("vault-b=vault:VAULT_B_")
+	if err != nil {
+		t.Fatalf("parseProviderAliases() error = %v", err)
+	}
+	settings := map[string]string{
+		"VAULT_TOKEN":        "plugin-token",
+		"VAULT_B_VAULT_ADDR": "https://vault-b.internal:8200",
+	}
+
+	// Neither the plugin's VAULT_TOKEN setting nor its environment is used
+	if _, err := initializeAliases(aliases, settings, nil, false, 0, 0); err == nil {
+		t.Fatalf("initializeAliases() succeeded without a token for the alias")
+	}
+}
+
+// newApproleVault serves AppRole logins and the secret db to the alias
+// settings it returns, failing every request while down is set
+func newApproleVault(t *testing.T) (settings map[string]string, down *atomic.Bool, logins *atomic.Int32) {
+	t.Helper()
+	down, logins = &atomic.Bool{}, &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Down, logins fail like on a Vault without the approle mount yet.
+		// Unlike 5xx answers, the client does not retry them.
+		if down.Load() {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors":["no handler for route \"auth/approle/login\". route entry not found."]}`)
+			return
+		}
+		switch {
+		case r.URL.Path == "/v1/auth/approle/login":
+			logins.Add(1)
+			fmt.Fprint(w, `{"auth":{"client_token":"alias-token","lease_duration":3600}}`)
+		case r.URL.Path == "/v1/secret/data/db" && r.Header.Get("X-Vault-Token") == "alias-token":
+			fmt.Fprint(w, `{"data":{"data":{"value":"from-alias"},"metadata":{"version":1}}}`)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	settings = map[string]string{
+		"VAULT_B_VAULT_ADDR":        server.URL,
+		"VAULT_B_VAULT_AUTH_METHOD": "approle",
+		"VAULT_B_VAULT_ROLE_ID":     "role",
+		"VAULT_B_VAULT_SECRET_ID":   "secret",
+	}
+	return settings, down, logins
+}
+
+func TestLazyAliasInit(t *testing.T) {
+	settings, down, logins := newApproleVault(t)
+	aliases, err := parseProviderAliases("vault-b=vault:VAULT_B_")
+	if err != nil {
+		t.Fatalf("parseProviderAliases() error = %v", err)
+	}
+	down.Store(true)
+
+	if _, err := initializeAliases(aliases, settings, nil, false, 0, 0); err == nil {
+		t.Fatalf("eager initializeAliases() succeeded while the backend is down")
+	}
+
+	// A down alias does not block startup when initialized lazily
+	entries, err := initializeAliases(aliases, settings, nil, true, 0, 0)
+	if err != nil {
+		t.Fatalf("lazy initializeAliases() error = %v", err)
+	}
+	if entries["vault-b"].ready || entries["vault-b"].failed() {
+		t.Fatalf("lazy alias was initialized at startup")
+	}
+
+	driver := newTestDriver(&fakeProvider{values: map[string]string{}}, &fakeDocker{})
+	driver.aliasProviders = entries
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"provider": "vault-b", "vault_path": "db"}}
+
+	// Requests for the alias fail on their own while it is down
+	if response := driver.Get(req); !strings.Contains(response.Err, "provider alias vault-b is not available") {
+		t.Fatalf("Get() error = %q, expected the alias to be unavailable", response.Err)
+	}
+	if !entries["vault-b"].failed() {
+		t.Errorf("failed() = false after a failed initialization")
+	}
+
+	down.Store(false)
+	response := driver.Get(req)
+	if response.Err != "" {
+		t.Fatalf("Get failed once the backend is up: %s", response.Err)
+	}
+	if string(response.Value) != "from-alias" {
+		t.Errorf("Get() = %q, expected %q", response.Value, "from-alias")
+	}
+	if entries["vault-b"].failed() || !entries["vault-b"].ready {
+		t.Errorf("alias is not ready after a successful initialization")
+	}
+
+	// Later requests reuse the initialized provider
+	if response := driver.Get(req); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	if n := logins.Load(); n != 1 {
+		t.Errorf("logged in %d times, expected once", n)
+	}
+}
+
+func TestLazyAliasBackgroundRetry(t *testing.T) {
+	settings, down, logins := newApproleVault(t)
+	aliases, err := parseProviderAliases("vault-b=vault:VAULT_B_")
+	if err != nil {
+		t.Fatalf("parseProviderAliases() error = %v", err)
+	}
+	entries, err := initializeAliases(aliases, settings, nil, true, 0, 0)
+	if err != nil {
+		t.Fatalf("lazy initializeAliases() error = %v", err)
+	}
+
+	driver := newTestDriver(&fakeProvider{values: map[string]string{}}, &fakeDocker{})
+	driver.aliasProviders = entries
+	driver.config.AliasRetryInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	driver.monitorCtx = ctx
+	go driver.startAliasRetries()
+
+	// Aliases never requested are left alone
+	time.Sleep(50 * time.Millisecond)
+	if n := logins.Load(); n != 0 {
+		t.Fatalf("background retries logged in %d times for an unused alias", n)
+	}
+
+	down.Store(true)
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"provider": "vault-b", "vault_path": "db"}}
+	if response := driver.Get(req); response.Err == "" {
+		t.Fatalf("Get() succeeded while the backend is down")
+	}
+
+	// Once the backend recovers the alias is ready before the next request
+	down.Store(false)
+	deadline := time.Now().Add(2 * time.Second)
+	for entries["vault-b"].failed() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if entries["vault-b"].failed() {
+		t.Fatalf("background retries did not initialize the recovered alias")
+	}
+	if response := driver.Get(req); response.Err != "" || string(response.Value) != "from-alias" {
+		t.Errorf("Get() = %q, %q, expected %q", response.Value, response.Err, "from-alias")
+	}
+	if n := logins.Load(); n != 1 {
+		t.Errorf("logged in %d times, expected once", n)
+	}
+}
@@ -0,0 +1,31 @@
+package providers
+
+import (
+	"sync"
+	"time"
+)
+
+// authStats counts a provider's logins against its backend for AuthReporter
+type authStats struct {
+	mu    sync.Mutex
+	stats AuthStats
+}
+
+// record counts a login that started at start and ended with err
+func (a *authStats) record(start time.Time, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err != nil {
+		a.stats.Failures++
+	} else {
+		a.stats.Successes++
+	}
+	a.stats.LatencyTotal += time.Since(start)
+}
+
+// snapshot returns the counts recorded so far
+func (a *authStats) snapshot() AuthStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stats
+}
@@ -0,0 +1,82 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVaultAuthStats(t *testing.T) {
+	var loginFails, renewFails atomic.Bool
+	loginFails.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			if loginFails.Load() {
+				http.Error(w, `{"errors":["invalid secret id"]}`, http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"auth":{"client_token":"approle-token","renewable":true,"lease_duration":30}}`)
+		case "/v1/auth/token/lookup-self":
+			fmt.Fprint(w, `{"data":{"ttl":30,"renewable":true}}`)
+		case "/v1/auth/token/renew-self":
+			if renewFails.Load() {
+				http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, `{"auth":{"client_token":"approle-token","renewable":true,"lease_duration":3600}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	config := Isolated(map[string]string{
+		"VAULT_ADDR":        server.URL,
+		"VAULT_AUTH_METHOD": "approle",
+		"VAULT_ROLE_ID":     "role",
+		"VAULT_SECRET_ID":   "secret",
+	})
+	v := &VaultProvider{}
+	expect := func(step string, successes, failures int64) {
+		t.Helper()
+		stats := v.AuthStats()
+		if stats.Successes != successes || stats.Failures != failures {
+			t.Errorf("%s: %d successes and %d failures, expected %d and %d", step, stats.Successes, stats.Failures, successes, failures)
+		}
+	}
+
+	if err := v.Initialize(config); err == nil {
+		t.Fatalf("Initialize() succeeded with a rejected login")
+	}
+	expect("failed login", 0, 1)
+
+	loginFails.Store(false)
+	if err := v.Initialize(config); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	expect("login", 1, 1)
+
+	// The token has 30s left, within the margin, so it is renewed
+	if err := v.RenewToken(context.Background(), time.Minute); err != nil {
+		t.Fatalf("RenewToken() error = %v", err)
+	}
+	expect("renewal", 2, 1)
+
+	// A token with more left than the margin is not touched
+	if err := v.RenewToken(context.Background(), time.Second); err != nil {
+		t.Fatalf("RenewToken() error = %v", err)
+	}
+	expect("renewal not needed", 2, 1)
+
+	// A failed renewal counts and falls back to logging in again
+	renewFails.Store(true)
+	if err := v.RenewToken(context.Background(), time.Minute); err != nil {
+		t.Fatalf("RenewToken() error = %v", err)
+	}
+	expect("login after failed renewal", 3, 2)
+}
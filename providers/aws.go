@@ -2,86 +2,179 @@ package providers
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/json"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
 	"github.com/docker/go-plugins-helpers/secrets"
 	log "github.com/sirupsen/logrus"
 )
 
 // AWSProvider implements the SecretsProvider interface for AWS Secrets Manager
 type AWSProvider struct {
-	client *secretsmanager.Client
-	config *AWSConfig
+	clients      []*secretsmanager.Client // one per region, in failover order
+	stsClients   []*sts.Client            // same order, for credential checks
+	activeRegion int
+	regionMutex  sync.RWMutex
+	config       *AWSConfig
+	proxy        func(*http.Request) (*url.URL, error)
+	tlsConfig    *tls.Config
+	throttle     *throttleBackoff
+	versionCache
 }
 
 // AWSConfig holds the configuration for the AWS Secrets Manager client
 type AWSConfig struct {
 	Region      string
+	Regions     []string
 	AccessKey   string
 	SecretKey   string
 	Profile     string
 	EndpointURL string
+	// Detect changes from ListSecrets timestamps instead of reading every secret
+	BatchChangeDetection bool
+	// Read due secrets with BatchGetSecretValue instead of one call each
+	BatchRead bool
+	// Where the service name goes in default secret names
+	Naming ServiceNaming
+	// Use only the configured keys, never the SDK's default credential chain
+	Isolated bool
 }
 
 // Initialize sets up the AWS provider with the given configuration
 func (a *AWSProvider) Initialize(config map[string]string) error {
+	naming, err := serviceNaming(config)
+	if err != nil {
+		return err
+	}
+
 	a.config = &AWSConfig{
-		Region:      getConfigOrDefault(config, "AWS_REGION", "us-east-1"),
+		Region:      getConfigOrDefault(config, "AWS_REGION", defaultAWSRegion(config)),
 		AccessKey:   config["AWS_ACCESS_KEY_ID"],
 		SecretKey:   config["AWS_SECRET_ACCESS_KEY"],
 		Profile:     config["AWS_PROFILE"],
 		EndpointURL: config["AWS_ENDPOINT_URL"],
+		// Opt-in since it needs secretsmanager:ListSecrets
+		BatchChangeDetection: getConfigOrDefault(config, "AWS_BATCH_CHANGE_DETECTION", "false") == "true",
+		// Opt-in since it needs secretsmanager:BatchGetSecretValue
+		BatchRead: getConfigOrDefault(config, "AWS_BATCH_READ", "false") == "true",
+		Naming:    naming,
+		Isolated:  isIsolated(config),
+	}
+	if a.config.Isolated {
+		if a.config.AccessKey == "" || a.config.SecretKey == "" {
+			return configErrorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required")
+		}
+		if a.config.Profile != "" {
+			return configErrorf("AWS_PROFILE reads the shared AWS files of the plugin host")
+		}
+	}
+
+	// AWS_REGION may list replica regions, tried in order on read failures
+	for _, region := range strings.Split(a.config.Region, ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			a.config.Regions = append(a.config.Regions, region)
+		}
+	}
+	if len(a.config.Regions) == 0 {
+		return configErrorf("AWS_REGION must contain at least one region")
 	}
+	a.config.Region = a.config.Regions[0]
 
-	// Load AWS configuration
-	cfg, err := a.loadAWSConfig()
+	proxy, err := proxyFunc(config)
 	if err != nil {
-		return fmt.Errorf("failed to load AWS config: %v", err)
+		return err
 	}
+	a.proxy = proxy
 
-	// Create Secrets Manager client with optional endpoint override
-	a.client = secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) {
-		if a.config.EndpointURL != "" {
-			o.BaseEndpoint = aws.String(a.config.EndpointURL)
+	tlsConfig, err := providerTLSConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to configure provider TLS: %w", err)
+	}
+	a.tlsConfig = tlsConfig
+
+	throttle, err := newThrottleBackoff(config, "AWS")
+	if err != nil {
+		return err
+	}
+	a.throttle = throttle
+
+	a.clients = make([]*secretsmanager.Client, 0, len(a.config.Regions))
+	a.stsClients = make([]*sts.Client, 0, len(a.config.Regions))
+	for _, region := range a.config.Regions {
+		// Load AWS configuration
+		cfg, err := a.loadAWSConfig(region)
+		if err != nil {
+			return fmt.Errorf("failed to load AWS config for region %s: %v", region, err)
 		}
-	})
 
-	log.Printf("Successfully initialized AWS Secrets Manager provider for region: %s", a.config.Region)
+		// Create Secrets Manager client with optional endpoint override
+		a.clients = append(a.clients, secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) {
+			if a.config.EndpointURL != "" {
+				o.BaseEndpoint = aws.String(a.config.EndpointURL)
+			}
+		}))
+		// AWS_ENDPOINT_URL is the Secrets Manager endpoint, STS keeps its default
+		a.stsClients = append(a.stsClients, sts.NewFromConfig(cfg))
+	}
+
+	log.Printf("Successfully initialized AWS Secrets Manager provider for regions: %v", a.config.Regions)
 	return nil
 }
 
 // GetSecret retrieves a secret value from AWS Secrets Manager
 func (a *AWSProvider) GetSecret(ctx context.Context, req secrets.Request) ([]byte, error) {
 	secretName := a.buildSecretName(req)
-	log.Printf("Reading secret from AWS Secrets Manager: %s", secretName)
+	requestLogger(ctx).Printf("Reading secret from AWS Secrets Manager: %s", secretName)
 
 	// Get secret value from AWS Secrets Manager
 	input := &secretsmanager.GetSecretValueInput{
 		SecretId: aws.String(secretName),
 	}
 
-	result, err := a.client.GetSecretValue(ctx, input)
+	result, err := a.getSecretValue(ctx, input)
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil, notFoundErrorf("secret %s not found in AWS Secrets Manager", secretName)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get secret from AWS Secrets Manager: %v", err)
 	}
 
-	if result.SecretString == nil {
+	content, ok := secretContent(result.SecretString, result.SecretBinary, req.SecretLabels)
+	if !ok {
 		return nil, fmt.Errorf("secret %s has no string value", secretName)
 	}
 
 	// Extract the secret value
-	value, err := a.extractSecretValue(*result.SecretString, req)
+	value, handled, err := contentValue(content, req.SecretLabels)
+	if !handled {
+		value, err = a.extractSecretValue(content, req)
+	}
+	value, err = allowNullField(value, err, req.SecretLabels)
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract secret value: %v", err)
+		return nil, fmt.Errorf("failed to extract secret value: %w", err)
 	}
+	a.recordVersion(secretName, aws.ToString(result.VersionId))
 
-	log.Printf("Successfully retrieved secret from AWS Secrets Manager")
+	requestLogger(ctx).Printf("Successfully retrieved secret from AWS Secrets Manager")
 	return value, nil
 }
 
@@ -97,23 +190,47 @@ func (a *AWSProvider) CheckSecretChanged(ctx context.Context, secretInfo *Secret
 		SecretId: aws.String(secretInfo.SecretPath),
 	}
 
-	result, err := a.client.GetSecretValue(ctx, input)
+	result, err := a.getSecretValue(ctx, input)
 	if err != nil {
 		return false, fmt.Errorf("error reading secret from AWS Secrets Manager: %v", err)
 	}
 
-	if result.SecretString == nil {
+	content, ok := secretContent(result.SecretString, result.SecretBinary, secretInfo.Labels)
+	if !ok {
 		return false, fmt.Errorf("secret %s has no string value", secretInfo.SecretPath)
 	}
+	return a.secretStringChanged(content, secretInfo)
+}
+
+// secretContent returns the stored value of a secret. SecretBinary is only
+// used for secrets labeled content_type=application/octet-stream.
+func secretContent(secretString *string, secretBinary []byte, labels map[string]string) (string, bool) {
+	if secretString != nil {
+		return *secretString, true
+	}
+	if contentType, _ := ContentType(labels); contentType == ContentTypeBinary && secretBinary != nil {
+		return string(secretBinary), true
+	}
+	return "", false
+}
 
-	// Extract current value
-	currentValue, err := a.extractSecretValueByField(*result.SecretString, secretInfo.SecretField)
+// secretStringChanged compares the tracked field of a secret string against the last delivered hash
+func (a *AWSProvider) secretStringChanged(secretString string, secretInfo *SecretInfo) (bool, error) {
+	currentValue, handled, err := contentValue(secretString, secretInfo.Labels)
+	switch {
+	case handled:
+	case secretInfo.AllFields:
+		currentValue, err = a.extractSecretValue(secretString, allFieldsRequest())
+	default:
+		currentValue, err = a.extractSecretValueByField(secretString, secretInfo.SecretField)
+	}
+	currentValue, err = allowNullField(currentValue, err, secretInfo.Labels)
 	if err != nil {
 		return false, fmt.Errorf("failed to extract secret field %s: %v", secretInfo.SecretField, err)
 	}
 
 	// Calculate current hash
-	currentHash := fmt.Sprintf("%x", sha256.Sum256(currentValue))
+	currentHash := HashValue(currentValue)
 	return currentHash != secretInfo.LastHash, nil
 }
 
@@ -122,19 +239,395 @@ func (a *AWSProvider) GetProviderName() string {
 	return "aws"
 }
 
+// FieldLabelKey returns the secret label selecting the field to extract
+func (a *AWSProvider) FieldLabelKey() string {
+	return "aws_field"
+}
+
+// PathLabelKey returns the secret label overriding the AWS Secrets Manager path
+func (a *AWSProvider) PathLabelKey() string {
+	return "aws_secret_name"
+}
+
+// BuildPath returns the AWS Secrets Manager path the request resolves to
+func (a *AWSProvider) BuildPath(req secrets.Request) string {
+	return a.buildSecretName(req)
+}
+
+// maxListSecretsFilterValues is the number of values AWS accepts per ListSecrets filter
+const maxListSecretsFilterValues = 10
+
+// ChangeTimestamps reads the last change time of the given secrets with
+// ListSecrets, batching the names into as few calls as the API allows
+func (a *AWSProvider) ChangeTimestamps(ctx context.Context, paths []string) (map[string]time.Time, error) {
+	if !a.config.BatchChangeDetection {
+		return nil, nil
+	}
+
+	wanted := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		wanted[path] = true
+	}
+
+	stamps := make(map[string]time.Time, len(paths))
+	for start := 0; start < len(paths); start += maxListSecretsFilterValues {
+		end := min(start+maxListSecretsFilterValues, len(paths))
+		input := &secretsmanager.ListSecretsInput{
+			Filters: []types.Filter{{
+				Key:    types.FilterNameStringTypeName,
+				Values: paths[start:end],
+			}},
+		}
+
+		// The name filter matches by prefix, so entries are checked against
+		// the wanted paths. A region failing midway is listed again in the next.
+		err := a.inRegions(ctx, func(idx int) error {
+			listed := make(map[string]time.Time)
+			paginator := secretsmanager.NewListSecretsPaginator(a.clients[idx], input)
+			for paginator.HasMorePages() {
+				page, err := paginator.NextPage(ctx)
+				if err != nil {
+					return err
+				}
+				for _, entry := range page.SecretList {
+					changed := latestChange(entry)
+					for _, key := range []*string{entry.Name, entry.ARN} {
+						if key != nil && wanted[*key] {
+							listed[*key] = changed
+						}
+					}
+				}
+			}
+			maps.Copy(stamps, listed)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list AWS secrets: %v", err)
+		}
+	}
+
+	return stamps, nil
+}
+
+// maxBatchGetSecretIDs is the number of secret ids AWS accepts per BatchGetSecretValue call
+const maxBatchGetSecretIDs = 20
+
+// CheckSecretsChanged reads the given secrets with BatchGetSecretValue and
+// compares each against its tracked hash. Secrets the batch could not read
+// are left out of the result so they are checked one by one.
+func (a *AWSProvider) CheckSecretsChanged(ctx context.Context, secretInfos []*SecretInfo) (map[string]bool, error) {
+	if !a.config.BatchRead || len(secretInfos) < 2 {
+		return nil, nil
+	}
+
+	// Several tracked secrets may read different fields of one AWS secret
+	byPath := make(map[string][]*SecretInfo)
+	paths := make([]string, 0, len(secretInfos))
+	for _, secretInfo := range secretInfos {
+		if _, seen := byPath[secretInfo.SecretPath]; !seen {
+			paths = append(paths, secretInfo.SecretPath)
+		}
+		byPath[secretInfo.SecretPath] = append(byPath[secretInfo.SecretPath], secretInfo)
+	}
+
+	changed := make(map[string]bool, len(secretInfos))
+	for start := 0; start < len(paths); start += maxBatchGetSecretIDs {
+		end := min(start+maxBatchGetSecretIDs, len(paths))
+		input := &secretsmanager.BatchGetSecretValueInput{SecretIdList: paths[start:end]}
+
+		var result *secretsmanager.BatchGetSecretValueOutput
+		err := a.inRegions(ctx, func(idx int) error {
+			return a.throttle.do(ctx, isAWSThrottle, func() error {
+				var err error
+				result, err = a.clients[idx].BatchGetSecretValue(ctx, input)
+				return err
+			})
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to batch read AWS secrets: %v", err)
+		}
+
+		for _, entry := range result.SecretValues {
+			if entry.SecretString == nil {
+				continue
+			}
+			for _, key := range []*string{entry.Name, entry.ARN} {
+				if key == nil {
+					continue
+				}
+				for _, secretInfo := range byPath[*key] {
+					secretChanged, err := a.secretStringChanged(*entry.SecretString, secretInfo)
+					if err != nil {
+						// Read individually to surface the error on the secret itself
+						continue
+					}
+					changed[secretInfo.DockerSecretName] = secretChanged
+				}
+			}
+		}
+		for _, failure := range result.Errors {
+			log.Warnf("Batch read of AWS secret %s failed, reading it individually: %s", aws.ToString(failure.SecretId), aws.ToString(failure.ErrorCode))
+		}
+	}
+
+	return changed, nil
+}
+
+// latestChange returns the most recent change or rotation time of a listed secret
+func latestChange(entry types.SecretListEntry) time.Time {
+	var latest time.Time
+	if entry.LastChangedDate != nil {
+		latest = *entry.LastChangedDate
+	}
+	if entry.LastRotatedDate != nil && entry.LastRotatedDate.After(latest) {
+		latest = *entry.LastRotatedDate
+	}
+	return latest
+}
+
+// RotationSchedule returns the rotation period of a secret with rotation
+// enabled, from AutomaticallyAfterDays or a rate() schedule expression.
+// cron() schedules have no fixed period and are reported as unscheduled.
+func (a *AWSProvider) RotationSchedule(ctx context.Context, path string) (time.Duration, bool, error) {
+	result, err := a.describeSecret(ctx, path)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to describe AWS secret %s: %v", path, err)
+	}
+	if !aws.ToBool(result.RotationEnabled) || result.RotationRules == nil {
+		return 0, false, nil
+	}
+
+	if days := aws.ToInt64(result.RotationRules.AutomaticallyAfterDays); days > 0 {
+		return time.Duration(days) * 24 * time.Hour, true, nil
+	}
+	period, ok := parseRateExpression(aws.ToString(result.RotationRules.ScheduleExpression))
+	return period, ok, nil
+}
+
+// RotationInProgress reports whether a rotation of the secret at path has
+// created its AWSPENDING version but not yet promoted it to AWSCURRENT
+func (a *AWSProvider) RotationInProgress(ctx context.Context, path string) (bool, error) {
+	result, err := a.describeSecret(ctx, path)
+	if err != nil {
+		return false, fmt.Errorf("failed to describe AWS secret %s: %v", path, err)
+	}
+	if !aws.ToBool(result.RotationEnabled) {
+		return false, nil
+	}
+
+	for _, stages := range result.VersionIdsToStages {
+		if slices.Contains(stages, "AWSPENDING") && !slices.Contains(stages, "AWSCURRENT") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parseRateExpression parses an AWS rate() schedule such as "rate(10 days)"
+func parseRateExpression(expression string) (time.Duration, bool) {
+	inner, found := strings.CutPrefix(strings.TrimSpace(expression), "rate(")
+	if !found {
+		return 0, false
+	}
+	inner, found = strings.CutSuffix(inner, ")")
+	if !found {
+		return 0, false
+	}
+
+	parts := strings.Fields(inner)
+	if len(parts) != 2 {
+		return 0, false
+	}
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count <= 0 {
+		return 0, false
+	}
+
+	switch strings.TrimSuffix(parts[1], "s") {
+	case "hour":
+		return time.Duration(count) * time.Hour, true
+	case "day":
+		return time.Duration(count) * 24 * time.Hour, true
+	}
+	return 0, false
+}
+
+// HealthCheck reports whether AWS Secrets Manager is reachable in any of the
+// regions. Any API response below 500, including access denied, counts as
+// reachable.
+func (a *AWSProvider) HealthCheck(ctx context.Context) error {
+	err := a.inRegions(ctx, func(idx int) error {
+		_, err := a.clients[idx].ListSecrets(ctx, &secretsmanager.ListSecretsInput{MaxResults: aws.Int32(1)})
+		if err != nil && !isAWSFailover(err) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("AWS Secrets Manager is unreachable in %v: %v", a.config.Regions, err)
+	}
+	return nil
+}
+
+// VerifyCredentials calls sts:GetCallerIdentity, which needs no permissions
+// and fails only for invalid or expired credentials
+func (a *AWSProvider) VerifyCredentials(ctx context.Context) error {
+	var identity *sts.GetCallerIdentityOutput
+	err := a.inRegions(ctx, func(idx int) error {
+		var err error
+		identity, err = a.stsClients[idx].GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("AWS credential check failed: %v", err)
+	}
+	log.Printf("AWS credentials belong to %s", aws.ToString(identity.Arn))
+	return nil
+}
+
+// ThrottledRequests returns how many reads AWS throttled
+func (a *AWSProvider) ThrottledRequests() int64 {
+	return a.throttle.ThrottledRequests()
+}
+
 // Close performs cleanup for the AWS provider
 func (a *AWSProvider) Close() error {
 	// AWS client does not require explicit cleanup
 	return nil
 }
 
+// ActiveRegion returns the region that served the last call
+func (a *AWSProvider) ActiveRegion() string {
+	a.regionMutex.RLock()
+	defer a.regionMutex.RUnlock()
+	return a.config.Regions[a.activeRegion]
+}
+
+// defaultAWSRegion returns the region used when AWS_REGION is unset. With
+// AWS_DISCOVER_REGION=true it asks the instance metadata service, so a plugin
+// on EC2 reads from its own region instead of silently using us-east-1.
+func defaultAWSRegion(config map[string]string) string {
+	const fallback = "us-east-1"
+	if config["AWS_REGION"] != "" || getConfigOrDefault(config, "AWS_DISCOVER_REGION", "false") != "true" {
+		return fallback
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// IMDSv2 session tokens are handled by the client
+	client := imds.New(imds.Options{Endpoint: config["AWS_EC2_METADATA_SERVICE_ENDPOINT"]})
+	result, err := client.GetRegion(ctx, &imds.GetRegionInput{})
+	if err != nil || result.Region == "" {
+		log.Warnf("Failed to discover AWS region from instance metadata, using %s: %v", fallback, err)
+		return fallback
+	}
+
+	log.Printf("Discovered AWS region %s from instance metadata", result.Region)
+	return result.Region
+}
+
+// getSecretValue reads a secret, failing over to the replica regions
+func (a *AWSProvider) getSecretValue(ctx context.Context, input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	var result *secretsmanager.GetSecretValueOutput
+	err := a.inRegions(ctx, func(idx int) error {
+		// Throttling is retried in the same region, failing over would not help
+		return a.throttle.do(ctx, isAWSThrottle, func() error {
+			var err error
+			result, err = a.clients[idx].GetSecretValue(ctx, input)
+			return err
+		})
+	})
+	return result, err
+}
+
+// describeSecret describes a secret, failing over to the replica regions
+func (a *AWSProvider) describeSecret(ctx context.Context, path string) (*secretsmanager.DescribeSecretOutput, error) {
+	var result *secretsmanager.DescribeSecretOutput
+	err := a.inRegions(ctx, func(idx int) error {
+		var err error
+		result, err = a.clients[idx].DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(path)})
+		return err
+	})
+	return result, err
+}
+
+// inRegions runs call against the regions in the configured order until one
+// succeeds. Every call starts from the first region, so reads return to it
+// once it recovers. Only errors another region may not share fail over: the
+// ones without a response, and 5xx responses. A canceled context, a missing
+// secret or denied access are returned right away.
+func (a *AWSProvider) inRegions(ctx context.Context, call func(idx int) error) error {
+	var err error
+	for idx := range a.clients {
+		if err = call(idx); err == nil {
+			a.setActiveRegion(idx)
+			return nil
+		}
+		if ctx.Err() != nil || !isAWSFailover(err) {
+			return err
+		}
+		if idx+1 < len(a.clients) {
+			log.Warnf("AWS Secrets Manager call in region %s failed, trying %s: %v", a.config.Regions[idx], a.config.Regions[idx+1], err)
+		}
+	}
+	return err
+}
+
+// setActiveRegion records the region that served the last call
+func (a *AWSProvider) setActiveRegion(idx int) {
+	a.regionMutex.Lock()
+	defer a.regionMutex.Unlock()
+	if a.activeRegion != idx {
+		log.Printf("AWS Secrets Manager calls are served from region %s", a.config.Regions[idx])
+		a.activeRegion = idx
+	}
+}
+
+// isAWSFailover reports whether another region may succeed where a call
+// failed: the request got no response, or the service failed with a 5xx
+func isAWSFailover(err error) bool {
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode() >= 500
+	}
+	return true
+}
+
+// isAWSThrottle reports whether an AWS error is a rate limiting rejection.
+// AWS sends no retry hint, so the adaptive backoff alone decides the wait.
+func isAWSThrottle(err error) (bool, time.Duration) {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false, 0
+	}
+	switch apiErr.ErrorCode() {
+	case "ThrottlingException", "Throttling", "RequestLimitExceeded", "TooManyRequestsException":
+		return true, 0
+	}
+	return false, 0
+}
+
 // loadAWSConfig loads AWS configuration from various sources
-func (a *AWSProvider) loadAWSConfig() (aws.Config, error) {
+func (a *AWSProvider) loadAWSConfig(region string) (aws.Config, error) {
+	if a.config.Isolated {
+		// Only the configured keys, no environment, shared files or instance role
+		return aws.Config{
+			Region: region,
+			Credentials: aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
+				a.config.AccessKey,
+				a.config.SecretKey,
+				"",
+			)),
+			HTTPClient: a.httpClient(),
+		}, nil
+	}
+
 	var opts []func(*config.LoadOptions) error
 
 	// Set region if provided
-	if a.config.Region != "" {
-		opts = append(opts, config.WithRegion(a.config.Region))
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
 	}
 
 	// Set profile if provided
@@ -142,6 +635,9 @@ func (a *AWSProvider) loadAWSConfig() (aws.Config, error) {
 		opts = append(opts, config.WithSharedConfigProfile(a.config.Profile))
 	}
 
+	// Route requests through the egress proxy and provider TLS settings, if any
+	opts = append(opts, config.WithHTTPClient(a.httpClient()))
+
 	// Load configuration
 	cfg, err := config.LoadDefaultConfig(context.TODO(), opts...)
 	if err != nil {
@@ -161,6 +657,18 @@ func (a *AWSProvider) loadAWSConfig() (aws.Config, error) {
 	return cfg, nil
 }
 
+// httpClient routes requests through the egress proxy and provider TLS settings, if any
+func (a *AWSProvider) httpClient() *awshttp.BuildableClient {
+	return awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		if a.proxy != nil {
+			tr.Proxy = a.proxy
+		}
+		if a.tlsConfig != nil {
+			tr.TLSClientConfig = a.tlsConfig.Clone()
+		}
+	})
+}
+
 // buildSecretName constructs the AWS secret name based on request labels and service information
 func (a *AWSProvider) buildSecretName(req secrets.Request) string {
 	// Use custom path from labels if provided
@@ -168,36 +676,28 @@ func (a *AWSProvider) buildSecretName(req secrets.Request) string {
 		return customPath
 	}
 	// Default naming convention
-	if req.ServiceName != "" {
-		return fmt.Sprintf("%s/%s", req.ServiceName, req.SecretName)
-	}
-	return req.SecretName
+	return a.config.Naming.join(req.ServiceName, req.SecretName, "/")
 }
 
 // extractSecretValue extracts the appropriate value from the AWS secret string
 func (a *AWSProvider) extractSecretValue(secretString string, req secrets.Request) ([]byte, error) {
+	// Deliver the whole secret object in the stable encodeJSON form
+	if strings.ToLower(req.SecretLabels["all_fields"]) == "true" {
+		data, err := decodeJSONObject(secretString)
+		if err != nil {
+			return nil, fmt.Errorf("all_fields requires a JSON object secret")
+		}
+		return encodeJSON(data)
+	}
+
 	// Check for specific field in labels
 	if field, exists := req.SecretLabels["aws_field"]; exists {
 		return a.extractSecretValueByField(secretString, field)
 	}
 
 	// Try to parse as JSON first
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(secretString), &data); err == nil {
-		// Default field names to try
-		for _, field := range []string{"value", "password", "secret", "data"} {
-			// Try to find a value using default field names
-			if value, ok := data[field]; ok {
-				return []byte(fmt.Sprintf("%v", value)), nil
-			}
-		}
-		// If no specific field found, return the first string value
-		for _, value := range data {
-			if strValue, ok := value.(string); ok {
-				return []byte(strValue), nil
-			}
-		}
-		return nil, fmt.Errorf("no suitable secret value found in JSON")
+	if data, err := decodeJSONObject(secretString); err == nil {
+		return defaultFieldValue(data, strictField(req))
 	}
 
 	// If not JSON, return the raw string
@@ -207,22 +707,17 @@ func (a *AWSProvider) extractSecretValue(secretString string, req secrets.Reques
 // extractSecretValueByField extracts a specific field from the secret string
 func (a *AWSProvider) extractSecretValueByField(secretString, field string) ([]byte, error) {
 	// Try to parse as JSON first
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(secretString), &data); err == nil {
+	if data, err := decodeJSONObject(secretString); err == nil {
 		if value, ok := data[field]; ok {
-			return []byte(fmt.Sprintf("%v", value)), nil
+			return formatFieldValue(field, value)
 		}
 		// Improved error message: show available keys
-		keys := make([]string, 0, len(data))
-		for k := range data {
-			keys = append(keys, k)
-		}
-		return nil, fmt.Errorf("field %s not found in secret; available fields: %v", field, keys)
+		return nil, notFoundErrorf("field %s not found in secret; available fields: %v", field, fieldNames(data))
 	}
 
 	// If not JSON and field is requested, return error
 	if field != "value" {
-		return nil, fmt.Errorf("field %s not found in non-JSON secret", field)
+		return nil, notFoundErrorf("field %s not found in non-JSON secret", field)
 	}
 
 	// If field is "value" and not JSON, return the raw string
@@ -0,0 +1,456 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// fakeAWSRegion answers Secrets Manager calls with a fixed status and body
+// and counts them
+type fakeAWSRegion struct {
+	server *httptest.Server
+	status atomic.Int32
+	body   atomic.Value
+	calls  atomic.Int32
+}
+
+func newFakeAWSRegion(t *testing.T, status int, body string) *fakeAWSRegion {
+	t.Helper()
+	region := &fakeAWSRegion{}
+	region.set(status, body)
+	region.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		region.calls.Add(1)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.WriteHeader(int(region.status.Load()))
+		fmt.Fprint(w, region.body.Load().(string))
+	}))
+	t.Cleanup(region.server.Close)
+	return region
+}
+
+func (r *fakeAWSRegion) set(status int, body string) {
+	r.status.Store(int32(status))
+	r.body.Store(body)
+}
+
+// newFailoverProvider builds an AWS provider reading from the given regions in order
+func newFailoverProvider(regions ...*fakeAWSRegion) *AWSProvider {
+	a := &AWSProvider{
+		config:   &AWSConfig{},
+		throttle: &throttleBackoff{},
+	}
+	for i, region := range regions {
+		name := fmt.Sprintf("region-%d", i+1)
+		a.config.Regions = append(a.config.Regions, name)
+		a.clients = append(a.clients, secretsmanager.New(secretsmanager.Options{
+			Region:       name,
+			BaseEndpoint: aws.String(region.server.URL),
+			Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+			Retryer:      aws.NopRetryer{},
+		}))
+	}
+	return a
+}
+
+const (
+	awsSecretBody  = `{"Name":"db","SecretString":"{\"value\":\"hunter2\"}","VersionId":"v1"}`
+	awsNotFound    = `{"__type":"ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`
+	awsAccessError = `{"__type":"AccessDeniedException","message":"not authorized"}`
+	awsServerError = `{"__type":"InternalServiceError","message":"internal error"}`
+)
+
+func TestAWSRegionFailover(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		wantErr      bool
+		wantFailover bool
+	}{
+		{"server error fails over", http.StatusInternalServerError, awsServerError, false, true},
+		{"unavailable fails over", http.StatusServiceUnavailable, awsServerError, false, true},
+		{"missing secret does not fail over", http.StatusBadRequest, awsNotFound, true, false},
+		{"denied access does not fail over", http.StatusBadRequest, awsAccessError, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := newFakeAWSRegion(t, tt.status, tt.body)
+			replica := newFakeAWSRegion(t, http.StatusOK, awsSecretBody)
+			a := newFailoverProvider(primary, replica)
+
+			req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"aws_secret_name": "db"}}
+			value, err := a.GetSecret(context.Background(), req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetSecret() error = %v, expected error %v", err, tt.wantErr)
+			}
+			if failedOver := replica.calls.Load() > 0; failedOver != tt.wantFailover {
+				t.Fatalf("failed over = %v, expected %v", failedOver, tt.wantFailover)
+			}
+			if !tt.wantFailover {
+				return
+			}
+			if string(value) != "hunter2" {
+				t.Errorf("GetSecret() = %q, expected the replica's value", value)
+			}
+			if got := a.ActiveRegion(); got != "region-2" {
+				t.Errorf("ActiveRegion() = %q, expected region-2", got)
+			}
+
+			// The primary is tried first again and serves once it recovers
+			primary.set(http.StatusOK, awsSecretBody)
+			if _, err := a.GetSecret(context.Background(), req); err != nil {
+				t.Fatalf("GetSecret() after recovery error = %v", err)
+			}
+			if got := a.ActiveRegion(); got != "region-1" {
+				t.Errorf("ActiveRegion() after recovery = %q, expected region-1", got)
+			}
+			if calls := replica.calls.Load(); calls != 1 {
+				t.Errorf("replica served %d reads, expected only the one during the outage", calls)
+			}
+		})
+	}
+}
+
+func TestAWSChangeTimestamps(t *testing.T) {
+	// ListSecrets matches names by prefix, so app/db-old is listed as well
+	region := newFakeAWSRegion(t, http.StatusOK, `{"SecretList":[
+		{"Name":"app/db","ARN":"arn:aws:secretsmanager:us-east-1:1:secret:app/db","LastChangedDate":1767225600,"LastRotatedDate":1767229200},
+		{"Name":"app/db-old","LastChangedDate":1767225600},
+		{"Name":"app/api","LastChangedDate":1767232800}
+	]}`)
+	a := newFailoverProvider(region)
+
+	if stamps, err := a.ChangeTimestamps(context.Background(), []string{"app/db"}); err != nil || stamps != nil {
+		t.Fatalf("ChangeTimestamps() = %v, %v without AWS_BATCH_CHANGE_DETECTION", stamps, err)
+	}
+
+	a.config.BatchChangeDetection = true
+	stamps, err := a.ChangeTimestamps(context.Background(), []string{"app/db", "app/api", "app/missing"})
+	if err != nil {
+		t.Fatalf("ChangeTimestamps() error = %v", err)
+	}
+	want := map[string]time.Time{
+		"app/db":  time.Unix(1767229200, 0), // rotated after the last change
+		"app/api": time.Unix(1767232800, 0),
+	}
+	if len(stamps) != len(want) {
+		t.Errorf("ChangeTimestamps() = %v, expected %v", stamps, want)
+	}
+	for path, stamp := range want {
+		if !stamps[path].Equal(stamp) {
+			t.Errorf("%s changed at %v, expected %v", path, stamps[path], stamp)
+		}
+	}
+	if calls := region.calls.Load(); calls != 1 {
+		t.Errorf("%d ListSecrets calls, expected one for every path", calls)
+	}
+}
+
+func TestAWSRegionFailoverStopsOnCanceledContext(t *testing.T) {
+	primary := newFakeAWSRegion(t, http.StatusInternalServerError, awsServerError)
+	replica := newFakeAWSRegion(t, http.StatusOK, awsSecretBody)
+	a := newFailoverProvider(primary, replica)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := a.getSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String("db")})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("getSecretValue() error = %v, expected the context error", err)
+	}
+	if calls := replica.calls.Load(); calls != 0 {
+		t.Errorf("replica was called %d times after the context was canceled", calls)
+	}
+}
+
+func TestAWSDescribeFailsOver(t *testing.T) {
+	primary := newFakeAWSRegion(t, http.StatusInternalServerError, awsServerError)
+	replica := newFakeAWSRegion(t, http.StatusOK, `{"Name":"db","RotationEnabled":true,"RotationRules":{"AutomaticallyAfterDays":7}}`)
+	a := newFailoverProvider(primary, replica)
+
+	period, scheduled, err := a.RotationSchedule(context.Background(), "db")
+	if err != nil {
+		t.Fatalf("RotationSchedule() error = %v", err)
+	}
+	if !scheduled || period != 7*24*time.Hour {
+		t.Errorf("RotationSchedule() = %v, %v, expected 168h from the replica", period, scheduled)
+	}
+}
+
+// awsSecret renders a GetSecretValue response holding secretString
+func awsSecret(secretString string) string {
+	body, _ := json.Marshal(map[string]string{"Name": "db", "SecretString": secretString, "VersionId": "v1"})
+	return string(body)
+}
+
+func TestAWSNestedObjectField(t *testing.T) {
+	region := newFakeAWSRegion(t, http.StatusOK, awsSecret(`{"tls": {"key": "K", "cert": "C&<>"}, "hosts": ["a", "b"], "port": 5432}`))
+	a := newFailoverProvider(region)
+
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{"tls", `{"cert":"C&<>","key":"K"}`},
+		{"hosts", `["a","b"]`},
+		{"port", "5432"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"aws_secret_name": "db", "aws_field": tt.field}}
+			value, err := a.GetSecret(context.Background(), req)
+			if err != nil {
+				t.Fatalf("GetSecret() error = %v", err)
+			}
+			if string(value) != tt.want {
+				t.Errorf("GetSecret() = %s, expected %s", value, tt.want)
+			}
+		})
+	}
+}
+
+func TestAWSBinaryContent(t *testing.T) {
+	binary := []byte{0x00, 0xff, 0x10, 'k', 'e', 'y'}
+	body, _ := json.Marshal(map[string]any{"Name": "db", "SecretBinary": binary, "VersionId": "v1"})
+	a := newFailoverProvider(newFakeAWSRegion(t, http.StatusOK, string(body)))
+
+	tests := []struct {
+		name        string
+		contentType string
+		wantErr     bool
+	}{
+		{"octet-stream reads SecretBinary", "application/octet-stream", false},
+		{"text needs SecretString", "text/plain", true},
+		{"no content type needs SecretString", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{}
+			if tt.contentType != "" {
+				labels["content_type"] = tt.contentType
+			}
+			value, err := a.GetSecret(context.Background(), secrets.Request{SecretName: "db", SecretLabels: labels})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(value, binary) {
+				t.Errorf("GetSecret() = %x, expected %x", value, binary)
+			}
+		})
+	}
+}
+
+func TestAWSVerifyCredentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr bool
+	}{
+		{"valid credentials", http.StatusOK, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>arn:aws:iam::123456789012:user/ci</Arn>
+    <UserId>AIDAEXAMPLE</UserId>
+    <Account>123456789012</Account>
+  </GetCallerIdentityResult>
+  <ResponseMetadata><RequestId>1</RequestId></ResponseMetadata>
+</GetCallerIdentityResponse>`, false},
+		{"invalid credentials", http.StatusForbidden, `<ErrorResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <Error>
+    <Type>Sender</Type>
+    <Code>InvalidClientTokenId</Code>
+    <Message>The security token included in the request is invalid.</Message>
+  </Error>
+  <RequestId>1</RequestId>
+</ErrorResponse>`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			region := newFakeAWSRegion(t, tt.status, tt.body)
+			a := newFailoverProvider(region)
+			a.stsClients = []*sts.Client{sts.New(sts.Options{
+				Region:       "region-1",
+				BaseEndpoint: aws.String(region.server.URL),
+				Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+				Retryer:      aws.NopRetryer{},
+			})}
+
+			err := a.VerifyCredentials(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyCredentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "InvalidClientTokenId") {
+				t.Errorf("error %q does not carry the STS error code", err)
+			}
+			if calls := region.calls.Load(); calls != 1 {
+				t.Errorf("%d calls, expected 1", calls)
+			}
+		})
+	}
+}
+
+func TestAWSRotationSchedule(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantPeriod    time.Duration
+		wantScheduled bool
+	}{
+		{"days", `{"RotationEnabled":true,"RotationRules":{"AutomaticallyAfterDays":30}}`, 30 * 24 * time.Hour, true},
+		{"rate in days", `{"RotationEnabled":true,"RotationRules":{"ScheduleExpression":"rate(10 days)"}}`, 10 * 24 * time.Hour, true},
+		{"rate in hours", `{"RotationEnabled":true,"RotationRules":{"ScheduleExpression":"rate(4 hours)"}}`, 4 * time.Hour, true},
+		{"cron", `{"RotationEnabled":true,"RotationRules":{"ScheduleExpression":"cron(0 16 1,15 * ? *)"}}`, 0, false},
+		{"rotation disabled", `{"RotationEnabled":false,"RotationRules":{"AutomaticallyAfterDays":30}}`, 0, false},
+		{"no rotation rules", `{"Name":"db"}`, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newFailoverProvider(newFakeAWSRegion(t, http.StatusOK, tt.body))
+			period, scheduled, err := a.RotationSchedule(context.Background(), "db")
+			if err != nil {
+				t.Fatalf("RotationSchedule() error = %v", err)
+			}
+			if period != tt.wantPeriod || scheduled != tt.wantScheduled {
+				t.Errorf("RotationSchedule() = %v, %v, expected %v, %v", period, scheduled, tt.wantPeriod, tt.wantScheduled)
+			}
+		})
+	}
+}
+
+func TestParseRateExpression(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       time.Duration
+		wantOK     bool
+	}{
+		{"rate(1 day)", 24 * time.Hour, true},
+		{" rate(12 hours) ", 12 * time.Hour, true},
+		{"rate(0 days)", 0, false},
+		{"rate(5 minutes)", 0, false},
+		{"rate(days)", 0, false},
+		{"rate(3 days", 0, false},
+		{"cron(0 12 * * ? *)", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRateExpression(tt.expression)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRateExpression(%q) = %v, %v, expected %v, %v", tt.expression, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestAWSBatchRead(t *testing.T) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"SecretValues": []map[string]string{
+			{"Name": "db", "SecretString": `{"password":"second","username":"app"}`},
+			{"Name": "api", "SecretString": "token-1"},
+		},
+		"Errors": []map[string]string{
+			{"SecretId": "cache", "ErrorCode": "ResourceNotFoundException"},
+		},
+	})
+	region := newFakeAWSRegion(t, http.StatusOK, string(body))
+	a := newFailoverProvider(region)
+	a.config.BatchRead = true
+
+	secretInfos := []*SecretInfo{
+		{DockerSecretName: "db_password", SecretPath: "db", SecretField: "password", LastHash: HashValue([]byte("first"))},
+		{DockerSecretName: "db_username", SecretPath: "db", SecretField: "username", LastHash: HashValue([]byte("app"))},
+		{DockerSecretName: "api_token", SecretPath: "api", SecretField: "value", LastHash: HashValue([]byte("token-1"))},
+		{DockerSecretName: "cache", SecretPath: "cache", SecretField: "value"},
+	}
+	changed, err := a.CheckSecretsChanged(context.Background(), secretInfos)
+	if err != nil {
+		t.Fatalf("CheckSecretsChanged() error = %v", err)
+	}
+
+	// Secrets the batch failed to read are left to individual reads
+	want := map[string]bool{"db_password": true, "db_username": false, "api_token": false}
+	if len(changed) != len(want) {
+		t.Errorf("CheckSecretsChanged() = %v, expected %v", changed, want)
+	}
+	for name, wantChanged := range want {
+		if got, ok := changed[name]; !ok || got != wantChanged {
+			t.Errorf("changed[%s] = %v, %v, expected %v", name, got, ok, wantChanged)
+		}
+	}
+	if calls := region.calls.Load(); calls != 1 {
+		t.Errorf("%d calls, expected one batch read for both AWS secrets", calls)
+	}
+
+	// Without AWS_BATCH_READ, or with one secret, every secret is read individually
+	a.config.BatchRead = false
+	if changed, err := a.CheckSecretsChanged(context.Background(), secretInfos); changed != nil || err != nil {
+		t.Errorf("CheckSecretsChanged() with batch reads off = %v, %v, expected nil", changed, err)
+	}
+	a.config.BatchRead = true
+	if changed, err := a.CheckSecretsChanged(context.Background(), secretInfos[:1]); changed != nil || err != nil {
+		t.Errorf("CheckSecretsChanged() of one secret = %v, %v, expected nil", changed, err)
+	}
+	if calls := region.calls.Load(); calls != 1 {
+		t.Errorf("%d calls, expected no batch reads when they do not apply", calls)
+	}
+}
+
+func TestDefaultAWSRegionDiscovery(t *testing.T) {
+	var tokens, lookups atomic.Int32
+	region := "eu-west-2"
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			tokens.Add(1)
+			w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+			fmt.Fprint(w, "session-token")
+		case r.URL.Path == "/latest/dynamic/instance-identity/document" && r.Header.Get("X-Aws-Ec2-Metadata-Token") == "session-token":
+			lookups.Add(1)
+			if region == "" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprintf(w, `{"region": %q, "instanceId": "i-0123456789abcdef0"}`, region)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	t.Cleanup(imds.Close)
+
+	tests := []struct {
+		name   string
+		config map[string]string
+		found  string // the region IMDS reports, empty when it has none
+		want   string
+	}{
+		{"discovered", map[string]string{"AWS_DISCOVER_REGION": "true"}, "eu-west-2", "eu-west-2"},
+		{"discovery off", map[string]string{}, "eu-west-2", "us-east-1"},
+		{"region configured", map[string]string{"AWS_DISCOVER_REGION": "true", "AWS_REGION": "ap-south-1"}, "eu-west-2", "us-east-1"},
+		{"metadata unavailable", map[string]string{"AWS_DISCOVER_REGION": "true"}, "", "us-east-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			region = tt.found
+			tt.config["AWS_EC2_METADATA_SERVICE_ENDPOINT"] = imds.URL
+			if got := defaultAWSRegion(tt.config); got != tt.want {
+				t.Errorf("defaultAWSRegion() = %q, expected %q", got, tt.want)
+			}
+		})
+	}
+	// IMDSv2 was used: a session token was requested before the lookups
+	if tokens.Load() == 0 || lookups.Load() != 2 {
+		t.Errorf("%d token requests and %d region lookups, expected IMDSv2 lookups only when discovering", tokens.Load(), lookups.Load())
+	}
+}
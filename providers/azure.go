@@ -2,11 +2,15 @@ package providers
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os" // Imported to read environment variables
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore" // Imported for credentials
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
@@ -17,13 +21,20 @@ import (
 
 // AzureProvider implements the SecretsProvider interface for Azure Key Vault.
 type AzureProvider struct {
-	client *azsecrets.Client
-	config *AzureConfig
+	client   *azsecrets.Client
+	config   *AzureConfig
+	throttle *throttleBackoff
+	versionCache
+
+	// Secret names resolved from azure_tag_selector labels, by selector
+	selected      map[string]string
+	selectedMutex sync.Mutex
 }
 
 // AzureConfig holds the configuration for the Azure Key Vault client.
 type AzureConfig struct {
 	VaultURL string
+	Naming   ServiceNaming // where the service name goes in default secret names
 }
 
 // SecretInfoAzure stores metadata about a retrieved secret for rotation checks.
@@ -35,43 +46,74 @@ type SecretInfoAzure struct {
 
 // Initialize sets up the Azure provider with the given configuration.
 func (az *AzureProvider) Initialize(config map[string]string) error {
+	naming, err := serviceNaming(config)
+	if err != nil {
+		return err
+	}
+
 	az.config = &AzureConfig{
 		VaultURL: config["AZURE_VAULT_URL"],
+		Naming:   naming,
 	}
 
 	if az.config.VaultURL == "" {
-		return fmt.Errorf("AZURE_VAULT_URL is required in the configuration")
+		return configErrorf("AZURE_VAULT_URL is required in the configuration")
 	}
 
 	if !strings.HasSuffix(az.config.VaultURL, "/") {
 		az.config.VaultURL += "/"
 	}
 
+	throttle, err := newThrottleBackoff(config, "AZURE")
+	if err != nil {
+		return err
+	}
+	az.throttle = throttle
+	az.selected = make(map[string]string)
+
+	// Route requests through the egress proxy and provider TLS settings, if any
+	transport, err := providerTransport(config)
+	if err != nil {
+		return err
+	}
+	clientOptions := azcore.ClientOptions{
+		Transport: &http.Client{Transport: transport},
+	}
+
 	var cred azcore.TokenCredential
-	var err error
 
-	// Prioritize Service Principal credentials from environment variables.
-	tenantID := os.Getenv("AZURE_TENANT_ID")
-	clientID := os.Getenv("AZURE_CLIENT_ID")
-	clientSecret := os.Getenv("AZURE_CLIENT_SECRET")
+	// Prioritize Service Principal credentials from the configuration.
+	tenantID := getConfigOrDefault(config, "AZURE_TENANT_ID", "")
+	clientID := getConfigOrDefault(config, "AZURE_CLIENT_ID", "")
+	clientSecret := getConfigOrDefault(config, "AZURE_CLIENT_SECRET", "")
 
+	if isIsolated(config) && (tenantID == "" || clientID == "" || clientSecret == "") {
+		// The default chain would authenticate as the plugin host's identity
+		return configErrorf("AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET are required")
+	}
 	if tenantID != "" && clientID != "" && clientSecret != "" {
 		log.Info("Authenticating with Azure using Service Principal credentials.")
-		cred, err = azidentity.NewClientSecretCredential(tenantID, clientID, clientSecret, nil)
+		cred, err = azidentity.NewClientSecretCredential(tenantID, clientID, clientSecret, &azidentity.ClientSecretCredentialOptions{
+			ClientOptions: clientOptions,
+		})
 		if err != nil {
 			return fmt.Errorf("failed to create Azure credential using Service Principal: %w", err)
 		}
 	} else {
 		// Fallback to default credential chain (Managed Identity, Azure CLI, etc.)
 		log.Info("Service Principal credentials not found. Falling back to Default Azure Credential.")
-		cred, err = azidentity.NewDefaultAzureCredential(nil)
+		cred, err = azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
+			ClientOptions: clientOptions,
+		})
 		if err != nil {
 			return fmt.Errorf("failed to create Azure credential using default chain: %w", err)
 		}
 	}
 
 	// Create a new secret client to interact with the Key Vault.
-	client, err := azsecrets.NewClient(az.config.VaultURL, cred, nil)
+	client, err := azsecrets.NewClient(az.config.VaultURL, cred, &azsecrets.ClientOptions{
+		ClientOptions: clientOptions,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create Azure Key Vault client: %w", err)
 	}
@@ -83,10 +125,22 @@ func (az *AzureProvider) Initialize(config map[string]string) error {
 
 // GetSecret retrieves a secret value from Azure Key Vault based on the request.
 func (az *AzureProvider) GetSecret(ctx context.Context, req secrets.Request) ([]byte, error) {
+	// Tag selectors are resolved again on every request, so moving the tags
+	// to another secret takes effect on the next read
+	if selector, exists := req.SecretLabels["azure_tag_selector"]; exists && req.SecretLabels["azure_secret_name"] == "" {
+		if _, err := az.resolveTagSelector(ctx, selector); err != nil {
+			return nil, err
+		}
+	}
+
 	secretName := az.buildSecretName(req)
-	log.Infof("Reading secret '%s' from Azure Key Vault", secretName)
+	requestLogger(ctx).Infof("Reading secret '%s' from Azure Key Vault", secretName)
 
-	resp, err := az.client.GetSecret(ctx, secretName, "", nil)
+	resp, err := az.getSecret(ctx, secretName)
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+		return nil, notFoundErrorf("secret '%s' not found in Azure Key Vault", secretName)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get secret '%s' from Azure Key Vault: %w", secretName, err)
 	}
@@ -95,12 +149,19 @@ func (az *AzureProvider) GetSecret(ctx context.Context, req secrets.Request) ([]
 		return nil, fmt.Errorf("secret '%s' was found but has no value", secretName)
 	}
 
-	value, err := az.extractSecretValue(*resp.Value, req)
+	value, handled, err := contentValue(*resp.Value, req.SecretLabels)
+	if !handled {
+		value, err = az.extractSecretValue(*resp.Value, req)
+	}
+	value, err = allowNullField(value, err, req.SecretLabels)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract value from secret '%s': %w", secretName, err)
 	}
+	if resp.ID != nil {
+		az.recordVersion(secretName, resp.ID.Version())
+	}
 
-	log.Infof("Successfully retrieved secret '%s' from Azure Key Vault", secretName)
+	requestLogger(ctx).Infof("Successfully retrieved secret '%s' from Azure Key Vault", secretName)
 	return value, nil
 }
 
@@ -114,9 +175,24 @@ func (az *AzureProvider) GetProviderName() string {
 	return "azure"
 }
 
+// FieldLabelKey returns the secret label selecting the field to extract.
+func (az *AzureProvider) FieldLabelKey() string {
+	return "azure_field"
+}
+
+// PathLabelKey returns the secret label overriding the Azure Key Vault path.
+func (az *AzureProvider) PathLabelKey() string {
+	return "azure_secret_name"
+}
+
+// BuildPath returns the Azure Key Vault path the request resolves to.
+func (az *AzureProvider) BuildPath(req secrets.Request) string {
+	return az.buildSecretName(req)
+}
+
 // CheckSecretChanged checks if a secret's value has changed in Azure Key Vault.
 func (az *AzureProvider) CheckSecretChanged(ctx context.Context, secretInfo *SecretInfo) (bool, error) {
-	resp, err := az.client.GetSecret(ctx, secretInfo.SecretPath, "", nil)
+	resp, err := az.getSecret(ctx, secretInfo.SecretPath)
 	if err != nil {
 		return false, fmt.Errorf("error reading secret '%s' for rotation check: %w", secretInfo.SecretPath, err)
 	}
@@ -125,15 +201,199 @@ func (az *AzureProvider) CheckSecretChanged(ctx context.Context, secretInfo *Sec
 		return false, fmt.Errorf("secret '%s' has no value for rotation check", secretInfo.SecretPath)
 	}
 
-	currentValue, err := az.extractSecretValueByField(*resp.Value, secretInfo.SecretField)
+	currentValue, handled, err := contentValue(*resp.Value, secretInfo.Labels)
+	switch {
+	case handled:
+	case secretInfo.AllFields:
+		currentValue, err = az.extractSecretValue(*resp.Value, allFieldsRequest())
+	default:
+		currentValue, err = az.extractSecretValueByField(*resp.Value, secretInfo.SecretField)
+	}
+	currentValue, err = allowNullField(currentValue, err, secretInfo.Labels)
 	if err != nil {
 		return false, fmt.Errorf("failed to extract field '%s' for rotation check: %w", secretInfo.SecretField, err)
 	}
 
-	currentHash := fmt.Sprintf("%x", sha256.Sum256(currentValue))
+	currentHash := HashValue(currentValue)
 	return currentHash != secretInfo.LastHash, nil
 }
 
+// HealthCheck reports whether the Key Vault is reachable. Any API response,
+// including access denied, counts as reachable.
+func (az *AzureProvider) HealthCheck(ctx context.Context) error {
+	pager := az.client.NewListSecretPropertiesPager(nil)
+	_, err := pager.NextPage(ctx)
+	var respErr *azcore.ResponseError
+	if err != nil && !errors.As(err, &respErr) {
+		return fmt.Errorf("azure key vault %s is unreachable: %w", az.config.VaultURL, err)
+	}
+	return nil
+}
+
+// ThrottledRequests returns how many reads Azure Key Vault throttled.
+func (az *AzureProvider) ThrottledRequests() int64 {
+	return az.throttle.ThrottledRequests()
+}
+
+// getSecret reads the latest version of a secret, backing off when Key Vault
+// throttles the request beyond the SDK's own retries.
+func (az *AzureProvider) getSecret(ctx context.Context, name string) (azsecrets.GetSecretResponse, error) {
+	// A full identifier URL may pin a version, a bare name reads the latest
+	version := ""
+	if vaultURL, secretName, secretVersion, ok := parseSecretID(name); ok {
+		if !sameVault(vaultURL, az.config.VaultURL) {
+			return azsecrets.GetSecretResponse{}, configErrorf("secret identifier %s is not in the configured Key Vault %s", name, az.config.VaultURL)
+		}
+		name, version = secretName, secretVersion
+	}
+
+	var resp azsecrets.GetSecretResponse
+	err := az.throttle.do(ctx, isAzureThrottle, func() error {
+		var err error
+		resp, err = az.client.GetSecret(ctx, name, version, nil)
+		return err
+	})
+	return resp, err
+}
+
+// resolveTagSelector finds the one enabled secret whose tags match every
+// key=value pair of the selector. Key Vault cannot filter by tag, so the
+// secret properties are listed and matched here; no values are read.
+func (az *AzureProvider) resolveTagSelector(ctx context.Context, selector string) (string, error) {
+	wanted, err := parseTagSelector(selector)
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	pager := az.client.NewListSecretPropertiesPager(nil)
+	for pager.More() {
+		var page azsecrets.ListSecretPropertiesResponse
+		err := az.throttle.do(ctx, isAzureThrottle, func() error {
+			var err error
+			page, err = pager.NextPage(ctx)
+			return err
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to list secrets for tag selector '%s': %w", selector, err)
+		}
+
+		for _, props := range page.Value {
+			if props == nil || props.ID == nil {
+				continue
+			}
+			if props.Attributes != nil && props.Attributes.Enabled != nil && !*props.Attributes.Enabled {
+				continue
+			}
+			if tagsMatch(props.Tags, wanted) {
+				matches = append(matches, props.ID.Name())
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", notFoundErrorf("no enabled secret in Azure Key Vault matches tag selector '%s'", selector)
+	case 1:
+		az.selectedMutex.Lock()
+		az.selected[selector] = matches[0]
+		az.selectedMutex.Unlock()
+		return matches[0], nil
+	}
+	sort.Strings(matches)
+	return "", configErrorf("tag selector '%s' matches %d secrets: %s", selector, len(matches), strings.Join(matches, ", "))
+}
+
+// parseTagSelector parses a comma separated list of key=value pairs.
+func parseTagSelector(selector string) (map[string]string, error) {
+	wanted := make(map[string]string)
+	for _, pair := range strings.Split(selector, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, found := strings.Cut(pair, "=")
+		if !found || strings.TrimSpace(key) == "" {
+			return nil, configErrorf("invalid azure_tag_selector entry '%s', expected key=value", pair)
+		}
+		wanted[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if len(wanted) == 0 {
+		return nil, configErrorf("azure_tag_selector is empty")
+	}
+	return wanted, nil
+}
+
+// tagsMatch reports whether the tags hold every wanted key=value pair.
+func tagsMatch(tags map[string]*string, wanted map[string]string) bool {
+	for key, value := range wanted {
+		tag, ok := tags[key]
+		if !ok || tag == nil || *tag != value {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSecretID splits a Key Vault secret identifier such as
+// https://myvault.vault.azure.net/secrets/name/version into the vault URL,
+// secret name and optional version. Bare names are not identifiers.
+func parseSecretID(id string) (string, string, string, bool) {
+	parsed, err := url.Parse(id)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return "", "", "", false
+	}
+
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if len(segments) < 2 || len(segments) > 3 || segments[0] != "secrets" || segments[1] == "" {
+		return "", "", "", false
+	}
+	version := ""
+	if len(segments) == 3 {
+		version = segments[2]
+	}
+	return "https://" + parsed.Host, segments[1], version, true
+}
+
+// sameVault reports whether two Key Vault URLs address the same vault
+func sameVault(a, b string) bool {
+	hostOf := func(raw string) string {
+		parsed, err := url.Parse(raw)
+		if err != nil {
+			return ""
+		}
+		return strings.ToLower(parsed.Hostname())
+	}
+	return hostOf(a) != "" && hostOf(a) == hostOf(b)
+}
+
+// isAzureThrottle reports whether an Azure error is a 429 response and the
+// wait its Retry-After header asks for.
+func isAzureThrottle(err error) (bool, time.Duration) {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusTooManyRequests {
+		return false, 0
+	}
+	if respErr.RawResponse == nil {
+		return true, 0
+	}
+	return true, parseRetryAfter(respErr.RawResponse.Header.Get("Retry-After"))
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
 // Close performs cleanup for the Azure provider.
 func (az *AzureProvider) Close() error {
 	// The Azure SDK client does not require an explicit close operation.
@@ -145,12 +405,21 @@ func (az *AzureProvider) buildSecretName(req secrets.Request) string {
 	if customName, exists := req.SecretLabels["azure_secret_name"]; exists {
 		return customName
 	}
-
-	secretName := req.SecretName
-	if req.ServiceName != "" {
-		secretName = fmt.Sprintf("%s-%s", req.ServiceName, req.SecretName)
+	if selector, exists := req.SecretLabels["azure_tag_selector"]; exists {
+		az.selectedMutex.Lock()
+		name, resolved := az.selected[selector]
+		az.selectedMutex.Unlock()
+		if resolved {
+			return name
+		}
+	}
+	// Identifier URLs are kept whole, sanitizing would turn them into an invalid name
+	if _, _, _, ok := parseSecretID(req.SecretName); ok {
+		return req.SecretName
 	}
 
+	secretName := az.config.Naming.join(req.ServiceName, req.SecretName, "-")
+
 	var sanitized strings.Builder
 	for _, char := range secretName {
 		if (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || char == '-' {
@@ -175,25 +444,21 @@ func (az *AzureProvider) buildSecretName(req secrets.Request) string {
 
 // extractSecretValue extracts the appropriate value from the Azure secret string.
 func (az *AzureProvider) extractSecretValue(secretValue string, req secrets.Request) ([]byte, error) {
+	// Deliver the whole secret object in the stable encodeJSON form
+	if strings.ToLower(req.SecretLabels["all_fields"]) == "true" {
+		data, err := decodeJSONObject(secretValue)
+		if err != nil {
+			return nil, fmt.Errorf("all_fields requires a JSON object secret")
+		}
+		return encodeJSON(data)
+	}
+
 	if field, exists := req.SecretLabels["azure_field"]; exists {
 		return az.extractSecretValueByField(secretValue, field)
 	}
 
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(secretValue), &data); err == nil {
-		defaultFields := []string{"value", "password", "secret", "data"}
-		for _, field := range defaultFields {
-			if value, ok := data[field]; ok {
-				return []byte(fmt.Sprintf("%v", value)), nil
-			}
-		}
-
-		for _, value := range data {
-			if strValue, ok := value.(string); ok {
-				return []byte(strValue), nil
-			}
-		}
-		return nil, fmt.Errorf("secret is a JSON object but no suitable value could be extracted")
+	if data, err := decodeJSONObject(secretValue); err == nil {
+		return defaultFieldValue(data, strictField(req))
 	}
 
 	return []byte(secretValue), nil
@@ -201,14 +466,14 @@ func (az *AzureProvider) extractSecretValue(secretValue string, req secrets.Requ
 
 // extractSecretValueByField extracts a specific field from a JSON secret string.
 func (az *AzureProvider) extractSecretValueByField(secretValue, field string) ([]byte, error) {
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(secretValue), &data); err != nil {
+	data, err := decodeJSONObject(secretValue)
+	if err != nil {
 		return nil, fmt.Errorf("cannot extract field '%s' because the secret is not a valid JSON object", field)
 	}
 
 	if value, ok := data[field]; ok {
-		return []byte(fmt.Sprintf("%v", value)), nil
+		return formatFieldValue(field, value)
 	}
 
-	return nil, fmt.Errorf("field '%s' not found in the JSON secret", field)
+	return nil, notFoundErrorf("field '%s' not found in the JSON secret", field)
 }
@@ -0,0 +1,290 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+const azureTestVaultURL = "https://test.vault.azure.net/"
+
+// fakeAzureVault answers Key Vault requests in process. It sends the bearer
+// challenge the SDK expects to unauthenticated requests and hands the others
+// to handler, counting them.
+type fakeAzureVault struct {
+	mutex   sync.Mutex
+	handler http.HandlerFunc
+	calls   int
+}
+
+func (f *fakeAzureVault) Do(req *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	if req.Header.Get("Authorization") == "" {
+		recorder.Header().Set("WWW-Authenticate", `Bearer authorization="https://login.microsoftonline.com/tenant", resource="https://vault.azure.net"`)
+		recorder.WriteHeader(http.StatusUnauthorized)
+	} else {
+		f.mutex.Lock()
+		f.calls++
+		f.mutex.Unlock()
+		recorder.Header().Set("Content-Type", "application/json")
+		f.handler(recorder, req)
+	}
+	resp := recorder.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+// callCount returns the number of authenticated requests answered
+func (f *fakeAzureVault) callCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.calls
+}
+
+// fakeAzureCredential hands out a static token
+type fakeAzureCredential struct{}
+
+func (fakeAzureCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// newFakeAzureProvider builds an Azure provider reading from vault, with the
+// SDK's own retries off so the provider's throttle handling is what runs
+func newFakeAzureProvider(t *testing.T, vault *fakeAzureVault) *AzureProvider {
+	t.Helper()
+	client, err := azsecrets.NewClient(azureTestVaultURL, fakeAzureCredential{}, &azsecrets.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Transport: vault,
+			Retry:     policy.RetryOptions{MaxRetries: -1},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &AzureProvider{
+		client:   client,
+		config:   &AzureConfig{VaultURL: azureTestVaultURL},
+		throttle: &throttleBackoff{baseDelay: time.Millisecond, maxDelay: 2 * time.Millisecond, maxRetries: 3},
+		selected: make(map[string]string),
+	}
+}
+
+// azureSecret renders a GetSecret response for version of secret name
+func azureSecret(name, version, value string) string {
+	return fmt.Sprintf(`{"value":%q,"id":"%ssecrets/%s/%s"}`, value, azureTestVaultURL, name, version)
+}
+
+func TestAzureThrottledRead(t *testing.T) {
+	tests := []struct {
+		name       string
+		throttled  int
+		retryAfter string
+		wantErr    bool
+		wantCalls  int
+	}{
+		{"throttled then served", 2, "", false, 3},
+		{"retry after honored", 1, "1", false, 2},
+		{"throttled past the retries", 10, "", true, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var served int
+			vault := &fakeAzureVault{}
+			vault.handler = func(w http.ResponseWriter, r *http.Request) {
+				if served++; served <= tt.throttled {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.WriteHeader(http.StatusTooManyRequests)
+					fmt.Fprint(w, `{"error":{"code":"Throttled","message":"Too many requests"}}`)
+					return
+				}
+				fmt.Fprint(w, azureSecret("db", "v1", "hunter2"))
+			}
+			az := newFakeAzureProvider(t, vault)
+
+			start := time.Now()
+			value, err := az.GetSecret(context.Background(), secrets.Request{SecretName: "db", SecretLabels: map[string]string{"azure_secret_name": "db"}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(value) != "hunter2" {
+				t.Errorf("GetSecret() = %q, expected %q", value, "hunter2")
+			}
+			if calls := vault.callCount(); calls != tt.wantCalls {
+				t.Errorf("%d calls, expected %d", calls, tt.wantCalls)
+			}
+			if throttled := az.ThrottledRequests(); throttled != int64(min(tt.throttled, tt.wantCalls)) {
+				t.Errorf("ThrottledRequests() = %d, expected %d", throttled, min(tt.throttled, tt.wantCalls))
+			}
+			if tt.retryAfter != "" && time.Since(start) < time.Second {
+				t.Errorf("retried after %v, expected the %ss Retry-After to be honored", time.Since(start), tt.retryAfter)
+			}
+		})
+	}
+}
+
+func TestAzureSecretIdentifier(t *testing.T) {
+	var paths []string
+	vault := &fakeAzureVault{}
+	vault.handler = func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		fmt.Fprint(w, azureSecret("db", "abc123", "hunter2"))
+	}
+	az := newFakeAzureProvider(t, vault)
+
+	tests := []struct {
+		name      string
+		req       secrets.Request
+		wantPath  string
+		wantError bool
+	}{
+		{"pinned version in the label", secrets.Request{SecretName: "db", SecretLabels: map[string]string{"azure_secret_name": azureTestVaultURL + "secrets/db/abc123"}}, "/secrets/db/abc123", false},
+		{"latest version as the secret name", secrets.Request{SecretName: azureTestVaultURL + "secrets/db", ServiceName: "api", SecretLabels: map[string]string{}}, "/secrets/db/", false},
+		{"identifier of another vault", secrets.Request{SecretName: "db", SecretLabels: map[string]string{"azure_secret_name": "https://other.vault.azure.net/secrets/db/abc123"}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths = nil
+			value, err := az.GetSecret(context.Background(), tt.req)
+			if tt.wantError {
+				if KindOf(err) != ErrorKindConfig || len(paths) != 0 {
+					t.Errorf("GetSecret() error = %v after reading %v, expected a configuration error without reads", err, paths)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetSecret() error = %v", err)
+			}
+			if string(value) != "hunter2" {
+				t.Errorf("GetSecret() = %q, expected %q", value, "hunter2")
+			}
+			if len(paths) != 1 || paths[0] != tt.wantPath {
+				t.Errorf("requested %v, expected %s", paths, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestParseSecretID(t *testing.T) {
+	tests := []struct {
+		id                  string
+		wantVault, wantName string
+		wantVersion         string
+		wantOK              bool
+	}{
+		{"https://test.vault.azure.net/secrets/db/abc123", "https://test.vault.azure.net", "db", "abc123", true},
+		{"https://test.vault.azure.net/secrets/db/", "https://test.vault.azure.net", "db", "", true},
+		{"https://test.vault.azure.net/keys/db/abc123", "", "", "", false},
+		{"https://test.vault.azure.net/secrets/db/abc123/extra", "", "", "", false},
+		{"http://test.vault.azure.net/secrets/db", "", "", "", false},
+		{"db-password", "", "", "", false},
+	}
+	for _, tt := range tests {
+		vault, name, version, ok := parseSecretID(tt.id)
+		if vault != tt.wantVault || name != tt.wantName || version != tt.wantVersion || ok != tt.wantOK {
+			t.Errorf("parseSecretID(%q) = %q, %q, %q, %v, expected %q, %q, %q, %v",
+				tt.id, vault, name, version, ok, tt.wantVault, tt.wantName, tt.wantVersion, tt.wantOK)
+		}
+	}
+}
+
+func TestIsAzureThrottle(t *testing.T) {
+	throttled := func(retryAfter string) error {
+		resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+		if retryAfter != "" {
+			resp.Header.Set("Retry-After", retryAfter)
+		}
+		return &azcore.ResponseError{StatusCode: http.StatusTooManyRequests, RawResponse: resp}
+	}
+	tests := []struct {
+		name     string
+		err      error
+		want     bool
+		wantWait time.Duration
+	}{
+		{"429 in seconds", throttled("7"), true, 7 * time.Second},
+		{"429 without a hint", throttled(""), true, 0},
+		{"429 with a past date", throttled("Mon, 02 Jan 2006 15:04:05 GMT"), true, 0},
+		{"403", &azcore.ResponseError{StatusCode: http.StatusForbidden}, false, 0},
+		{"not a response", fmt.Errorf("dial tcp: connection refused"), false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, wait := isAzureThrottle(tt.err)
+			if got != tt.want || wait != tt.wantWait {
+				t.Errorf("isAzureThrottle() = %v, %v, expected %v, %v", got, wait, tt.want, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestAzureTagSelector(t *testing.T) {
+	listing := func(secrets ...string) string {
+		return fmt.Sprintf(`{"value":[%s]}`, strings.Join(secrets, ","))
+	}
+	property := func(name string, enabled bool, tags string) string {
+		return fmt.Sprintf(`{"id":"%ssecrets/%s","attributes":{"enabled":%v},"tags":%s}`, azureTestVaultURL, name, enabled, tags)
+	}
+	tests := []struct {
+		name     string
+		listed   string
+		selector string
+		want     string
+		wantKind ErrorKind
+		wantText string
+	}{
+		{"one match", listing(property("db-prod", true, `{"app":"api","env":"prod"}`), property("db-dev", true, `{"app":"api","env":"dev"}`)), "app=api, env=prod", "db-prod", "", ""},
+		{"disabled secrets are skipped", listing(property("db-old", false, `{"env":"prod"}`), property("db-prod", true, `{"env":"prod"}`)), "env=prod", "db-prod", "", ""},
+		{"two matches", listing(property("db-prod", true, `{"env":"prod"}`), property("cache-prod", true, `{"env":"prod"}`)), "env=prod", "", ErrorKindConfig, "cache-prod, db-prod"},
+		{"no match", listing(property("db-dev", true, `{"env":"dev"}`)), "env=prod", "", ErrorKindNotFound, ""},
+		{"invalid selector", listing(), "env", "", ErrorKindConfig, "expected key=value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var read []string
+			vault := &fakeAzureVault{}
+			vault.handler = func(w http.ResponseWriter, r *http.Request) {
+				if strings.TrimSuffix(r.URL.Path, "/") == "/secrets" {
+					fmt.Fprint(w, tt.listed)
+					return
+				}
+				name := strings.Split(strings.TrimPrefix(r.URL.Path, "/secrets/"), "/")[0]
+				read = append(read, name)
+				fmt.Fprint(w, azureSecret(name, "v1", "value of "+name))
+			}
+			az := newFakeAzureProvider(t, vault)
+			req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"azure_tag_selector": tt.selector}}
+
+			value, err := az.GetSecret(context.Background(), req)
+			if tt.wantKind != "" {
+				if KindOf(err) != tt.wantKind || len(read) != 0 {
+					t.Fatalf("GetSecret() error = %v after reading %v, expected a %s error without reads", err, read, tt.wantKind)
+				}
+				if !strings.Contains(err.Error(), tt.wantText) {
+					t.Errorf("error %q does not contain %q", err, tt.wantText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetSecret() error = %v", err)
+			}
+			if string(value) != "value of "+tt.want || len(read) != 1 || read[0] != tt.want {
+				t.Errorf("GetSecret() = %q after reading %v, expected secret %s", value, read, tt.want)
+			}
+			if path := az.BuildPath(req); path != tt.want {
+				t.Errorf("BuildPath() = %q, expected %q", path, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	log "github.com/sirupsen/logrus"
+)
+
+// EnvProvider implements the SecretsProvider interface on top of the plugin's
+// environment variables, for development and CI without a secrets backend
+type EnvProvider struct {
+	prefix string
+}
+
+// Initialize sets up the environment provider with the given configuration
+func (e *EnvProvider) Initialize(config map[string]string) error {
+	e.prefix = config["ENV_PREFIX"]
+
+	log.Printf("Successfully initialized environment provider with prefix %q", e.prefix)
+	return nil
+}
+
+// GetSecret retrieves a secret value from an environment variable
+func (e *EnvProvider) GetSecret(ctx context.Context, req secrets.Request) ([]byte, error) {
+	name := e.buildVariableName(req)
+	requestLogger(ctx).Printf("Reading secret from environment variable: %s", name)
+
+	content, err := e.readVariable(name)
+	if err != nil {
+		return nil, err
+	}
+
+	field, exists := req.SecretLabels["env_field"]
+	if !exists {
+		field = "value"
+	}
+	value, handled, err := contentValue(content, req.SecretLabels)
+	if !handled {
+		value, err = e.extractSecretValueByField(content, field)
+	}
+	value, err = allowNullField(value, err, req.SecretLabels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract secret value: %w", err)
+	}
+
+	requestLogger(ctx).Printf("Successfully retrieved secret from environment variable")
+	return value, nil
+}
+
+// SupportsRotation indicates that environment variables support rotation monitoring
+func (e *EnvProvider) SupportsRotation() bool {
+	return true
+}
+
+// CheckSecretChanged checks if an environment variable has changed
+func (e *EnvProvider) CheckSecretChanged(ctx context.Context, secretInfo *SecretInfo) (bool, error) {
+	content, err := e.readVariable(secretInfo.SecretPath)
+	if err != nil {
+		return false, err
+	}
+
+	currentValue, handled, err := contentValue(content, secretInfo.Labels)
+	if !handled {
+		currentValue, err = e.extractSecretValueByField(content, secretInfo.SecretField)
+	}
+	currentValue, err = allowNullField(currentValue, err, secretInfo.Labels)
+	if err != nil {
+		return false, fmt.Errorf("failed to extract secret field %s: %v", secretInfo.SecretField, err)
+	}
+
+	currentHash := HashValue(currentValue)
+	return currentHash != secretInfo.LastHash, nil
+}
+
+// GetProviderName returns the name of this provider
+func (e *EnvProvider) GetProviderName() string {
+	return "env"
+}
+
+// FieldLabelKey returns the secret label selecting the field to extract
+func (e *EnvProvider) FieldLabelKey() string {
+	return "env_field"
+}
+
+// PathLabelKey returns the secret label overriding the variable name
+func (e *EnvProvider) PathLabelKey() string {
+	return "env_name"
+}
+
+// BuildPath returns the environment variable the request resolves to
+func (e *EnvProvider) BuildPath(req secrets.Request) string {
+	return e.buildVariableName(req)
+}
+
+// HealthCheck always succeeds, the environment is always available
+func (e *EnvProvider) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// Close performs cleanup for the environment provider
+func (e *EnvProvider) Close() error {
+	return nil
+}
+
+// readVariable returns the content of an environment variable
+func (e *EnvProvider) readVariable(name string) (string, error) {
+	content, ok := lookupEnv(name)
+	if !ok {
+		return "", notFoundErrorf("environment variable %s is not set", name)
+	}
+	return content, nil
+}
+
+// buildVariableName maps the secret name to an environment variable, e.g.
+// db-password with ENV_PREFIX=APP_ reads APP_DB_PASSWORD
+func (e *EnvProvider) buildVariableName(req secrets.Request) string {
+	if customName, exists := req.SecretLabels["env_name"]; exists {
+		return customName
+	}
+
+	name := strings.Map(func(char rune) rune {
+		if (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') {
+			return char
+		}
+		return '_'
+	}, req.SecretName)
+	return e.prefix + strings.ToUpper(name)
+}
+
+// extractSecretValueByField extracts a specific field from a JSON variable,
+// plain variables are delivered whole as the value field
+func (e *EnvProvider) extractSecretValueByField(content, field string) ([]byte, error) {
+	if data, err := decodeJSONObject(content); err == nil {
+		if value, ok := data[field]; ok {
+			return formatFieldValue(field, value)
+		}
+		if field != "value" {
+			return nil, notFoundErrorf("field %s not found in variable; available fields: %v", field, fieldNames(data))
+		}
+	} else if field != "value" {
+		return nil, notFoundErrorf("field %s not found in non-JSON variable", field)
+	}
+
+	return []byte(content), nil
+}
@@ -0,0 +1,64 @@
+package providers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestEnvProvider(t *testing.T) {
+	t.Setenv("APP_DB_PASSWORD", "hunter2")
+	t.Setenv("APP_DB", `{"username": "app", "password": "first"}`)
+	t.Setenv("SHARED_TOKEN", "token-1")
+
+	e := &EnvProvider{}
+	if err := e.Initialize(map[string]string{"ENV_PREFIX": "APP_"}); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		secretName string
+		labels     map[string]string
+		want       string
+		wantErr    ErrorKind
+	}{
+		{"prefixed and uppercased name", "db-password", nil, "hunter2", ""},
+		{"explicit variable", "token", map[string]string{"env_name": "SHARED_TOKEN"}, "token-1", ""},
+		{"JSON field", "db", map[string]string{"env_field": "username"}, "app", ""},
+		{"missing field", "db", map[string]string{"env_field": "host"}, "", ErrorKindNotFound},
+		{"unset variable", "api-key", nil, "", ErrorKindNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{}
+			for key, value := range tt.labels {
+				labels[key] = value
+			}
+			value, err := e.GetSecret(context.Background(), secrets.Request{SecretName: tt.secretName, SecretLabels: labels})
+			if tt.wantErr != "" {
+				if err == nil || KindOf(err) != tt.wantErr {
+					t.Fatalf("GetSecret() error = %v, expected a %s error", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetSecret() error = %v", err)
+			}
+			if string(value) != tt.want {
+				t.Errorf("GetSecret() = %q, expected %q", value, tt.want)
+			}
+		})
+	}
+
+	// Change detection hashes the current value of the variable
+	secretInfo := &SecretInfo{SecretPath: "APP_DB", SecretField: "password", LastHash: HashValue([]byte("first"))}
+	if changed, err := e.CheckSecretChanged(context.Background(), secretInfo); err != nil || changed {
+		t.Errorf("CheckSecretChanged() = %v, %v, expected unchanged", changed, err)
+	}
+	t.Setenv("APP_DB", `{"username": "app", "password": "second"}`)
+	if changed, err := e.CheckSecretChanged(context.Background(), secretInfo); err != nil || !changed {
+		t.Errorf("CheckSecretChanged() after the variable changed = %v, %v, expected changed", changed, err)
+	}
+}
@@ -0,0 +1,71 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorKind classifies provider failures, so callers can tell failures that
+// retrying cannot fix from ones that may succeed on retry
+type ErrorKind string
+
+const (
+	// ErrorKindConfig is a misconfiguration, such as a bad label or setting
+	ErrorKindConfig ErrorKind = "config"
+	// ErrorKindNotFound is a secret or field that does not exist in the backend
+	ErrorKindNotFound ErrorKind = "notfound"
+	// ErrorKindTransient is a backend or network failure that may succeed on retry
+	ErrorKindTransient ErrorKind = "transient"
+)
+
+// ProviderError carries the kind of a provider failure
+type ProviderError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *ProviderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// notFoundErrorf formats a ProviderError for a missing secret or field
+func notFoundErrorf(format string, args ...interface{}) error {
+	return &ProviderError{Kind: ErrorKindNotFound, Err: fmt.Errorf(format, args...)}
+}
+
+// KindOf returns the kind of a provider error. Errors that were not
+// classified are treated as transient.
+func KindOf(err error) ErrorKind {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.Kind
+	}
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		return ErrorKindConfig
+	}
+	return ErrorKindTransient
+}
+
+// ConfigError marks a provider configuration problem that retrying cannot fix,
+// such as a missing setting or an unsupported auth method
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// configErrorf formats a ConfigError
+func configErrorf(format string, args ...interface{}) error {
+	return &ConfigError{Err: fmt.Errorf(format, args...)}
+}
@@ -0,0 +1,27 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{"config error", configErrorf("VAULT_ADDR is required"), ErrorKindConfig},
+		{"wrapped config error", fmt.Errorf("failed to initialize: %w", configErrorf("bad setting")), ErrorKindConfig},
+		{"not found", notFoundErrorf("secret not found at path: %s", "app/db"), ErrorKindNotFound},
+		{"wrapped not found", fmt.Errorf("read failed: %w", notFoundErrorf("field missing")), ErrorKindNotFound},
+		{"explicit kind", &ProviderError{Kind: ErrorKindTransient, Err: errors.New("503")}, ErrorKindTransient},
+		{"unclassified", errors.New("connection refused"), ErrorKindTransient},
+	}
+	for _, tt := range tests {
+		if got := KindOf(tt.err); got != tt.want {
+			t.Errorf("%s: KindOf(%v) = %v, expected %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
@@ -18,6 +18,10 @@ func CreateProvider(providerType string) (SecretsProvider, error) {
 		return &AzureProvider{}, nil
 	case "openbao":
 		return &OpenBaoProvider{}, nil
+	case "swarmconfig", "swarm-config":
+		return &SwarmConfigProvider{}, nil
+	case "env":
+		return &EnvProvider{}, nil
 	default:
 		return nil, fmt.Errorf("unsupported provider type: %s", providerType)
 	}
@@ -31,6 +35,8 @@ func GetSupportedProviders() []string {
 		"gcp",
 		"azure",
 		"openbao",
+		"swarmconfig",
+		"env",
 	}
 }
 
@@ -69,6 +75,18 @@ func GetProviderInfo(providerType string) (map[string]string, error) {
 		info["auth_methods"] = "token, approle"
 		info["env_vars"] = "OPENBAO_ADDR, OPENBAO_TOKEN, OPENBAO_MOUNT_PATH, OPENBAO_AUTH_METHOD, OPENBAO_ROLE_ID, OPENBAO_SECRET_ID"
 
+	case "swarmconfig", "swarm-config":
+		info["name"] = "Docker Swarm Configs"
+		info["description"] = "Docker Swarm configs read through the local Docker socket"
+		info["auth_methods"] = "docker socket"
+		info["env_vars"] = "DOCKER_HOST, DOCKER_API_VERSION, DOCKER_CERT_PATH, DOCKER_TLS_VERIFY"
+
+	case "env":
+		info["name"] = "Environment Variables"
+		info["description"] = "Plugin environment variables, for development without a backend"
+		info["auth_methods"] = "none"
+		info["env_vars"] = "ENV_PREFIX"
+
 	default:
 		return nil, fmt.Errorf("unsupported provider type: %s", providerType)
 	}
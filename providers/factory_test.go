@@ -0,0 +1,64 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestProviderCapabilities(t *testing.T) {
+	tests := []struct {
+		providerType string
+		name         string
+		fieldLabel   string
+		pathLabel    string
+	}{
+		{"vault", "vault", "vault_field", "vault_path"},
+		{"aws", "aws", "aws_field", "aws_secret_name"},
+		{"gcp", "gcp", "gcp_field", "gcp_secret_name"},
+		{"azure", "azure", "azure_field", "azure_secret_name"},
+		{"openbao", "openbao", "openbao_field", "openbao_path"},
+		{"swarmconfig", "swarmconfig", "swarmconfig_field", "swarmconfig_name"},
+		{"env", "env", "env_field", "env_name"},
+	}
+	if len(tests) != len(GetSupportedProviders()) {
+		t.Fatalf("%d providers covered, %d supported", len(tests), len(GetSupportedProviders()))
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.providerType, func(t *testing.T) {
+			provider, err := CreateProvider(tt.providerType)
+			if err != nil {
+				t.Fatalf("CreateProvider() error = %v", err)
+			}
+			if got := provider.GetProviderName(); got != tt.name {
+				t.Errorf("GetProviderName() = %q, expected %q", got, tt.name)
+			}
+			if got := provider.FieldLabelKey(); got != tt.fieldLabel {
+				t.Errorf("FieldLabelKey() = %q, expected %q", got, tt.fieldLabel)
+			}
+			if got := provider.PathLabelKey(); got != tt.pathLabel {
+				t.Errorf("PathLabelKey() = %q, expected %q", got, tt.pathLabel)
+			}
+		})
+	}
+}
+
+func TestBuildPathHonorsPathLabel(t *testing.T) {
+	tests := []struct {
+		provider SecretsProvider
+		path     string
+	}{
+		{&AWSProvider{}, "prod/db"},
+		{&GCPProvider{}, "projects/prod/secrets/db"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.provider.GetProviderName(), func(t *testing.T) {
+			req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{tt.provider.PathLabelKey(): tt.path}}
+			if got := tt.provider.BuildPath(req); got != tt.path {
+				t.Errorf("BuildPath() = %q, expected %q", got, tt.path)
+			}
+		})
+	}
+}
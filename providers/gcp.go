@@ -2,23 +2,31 @@ package providers
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
 	"github.com/docker/go-plugins-helpers/secrets"
+	"github.com/googleapis/gax-go/v2"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 )
 
 // GCPProvider implements the SecretsProvider interface for GCP Secret Manager
 type GCPProvider struct {
 	client *secretmanager.Client
 	config *GCPConfig
-	ctx    context.Context
+	versionCache
 }
 
 // GCPConfig holds the configuration for the GCP Secret Manager client
@@ -26,43 +34,121 @@ type GCPConfig struct {
 	ProjectID       string
 	CredentialsPath string
 	CredentialsJSON string
+	APITimeout      time.Duration // overall deadline of one API call, retries included
+	RetryInitial    time.Duration
+	RetryMax        time.Duration
+	Naming          ServiceNaming // where the service name goes in default secret names
 }
 
 // Initialize sets up the GCP provider with the given configuration
 func (g *GCPProvider) Initialize(config map[string]string) error {
-	g.ctx = context.Background()
+	naming, err := serviceNaming(config)
+	if err != nil {
+		return err
+	}
+
 	g.config = &GCPConfig{
 		ProjectID:       getConfigOrDefault(config, "GCP_PROJECT_ID", ""),
 		CredentialsPath: getConfigOrDefault(config, "GOOGLE_APPLICATION_CREDENTIALS", ""),
 		CredentialsJSON: config["GCP_CREDENTIALS_JSON"],
+		Naming:          naming,
+	}
+	if isIsolated(config) && g.config.CredentialsJSON == "" && g.config.CredentialsPath == "" {
+		// Application default credentials belong to the plugin host
+		return configErrorf("GCP_CREDENTIALS_JSON is required")
+	}
+
+	if g.config.APITimeout, err = durationConfig(config, "GCP_API_TIMEOUT", 30*time.Second); err != nil {
+		return err
+	}
+	if g.config.RetryInitial, err = durationConfig(config, "GCP_RETRY_INITIAL_BACKOFF", 100*time.Millisecond); err != nil {
+		return err
+	}
+	if g.config.RetryMax, err = durationConfig(config, "GCP_RETRY_MAX_BACKOFF", 10*time.Second); err != nil {
+		return err
+	}
+
+	// Fall back to the project the service account belongs to
+	if g.config.ProjectID == "" {
+		projectID, err := g.projectIDFromCredentials()
+		if err != nil {
+			return err
+		}
+		g.config.ProjectID = projectID
+	}
+	if g.config.ProjectID == "" {
+		return configErrorf("GCP_PROJECT_ID is required when the credentials do not contain a project_id")
 	}
 
+	// The client talks gRPC, so the egress proxy is applied by the dialer
+	proxy, err := proxyFunc(config)
+	if err != nil {
+		return err
+	}
+	opts := []option.ClientOption{
+		option.WithGRPCDialOption(grpc.WithContextDialer(proxyDialer(proxy))),
+	}
+
+	// The client does not use an http.Client, so the provider TLS settings
+	// replace the gRPC transport credentials
+	tlsConfig, err := providerTLSConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to configure provider TLS: %w", err)
+	}
+	if tlsConfig != nil {
+		opts = append(opts, option.WithGRPCDialOption(grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))))
+	}
+
+	// The client lives as long as the provider, request deadlines come from
+	// the context passed to each call
+	ctx := context.Background()
 	var client *secretmanager.Client
-	var err error
 
 	if g.config.CredentialsJSON != "" {
-		client, err = secretmanager.NewClient(g.ctx, option.WithCredentialsJSON([]byte(g.config.CredentialsJSON)))
+		client, err = secretmanager.NewClient(ctx, append(opts, option.WithCredentialsJSON([]byte(g.config.CredentialsJSON)))...)
 	} else if g.config.CredentialsPath != "" {
-		client, err = secretmanager.NewClient(g.ctx, option.WithCredentialsFile(g.config.CredentialsPath))
+		client, err = secretmanager.NewClient(ctx, append(opts, option.WithCredentialsFile(g.config.CredentialsPath))...)
 	} else {
 		// Try using Application Default Credentials
-		client, err = secretmanager.NewClient(g.ctx)
+		client, err = secretmanager.NewClient(ctx, opts...)
 	}
 
 	if err != nil {
 		return fmt.Errorf("failed to create secretmanager client: %w", err)
 	}
+	g.configureCallOptions(client)
 	g.client = client
 
 	log.Printf("Successfully initialized GCP Secret Manager provider for project: %s", g.config.ProjectID)
 	return nil
 }
 
+// configureCallOptions applies the API timeout and retry backoff to the calls
+// the provider makes. Only transient errors are retried, within the timeout.
+func (g *GCPProvider) configureCallOptions(client *secretmanager.Client) {
+	opts := []gax.CallOption{
+		gax.WithTimeout(g.config.APITimeout),
+		gax.WithRetry(func() gax.Retryer {
+			return gax.OnCodes([]codes.Code{
+				codes.Unavailable,
+				codes.DeadlineExceeded,
+				codes.ResourceExhausted,
+			}, gax.Backoff{
+				Initial:    g.config.RetryInitial,
+				Max:        g.config.RetryMax,
+				Multiplier: 2,
+			})
+		}),
+	}
+	client.CallOptions.AccessSecretVersion = opts
+	client.CallOptions.ListSecrets = opts
+}
+
 // GetSecret retrieves a secret value from GCP Secret Manager
 func (g *GCPProvider) GetSecret(ctx context.Context, req secrets.Request) ([]byte, error) {
 	// Build the full secret name for GCP Secret Manager
 	secretName := g.buildSecretName(req)
-	log.Printf("Reading secret from GCP Secret Manager: %s", secretName)
+	requestLogger(ctx).Printf("Reading secret from GCP Secret Manager: %s", secretName)
 
 	// Create the request to access the latest version of the secret
 	secretRequest := &secretmanagerpb.AccessSecretVersionRequest{
@@ -71,73 +157,178 @@ func (g *GCPProvider) GetSecret(ctx context.Context, req secrets.Request) ([]byt
 
 	// Call the API to get the secret
 	result, err := g.client.AccessSecretVersion(ctx, secretRequest)
+	if status.Code(err) == codes.NotFound {
+		return nil, notFoundErrorf("secret %s not found in GCP Secret Manager", secretName)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to access secret version: %w", err)
 	}
 
+	// Refuse to serve a version not encrypted with the key the secret expects
+	if expectedKey, exists := req.SecretLabels["gcp_expected_kms_key"]; exists {
+		if err := g.verifyKMSKey(ctx, result.Name, expectedKey); err != nil {
+			return nil, err
+		}
+	}
+
 	// Store version information for rotation tracking
 	if g.SupportsRotation() {
-		log.Printf("Secret version for rotation tracking: %s", result.Name)
+		requestLogger(ctx).Printf("Secret version for rotation tracking: %s", result.Name)
+		g.recordVersion(secretName, result.Name)
 	}
 
 	// Extract the specific field from the secret data
 	secretData := result.Payload.Data
-	extractedValue, err := g.extractSecretValue(string(secretData), req)
+	extractedValue, handled, err := contentValue(string(secretData), req.SecretLabels)
+	if !handled {
+		extractedValue, err = g.extractSecretValue(string(secretData), req)
+	}
+	extractedValue, err = allowNullField(extractedValue, err, req.SecretLabels)
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract secret value: %v", err)
+		return nil, fmt.Errorf("failed to extract secret value: %w", err)
 	}
 
 	return extractedValue, nil
 }
 
+// verifyKMSKey checks that every replica of a secret version is encrypted with
+// the expected customer-managed key. The key may be given as a key or a key
+// version resource name.
+func (g *GCPProvider) verifyKMSKey(ctx context.Context, versionName, expectedKey string) error {
+	version, err := g.client.GetSecretVersion(ctx, &secretmanagerpb.GetSecretVersionRequest{Name: versionName})
+	if err != nil {
+		return fmt.Errorf("failed to read encryption of secret version %s: %w", versionName, err)
+	}
+
+	var keyVersions []string
+	replication := version.GetReplicationStatus()
+	if automatic := replication.GetAutomatic(); automatic != nil {
+		keyVersions = append(keyVersions, automatic.GetCustomerManagedEncryption().GetKmsKeyVersionName())
+	}
+	for _, replica := range replication.GetUserManaged().GetReplicas() {
+		keyVersions = append(keyVersions, replica.GetCustomerManagedEncryption().GetKmsKeyVersionName())
+	}
+	if len(keyVersions) == 0 {
+		return configErrorf("secret version %s has no replication status to verify its KMS key", versionName)
+	}
+
+	expected := kmsKeyName(expectedKey)
+	for _, keyVersion := range keyVersions {
+		if keyVersion == "" {
+			return configErrorf("secret version %s is not encrypted with a customer-managed key, expected %s", versionName, expectedKey)
+		}
+		if keyVersion != expectedKey && kmsKeyName(keyVersion) != expected {
+			return configErrorf("secret version %s is encrypted with %s, expected %s", versionName, keyVersion, expectedKey)
+		}
+	}
+	return nil
+}
+
+// kmsKeyName strips the version from a Cloud KMS key version resource name
+func kmsKeyName(name string) string {
+	if idx := strings.Index(name, "/cryptoKeyVersions/"); idx >= 0 {
+		return name[:idx]
+	}
+	return name
+}
+
+// projectIDFromCredentials reads the project_id field from the configured service account credentials
+func (g *GCPProvider) projectIDFromCredentials() (string, error) {
+	var raw []byte
+	switch {
+	case g.config.CredentialsJSON != "":
+		raw = []byte(g.config.CredentialsJSON)
+	case g.config.CredentialsPath != "":
+		data, err := os.ReadFile(g.config.CredentialsPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read GCP credentials file: %w", err)
+		}
+		raw = data
+	default:
+		return "", nil
+	}
+
+	var creds struct {
+		ProjectID string `json:"project_id"`
+	}
+	if err := json.Unmarshal(raw, &creds); err != nil {
+		return "", configErrorf("failed to parse GCP credentials: %w", err)
+	}
+
+	if creds.ProjectID != "" {
+		log.Printf("Using GCP project %s from credentials", creds.ProjectID)
+	}
+	return creds.ProjectID, nil
+}
+
 // buildSecretName constructs the GCP secret name based on request labels and service information
 func (g *GCPProvider) buildSecretName(req secrets.Request) string {
-	// Use custom path from labels if provided
-	if customPath, exists := req.SecretLabels["gcp_secret_name"]; exists {
+	// Use custom path from labels if provided, short names are resolved in the project
+	customPath, hasCustomPath := req.SecretLabels["gcp_secret_name"]
+	if hasCustomPath && strings.HasPrefix(customPath, "projects/") {
 		return customPath
 	}
 
 	// Default naming convention: projects/{project}/secrets/{secret-name}
-	projectID := g.config.ProjectID
-	if projectID == "" {
+	project := g.config.ProjectID
+	if override, exists := req.SecretLabels["gcp_project_override"]; exists && override != "" {
+		project = override
+	}
+	project = normalizeGCPProject(project)
+	if project == "" {
 		log.Fatal("GCP_PROJECT_ID is required but not configured. Please set the GCP_PROJECT_ID environment variable.")
 	}
 
-	secretName := req.SecretName
-	if req.ServiceName != "" {
-		secretName = fmt.Sprintf("%s-%s", req.ServiceName, req.SecretName)
+	if hasCustomPath {
+		return fmt.Sprintf("projects/%s/secrets/%s", project, customPath)
 	}
 
-	return fmt.Sprintf("projects/%s/secrets/%s", projectID, secretName)
+	secretName := g.config.Naming.join(req.ServiceName, req.SecretName, "-")
+	return fmt.Sprintf("projects/%s/secrets/%s", project, secretName)
+}
+
+// normalizeGCPProject accepts a project id or project number, with or without
+// the projects/ prefix, and returns the bare identifier for resource names
+func normalizeGCPProject(project string) string {
+	project = strings.TrimPrefix(strings.TrimSpace(project), "projects/")
+	project = strings.TrimSuffix(project, "/")
+	if isGCPProjectNumber(project) {
+		log.Debugf("Using GCP project number %s in resource names", project)
+	}
+	return project
+}
+
+// isGCPProjectNumber reports whether the identifier is a numeric project number rather than a project id
+func isGCPProjectNumber(project string) bool {
+	if project == "" {
+		return false
+	}
+	for _, char := range project {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+	return true
 }
 
 // extractSecretValue extracts the appropriate value from the GCP secret string
 func (g *GCPProvider) extractSecretValue(secretString string, req secrets.Request) ([]byte, error) {
+	// Deliver the whole secret object in the stable encodeJSON form
+	if strings.ToLower(req.SecretLabels["all_fields"]) == "true" {
+		data, err := decodeJSONObject(secretString)
+		if err != nil {
+			return nil, fmt.Errorf("all_fields requires a JSON object secret")
+		}
+		return encodeJSON(data)
+	}
+
 	// Check for specific field in labels
 	if field, exists := req.SecretLabels["gcp_field"]; exists {
 		return g.extractSecretValueByField(secretString, field)
 	}
 
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(secretString), &data); err == nil {
-		// Default field names to try
-		defaultFields := []string{"value", "password", "secret", "data"}
-
-		// Try to find a value using default field names
-		for _, field := range defaultFields {
-			if value, ok := data[field]; ok {
-				return []byte(fmt.Sprintf("%v", value)), nil
-			}
-		}
-
-		// If no specific field found, return the first string value
-		for _, value := range data {
-			if strValue, ok := value.(string); ok {
-				return []byte(strValue), nil
-			}
-		}
-
-		return nil, fmt.Errorf("no suitable secret value found in JSON")
+	if data, err := decodeJSONObject(secretString); err == nil {
+		return defaultFieldValue(data, strictField(req))
 	}
 
 	// If not JSON, return the raw string
@@ -147,22 +338,17 @@ func (g *GCPProvider) extractSecretValue(secretString string, req secrets.Reques
 // extractSecretValueByField extracts a specific field from the secret string
 func (g *GCPProvider) extractSecretValueByField(secretString, field string) ([]byte, error) {
 	// Try to parse as JSON first
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(secretString), &data); err == nil {
+	if data, err := decodeJSONObject(secretString); err == nil {
 		if value, ok := data[field]; ok {
-			return []byte(fmt.Sprintf("%v", value)), nil
+			return formatFieldValue(field, value)
 		}
 		// Improved error message: show available keys
-		keys := make([]string, 0, len(data))
-		for k := range data {
-			keys = append(keys, k)
-		}
-		return nil, fmt.Errorf("field %s not found in secret; available fields: %v", field, keys)
+		return nil, notFoundErrorf("field %s not found in secret; available fields: %v", field, fieldNames(data))
 	}
 
 	// If not JSON and field is requested, return error
 	if field != "value" {
-		return nil, fmt.Errorf("field %s not found in non-JSON secret", field)
+		return nil, notFoundErrorf("field %s not found in non-JSON secret", field)
 	}
 
 	// If field is "value" and not JSON, return the raw string
@@ -174,6 +360,20 @@ func (g *GCPProvider) SupportsRotation() bool {
 	return true
 }
 
+// RotationSchedule returns the rotation period from the secret's rotation policy
+func (g *GCPProvider) RotationSchedule(ctx context.Context, path string) (time.Duration, bool, error) {
+	secret, err := g.client.GetSecret(ctx, &secretmanagerpb.GetSecretRequest{Name: path})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get GCP secret metadata for %s: %w", path, err)
+	}
+
+	period := secret.GetRotation().GetRotationPeriod()
+	if period == nil || period.AsDuration() <= 0 {
+		return 0, false, nil
+	}
+	return period.AsDuration(), true, nil
+}
+
 // CheckSecretChanged checks if a secret has changed in GCP Secret Manager
 func (g *GCPProvider) CheckSecretChanged(ctx context.Context, secretInfo *SecretInfo) (bool, error) {
 	secretName := secretInfo.SecretPath
@@ -190,11 +390,15 @@ func (g *GCPProvider) CheckSecretChanged(ctx context.Context, secretInfo *Secret
 
 	// Extract the secret value using the same logic as GetSecret
 	secretData := result.Payload.Data
-	var extractedValue []byte
+	extractedValue, handled, err := contentValue(string(secretData), secretInfo.Labels)
 
-	if secretInfo.SecretField != "" {
+	switch {
+	case handled:
+	case secretInfo.AllFields:
+		extractedValue, err = g.extractSecretValue(string(secretData), allFieldsRequest())
+	case secretInfo.SecretField != "":
 		extractedValue, err = g.extractSecretValueByField(string(secretData), secretInfo.SecretField)
-	} else {
+	default:
 		// Create a dummy request to use existing extraction logic
 		dummyReq := secrets.Request{
 			SecretName:   secretInfo.DockerSecretName,
@@ -203,12 +407,13 @@ func (g *GCPProvider) CheckSecretChanged(ctx context.Context, secretInfo *Secret
 		extractedValue, err = g.extractSecretValue(string(secretData), dummyReq)
 	}
 
+	extractedValue, err = allowNullField(extractedValue, err, secretInfo.Labels)
 	if err != nil {
 		return false, fmt.Errorf("failed to extract secret value: %w", err)
 	}
 
 	// Compute hash of current value
-	currentHash := computeHash(extractedValue)
+	currentHash := HashValue(extractedValue)
 
 	// Compare with stored hash
 	if secretInfo.LastHash != currentHash {
@@ -224,6 +429,39 @@ func (g *GCPProvider) GetProviderName() string {
 	return "gcp"
 }
 
+// FieldLabelKey returns the secret label selecting the field to extract
+func (g *GCPProvider) FieldLabelKey() string {
+	return "gcp_field"
+}
+
+// PathLabelKey returns the secret label overriding the GCP Secret Manager path
+func (g *GCPProvider) PathLabelKey() string {
+	return "gcp_secret_name"
+}
+
+// BuildPath returns the GCP Secret Manager path the request resolves to
+func (g *GCPProvider) BuildPath(req secrets.Request) string {
+	return g.buildSecretName(req)
+}
+
+// HealthCheck reports whether GCP Secret Manager is reachable. Any API
+// response, including permission denied, counts as reachable.
+func (g *GCPProvider) HealthCheck(ctx context.Context) error {
+	it := g.client.ListSecrets(ctx, &secretmanagerpb.ListSecretsRequest{
+		Parent:   "projects/" + g.config.ProjectID,
+		PageSize: 1,
+	})
+	_, err := it.Next()
+	if err == nil || errors.Is(err, iterator.Done) {
+		return nil
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled, codes.Unknown:
+		return fmt.Errorf("GCP Secret Manager is unreachable: %w", err)
+	}
+	return nil
+}
+
 // Close performs cleanup for the GCP provider
 func (g *GCPProvider) Close() error {
 	if g.client != nil {
@@ -231,9 +469,3 @@ func (g *GCPProvider) Close() error {
 	}
 	return nil
 }
-
-// computeHash computes SHA256 hash of the given data
-func computeHash(data []byte) string {
-	hash := sha256.Sum256(data)
-	return hex.EncodeToString(hash[:])
-}
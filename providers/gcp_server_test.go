@@ -0,0 +1,80 @@
+package providers
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// fakeSecretManager is an in-process Secret Manager. Each AccessSecretVersion
+// call takes the next error of failures before it answers with payload.
+type fakeSecretManager struct {
+	secretmanagerpb.UnimplementedSecretManagerServiceServer
+	mutex    sync.Mutex
+	payload  string
+	version  *secretmanagerpb.SecretVersion
+	failures []error
+	calls    int
+}
+
+func (f *fakeSecretManager) AccessSecretVersion(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.calls++
+	if len(f.failures) > 0 {
+		err := f.failures[0]
+		f.failures = f.failures[1:]
+		return nil, err
+	}
+	return &secretmanagerpb.AccessSecretVersionResponse{
+		Name:    req.Name[:len(req.Name)-len("latest")] + "3",
+		Payload: &secretmanagerpb.SecretPayload{Data: []byte(f.payload)},
+	}, nil
+}
+
+func (f *fakeSecretManager) GetSecretVersion(ctx context.Context, req *secretmanagerpb.GetSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.version, nil
+}
+
+// callCount returns the number of AccessSecretVersion calls answered
+func (f *fakeSecretManager) callCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.calls
+}
+
+// newFakeGCPProvider serves a GCP provider from an in-process Secret Manager
+func newFakeGCPProvider(t *testing.T, server *fakeSecretManager, config *GCPConfig) *GCPProvider {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := grpc.NewServer()
+	secretmanagerpb.RegisterSecretManagerServiceServer(grpcServer, server)
+	go func() { _ = grpcServer.Serve(listener) }()
+	t.Cleanup(grpcServer.Stop)
+
+	client, err := secretmanager.NewClient(context.Background(),
+		option.WithEndpoint(listener.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	g := &GCPProvider{client: client, config: config}
+	g.configureCallOptions(client)
+	return g
+}
@@ -0,0 +1,204 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/docker/go-plugins-helpers/secrets"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGCPProjectIDFromCredentials(t *testing.T) {
+	credentials := `{"type": "service_account", "project_id": "from-credentials", "client_email": "plugin@from-credentials.iam.gserviceaccount.com"}`
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(path, []byte(credentials), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  GCPConfig
+		want    string
+		wantErr bool
+	}{
+		{"credentials json", GCPConfig{CredentialsJSON: credentials}, "from-credentials", false},
+		{"credentials file", GCPConfig{CredentialsPath: path}, "from-credentials", false},
+		{"json wins over file", GCPConfig{CredentialsJSON: `{"project_id": "from-json"}`, CredentialsPath: path}, "from-json", false},
+		{"no project_id", GCPConfig{CredentialsJSON: `{"type": "service_account"}`}, "", false},
+		{"no credentials", GCPConfig{}, "", false},
+		{"invalid json", GCPConfig{CredentialsJSON: "not json"}, "", true},
+		{"missing file", GCPConfig{CredentialsPath: filepath.Join(t.TempDir(), "missing.json")}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &GCPProvider{config: &tt.config}
+			projectID, err := provider.projectIDFromCredentials()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("projectIDFromCredentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if projectID != tt.want {
+				t.Errorf("projectIDFromCredentials() = %q, expected %q", projectID, tt.want)
+			}
+		})
+	}
+}
+
+func TestGCPInitializeRequiresProject(t *testing.T) {
+	provider := &GCPProvider{}
+	err := provider.Initialize(Isolated(map[string]string{"GCP_CREDENTIALS_JSON": `{"type": "service_account"}`}))
+	if KindOf(err) != ErrorKindConfig {
+		t.Errorf("Initialize() error = %v, expected a configuration error", err)
+	}
+}
+
+func TestGCPProjectResourceNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		project  string
+		labels   map[string]string
+		wantName string
+	}{
+		{"project id", "my-project", nil, "projects/my-project/secrets/db"},
+		{"project number", "123456789012", nil, "projects/123456789012/secrets/db"},
+		{"prefixed project number", "projects/123456789012/", nil, "projects/123456789012/secrets/db"},
+		{"override with number", "my-project", map[string]string{"gcp_project_override": "987654321098"}, "projects/987654321098/secrets/db"},
+		{"override with id", "123456789012", map[string]string{"gcp_project_override": "other-project"}, "projects/other-project/secrets/db"},
+		{"custom short name", "123456789012", map[string]string{"gcp_secret_name": "shared-db"}, "projects/123456789012/secrets/shared-db"},
+		{"custom full name", "my-project", map[string]string{"gcp_secret_name": "projects/555/secrets/db"}, "projects/555/secrets/db"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &GCPProvider{config: &GCPConfig{ProjectID: tt.project}}
+			got := provider.BuildPath(secrets.Request{SecretName: "db", SecretLabels: tt.labels})
+			if got != tt.wantName {
+				t.Errorf("BuildPath() = %q, expected %q", got, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestIsGCPProjectNumber(t *testing.T) {
+	for project, want := range map[string]bool{"123456789012": true, "my-project": false, "project-123": false, "": false} {
+		if got := isGCPProjectNumber(project); got != want {
+			t.Errorf("isGCPProjectNumber(%q) = %v, expected %v", project, got, want)
+		}
+	}
+}
+
+func TestGCPRetries(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "backend unavailable")
+	denied := status.Error(codes.PermissionDenied, "permission denied")
+	tests := []struct {
+		name      string
+		failures  []error
+		timeout   time.Duration
+		wantErr   bool
+		wantCalls int
+	}{
+		{"transient errors retried", []error{unavailable, unavailable}, time.Second, false, 3},
+		{"permission denied not retried", []error{denied}, time.Second, true, 1},
+		// Backoff is jittered, so fail far more often than fits in the timeout
+		{"retries stop at the API timeout", slices.Repeat([]error{unavailable}, 1000), 50 * time.Millisecond, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeSecretManager{payload: "hunter2", failures: tt.failures}
+			g := newFakeGCPProvider(t, server, &GCPConfig{
+				ProjectID:    "my-project",
+				APITimeout:   tt.timeout,
+				RetryInitial: 10 * time.Millisecond,
+				RetryMax:     20 * time.Millisecond,
+			})
+
+			value, err := g.GetSecret(context.Background(), secrets.Request{SecretName: "db"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(value) != "hunter2" {
+				t.Errorf("GetSecret() = %q, expected %q", value, "hunter2")
+			}
+			if calls := server.callCount(); tt.wantCalls > 0 && calls != tt.wantCalls {
+				t.Errorf("%d calls, expected %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestGCPRetrySettings(t *testing.T) {
+	for _, key := range []string{"GCP_API_TIMEOUT", "GCP_RETRY_INITIAL_BACKOFF", "GCP_RETRY_MAX_BACKOFF"} {
+		for _, value := range []string{"soon", "-1s", "0s"} {
+			err := (&GCPProvider{}).Initialize(Isolated(map[string]string{
+				"GCP_PROJECT_ID":       "my-project",
+				"GCP_CREDENTIALS_JSON": "{}",
+				key:                    value,
+			}))
+			if KindOf(err) != ErrorKindConfig {
+				t.Errorf("Initialize() with %s=%q error = %v, expected a configuration error", key, value, err)
+			}
+		}
+	}
+}
+
+func TestGCPExpectedKMSKey(t *testing.T) {
+	const key = "projects/my-project/locations/global/keyRings/plugin/cryptoKeys/secrets"
+	cmek := func(keyVersion string) *secretmanagerpb.CustomerManagedEncryptionStatus {
+		return &secretmanagerpb.CustomerManagedEncryptionStatus{KmsKeyVersionName: keyVersion}
+	}
+	automatic := func(encryption *secretmanagerpb.CustomerManagedEncryptionStatus) *secretmanagerpb.SecretVersion {
+		return &secretmanagerpb.SecretVersion{ReplicationStatus: &secretmanagerpb.ReplicationStatus{
+			ReplicationStatus: &secretmanagerpb.ReplicationStatus_Automatic{
+				Automatic: &secretmanagerpb.ReplicationStatus_AutomaticStatus{CustomerManagedEncryption: encryption},
+			},
+		}}
+	}
+	replicas := func(encryptions ...*secretmanagerpb.CustomerManagedEncryptionStatus) *secretmanagerpb.SecretVersion {
+		status := &secretmanagerpb.ReplicationStatus_UserManagedStatus{}
+		for _, encryption := range encryptions {
+			status.Replicas = append(status.Replicas, &secretmanagerpb.ReplicationStatus_UserManagedStatus_ReplicaStatus{CustomerManagedEncryption: encryption})
+		}
+		return &secretmanagerpb.SecretVersion{ReplicationStatus: &secretmanagerpb.ReplicationStatus{
+			ReplicationStatus: &secretmanagerpb.ReplicationStatus_UserManaged{UserManaged: status},
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+		version  *secretmanagerpb.SecretVersion
+		wantErr  bool
+	}{
+		{"matching key", key, automatic(cmek(key + "/cryptoKeyVersions/3")), false},
+		{"matching key version", key + "/cryptoKeyVersions/3", automatic(cmek(key + "/cryptoKeyVersions/3")), false},
+		{"every replica matches", key, replicas(cmek(key+"/cryptoKeyVersions/1"), cmek(key+"/cryptoKeyVersions/2")), false},
+		{"one replica on another key", key, replicas(cmek(key+"/cryptoKeyVersions/1"), cmek("projects/other/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1")), true},
+		{"google-managed encryption", key, automatic(nil), true},
+		{"no replication status", key, &secretmanagerpb.SecretVersion{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeSecretManager{payload: "hunter2", version: tt.version}
+			g := newFakeGCPProvider(t, server, &GCPConfig{ProjectID: "my-project", APITimeout: time.Second})
+
+			req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"gcp_expected_kms_key": tt.expected}}
+			value, err := g.GetSecret(context.Background(), req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && KindOf(err) != ErrorKindConfig {
+				t.Errorf("KindOf(%v) = %v, expected %v", err, KindOf(err), ErrorKindConfig)
+			}
+			if !tt.wantErr && string(value) != "hunter2" {
+				t.Errorf("GetSecret() = %q, expected %q", value, "hunter2")
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package providers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// changeHashKey switches change detection from plain SHA-256 to HMAC-SHA256,
+// so a crafted value cannot be made to collide with a known hash
+var (
+	changeHashKey   []byte
+	changeHashMutex sync.RWMutex
+)
+
+// SetChangeHashKey sets the HMAC key of change detection hashes, an empty key
+// selects plain SHA-256
+func SetChangeHashKey(key string) {
+	changeHashMutex.Lock()
+	defer changeHashMutex.Unlock()
+	changeHashKey = []byte(key)
+}
+
+// HashValue returns the change detection hash of a secret value. The driver
+// and every provider use it, so tracked and current hashes always compare.
+func HashValue(value []byte) string {
+	changeHashMutex.RLock()
+	key := changeHashKey
+	changeHashMutex.RUnlock()
+
+	if len(key) == 0 {
+		sum := sha256.Sum256(value)
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(value)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,35 @@
+package providers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestHashValue(t *testing.T) {
+	t.Cleanup(func() { SetChangeHashKey("") })
+	value := []byte("hunter2")
+
+	plain := sha256.Sum256(value)
+	if got := HashValue(value); got != hex.EncodeToString(plain[:]) {
+		t.Errorf("HashValue() without a key = %s, expected plain SHA-256", got)
+	}
+
+	SetChangeHashKey("instance-key")
+	mac := hmac.New(sha256.New, []byte("instance-key"))
+	mac.Write(value)
+	keyed := HashValue(value)
+	if keyed != hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("HashValue() with a key = %s, expected HMAC-SHA256", keyed)
+	}
+	if HashValue(value) != keyed {
+		t.Error("HashValue() is not stable for the same key and value")
+	}
+
+	// Another instance key yields unrelated hashes
+	SetChangeHashKey("other-key")
+	if HashValue(value) == keyed {
+		t.Error("HashValue() is the same under two keys")
+	}
+}
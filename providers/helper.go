@@ -0,0 +1,315 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// defaultFields are tried in order when the request names no field
+var defaultFields = []string{"value", "password", "secret", "data"}
+
+// errNullField marks a JSON field whose value is explicitly null
+var errNullField = errors.New("field is null")
+
+// formatFieldValue renders an extracted secret field, keeping nested objects
+// and arrays as JSON instead of Go's map/slice formatting. A null field fails
+// rather than rendering as "<nil>".
+func formatFieldValue(field string, value interface{}) ([]byte, error) {
+	switch value.(type) {
+	case nil:
+		return nil, &ProviderError{Kind: ErrorKindNotFound, Err: fmt.Errorf("%w: %s is null; set allow_empty=true to deliver an empty value", errNullField, field)}
+	case map[string]interface{}, []interface{}:
+		if encoded, err := encodeJSON(value); err == nil {
+			return encoded, nil
+		}
+	}
+	return []byte(fmt.Sprintf("%v", value)), nil
+}
+
+// allowNullField turns the error of a null field into an empty value for
+// secrets labeled allow_empty=true, other results pass through
+func allowNullField(value []byte, err error, labels map[string]string) ([]byte, error) {
+	if errors.Is(err, errNullField) && strings.ToLower(labels["allow_empty"]) == "true" {
+		return []byte{}, nil
+	}
+	return value, err
+}
+
+// Content types of the content_type label
+const (
+	ContentTypeJSON   = "application/json"
+	ContentTypeText   = "text/plain"
+	ContentTypeBinary = "application/octet-stream"
+)
+
+// ContentType returns the media type of a secret's content_type label,
+// without parameters such as charset, or "" when the label is not set
+func ContentType(labels map[string]string) (string, error) {
+	raw, exists := labels["content_type"]
+	if !exists {
+		return "", nil
+	}
+	mediaType, _, err := mime.ParseMediaType(raw)
+	if err != nil {
+		return "", configErrorf("invalid content_type %q: %v", raw, err)
+	}
+	switch mediaType {
+	case ContentTypeJSON, ContentTypeText, ContentTypeBinary:
+		return mediaType, nil
+	default:
+		return "", configErrorf("unsupported content_type %q: use %s, %s or %s", raw, ContentTypeJSON, ContentTypeText, ContentTypeBinary)
+	}
+}
+
+// contentValue applies the content_type label to a secret stored as a string.
+// Text and binary content is the value as a whole, without looking for
+// fields; JSON content must parse. handled reports whether value and err are
+// final, otherwise the provider extracts fields as usual.
+func contentValue(content string, labels map[string]string) (value []byte, handled bool, err error) {
+	contentType, err := ContentType(labels)
+	if err != nil {
+		return nil, true, err
+	}
+
+	switch contentType {
+	case ContentTypeText, ContentTypeBinary:
+		return []byte(content), true, nil
+	case ContentTypeJSON:
+		if _, err := decodeJSONObject(content); err != nil {
+			return nil, true, configErrorf("content_type is %s but the secret is not a JSON object: %v", ContentTypeJSON, err)
+		}
+	}
+	return nil, false, nil
+}
+
+// decodeJSONObject parses a secret holding a JSON object. Numbers are kept as
+// json.Number, so large integers such as account IDs keep their exact text
+// instead of passing through float64.
+func decodeJSONObject(content string) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+
+	var data map[string]interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+	// Unmarshal rejected trailing data, the decoder stops after one value
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid character after top-level value")
+	}
+	return data, nil
+}
+
+// encodeJSON renders the JSON the plugin generates, whole secret objects and
+// nested fields, in one stable form: keys sorted at every level, no whitespace
+// and no trailing newline. Unlike json.Marshal, <, > and & are kept as written.
+func encodeJSON(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// allFieldsRequest is a request for the whole secret object, used by rotation
+// checks of secrets tracked with all_fields
+func allFieldsRequest() secrets.Request {
+	return secrets.Request{SecretLabels: map[string]string{"all_fields": "true"}}
+}
+
+// emptySecretValue handles a secret that exists but holds no data, e.g. a KV
+// v2 secret whose versions were all deleted. Secrets labeled allow_empty=true
+// deliver an empty value, others fail with an error naming the cause.
+func emptySecretValue(labels map[string]string) ([]byte, error) {
+	if strings.ToLower(labels["allow_empty"]) == "true" {
+		return []byte{}, nil
+	}
+	return nil, notFoundErrorf("secret exists but has no data (deleted or never written); set allow_empty=true to deliver an empty value")
+}
+
+// durationConfig reads a duration setting, rejecting values that do not parse
+func durationConfig(config map[string]string, key string, defaultValue time.Duration) (time.Duration, error) {
+	raw := getConfigOrDefault(config, key, "")
+	if raw == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(raw)
+	if err != nil || duration <= 0 {
+		return 0, configErrorf("invalid %s %q: expected a positive duration such as 30s", key, raw)
+	}
+	return duration, nil
+}
+
+// ServiceNaming decides how the service name takes part in default secret paths
+type ServiceNaming struct {
+	Placement      string // prefix, suffix or none
+	DefaultService string // used when the request has no service name
+}
+
+// serviceNaming reads SERVICE_NAME_PLACEMENT and DEFAULT_SERVICE_NAME
+func serviceNaming(config map[string]string) (ServiceNaming, error) {
+	placement := strings.ToLower(getConfigOrDefault(config, "SERVICE_NAME_PLACEMENT", "prefix"))
+	switch placement {
+	case "prefix", "suffix", "none":
+	default:
+		return ServiceNaming{}, configErrorf("invalid SERVICE_NAME_PLACEMENT %q, expected prefix, suffix or none", placement)
+	}
+	return ServiceNaming{
+		Placement:      placement,
+		DefaultService: config["DEFAULT_SERVICE_NAME"],
+	}, nil
+}
+
+// join builds the default secret name from the service and secret names,
+// joined with the separator the backend allows in names
+func (n ServiceNaming) join(serviceName, secretName, sep string) string {
+	if serviceName == "" {
+		serviceName = n.DefaultService
+	}
+	if serviceName == "" {
+		return secretName
+	}
+	switch n.Placement {
+	case "suffix":
+		return secretName + sep + serviceName
+	case "none":
+		return secretName
+	}
+	return serviceName + sep + secretName
+}
+
+// strictField reports whether the request disabled the default field search
+func strictField(req secrets.Request) bool {
+	return strings.ToLower(req.SecretLabels["strict_field"]) == "true"
+}
+
+// defaultFieldValue picks the value delivered when the request names no field.
+// It tries the default field names, then the first string field in key order.
+// In strict mode the secret must have exactly one field instead.
+func defaultFieldValue(data map[string]interface{}, strict bool) ([]byte, error) {
+	keys := fieldNames(data)
+
+	if strict {
+		if len(keys) != 1 {
+			return nil, configErrorf("strict_field is set and the secret has %d fields %v; select one with a field label", len(keys), keys)
+		}
+		return formatFieldValue(keys[0], data[keys[0]])
+	}
+
+	for _, field := range defaultFields {
+		if value, ok := data[field]; ok {
+			return formatFieldValue(field, value)
+		}
+	}
+
+	// Sorted so the same secret always yields the same field
+	for _, key := range keys {
+		if strValue, ok := data[key].(string); ok {
+			return []byte(strValue), nil
+		}
+	}
+
+	return nil, configErrorf("no suitable secret value found; select a field with a field label")
+}
+
+// versionCache remembers the backend version of the last secret read from
+// each path. Providers embed it to implement VersionReporter.
+type versionCache struct {
+	versionMutex sync.Mutex
+	versions     map[string]string
+}
+
+// recordVersion stores the version of the secret just read from path
+func (c *versionCache) recordVersion(path, version string) {
+	c.versionMutex.Lock()
+	defer c.versionMutex.Unlock()
+
+	if c.versions == nil {
+		c.versions = make(map[string]string)
+	}
+	if version == "" {
+		delete(c.versions, path)
+		return
+	}
+	c.versions[path] = version
+}
+
+// SecretVersion returns the backend version of the last secret read from path
+func (c *versionCache) SecretVersion(path string) (string, bool) {
+	c.versionMutex.Lock()
+	defer c.versionMutex.Unlock()
+
+	version, ok := c.versions[path]
+	return version, ok
+}
+
+// parseMountPaths splits a comma-separated mount path setting, such as
+// VAULT_MOUNT_PATH, into mounts
+func parseMountPaths(value string) []string {
+	var mounts []string
+	for _, mount := range strings.Split(value, ",") {
+		if mount = strings.Trim(strings.TrimSpace(mount), "/"); mount != "" {
+			mounts = append(mounts, mount)
+		}
+	}
+	return mounts
+}
+
+// mountMemory remembers which of several candidate mounts held each secret,
+// for the Vault-compatible providers trying their mounts in order
+type mountMemory struct {
+	mountMutex sync.Mutex
+	mounts     map[string]string // path below the mount -> mount the secret was found under
+}
+
+// candidates returns the mounts to try for a secret path below the mount,
+// the one that held it last time first
+func (m *mountMemory) candidates(mounts []string, relativePath string) []string {
+	m.mountMutex.Lock()
+	known, ok := m.mounts[relativePath]
+	m.mountMutex.Unlock()
+	if !ok {
+		return mounts
+	}
+
+	candidates := []string{known}
+	for _, mount := range mounts {
+		if mount != known {
+			candidates = append(candidates, mount)
+		}
+	}
+	return candidates
+}
+
+// remember records the mount a secret path was found under
+func (m *mountMemory) remember(relativePath, mount string) {
+	m.mountMutex.Lock()
+	defer m.mountMutex.Unlock()
+
+	if m.mounts == nil {
+		m.mounts = make(map[string]string)
+	}
+	m.mounts[relativePath] = mount
+}
+
+// fieldNames returns the sorted top-level field names of a secret
+func fieldNames(data map[string]interface{}) []string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
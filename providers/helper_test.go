@@ -0,0 +1,363 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestDefaultFieldValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]interface{}
+		strict  bool
+		want    string
+		wantErr bool
+	}{
+		{"default field name", map[string]interface{}{"user": "app", "password": "hunter2"}, false, "hunter2", false},
+		{"value before password", map[string]interface{}{"password": "hunter2", "value": "v"}, false, "v", false},
+		{"first string in key order", map[string]interface{}{"zeta": "z", "alpha": "a", "mid": "m"}, false, "a", false},
+		{"non-string fields skipped", map[string]interface{}{"count": 3, "name": "n"}, false, "n", false},
+		{"no string field", map[string]interface{}{"count": 3}, false, "", true},
+		{"strict single field", map[string]interface{}{"token": "t"}, true, "t", false},
+		{"strict several fields", map[string]interface{}{"user": "app", "password": "hunter2"}, true, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Repeated, since map order varies between iterations
+			for range 20 {
+				value, err := defaultFieldValue(tt.data, tt.strict)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("defaultFieldValue() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if string(value) != tt.want {
+					t.Fatalf("defaultFieldValue() = %q, expected %q", value, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultServiceName(t *testing.T) {
+	_, server := newFakeVault(t, nil)
+	config := map[string]string{"DEFAULT_SERVICE_NAME": "shared"}
+	v := newTestVault(t, server.URL, config)
+	naming, err := serviceNaming(config)
+	if err != nil {
+		t.Fatalf("serviceNaming() error = %v", err)
+	}
+	a := &AWSProvider{config: &AWSConfig{Naming: naming}}
+
+	tests := []struct {
+		name        string
+		serviceName string
+		wantVault   string
+		wantAWS     string
+	}{
+		{"service name omitted", "", "secret/data/shared/db", "shared/db"},
+		{"service name given", "api", "secret/data/api/db", "api/db"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := secrets.Request{SecretName: "db", ServiceName: tt.serviceName, SecretLabels: map[string]string{}}
+			if got := v.BuildPath(req); got != tt.wantVault {
+				t.Errorf("Vault BuildPath() = %q, expected %q", got, tt.wantVault)
+			}
+			if got := a.BuildPath(req); got != tt.wantAWS {
+				t.Errorf("AWS BuildPath() = %q, expected %q", got, tt.wantAWS)
+			}
+		})
+	}
+
+	// Without a default the service segment is dropped
+	a.config.Naming.DefaultService = ""
+	if got := a.BuildPath(secrets.Request{SecretName: "db", SecretLabels: map[string]string{}}); got != "db" {
+		t.Errorf("AWS BuildPath() without a default = %q, expected %q", got, "db")
+	}
+}
+
+func TestServiceNamePlacement(t *testing.T) {
+	_, server := newFakeVault(t, nil)
+	req := secrets.Request{SecretName: "db", ServiceName: "api", SecretLabels: map[string]string{}}
+	tests := []struct {
+		placement string
+		wantVault string
+		wantAWS   string
+	}{
+		{"", "secret/data/api/db", "api/db"},
+		{"prefix", "secret/data/api/db", "api/db"},
+		{"Suffix", "secret/data/db/api", "db/api"},
+		{"none", "secret/data/db", "db"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.placement, func(t *testing.T) {
+			config := map[string]string{}
+			if tt.placement != "" {
+				config["SERVICE_NAME_PLACEMENT"] = tt.placement
+			}
+			v := newTestVault(t, server.URL, config)
+			naming, err := serviceNaming(config)
+			if err != nil {
+				t.Fatalf("serviceNaming() error = %v", err)
+			}
+			a := &AWSProvider{config: &AWSConfig{Naming: naming}}
+
+			if got := v.BuildPath(req); got != tt.wantVault {
+				t.Errorf("Vault BuildPath() = %q, expected %q", got, tt.wantVault)
+			}
+			if got := a.BuildPath(req); got != tt.wantAWS {
+				t.Errorf("AWS BuildPath() = %q, expected %q", got, tt.wantAWS)
+			}
+
+			// Explicit path labels win over every placement
+			labeled := secrets.Request{SecretName: "db", ServiceName: "api", SecretLabels: map[string]string{"vault_path": "shared/db", "aws_secret_name": "shared/db"}}
+			if got := v.BuildPath(labeled); got != "secret/data/shared/db" {
+				t.Errorf("Vault BuildPath() with vault_path = %q, expected the label path", got)
+			}
+			if got := a.BuildPath(labeled); got != "shared/db" {
+				t.Errorf("AWS BuildPath() with aws_secret_name = %q, expected the label path", got)
+			}
+		})
+	}
+
+	if _, err := serviceNaming(map[string]string{"SERVICE_NAME_PLACEMENT": "middle"}); KindOf(err) != ErrorKindConfig {
+		t.Errorf("serviceNaming() with an unknown placement error = %v, expected a configuration error", err)
+	}
+}
+
+func TestNullField(t *testing.T) {
+	t.Setenv("APP_DB", `{"password": null}`)
+	env := &EnvProvider{}
+	if err := env.Initialize(map[string]string{"ENV_PREFIX": "APP_"}); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	_, server := newFakeVault(t, map[string]string{
+		"/v1/secret/data/db": kvV2(`{"password": null}`),
+	})
+	vault := newTestVault(t, server.URL, nil)
+	aws := newFailoverProvider(newFakeAWSRegion(t, http.StatusOK, awsSecret(`{"password": null}`)))
+
+	providers := []struct {
+		provider SecretsProvider
+		field    string
+	}{
+		{env, "env_field"},
+		{vault, "vault_field"},
+		{aws, "aws_field"},
+	}
+	for _, p := range providers {
+		t.Run(p.provider.GetProviderName(), func(t *testing.T) {
+			labels := map[string]string{p.field: "password"}
+			value, err := p.provider.GetSecret(context.Background(), secrets.Request{SecretName: "db", SecretLabels: labels})
+			if err == nil || KindOf(err) != ErrorKindNotFound || !strings.Contains(err.Error(), "password is null") {
+				t.Errorf("GetSecret() = %q, %v, expected a not found error naming the null field", value, err)
+			}
+
+			labels["allow_empty"] = "true"
+			value, err = p.provider.GetSecret(context.Background(), secrets.Request{SecretName: "db", SecretLabels: labels})
+			if err != nil || value == nil || len(value) != 0 {
+				t.Errorf("GetSecret() with allow_empty = %q, %v, expected an empty value", value, err)
+			}
+		})
+	}
+}
+
+func TestContentType(t *testing.T) {
+	const jsonContent = `{"password": "hunter2", "user": "app"}`
+	const rawContent = "-----BEGIN KEY-----\nraw\n-----END KEY-----"
+
+	tests := []struct {
+		name        string
+		content     string
+		contentType string
+		field       string
+		want        string
+		wantErr     bool
+	}{
+		{"no content type extracts fields", jsonContent, "", "user", "app", false},
+		{"json extracts a field", jsonContent, "application/json", "user", "app", false},
+		{"json that does not parse", rawContent, "application/json", "", "", true},
+		{"text keeps json whole", jsonContent, "text/plain", "", jsonContent, false},
+		{"text ignores the field label", jsonContent, "text/plain", "user", jsonContent, false},
+		{"text with a charset", rawContent, "text/plain; charset=utf-8", "", rawContent, false},
+		{"binary keeps json whole", jsonContent, "application/octet-stream", "", jsonContent, false},
+		{"binary raw value", rawContent, "application/octet-stream", "", rawContent, false},
+		{"unsupported content type", jsonContent, "text/html", "", "", true},
+		{"malformed content type", jsonContent, "text/plain; charset", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APP_DB", tt.content)
+			env := &EnvProvider{}
+			if err := env.Initialize(map[string]string{"ENV_PREFIX": "APP_"}); err != nil {
+				t.Fatalf("Initialize() error = %v", err)
+			}
+			aws := newFailoverProvider(newFakeAWSRegion(t, http.StatusOK, awsSecret(tt.content)))
+			vault := &fakeAzureVault{handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, azureSecret("db", "v1", tt.content))
+			}}
+			azure := newFakeAzureProvider(t, vault)
+
+			for _, p := range []struct {
+				provider SecretsProvider
+				field    string
+			}{
+				{env, "env_field"},
+				{aws, "aws_field"},
+				{azure, "azure_field"},
+			} {
+				labels := map[string]string{}
+				if tt.contentType != "" {
+					labels["content_type"] = tt.contentType
+				}
+				if tt.field != "" {
+					labels[p.field] = tt.field
+				}
+				value, err := p.provider.GetSecret(context.Background(), secrets.Request{SecretName: "db", SecretLabels: labels})
+				if tt.wantErr {
+					if KindOf(err) != ErrorKindConfig {
+						t.Errorf("%s: GetSecret() = %q, %v, expected a configuration error", p.provider.GetProviderName(), value, err)
+					}
+					continue
+				}
+				if err != nil || string(value) != tt.want {
+					t.Errorf("%s: GetSecret() = %q, %v, expected %q", p.provider.GetProviderName(), value, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLargeNumberField(t *testing.T) {
+	// 2^53 + 1 and a uint64 past 2^63 both lose digits as float64
+	const content = `{"account_id": 9007199254740993, "serial": 12345678901234567890, "ratio": 0.1000000000000000055}`
+
+	t.Setenv("APP_DB", content)
+	env := &EnvProvider{}
+	if err := env.Initialize(map[string]string{"ENV_PREFIX": "APP_"}); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	_, server := newFakeVault(t, map[string]string{"/v1/secret/data/db": kvV2(content)})
+	vault := newTestVault(t, server.URL, nil)
+	aws := newFailoverProvider(newFakeAWSRegion(t, http.StatusOK, awsSecret(content)))
+	azure := newFakeAzureProvider(t, &fakeAzureVault{handler: func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, azureSecret("db", "v1", content))
+	}})
+	gcp := newFakeGCPProvider(t, &fakeSecretManager{payload: content}, &GCPConfig{ProjectID: "project"})
+
+	providers := []struct {
+		provider SecretsProvider
+		field    string
+	}{
+		{env, "env_field"},
+		{vault, "vault_field"},
+		{aws, "aws_field"},
+		{azure, "azure_field"},
+		{gcp, "gcp_field"},
+	}
+	for _, p := range providers {
+		t.Run(p.provider.GetProviderName(), func(t *testing.T) {
+			for field, want := range map[string]string{
+				"account_id": "9007199254740993",
+				"serial":     "12345678901234567890",
+				"ratio":      "0.1000000000000000055",
+			} {
+				value, err := p.provider.GetSecret(context.Background(), secrets.Request{SecretName: "db", SecretLabels: map[string]string{p.field: field}})
+				if err != nil || string(value) != want {
+					t.Errorf("GetSecret(%s) = %q, %v, expected %q", field, value, err, want)
+				}
+			}
+
+			value, err := p.provider.GetSecret(context.Background(), secrets.Request{SecretName: "db", SecretLabels: map[string]string{"all_fields": "true"}})
+			if err != nil || !strings.Contains(string(value), "9007199254740993") || !strings.Contains(string(value), "12345678901234567890") {
+				t.Errorf("GetSecret() with all_fields = %s, %v, expected the exact numbers", value, err)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONObject(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"object", `{"id": 9007199254740993}`, false},
+		{"trailing whitespace", "{\"id\": 1}\n", false},
+		{"trailing data", `{"id": 1} {"id": 2}`, true},
+		{"not an object", `[1, 2]`, true},
+		{"not JSON", `id=1`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeJSONObject(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decodeJSONObject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	data, _ := decodeJSONObject(`{"id": 9007199254740993}`)
+	if id, ok := data["id"].(json.Number); !ok || id.String() != "9007199254740993" {
+		t.Errorf("id = %#v, expected json.Number 9007199254740993", data["id"])
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"keys sorted", map[string]interface{}{"zeta": "z", "alpha": "a", "mid": "m"}, `{"alpha":"a","mid":"m","zeta":"z"}`},
+		{"nested keys sorted", map[string]interface{}{"b": map[string]interface{}{"y": 1, "x": 2}, "a": []interface{}{3, 1}}, `{"a":[3,1],"b":{"x":2,"y":1}}`},
+		{"html kept as written", map[string]interface{}{"url": "https://host/?a=1&b=<2>"}, `{"url":"https://host/?a=1&b=<2>"}`},
+		{"numbers kept exact", map[string]interface{}{"id": json.Number("9007199254740993")}, `{"id":9007199254740993}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := encodeJSON(tt.value)
+			if err != nil {
+				t.Fatalf("encodeJSON() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("encodeJSON() = %s, expected %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllFieldsStableOutput(t *testing.T) {
+	const content = `{"zeta": "z", "alpha": {"b": "<&>", "a": 1}, "mid": [3, 1], "port": 5432}`
+	const want = `{"alpha":{"a":1,"b":"<&>"},"mid":[3,1],"port":5432,"zeta":"z"}`
+
+	// The env provider delivers variables as they are and generates no JSON
+	_, server := newFakeVault(t, map[string]string{"/v1/secret/data/db": kvV2(content)})
+	vault := newTestVault(t, server.URL, nil)
+	aws := newFailoverProvider(newFakeAWSRegion(t, http.StatusOK, awsSecret(content)))
+	azure := newFakeAzureProvider(t, &fakeAzureVault{handler: func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, azureSecret("db", "v1", content))
+	}})
+	gcp := newFakeGCPProvider(t, &fakeSecretManager{payload: content}, &GCPConfig{ProjectID: "project"})
+
+	for _, provider := range []SecretsProvider{vault, aws, azure, gcp} {
+		t.Run(provider.GetProviderName(), func(t *testing.T) {
+			// Map iteration order differs between runs, the output must not
+			for range 20 {
+				value, err := provider.GetSecret(context.Background(), secrets.Request{SecretName: "db", SecretLabels: map[string]string{"all_fields": "true"}})
+				if err != nil {
+					t.Fatalf("GetSecret() error = %v", err)
+				}
+				if string(value) != want {
+					t.Fatalf("GetSecret() = %s, expected %s", value, want)
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"time"
 
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/go-plugins-helpers/secrets"
 )
 
@@ -15,7 +17,40 @@ type SecretInfo struct {
 	ServiceNames     []string
 	LastHash         string // Hash of the secret value for change detection
 	LastUpdated      time.Time
-	Provider         string // Which provider manages this secret
+	Provider         string            // Which provider manages this secret
+	Labels           map[string]string // Labels of the original request, replayed on rotation
+	AllFields        bool              // Whether the whole secret object is delivered as JSON
+	WebhookURL       string            // Per-secret rotation webhook, overrides the global one
+	WebhookHeaders   map[string]string
+	SplitTargets     map[string]string // Companion Docker secret name -> source field
+	SplitHashes      map[string]string // Companion Docker secret name -> last delivered hash
+	LastError        string            // Last check or rotation error, cleared on success
+	FieldHashes      map[string]string // Field name -> hash, kept with ROTATION_FIELD_DIFF
+	ChangedFields    []string          // Fields that differed at the last rotation
+	LeaseID          string            // Lease of a dynamic secret, renewed instead of re-read
+	LeaseDuration    time.Duration
+	LeaseExpiry      time.Time
+	LastChanged      time.Time     // Backend change time, for batch change detection
+	Version          string        // Backend version of the last delivered value
+	WatchFields      []string      // Only changes to these fields trigger rotation
+	WatchHash        string        // Hash of the watched fields at the last read
+	CheckInterval    time.Duration // Backend rotation cadence, with FOLLOW_BACKEND_SCHEDULE
+	NextCheck        time.Time     // When a scheduled secret is checked next
+	ChangeDetectedAt time.Time     // When a change not yet rotated was first seen
+}
+
+// SwarmConfigAPI is the part of the Docker API that reads Swarm configs
+type SwarmConfigAPI interface {
+	ConfigList(ctx context.Context, options swarm.ConfigListOptions) ([]swarm.Config, error)
+	ConfigInspectWithRaw(ctx context.Context, id string) (swarm.Config, []byte, error)
+	Ping(ctx context.Context) (types.Ping, error)
+}
+
+// DockerClientUser is implemented by providers that read from the Docker
+// daemon. The driver hands them its own client before initializing them.
+type DockerClientUser interface {
+	// UseDockerClient sets the client, which stays owned by the driver
+	UseDockerClient(client SwarmConfigAPI)
 }
 
 // SecretsProvider defines the interface that all secret providers must implement
@@ -35,10 +70,111 @@ type SecretsProvider interface {
 	// GetProviderName returns the name of this provider
 	GetProviderName() string
 
+	// FieldLabelKey returns the secret label used to select a field, e.g. "vault_field"
+	FieldLabelKey() string
+
+	// PathLabelKey returns the secret label used to override the secret path, e.g. "vault_path"
+	PathLabelKey() string
+
+	// BuildPath returns the provider path or name a request resolves to
+	BuildPath(req secrets.Request) string
+
+	// HealthCheck reports whether the backend is reachable
+	HealthCheck(ctx context.Context) error
+
 	// Close performs any cleanup needed by the provider
 	Close() error
 }
 
+// RegionReporter is implemented by providers that fail over between regions
+type RegionReporter interface {
+	// ActiveRegion returns the region currently serving reads
+	ActiveRegion() string
+}
+
+// ThrottleReporter is implemented by providers that back off when the
+// backend rate limits them
+type ThrottleReporter interface {
+	// ThrottledRequests returns how many requests the backend throttled
+	ThrottledRequests() int64
+}
+
+// AuthStats counts the logins a provider made against its backend
+type AuthStats struct {
+	Successes    int64
+	Failures     int64
+	LatencyTotal time.Duration // summed over all logins
+}
+
+// AuthReporter is implemented by providers that log in to their backend
+type AuthReporter interface {
+	// AuthStats returns the logins made so far
+	AuthStats() AuthStats
+}
+
+// TokenRenewer is implemented by providers whose login token expires
+type TokenRenewer interface {
+	// RenewToken renews the token once less than margin of its TTL is left,
+	// and logs in again when it expired or cannot be renewed
+	RenewToken(ctx context.Context, margin time.Duration) error
+}
+
+// ScheduleReporter is implemented by providers whose secrets can declare a
+// rotation cadence in the backend
+type ScheduleReporter interface {
+	// RotationSchedule returns the rotation period declared for the secret at
+	// path, or false when it has none
+	RotationSchedule(ctx context.Context, path string) (time.Duration, bool, error)
+}
+
+// RotationStateReporter is implemented by providers whose backend rotates
+// secrets on its own and can tell when a rotation has not finished
+type RotationStateReporter interface {
+	// RotationInProgress reports whether the backend is rotating the secret at path
+	RotationInProgress(ctx context.Context, path string) (bool, error)
+}
+
+// CredentialVerifier is implemented by providers that can check their
+// credentials against the backend, which HealthCheck does not
+type CredentialVerifier interface {
+	// VerifyCredentials returns an error when the backend rejects the credentials
+	VerifyCredentials(ctx context.Context) error
+}
+
+// LeaseRenewer is implemented by providers whose secrets can carry a lease,
+// such as the Vault database or AWS secrets engines
+type LeaseRenewer interface {
+	// LeaseFor returns the lease of the last secret read from path, if it had one
+	LeaseFor(path string) (leaseID string, duration time.Duration, ok bool)
+
+	// RenewLease extends a lease and returns its new duration
+	RenewLease(ctx context.Context, leaseID string, increment time.Duration) (time.Duration, error)
+}
+
+// VersionReporter is implemented by providers that expose the backend version
+// of a secret, such as the AWS VersionId or the Vault KV v2 version
+type VersionReporter interface {
+	// SecretVersion returns the version of the last secret read from path
+	SecretVersion(path string) (string, bool)
+}
+
+// BatchChangeDetector is implemented by providers that can read the change
+// time of many secrets with one call, so only changed secrets are re-read
+type BatchChangeDetector interface {
+	// ChangeTimestamps returns the last change time of each secret path it
+	// resolved, or nil when batch detection is disabled
+	ChangeTimestamps(ctx context.Context, paths []string) (map[string]time.Time, error)
+}
+
+// BatchChangeChecker is implemented by providers that can read many secrets
+// with one call to compare them against their tracked hashes
+type BatchChangeChecker interface {
+	// CheckSecretsChanged reports whether each secret changed, keyed by its
+	// Docker secret name. Secrets missing from the result, or every secret
+	// when it is nil, are checked one by one.
+	CheckSecretsChanged(ctx context.Context, secretInfos []*SecretInfo) (map[string]bool, error)
+}
+
 // ProviderConfig holds common configuration for all providers
 type ProviderConfig struct {
 	ProviderType     string            `json:"provider_type"`
@@ -0,0 +1,126 @@
+package providers
+
+import (
+	"crypto/tls"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// isolatedKey marks settings a provider must use as its only configuration.
+// It cannot collide with a variable or label name.
+const isolatedKey = "\x00isolated"
+
+// hostSettings name files or local credential sources of the plugin host,
+// which a secret's labels must never point a provider at
+var hostSettings = []string{
+	"VAULT_CACERT", "VAULT_CLIENT_CERT", "VAULT_CLIENT_KEY",
+	"OPENBAO_CACERT", "OPENBAO_CLIENT_CERT", "OPENBAO_CLIENT_KEY",
+	"PROVIDER_CACERT", "PROVIDER_CLIENT_CERT", "PROVIDER_CLIENT_KEY",
+	"GOOGLE_APPLICATION_CREDENTIALS",
+	"AWS_PROFILE", "AWS_DISCOVER_REGION", "AWS_EC2_METADATA_SERVICE_ENDPOINT",
+}
+
+// sdkEnvPrefixes name the variables the Vault and OpenBao SDKs read in
+// NewClient, which always applies DefaultConfig and its ReadEnvironment
+var sdkEnvPrefixes = []string{"VAULT_", "BAO_"}
+
+// envMutex keeps reads of the environment out of the window in which an
+// isolated client is built with the SDK variables hidden
+var envMutex sync.RWMutex
+
+// Isolated returns a copy of settings that a provider uses as its only
+// source of configuration. It neither falls back to the plugin's environment
+// nor picks up credentials the SDKs would find on their own, such as
+// VAULT_TOKEN, shared AWS files, instance roles, managed identities or
+// application default credentials.
+func Isolated(settings map[string]string) map[string]string {
+	isolated := make(map[string]string, len(settings)+1)
+	for key, value := range settings {
+		isolated[key] = value
+	}
+	isolated[isolatedKey] = "true"
+	return isolated
+}
+
+// isIsolated reports whether config was built with Isolated
+func isIsolated(config map[string]string) bool {
+	return config[isolatedKey] == "true"
+}
+
+// CheckLabelSettings rejects settings that would make a provider read files
+// or local credential sources of the plugin host
+func CheckLabelSettings(settings map[string]string) error {
+	var rejected []string
+	for _, key := range hostSettings {
+		if _, exists := settings[key]; exists {
+			rejected = append(rejected, key)
+		}
+	}
+	if len(rejected) > 0 {
+		sort.Strings(rejected)
+		return configErrorf("%v cannot be set through labels, they read files or credentials of the plugin host", rejected)
+	}
+	return nil
+}
+
+// lookupEnv reads a variable of the plugin's environment
+func lookupEnv(key string) (string, bool) {
+	envMutex.RLock()
+	defer envMutex.RUnlock()
+	return os.LookupEnv(key)
+}
+
+// constructClient runs a Vault or OpenBao client constructor. The SDKs read
+// the VAULT_ and BAO_ variables whatever configuration they are given, so
+// for isolated configs those are hidden while the client is built.
+func constructClient(config map[string]string, construct func() error) error {
+	if !isIsolated(config) {
+		envMutex.RLock()
+		defer envMutex.RUnlock()
+		return construct()
+	}
+
+	envMutex.Lock()
+	defer envMutex.Unlock()
+
+	hidden := make(map[string]string)
+	for _, pair := range os.Environ() {
+		key, value, _ := strings.Cut(pair, "=")
+		for _, prefix := range sdkEnvPrefixes {
+			if strings.HasPrefix(key, prefix) {
+				hidden[key] = value
+				break
+			}
+		}
+	}
+	for key := range hidden {
+		os.Unsetenv(key)
+	}
+	defer func() {
+		for key, value := range hidden {
+			os.Setenv(key, value)
+		}
+	}()
+
+	return construct()
+}
+
+// isolatedHTTPClient returns the HTTP client the Vault and OpenBao SDKs start
+// from, without the TLS settings DefaultConfig reads from the environment
+func isolatedHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+
+	return &http.Client{
+		Transport: transport,
+		// The SDKs follow redirects themselves
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
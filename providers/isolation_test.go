@@ -0,0 +1,189 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestGetConfigOrDefaultIsolated(t *testing.T) {
+	t.Setenv("VAULT_MOUNT_PATH", "from-env")
+
+	tests := []struct {
+		name   string
+		config map[string]string
+		want   string
+	}{
+		{"config value", map[string]string{"VAULT_MOUNT_PATH": "kv"}, "kv"},
+		{"environment fallback", map[string]string{}, "from-env"},
+		{"isolated config value", Isolated(map[string]string{"VAULT_MOUNT_PATH": "kv"}), "kv"},
+		{"isolated ignores environment", Isolated(map[string]string{}), "secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getConfigOrDefault(tt.config, "VAULT_MOUNT_PATH", "secret"); got != tt.want {
+				t.Errorf("getConfigOrDefault() = %q, expected %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsolatedCopiesSettings(t *testing.T) {
+	settings := map[string]string{"VAULT_ADDR": "https://vault.example:8200"}
+	isolated := Isolated(settings)
+	if !isIsolated(isolated) || isIsolated(settings) {
+		t.Fatalf("only the copy should be isolated")
+	}
+	if isolated["VAULT_ADDR"] != settings["VAULT_ADDR"] {
+		t.Errorf("VAULT_ADDR = %q, expected %q", isolated["VAULT_ADDR"], settings["VAULT_ADDR"])
+	}
+}
+
+func TestCheckLabelSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]string
+		wantErr  bool
+	}{
+		{"backend settings", map[string]string{"VAULT_ADDR": "https://vault.example:8200", "VAULT_TOKEN": "token"}, false},
+		{"vault CA file", map[string]string{"VAULT_CACERT": "/etc/ssl/ca.pem"}, true},
+		{"openbao client key", map[string]string{"OPENBAO_CLIENT_KEY": "/run/secrets/key"}, true},
+		{"provider client cert", map[string]string{"PROVIDER_CLIENT_CERT": "/run/secrets/cert"}, true},
+		{"gcp credentials file", map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": "/root/key.json"}, true},
+		{"gcp credentials json", map[string]string{"GCP_CREDENTIALS_JSON": "{}"}, false},
+		{"aws profile", map[string]string{"AWS_PROFILE": "default"}, true},
+		{"aws region discovery", map[string]string{"AWS_DISCOVER_REGION": "true"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckLabelSettings(tt.settings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckLabelSettings() error = %v, expected error %v", err, tt.wantErr)
+			}
+			var configErr *ConfigError
+			if err != nil && !errors.As(err, &configErr) {
+				t.Errorf("CheckLabelSettings() error %v is not a ConfigError", err)
+			}
+		})
+	}
+}
+
+func TestVaultIsolatedIgnoresPluginCredentials(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "plugin-token")
+	t.Setenv("VAULT_NAMESPACE", "plugin-namespace")
+	t.Setenv("VAULT_AGENT_ADDR", "http://127.0.0.1:8100")
+	t.Setenv("VAULT_CACERT", "/nonexistent/ca.pem")
+
+	v := &VaultProvider{}
+	err := v.Initialize(Isolated(map[string]string{
+		"VAULT_ADDR":  "https://vault.example:8200",
+		"VAULT_TOKEN": "label-token",
+	}))
+	if err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	if got := v.client.Token(); got != "label-token" {
+		t.Errorf("token = %q, expected the label token", got)
+	}
+	if got := v.client.Namespace(); got != "" {
+		t.Errorf("namespace = %q, expected none", got)
+	}
+	if got := v.client.Address(); got != "https://vault.example:8200" {
+		t.Errorf("address = %q, expected the label address", got)
+	}
+	if got := os.Getenv("VAULT_CACERT"); got != "/nonexistent/ca.pem" {
+		t.Errorf("VAULT_CACERT = %q after Initialize, expected the plugin's value to be restored", got)
+	}
+
+	// Without a token in the labels the plugin's own is not used instead
+	err = (&VaultProvider{}).Initialize(Isolated(map[string]string{"VAULT_ADDR": "https://vault.example:8200"}))
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Errorf("Initialize() without a token error = %v, expected a ConfigError", err)
+	}
+}
+
+func TestOpenBaoIsolatedIgnoresPluginCredentials(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "plugin-token")
+	t.Setenv("VAULT_NAMESPACE", "plugin-namespace")
+
+	o := &OpenBaoProvider{}
+	err := o.Initialize(Isolated(map[string]string{
+		"OPENBAO_ADDR":  "https://bao.example:8200",
+		"OPENBAO_TOKEN": "label-token",
+	}))
+	if err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	if got := o.client.Token(); got != "label-token" {
+		t.Errorf("token = %q, expected the label token", got)
+	}
+	if got := o.client.Namespace(); got != "" {
+		t.Errorf("namespace = %q, expected none", got)
+	}
+}
+
+func TestAWSIsolatedUsesOnlyConfiguredKeys(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "PLUGINKEY")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "plugin-secret")
+	t.Setenv("AWS_REGION", "us-west-2")
+
+	a := &AWSProvider{}
+	err := a.Initialize(Isolated(map[string]string{
+		"AWS_ACCESS_KEY_ID":     "LABELKEY",
+		"AWS_SECRET_ACCESS_KEY": "label-secret",
+	}))
+	if err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	if a.config.Region != "us-east-1" {
+		t.Errorf("region = %q, expected the default instead of the plugin's", a.config.Region)
+	}
+
+	cfg, err := a.loadAWSConfig(a.config.Region)
+	if err != nil {
+		t.Fatalf("loadAWSConfig() error = %v", err)
+	}
+	creds, err := cfg.Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("Retrieve() error = %v", err)
+	}
+	if creds.AccessKeyID != "LABELKEY" {
+		t.Errorf("access key = %q, expected the label key", creds.AccessKeyID)
+	}
+}
+
+func TestIsolatedRequiresCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "PLUGINKEY")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "plugin-secret")
+	t.Setenv("AZURE_TENANT_ID", "plugin-tenant")
+	t.Setenv("AZURE_CLIENT_ID", "plugin-client")
+	t.Setenv("AZURE_CLIENT_SECRET", "plugin-secret")
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "/plugin/key.json")
+
+	tests := []struct {
+		name     string
+		provider SecretsProvider
+		settings map[string]string
+	}{
+		{"aws without keys", &AWSProvider{}, map[string]string{"AWS_REGION": "eu-west-1"}},
+		{"aws with a profile", &AWSProvider{}, map[string]string{
+			"AWS_ACCESS_KEY_ID": "LABELKEY", "AWS_SECRET_ACCESS_KEY": "label-secret", "AWS_PROFILE": "default",
+		}},
+		{"azure without a service principal", &AzureProvider{}, map[string]string{"AZURE_VAULT_URL": "https://kv.vault.azure.net"}},
+		{"gcp without credentials", &GCPProvider{}, map[string]string{"GCP_PROJECT_ID": "project"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.provider.Initialize(Isolated(tt.settings))
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Errorf("Initialize() error = %v, expected a ConfigError", err)
+			}
+		})
+	}
+}
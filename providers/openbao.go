@@ -2,8 +2,11 @@ package providers
 
 import (
 	"context"
-	"crypto/sha256"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/docker/go-plugins-helpers/secrets"
 	"github.com/openbao/openbao/api/v2"
@@ -15,38 +18,94 @@ import (
 type OpenBaoProvider struct {
 	client *api.Client
 	config *OpenBaoConfig
+	auth   authStats
+	mounts mountMemory
 }
 
 // OpenBaoConfig holds the configuration for the OpenBao client
 type OpenBaoConfig struct {
 	Address    string
 	Token      string
-	MountPath  string
+	MountPath  string   // first of MountPaths
+	MountPaths []string // candidate mounts, tried in order until a secret is found
 	RoleID     string
 	SecretID   string
 	AuthMethod string
 	CACert     string
 	ClientCert string
 	ClientKey  string
+	// Where the service name goes in default paths
+	Naming ServiceNaming
 }
 
 // Initialize sets up the OpenBao provider with the given configuration
 func (o *OpenBaoProvider) Initialize(config map[string]string) error {
+	mountPaths := parseMountPaths(getConfigOrDefault(config, "OPENBAO_MOUNT_PATH", "secret"))
+	if len(mountPaths) == 0 {
+		return configErrorf("OPENBAO_MOUNT_PATH does not name any mount")
+	}
+
+	naming, err := serviceNaming(config)
+	if err != nil {
+		return err
+	}
+
 	o.config = &OpenBaoConfig{
 		Address:    getConfigOrDefault(config, "OPENBAO_ADDR", "http://localhost:8200"),
 		Token:      config["OPENBAO_TOKEN"],
-		MountPath:  getConfigOrDefault(config, "OPENBAO_MOUNT_PATH", "secret"),
+		MountPath:  mountPaths[0],
+		MountPaths: mountPaths,
 		RoleID:     config["OPENBAO_ROLE_ID"],
 		SecretID:   config["OPENBAO_SECRET_ID"],
 		AuthMethod: getConfigOrDefault(config, "OPENBAO_AUTH_METHOD", "token"),
 		CACert:     config["OPENBAO_CACERT"],
 		ClientCert: config["OPENBAO_CLIENT_CERT"],
 		ClientKey:  config["OPENBAO_CLIENT_KEY"],
+		// Where the service name goes in default paths
+		Naming: naming,
 	}
 
-	// Configure OpenBao client (using OpenBao API client since OpenBao is compatible)
-	openBaoConfig := api.DefaultConfig()
-	openBaoConfig.Address = o.config.Address
+	// Route requests through the egress proxy, if any
+	proxy, err := proxyFunc(config)
+	if err != nil {
+		return err
+	}
+
+	var client *api.Client
+	err = constructClient(config, func() error {
+		var err error
+		client, err = o.newClient(config, proxy)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	o.client = client
+
+	// Authenticate with OpenBao
+	if err := o.authenticate(); err != nil {
+		return fmt.Errorf("failed to authenticate with OpenBao: %w", err)
+	}
+
+	log.Printf("Successfully initialized OpenBao provider using %s method", o.config.AuthMethod)
+	return nil
+}
+
+// newClient builds the OpenBao client (using OpenBao API client since OpenBao
+// is compatible). Isolated configs start from a configuration built by hand,
+// since DefaultConfig reads the environment.
+func (o *OpenBaoProvider) newClient(config map[string]string, proxy func(*http.Request) (*url.URL, error)) (*api.Client, error) {
+	var clientConfig *api.Config
+	if isIsolated(config) {
+		clientConfig = &api.Config{
+			HttpClient: isolatedHTTPClient(),
+			Timeout:    60 * time.Second,
+			MaxRetries: 2,
+		}
+	} else {
+		clientConfig = api.DefaultConfig()
+	}
+	clientConfig.Address = o.config.Address
 
 	// Configure TLS if certificates are provided
 	if o.config.CACert != "" || o.config.ClientCert != "" {
@@ -55,49 +114,55 @@ func (o *OpenBaoProvider) Initialize(config map[string]string) error {
 			ClientCert: o.config.ClientCert,
 			ClientKey:  o.config.ClientKey,
 		}
-		if err := openBaoConfig.ConfigureTLS(tlsConfig); err != nil {
-			return fmt.Errorf("failed to configure TLS: %v", err)
+		if err := clientConfig.ConfigureTLS(tlsConfig); err != nil {
+			return nil, configErrorf("failed to configure TLS: %w", err)
 		}
 	}
 
-	client, err := api.NewClient(openBaoConfig)
-	if err != nil {
-		return fmt.Errorf("failed to create OpenBao client: %v", err)
+	if err := applyProxy(clientConfig.HttpClient, proxy); err != nil {
+		return nil, fmt.Errorf("failed to configure proxy: %v", err)
 	}
 
-	o.client = client
-
-	// Authenticate with OpenBao
-	if err := o.authenticate(); err != nil {
-		return fmt.Errorf("failed to authenticate with OpenBao: %v", err)
+	client, err := api.NewClient(clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OpenBao client: %v", err)
 	}
-
-	log.Printf("Successfully initialized OpenBao provider using %s method", o.config.AuthMethod)
-	return nil
+	return client, nil
 }
 
 // GetSecret retrieves a secret value from OpenBao
 func (o *OpenBaoProvider) GetSecret(ctx context.Context, req secrets.Request) ([]byte, error) {
-	secretPath := o.buildSecretPath(req)
-	log.Printf("Reading secret from OpenBao path: %s", secretPath)
-
-	// Read secret from OpenBao
-	secret, err := o.client.Logical().ReadWithContext(ctx, secretPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read secret from OpenBao: %v", err)
+	// Try each candidate mount, starting with the one that held the secret last time
+	var secret *api.Secret
+	var tried []string
+	for _, mount := range o.candidateMounts(req) {
+		secretPath := o.buildSecretPathForMount(req, mount)
+		requestLogger(ctx).Printf("Reading secret from OpenBao path: %s", secretPath)
+
+		var err error
+		secret, err = o.client.Logical().ReadWithContext(ctx, secretPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret from OpenBao: %v", err)
+		}
+		if secret != nil {
+			o.mounts.remember(o.relativeSecretPath(req), mount)
+			break
+		}
+		tried = append(tried, secretPath)
 	}
 
 	if secret == nil {
-		return nil, fmt.Errorf("secret not found at path: %s", secretPath)
+		return nil, notFoundErrorf("secret not found at path: %s", strings.Join(tried, ", "))
 	}
 
 	// Extract the secret value
 	value, err := o.extractSecretValue(secret, req)
+	value, err = allowNullField(value, err, req.SecretLabels)
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract secret value: %v", err)
+		return nil, fmt.Errorf("failed to extract secret value: %w", err)
 	}
 
-	log.Printf("Successfully retrieved secret from OpenBao")
+	requestLogger(ctx).Printf("Successfully retrieved secret from OpenBao")
 	return value, nil
 }
 
@@ -115,26 +180,40 @@ func (o *OpenBaoProvider) CheckSecretChanged(ctx context.Context, secretInfo *Se
 	}
 
 	if secret == nil {
-		return false, fmt.Errorf("secret not found at path: %s", secretInfo.SecretPath)
+		return false, notFoundErrorf("secret not found at path: %s", secretInfo.SecretPath)
 	}
 
 	// Extract current value
 	var data map[string]interface{}
 	if secretData, ok := secret.Data["data"]; ok {
-		data = secretData.(map[string]interface{})
+		// Null for a deleted KV v2 version, which is treated as empty
+		data, _ = secretData.(map[string]interface{})
 	} else {
 		data = secret.Data
 	}
 
 	var currentValue []byte
-	if value, ok := data[secretInfo.SecretField]; ok {
-		currentValue = []byte(fmt.Sprintf("%v", value))
+	if len(data) == 0 {
+		currentValue, err = emptySecretValue(secretInfo.Labels)
+		if err != nil {
+			return false, err
+		}
+	} else if secretInfo.AllFields {
+		currentValue, err = encodeJSON(data)
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal secret data: %v", err)
+		}
+	} else if value, ok := data[secretInfo.SecretField]; ok {
+		currentValue, err = formatFieldValue(secretInfo.SecretField, value)
+		if currentValue, err = allowNullField(currentValue, err, secretInfo.Labels); err != nil {
+			return false, err
+		}
 	} else {
 		return false, fmt.Errorf("field %s not found in secret", secretInfo.SecretField)
 	}
 
 	// Calculate current hash
-	currentHash := fmt.Sprintf("%x", sha256.Sum256(currentValue))
+	currentHash := HashValue(currentValue)
 
 	return currentHash != secretInfo.LastHash, nil
 }
@@ -144,6 +223,82 @@ func (o *OpenBaoProvider) GetProviderName() string {
 	return "openbao"
 }
 
+// FieldLabelKey returns the secret label selecting the field to extract
+func (o *OpenBaoProvider) FieldLabelKey() string {
+	return "openbao_field"
+}
+
+// PathLabelKey returns the secret label overriding the OpenBao path
+func (o *OpenBaoProvider) PathLabelKey() string {
+	return "openbao_path"
+}
+
+// BuildPath returns the OpenBao path the request resolves to
+func (o *OpenBaoProvider) BuildPath(req secrets.Request) string {
+	return o.buildSecretPath(req)
+}
+
+// HealthCheck reports whether the OpenBao server is reachable
+func (o *OpenBaoProvider) HealthCheck(ctx context.Context) error {
+	if _, err := o.client.Sys().HealthWithContext(ctx); err != nil {
+		return fmt.Errorf("openbao health check failed: %v", err)
+	}
+	return nil
+}
+
+// AuthStats returns the logins made against OpenBao
+func (o *OpenBaoProvider) AuthStats() AuthStats {
+	return o.auth.snapshot()
+}
+
+// RenewToken renews the token once less than margin of its TTL is left and
+// logs in again when it expired or cannot be renewed. Tokens without a TTL,
+// such as root tokens, are left alone.
+func (o *OpenBaoProvider) RenewToken(ctx context.Context, margin time.Duration) error {
+	self, err := o.client.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		// An expired or revoked token cannot look itself up
+		return o.reauthenticate(fmt.Errorf("failed to look up token: %v", err))
+	}
+	ttl, err := self.TokenTTL()
+	if err != nil || ttl == 0 || ttl > margin {
+		return nil
+	}
+
+	renewable, _ := self.TokenIsRenewable()
+	if !renewable {
+		return o.reauthenticate(fmt.Errorf("token expires in %v and is not renewable", ttl))
+	}
+	if err := o.renewToken(ctx); err != nil {
+		return o.reauthenticate(err)
+	}
+	return nil
+}
+
+// renewToken extends the token through auth/token/renew-self
+func (o *OpenBaoProvider) renewToken(ctx context.Context) (err error) {
+	start := time.Now()
+	defer func() { o.auth.record(start, err) }()
+
+	if _, err := o.client.Auth().Token().RenewSelfWithContext(ctx, 0); err != nil {
+		return fmt.Errorf("failed to renew token: %v", err)
+	}
+	return nil
+}
+
+// reauthenticate logs in again after the token could not be kept alive. Only
+// AppRole can, a static token cannot be replaced by the plugin.
+func (o *OpenBaoProvider) reauthenticate(cause error) error {
+	if o.config.AuthMethod != "approle" || o.config.SecretID == "" {
+		return cause
+	}
+	if err := o.authenticate(); err != nil {
+		return fmt.Errorf("%v, logging in again failed: %w", cause, err)
+	}
+	log.Printf("Logged in to OpenBao again: %v", cause)
+	return nil
+}
+
 // Close performs cleanup for the OpenBao provider
 func (o *OpenBaoProvider) Close() error {
 	// OpenBao client doesn't require explicit cleanup
@@ -151,17 +306,20 @@ func (o *OpenBaoProvider) Close() error {
 }
 
 // authenticate handles various OpenBao authentication methods
-func (o *OpenBaoProvider) authenticate() error {
+func (o *OpenBaoProvider) authenticate() (err error) {
+	start := time.Now()
+	defer func() { o.auth.record(start, err) }()
+
 	switch o.config.AuthMethod {
 	case "token":
 		if o.config.Token == "" {
-			return fmt.Errorf("OPENBAO_TOKEN is required for token authentication")
+			return configErrorf("OPENBAO_TOKEN is required for token authentication")
 		}
 		o.client.SetToken(o.config.Token)
 
 	case "approle":
 		if o.config.RoleID == "" || o.config.SecretID == "" {
-			return fmt.Errorf("OPENBAO_ROLE_ID and OPENBAO_SECRET_ID are required for approle authentication")
+			return configErrorf("OPENBAO_ROLE_ID and OPENBAO_SECRET_ID are required for approle authentication")
 		}
 
 		data := map[string]interface{}{
@@ -181,36 +339,42 @@ func (o *OpenBaoProvider) authenticate() error {
 		o.client.SetToken(resp.Auth.ClientToken)
 
 	default:
-		return fmt.Errorf("unsupported authentication method: %s", o.config.AuthMethod)
+		return configErrorf("unsupported authentication method: %s", o.config.AuthMethod)
 	}
 
 	return nil
 }
 
-// buildSecretPath constructs the OpenBao secret path based on request labels and service information
+// candidateMounts returns the mounts to try for a request, the one that held
+// the secret last time first
+func (o *OpenBaoProvider) candidateMounts(req secrets.Request) []string {
+	return o.mounts.candidates(o.config.MountPaths, o.relativeSecretPath(req))
+}
+
+// buildSecretPath constructs the OpenBao secret path under the mount that
+// last held the secret, or the first configured mount
 func (o *OpenBaoProvider) buildSecretPath(req secrets.Request) string {
-	// Use custom path from labels if provided
-	if customPath, exists := req.SecretLabels["openbao_path"]; exists {
-		// For KV v2, ensure we have the /data/ prefix
-		if o.config.MountPath == "secret" {
-			return fmt.Sprintf("%s/data/%s", o.config.MountPath, customPath)
-		}
-		return fmt.Sprintf("%s/%s", o.config.MountPath, customPath)
-	}
+	return o.buildSecretPathForMount(req, o.candidateMounts(req)[0])
+}
 
-	// Default path structure for KV v2
-	if o.config.MountPath == "secret" {
-		if req.ServiceName != "" {
-			return fmt.Sprintf("%s/data/%s/%s", o.config.MountPath, req.ServiceName, req.SecretName)
-		}
-		return fmt.Sprintf("%s/data/%s", o.config.MountPath, req.SecretName)
+// buildSecretPathForMount constructs the secret path under a given mount
+func (o *OpenBaoProvider) buildSecretPathForMount(req secrets.Request, mount string) string {
+	// For KV v2, ensure we have the /data/ prefix
+	if mount == "secret" {
+		return fmt.Sprintf("%s/data/%s", mount, o.relativeSecretPath(req))
 	}
-
 	// For other mount paths
-	if req.ServiceName != "" {
-		return fmt.Sprintf("%s/%s/%s", o.config.MountPath, req.ServiceName, req.SecretName)
+	return fmt.Sprintf("%s/%s", mount, o.relativeSecretPath(req))
+}
+
+// relativeSecretPath returns the secret path below the mount based on request
+// labels and service information
+func (o *OpenBaoProvider) relativeSecretPath(req secrets.Request) string {
+	// Use custom path from labels if provided
+	if customPath, exists := req.SecretLabels["openbao_path"]; exists {
+		return customPath
 	}
-	return fmt.Sprintf("%s/%s", o.config.MountPath, req.SecretName)
+	return o.config.Naming.join(req.ServiceName, req.SecretName, "/")
 }
 
 // extractSecretValue extracts the appropriate value from the OpenBao response
@@ -218,35 +382,27 @@ func (o *OpenBaoProvider) extractSecretValue(secret *api.Secret, req secrets.Req
 	// For KV v2, data is nested under "data"
 	var data map[string]interface{}
 	if secretData, ok := secret.Data["data"]; ok {
-		data = secretData.(map[string]interface{})
+		// Null for a deleted KV v2 version, which is treated as empty
+		data, _ = secretData.(map[string]interface{})
 	} else {
 		data = secret.Data
 	}
-
-	// Check for specific field in labels
-	if field, exists := req.SecretLabels["openbao_field"]; exists {
-		if value, ok := data[field]; ok {
-			return []byte(fmt.Sprintf("%v", value)), nil
-		}
-		return nil, fmt.Errorf("field %s not found in secret", field)
+	if len(data) == 0 {
+		return emptySecretValue(req.SecretLabels)
 	}
 
-	// Default field names to try
-	defaultFields := []string{"value", "password", "secret", "data"}
-
-	// Try to find a value using default field names
-	for _, field := range defaultFields {
-		if value, ok := data[field]; ok {
-			return []byte(fmt.Sprintf("%v", value)), nil
-		}
+	// Deliver the whole secret object in the stable encodeJSON form
+	if strings.ToLower(req.SecretLabels["all_fields"]) == "true" {
+		return encodeJSON(data)
 	}
 
-	// If no specific field found, return the first string value
-	for _, value := range data {
-		if strValue, ok := value.(string); ok {
-			return []byte(strValue), nil
+	// Check for specific field in labels
+	if field, exists := req.SecretLabels["openbao_field"]; exists {
+		if value, ok := data[field]; ok {
+			return formatFieldValue(field, value)
 		}
+		return nil, notFoundErrorf("field %s not found in secret", field)
 	}
 
-	return nil, fmt.Errorf("no suitable secret value found")
+	return defaultFieldValue(data, strictField(req))
 }
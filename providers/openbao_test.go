@@ -0,0 +1,59 @@
+package providers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestOpenBaoCandidateMounts(t *testing.T) {
+	// Only the default secret/ mount is KV v2, legacy/ is read as KV v1
+	bao, server := newFakeVault(t, map[string]string{
+		"/v1/secret/data/api/db": kvV2(`{"value":"from-secret"}`),
+	})
+	o := &OpenBaoProvider{}
+	err := o.Initialize(Isolated(map[string]string{
+		"OPENBAO_ADDR":       server.URL,
+		"OPENBAO_TOKEN":      "token",
+		"OPENBAO_MOUNT_PATH": "legacy, secret",
+	}))
+	if err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	req := secrets.Request{SecretName: "db", ServiceName: "api"}
+
+	value, err := o.GetSecret(context.Background(), req)
+	if err != nil {
+		t.Fatalf("GetSecret() error = %v", err)
+	}
+	if string(value) != "from-secret" {
+		t.Errorf("GetSecret() = %q, expected %q", value, "from-secret")
+	}
+	if got := bao.requests; len(got) != 2 || got[0] != "/v1/legacy/api/db" || got[1] != "/v1/secret/data/api/db" {
+		t.Errorf("requests = %v, expected the legacy mount then the secret one", got)
+	}
+
+	// The mount that held the secret is remembered for reads and rotation
+	if path := o.BuildPath(req); path != "secret/data/api/db" {
+		t.Errorf("BuildPath() = %q, expected the secret mount", path)
+	}
+	bao.requests = nil
+	if _, err := o.GetSecret(context.Background(), req); err != nil {
+		t.Fatalf("GetSecret() error = %v", err)
+	}
+	if got := bao.requests; len(got) != 1 || got[0] != "/v1/secret/data/api/db" {
+		t.Errorf("requests = %v, expected only the remembered mount", got)
+	}
+
+	// Moved back to the first mount, the secret is found there again
+	bao.set("/v1/legacy/api/db", `{"data":{"value":"from-legacy"}}`)
+	delete(bao.responses, "/v1/secret/data/api/db")
+	if value, err := o.GetSecret(context.Background(), req); err != nil || string(value) != "from-legacy" {
+		t.Errorf("GetSecret() = %q, %v, expected %q", value, err, "from-legacy")
+	}
+
+	if _, err := o.GetSecret(context.Background(), secrets.Request{SecretName: "missing"}); KindOf(err) != ErrorKindNotFound {
+		t.Errorf("GetSecret() of a missing secret error = %v, expected not found", err)
+	}
+}
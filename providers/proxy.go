@@ -0,0 +1,147 @@
+package providers
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// proxyFunc selects the egress proxy for provider requests. SECRETS_PROXY_URL
+// applies to every request; otherwise HTTPS_PROXY/HTTP_PROXY/NO_PROXY are used
+// with ALL_PROXY as the fallback, which net/http alone ignores
+func proxyFunc(config map[string]string) (func(*http.Request) (*url.URL, error), error) {
+	if override := getConfigOrDefault(config, "SECRETS_PROXY_URL", ""); override != "" {
+		proxyURL, err := url.Parse(override)
+		if err != nil || proxyURL.Host == "" {
+			return nil, configErrorf("invalid SECRETS_PROXY_URL %q", override)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, configErrorf("unsupported SECRETS_PROXY_URL scheme %q", proxyURL.Scheme)
+		}
+		return http.ProxyURL(proxyURL), nil
+	}
+
+	proxyConfig := httpproxy.FromEnvironment()
+	allProxy := getConfigOrDefault(config, "ALL_PROXY", getConfigOrDefault(config, "all_proxy", ""))
+	if proxyConfig.HTTPSProxy == "" {
+		proxyConfig.HTTPSProxy = allProxy
+	}
+	if proxyConfig.HTTPProxy == "" {
+		proxyConfig.HTTPProxy = allProxy
+	}
+
+	resolve := proxyConfig.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return resolve(req.URL)
+	}, nil
+}
+
+// applyProxy sets the proxy on a client transport built by an SDK
+func applyProxy(client *http.Client, proxyFn func(*http.Request) (*url.URL, error)) error {
+	if client == nil {
+		return fmt.Errorf("no HTTP client to configure")
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("unexpected HTTP transport type %T", client.Transport)
+	}
+	transport.Proxy = proxyFn
+	return nil
+}
+
+// proxyDialer dials TCP connections through the proxy, for gRPC based SDKs
+// that do not go through an http.Transport
+func proxyDialer(proxyFn func(*http.Request) (*url.URL, error)) func(context.Context, string) (net.Conn, error) {
+	direct := &net.Dialer{}
+
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		proxyURL, err := proxyFn(&http.Request{URL: &url.URL{Scheme: "https", Host: addr}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve proxy for %s: %v", addr, err)
+		}
+		if proxyURL == nil {
+			return direct.DialContext(ctx, "tcp", addr)
+		}
+
+		switch proxyURL.Scheme {
+		case "socks5", "socks5h":
+			dialer, err := proxy.FromURL(proxyURL, direct)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create SOCKS5 dialer: %v", err)
+			}
+			if contextDialer, ok := dialer.(proxy.ContextDialer); ok {
+				return contextDialer.DialContext(ctx, "tcp", addr)
+			}
+			return dialer.Dial("tcp", addr)
+		default:
+			return dialConnect(ctx, direct, proxyURL, addr)
+		}
+	}
+}
+
+// dialConnect opens a tunnel to addr with an HTTP CONNECT request
+func dialConnect(ctx context.Context, dialer *net.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		if proxyURL.Scheme == "https" {
+			proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "443")
+		} else {
+			proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "80")
+		}
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy %s: %v", proxyAddr, err)
+	}
+	if proxyURL.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+	}
+
+	connectReq := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		connectReq.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	}
+	if err := connectReq.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to send CONNECT to proxy: %v", err)
+	}
+
+	// The server only speaks after the client's TLS hello, so nothing is
+	// buffered past the CONNECT response
+	resp, err := http.ReadResponse(bufio.NewReader(conn), connectReq)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to read CONNECT response from proxy: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy refused CONNECT to %s: %s", addr, resp.Status)
+	}
+
+	return conn, nil
+}
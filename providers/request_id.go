@@ -0,0 +1,30 @@
+package providers
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// requestIDKey is the context key carrying the id of the Get request a call serves
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the id of the request being served
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request id carried by ctx, empty when there is none
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// requestLogger returns a logger tagging lines with the request id carried by
+// ctx, so provider lines can be correlated with the driver's
+func requestLogger(ctx context.Context) *log.Entry {
+	if requestID := RequestID(ctx); requestID != "" {
+		return log.WithField("request_id", requestID)
+	}
+	return log.NewEntry(log.StandardLogger())
+}
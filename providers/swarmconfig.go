@@ -0,0 +1,182 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	dockerclient "github.com/docker/docker/client"
+	"github.com/docker/go-plugins-helpers/secrets"
+	log "github.com/sirupsen/logrus"
+)
+
+var _ SwarmConfigAPI = (*dockerclient.Client)(nil)
+
+// SwarmConfigProvider implements the SecretsProvider interface for Docker Swarm configs
+type SwarmConfigProvider struct {
+	client SwarmConfigAPI // the driver's client, set through UseDockerClient
+	naming ServiceNaming  // how the service name takes part in default config names
+}
+
+// UseDockerClient reads configs through the client the driver manages
+// secrets and services with
+func (s *SwarmConfigProvider) UseDockerClient(client SwarmConfigAPI) {
+	s.client = client
+}
+
+// Initialize sets up the Swarm config provider with the given configuration
+func (s *SwarmConfigProvider) Initialize(config map[string]string) error {
+	if s.client == nil {
+		return configErrorf("the swarm config provider needs the plugin's Docker client")
+	}
+	naming, err := serviceNaming(config)
+	if err != nil {
+		return err
+	}
+	s.naming = naming
+
+	log.Printf("Successfully initialized Swarm config provider")
+	return nil
+}
+
+// GetSecret retrieves a value from a Docker Swarm config
+func (s *SwarmConfigProvider) GetSecret(ctx context.Context, req secrets.Request) ([]byte, error) {
+	configName := s.buildConfigName(req)
+	requestLogger(ctx).Printf("Reading value from Swarm config: %s", configName)
+
+	data, err := s.readConfig(ctx, configName)
+	if err != nil {
+		return nil, err
+	}
+
+	value, handled, err := contentValue(string(data), req.SecretLabels)
+	if !handled {
+		value, err = s.extractSecretValue(string(data), req)
+	}
+	value, err = allowNullField(value, err, req.SecretLabels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract secret value: %w", err)
+	}
+
+	requestLogger(ctx).Printf("Successfully retrieved value from Swarm config")
+	return value, nil
+}
+
+// SupportsRotation indicates that Swarm configs support rotation monitoring
+func (s *SwarmConfigProvider) SupportsRotation() bool {
+	return true
+}
+
+// CheckSecretChanged checks if a Swarm config has changed
+func (s *SwarmConfigProvider) CheckSecretChanged(ctx context.Context, secretInfo *SecretInfo) (bool, error) {
+	data, err := s.readConfig(ctx, secretInfo.SecretPath)
+	if err != nil {
+		return false, err
+	}
+
+	currentValue, handled, err := contentValue(string(data), secretInfo.Labels)
+	if !handled {
+		currentValue, err = s.extractSecretValueByField(string(data), secretInfo.SecretField)
+	}
+	currentValue, err = allowNullField(currentValue, err, secretInfo.Labels)
+	if err != nil {
+		return false, fmt.Errorf("failed to extract secret field %s: %v", secretInfo.SecretField, err)
+	}
+
+	currentHash := HashValue(currentValue)
+	return currentHash != secretInfo.LastHash, nil
+}
+
+// GetProviderName returns the name of this provider
+func (s *SwarmConfigProvider) GetProviderName() string {
+	return "swarmconfig"
+}
+
+// FieldLabelKey returns the secret label selecting the field to extract
+func (s *SwarmConfigProvider) FieldLabelKey() string {
+	return "swarmconfig_field"
+}
+
+// PathLabelKey returns the secret label overriding the Swarm config path
+func (s *SwarmConfigProvider) PathLabelKey() string {
+	return "swarmconfig_name"
+}
+
+// BuildPath returns the Swarm config path the request resolves to
+func (s *SwarmConfigProvider) BuildPath(req secrets.Request) string {
+	return s.buildConfigName(req)
+}
+
+// HealthCheck reports whether the Docker daemon is reachable
+func (s *SwarmConfigProvider) HealthCheck(ctx context.Context) error {
+	if _, err := s.client.Ping(ctx); err != nil {
+		return fmt.Errorf("docker daemon is unreachable: %v", err)
+	}
+	return nil
+}
+
+// Close performs cleanup for the Swarm config provider. The Docker client
+// belongs to the driver, which closes it.
+func (s *SwarmConfigProvider) Close() error {
+	return nil
+}
+
+// readConfig looks up a Swarm config by its exact name and returns its content
+func (s *SwarmConfigProvider) readConfig(ctx context.Context, configName string) ([]byte, error) {
+	// The name filter is a prefix match, so the exact name is checked below
+	configs, err := s.client.ConfigList(ctx, swarm.ConfigListOptions{
+		Filters: filters.NewArgs(filters.Arg("name", configName)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list swarm configs: %v", err)
+	}
+
+	for _, cfg := range configs {
+		if cfg.Spec.Name != configName {
+			continue
+		}
+		// The list endpoint may omit the payload, inspect to get the data
+		inspected, _, err := s.client.ConfigInspectWithRaw(ctx, cfg.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect swarm config %s: %v", configName, err)
+		}
+		return inspected.Spec.Data, nil
+	}
+
+	return nil, notFoundErrorf("swarm config %s not found", configName)
+}
+
+// buildConfigName constructs the Swarm config name based on request labels and service information
+func (s *SwarmConfigProvider) buildConfigName(req secrets.Request) string {
+	if customName, exists := req.SecretLabels["swarmconfig_name"]; exists {
+		return customName
+	}
+	return s.naming.join(req.ServiceName, req.SecretName, "_")
+}
+
+// extractSecretValue extracts the appropriate value from the config content
+func (s *SwarmConfigProvider) extractSecretValue(content string, req secrets.Request) ([]byte, error) {
+	if field, exists := req.SecretLabels["swarmconfig_field"]; exists {
+		return s.extractSecretValueByField(content, field)
+	}
+	// Matches the default field recorded by the driver for rotation tracking
+	return s.extractSecretValueByField(content, "value")
+}
+
+// extractSecretValueByField extracts a specific field from the config content
+func (s *SwarmConfigProvider) extractSecretValueByField(content, field string) ([]byte, error) {
+	if data, err := decodeJSONObject(content); err == nil {
+		if value, ok := data[field]; ok {
+			return formatFieldValue(field, value)
+		}
+		if field != "value" {
+			return nil, notFoundErrorf("field %s not found in config; available fields: %v", field, fieldNames(data))
+		}
+	} else if field != "value" {
+		return nil, notFoundErrorf("field %s not found in non-JSON config", field)
+	}
+
+	// Configs are frequently plain files, so the whole content is the default value
+	return []byte(content), nil
+}
@@ -0,0 +1,171 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// fakeConfigAPI serves Swarm configs from memory. Like Docker, the list
+// matches names by prefix and leaves the payload to inspect.
+type fakeConfigAPI struct {
+	configs []swarm.Config
+}
+
+func (f *fakeConfigAPI) ConfigList(ctx context.Context, options swarm.ConfigListOptions) ([]swarm.Config, error) {
+	names := options.Filters.Get("name")
+	var listed []swarm.Config
+	for _, cfg := range f.configs {
+		for _, name := range names {
+			if strings.HasPrefix(cfg.Spec.Name, name) {
+				listed = append(listed, swarm.Config{ID: cfg.ID, Spec: swarm.ConfigSpec{Annotations: cfg.Spec.Annotations}})
+				break
+			}
+		}
+	}
+	return listed, nil
+}
+
+func (f *fakeConfigAPI) ConfigInspectWithRaw(ctx context.Context, id string) (swarm.Config, []byte, error) {
+	for _, cfg := range f.configs {
+		if cfg.ID == id {
+			return cfg, cfg.Spec.Data, nil
+		}
+	}
+	return swarm.Config{}, nil, fmt.Errorf("no such config: %s", id)
+}
+
+func (f *fakeConfigAPI) Ping(ctx context.Context) (types.Ping, error) {
+	return types.Ping{}, nil
+}
+
+// set replaces the content of a config, adding it if needed
+func (f *fakeConfigAPI) set(name, data string) {
+	for i := range f.configs {
+		if f.configs[i].Spec.Name == name {
+			f.configs[i].Spec.Data = []byte(data)
+			return
+		}
+	}
+	f.configs = append(f.configs, swarm.Config{
+		ID:   fmt.Sprintf("config-%d", len(f.configs)),
+		Spec: swarm.ConfigSpec{Annotations: swarm.Annotations{Name: name}, Data: []byte(data)},
+	})
+}
+
+func newTestSwarmConfigProvider() (*SwarmConfigProvider, *fakeConfigAPI) {
+	api := &fakeConfigAPI{}
+	api.set("api_settings", `{"url":"https://example.com","retries":3}`)
+	api.set("api_banner", "welcome")
+	api.set("api_banner_old", "goodbye")
+	api.set("shared_banner", "hello")
+	return &SwarmConfigProvider{client: api, naming: ServiceNaming{Placement: "prefix"}}, api
+}
+
+func TestSwarmConfigUsesDriverClient(t *testing.T) {
+	provider, err := CreateProvider("swarmconfig")
+	if err != nil {
+		t.Fatalf("CreateProvider() error = %v", err)
+	}
+	var configErr *ConfigError
+	if err := provider.Initialize(map[string]string{}); !errors.As(err, &configErr) {
+		t.Fatalf("Initialize() error = %v without a Docker client, expected a ConfigError", err)
+	}
+
+	// Configs are read through the client the driver hands over
+	api := &fakeConfigAPI{}
+	api.set("api_banner", "welcome")
+	user, ok := provider.(DockerClientUser)
+	if !ok {
+		t.Fatalf("swarm config provider does not take the driver's Docker client")
+	}
+	user.UseDockerClient(api)
+	if err := provider.Initialize(map[string]string{}); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	value, err := provider.GetSecret(context.Background(), secrets.Request{SecretName: "banner", ServiceName: "api"})
+	if err != nil || string(value) != "welcome" {
+		t.Errorf("GetSecret() = %q, %v, expected %q", value, err, "welcome")
+	}
+}
+
+func TestSwarmConfigGetSecret(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          secrets.Request
+		want         string
+		wantNotFound bool
+	}{
+		{"plain config", secrets.Request{SecretName: "banner", ServiceName: "api"}, "welcome", false},
+		{"json field", secrets.Request{SecretName: "settings", ServiceName: "api", SecretLabels: map[string]string{"swarmconfig_field": "url"}}, "https://example.com", false},
+		{"json without field", secrets.Request{SecretName: "settings", ServiceName: "api"}, `{"url":"https://example.com","retries":3}`, false},
+		{"config name label", secrets.Request{SecretName: "banner", ServiceName: "api", SecretLabels: map[string]string{"swarmconfig_name": "shared_banner"}}, "hello", false},
+		{"prefix of another config", secrets.Request{SecretName: "bann", ServiceName: "api"}, "", true},
+		{"missing config", secrets.Request{SecretName: "missing", ServiceName: "api"}, "", true},
+		{"missing field", secrets.Request{SecretName: "settings", ServiceName: "api", SecretLabels: map[string]string{"swarmconfig_field": "token"}}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, _ := newTestSwarmConfigProvider()
+			value, err := provider.GetSecret(context.Background(), tt.req)
+			if tt.wantNotFound {
+				if KindOf(err) != ErrorKindNotFound {
+					t.Fatalf("GetSecret() error = %v, expected not found", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetSecret() error = %v", err)
+			}
+			if string(value) != tt.want {
+				t.Errorf("GetSecret() = %q, expected %q", value, tt.want)
+			}
+		})
+	}
+}
+
+func TestSwarmConfigCheckSecretChanged(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   string
+		update  string
+		changed bool
+	}{
+		{"unchanged", "url", `{"url":"https://example.com","retries":3}`, false},
+		{"other field changed", "url", `{"url":"https://example.com","retries":5}`, false},
+		{"field changed", "url", `{"url":"https://example.org","retries":3}`, true},
+		{"whole config changed", "value", `{"url":"https://example.com","retries":5}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, api := newTestSwarmConfigProvider()
+			info := &SecretInfo{DockerSecretName: "settings", SecretPath: "api_settings", SecretField: tt.field}
+			labels := map[string]string{}
+			if tt.field != "value" {
+				labels["swarmconfig_field"] = tt.field
+			}
+			value, err := provider.GetSecret(context.Background(), secrets.Request{SecretName: "settings", ServiceName: "api", SecretLabels: labels})
+			if err != nil {
+				t.Fatalf("GetSecret() error = %v", err)
+			}
+			info.LastHash = HashValue(value)
+
+			api.set("api_settings", tt.update)
+			changed, err := provider.CheckSecretChanged(context.Background(), info)
+			if err != nil {
+				t.Fatalf("CheckSecretChanged() error = %v", err)
+			}
+			if changed != tt.changed {
+				t.Errorf("CheckSecretChanged() = %v, expected %v", changed, tt.changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"context"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// throttleBackoff retries calls the backend rejected for rate limiting, on
+// top of the SDK's own retries. The delay adapts to how throttled the backend
+// is: it doubles on every throttled attempt and decays on success, and each
+// wait is jittered so concurrent rotations do not retry in lockstep.
+type throttleBackoff struct {
+	mu         sync.Mutex
+	delay      time.Duration // current adaptive delay, 0 when not throttled
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	maxRetries int
+	throttled  atomic.Int64
+}
+
+// newThrottleBackoff reads the <prefix>_THROTTLE_MAX_RETRIES,
+// <prefix>_THROTTLE_BASE_DELAY and <prefix>_THROTTLE_MAX_DELAY settings
+func newThrottleBackoff(config map[string]string, prefix string) (*throttleBackoff, error) {
+	retriesKey := prefix + "_THROTTLE_MAX_RETRIES"
+	rawRetries := getConfigOrDefault(config, retriesKey, "5")
+	maxRetries, err := strconv.Atoi(rawRetries)
+	if err != nil || maxRetries < 0 {
+		return nil, configErrorf("invalid %s %q: expected a non-negative integer", retriesKey, rawRetries)
+	}
+
+	baseDelay, err := durationConfig(config, prefix+"_THROTTLE_BASE_DELAY", 200*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	maxDelay, err := durationConfig(config, prefix+"_THROTTLE_MAX_DELAY", 20*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if maxDelay < baseDelay {
+		return nil, configErrorf("%s_THROTTLE_MAX_DELAY must not be below %s_THROTTLE_BASE_DELAY", prefix, prefix)
+	}
+
+	return &throttleBackoff{
+		baseDelay:  baseDelay,
+		maxDelay:   maxDelay,
+		maxRetries: maxRetries,
+	}, nil
+}
+
+// throttleClassifier reports whether an error is a throttling rejection and
+// how long the backend asked to wait, 0 when it gave no hint
+type throttleClassifier func(error) (bool, time.Duration)
+
+// do runs call, retrying while classify reports its error as throttling. A
+// wait the backend asks for is honored, unless it would pass the deadline.
+func (t *throttleBackoff) do(ctx context.Context, classify throttleClassifier, call func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if err == nil {
+			t.recover()
+			return nil
+		}
+		throttled, retryAfter := classify(err)
+		if !throttled {
+			return err
+		}
+
+		t.throttled.Add(1)
+		if attempt >= t.maxRetries {
+			return err
+		}
+
+		wait := max(t.nextDelay(), retryAfter)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return err
+		}
+		log.Warnf("Backend throttled the request, retrying in %v: %v", wait, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// nextDelay grows the adaptive delay and returns a jittered wait from it
+func (t *throttleBackoff) nextDelay() time.Duration {
+	t.mu.Lock()
+	if t.delay == 0 {
+		t.delay = t.baseDelay
+	} else {
+		t.delay = min(2*t.delay, t.maxDelay)
+	}
+	delay := t.delay
+	t.mu.Unlock()
+
+	// Equal jitter: at least half the delay, so waits still grow under throttling
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// recover lets the adaptive delay decay after a successful call
+func (t *throttleBackoff) recover() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.delay /= 2
+	if t.delay < t.baseDelay {
+		t.delay = 0
+	}
+}
+
+// ThrottledRequests returns how many calls the backend throttled
+func (t *throttleBackoff) ThrottledRequests() int64 {
+	return t.throttled.Load()
+}
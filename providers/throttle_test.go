@@ -0,0 +1,104 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestIsAWSThrottle(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&smithy.GenericAPIError{Code: "ThrottlingException"}, true},
+		{&smithy.GenericAPIError{Code: "RequestLimitExceeded"}, true},
+		{&smithy.GenericAPIError{Code: "TooManyRequestsException"}, true},
+		{fmt.Errorf("read failed: %w", &smithy.GenericAPIError{Code: "Throttling"}), true},
+		{&smithy.GenericAPIError{Code: "AccessDeniedException"}, false},
+		{errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got, _ := isAWSThrottle(tt.err); got != tt.want {
+			t.Errorf("isAWSThrottle(%v) = %v, expected %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestThrottleBackoff(t *testing.T) {
+	errThrottled := errors.New("throttled")
+	classify := func(err error) (bool, time.Duration) { return errors.Is(err, errThrottled), 0 }
+	throttle := &throttleBackoff{baseDelay: time.Millisecond, maxDelay: 4 * time.Millisecond, maxRetries: 3}
+
+	// Throttled calls are retried with a growing delay until one succeeds
+	calls := 0
+	err := throttle.do(context.Background(), classify, func() error {
+		if calls++; calls <= 2 {
+			return errThrottled
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("do() = %v after %d calls, expected success on the third", err, calls)
+	}
+	if throttle.ThrottledRequests() != 2 {
+		t.Errorf("ThrottledRequests() = %d, expected 2", throttle.ThrottledRequests())
+	}
+	// The delay reached 2ms, the success halves it back toward the base
+	if throttle.delay != time.Millisecond {
+		t.Errorf("delay after success = %v, expected %v", throttle.delay, time.Millisecond)
+	}
+
+	// Other errors and exhausted retries are returned to the caller
+	calls = 0
+	other := errors.New("denied")
+	if err := throttle.do(context.Background(), classify, func() error { calls++; return other }); err != other || calls != 1 {
+		t.Errorf("do() = %v after %d calls, expected the error without retries", err, calls)
+	}
+	calls = 0
+	if err := throttle.do(context.Background(), classify, func() error { calls++; return errThrottled }); err != errThrottled || calls != 4 {
+		t.Errorf("do() = %v after %d calls, expected to give up after 3 retries", err, calls)
+	}
+	for i := 0; i < 10; i++ {
+		if wait := throttle.nextDelay(); wait < throttle.maxDelay/2 || wait > throttle.maxDelay {
+			t.Errorf("nextDelay() = %v, expected a jittered wait capped at %v", wait, throttle.maxDelay)
+		}
+	}
+}
+
+func TestAWSThrottledRead(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type":"ThrottlingException","message":"Rate exceeded"}`)
+			return
+		}
+		fmt.Fprint(w, awsSecretBody)
+	}))
+	t.Cleanup(server.Close)
+
+	a := newFailoverProvider(&fakeAWSRegion{server: server})
+	a.throttle = &throttleBackoff{baseDelay: time.Millisecond, maxDelay: 2 * time.Millisecond, maxRetries: 5}
+
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"aws_secret_name": "db"}}
+	value, err := a.GetSecret(context.Background(), req)
+	if err != nil {
+		t.Fatalf("GetSecret() error = %v", err)
+	}
+	if string(value) != "hunter2" {
+		t.Errorf("GetSecret() = %q, expected %q", value, "hunter2")
+	}
+	if calls.Load() != 3 || a.ThrottledRequests() != 2 {
+		t.Errorf("%d calls with %d throttled, expected 3 calls with 2 throttled", calls.Load(), a.ThrottledRequests())
+	}
+}
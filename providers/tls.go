@@ -0,0 +1,85 @@
+package providers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// tlsVersions maps PROVIDER_TLS_MIN_VERSION values to TLS versions
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// providerTLSConfig builds the TLS settings for cloud provider endpoints from
+// PROVIDER_CACERT, PROVIDER_CLIENT_CERT/PROVIDER_CLIENT_KEY and
+// PROVIDER_TLS_MIN_VERSION. It returns nil when none are set, leaving the
+// SDK defaults in place.
+func providerTLSConfig(config map[string]string) (*tls.Config, error) {
+	caCert := getConfigOrDefault(config, "PROVIDER_CACERT", "")
+	clientCert := getConfigOrDefault(config, "PROVIDER_CLIENT_CERT", "")
+	clientKey := getConfigOrDefault(config, "PROVIDER_CLIENT_KEY", "")
+	minVersion := getConfigOrDefault(config, "PROVIDER_TLS_MIN_VERSION", "")
+
+	if caCert == "" && clientCert == "" && clientKey == "" && minVersion == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if minVersion != "" {
+		version, ok := tlsVersions[minVersion]
+		if !ok {
+			return nil, configErrorf("unsupported PROVIDER_TLS_MIN_VERSION %q, use 1.2 or 1.3", minVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, configErrorf("failed to read PROVIDER_CACERT: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, configErrorf("no certificates found in PROVIDER_CACERT %s", caCert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if clientCert != "" || clientKey != "" {
+		if clientCert == "" || clientKey == "" {
+			return nil, configErrorf("PROVIDER_CLIENT_CERT and PROVIDER_CLIENT_KEY must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, configErrorf("failed to load provider client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// providerTransport builds the HTTP client used by SDKs that accept one,
+// applying the egress proxy and the provider TLS settings
+func providerTransport(config map[string]string) (*http.Transport, error) {
+	proxy, err := proxyFunc(config)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := providerTLSConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure provider TLS: %w", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport, nil
+}
@@ -0,0 +1,172 @@
+package providers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// testPKI is a throwaway CA with a server certificate for 127.0.0.1 and a
+// client certificate, written to PEM files
+type testPKI struct {
+	pool                          *x509.CertPool
+	server                        tls.Certificate
+	caFile, clientCert, clientKey string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	issue := func(serial int64, usage x509.ExtKeyUsage) ([]byte, *ecdsa.PrivateKey) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "test"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der, key
+	}
+	writePEM := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	pki := &testPKI{pool: x509.NewCertPool()}
+	pki.pool.AddCert(ca)
+	pki.caFile = writePEM("ca.pem", "CERTIFICATE", caDER)
+
+	serverDER, serverKey := issue(2, x509.ExtKeyUsageServerAuth)
+	pki.server = tls.Certificate{Certificate: [][]byte{serverDER}, PrivateKey: serverKey}
+
+	clientDER, clientKey := issue(3, x509.ExtKeyUsageClientAuth)
+	keyDER, _ := x509.MarshalECPrivateKey(clientKey)
+	pki.clientCert = writePEM("client.pem", "CERTIFICATE", clientDER)
+	pki.clientKey = writePEM("client-key.pem", "EC PRIVATE KEY", keyDER)
+	return pki
+}
+
+func TestAWSMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		_, _ = w.Write([]byte(awsSecret("hunter2")))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pki.server},
+		ClientCAs:    pki.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MaxVersion:   tls.VersionTLS12,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		settings map[string]string
+		wantErr  bool
+	}{
+		{"client certificate", map[string]string{
+			"PROVIDER_CACERT":      pki.caFile,
+			"PROVIDER_CLIENT_CERT": pki.clientCert,
+			"PROVIDER_CLIENT_KEY":  pki.clientKey,
+		}, false},
+		{"no client certificate", map[string]string{"PROVIDER_CACERT": pki.caFile}, true},
+		{"server below minimum version", map[string]string{
+			"PROVIDER_CACERT":          pki.caFile,
+			"PROVIDER_CLIENT_CERT":     pki.clientCert,
+			"PROVIDER_CLIENT_KEY":      pki.clientKey,
+			"PROVIDER_TLS_MIN_VERSION": "1.3",
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := map[string]string{
+				"AWS_REGION":            "us-east-1",
+				"AWS_ACCESS_KEY_ID":     "key",
+				"AWS_SECRET_ACCESS_KEY": "secret",
+				"AWS_ENDPOINT_URL":      server.URL,
+			}
+			for key, value := range tt.settings {
+				config[key] = value
+			}
+			a := &AWSProvider{}
+			if err := a.Initialize(Isolated(config)); err != nil {
+				t.Fatalf("Initialize() error = %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			value, err := a.GetSecret(ctx, secrets.Request{SecretName: "db", SecretLabels: map[string]string{"aws_secret_name": "db"}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(value) != "hunter2" {
+				t.Errorf("GetSecret() = %q, expected %q", value, "hunter2")
+			}
+		})
+	}
+}
+
+func TestProviderTLSConfigErrors(t *testing.T) {
+	pki := newTestPKI(t)
+	tests := []struct {
+		name     string
+		settings map[string]string
+	}{
+		{"unsupported minimum version", map[string]string{"PROVIDER_TLS_MIN_VERSION": "1.1"}},
+		{"certificate without key", map[string]string{"PROVIDER_CLIENT_CERT": pki.clientCert}},
+		{"missing CA file", map[string]string{"PROVIDER_CACERT": filepath.Join(t.TempDir(), "missing.pem")}},
+		{"CA file without certificates", map[string]string{"PROVIDER_CACERT": pki.clientKey}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := providerTLSConfig(Isolated(tt.settings)); KindOf(err) != ErrorKindConfig {
+				t.Errorf("providerTLSConfig() error = %v, expected a configuration error", err)
+			}
+		})
+	}
+}
@@ -2,51 +2,151 @@ package providers
 
 import (
 	"context"
-	"crypto/sha256"
 	"fmt"
-	"os"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/docker/go-plugins-helpers/secrets"
 	"github.com/hashicorp/vault/api"
 	log "github.com/sirupsen/logrus"
 )
 
+// vaultMetadataFieldLabel selects a key of the KV v2 custom_metadata as the value
+const vaultMetadataFieldLabel = "vault_metadata_field"
+
 // VaultProvider implements the SecretsProvider interface for HashiCorp Vault
 type VaultProvider struct {
-	client *api.Client
-	config *SecretsConfig
+	client     *api.Client
+	config     *SecretsConfig
+	leases     map[string]vaultLease // secret path -> lease of the last read
+	leaseMutex sync.Mutex
+	mounts     mountMemory
+	auth       authStats
+	versionCache
+}
+
+// vaultLease is the lease returned with a dynamic secret
+type vaultLease struct {
+	id       string
+	duration time.Duration
 }
 
 // SecretsConfig holds the configuration for the Vault client
 type SecretsConfig struct {
 	Address    string
 	Token      string
-	MountPath  string
+	MountPath  string   // first of MountPaths
+	MountPaths []string // candidate mounts, tried in order until a secret is found
 	RoleID     string
 	SecretID   string
 	AuthMethod string
 	CACert     string
 	ClientCert string
 	ClientKey  string
+	// Exchange the login token for a child token limited to ChildPolicies
+	Bootstrap     bool
+	ChildPolicies []string
+	ChildTTL      string
+	// Resolve the KV version of each mount from sys/mounts at startup
+	AutodetectMount bool
+	KVVersions      map[string]int // detected KV engine version per mount
+	Naming          ServiceNaming  // where the service name goes in default paths
 }
 
 // Initialize sets up the Vault provider with the given configuration
 func (v *VaultProvider) Initialize(config map[string]string) error {
+	mountPaths := parseMountPaths(getConfigOrDefault(config, "VAULT_MOUNT_PATH", "secret"))
+	if len(mountPaths) == 0 {
+		return configErrorf("VAULT_MOUNT_PATH does not name any mount")
+	}
+
+	naming, err := serviceNaming(config)
+	if err != nil {
+		return err
+	}
+
 	v.config = &SecretsConfig{
 		Address:    getConfigOrDefault(config, "VAULT_ADDR", ""),
 		Token:      getConfigOrDefault(config, "VAULT_TOKEN", ""),
-		MountPath:  getConfigOrDefault(config, "VAULT_MOUNT_PATH", "secret"),
+		MountPath:  mountPaths[0],
+		MountPaths: mountPaths,
 		RoleID:     config["VAULT_ROLE_ID"],
 		SecretID:   config["VAULT_SECRET_ID"],
 		AuthMethod: getConfigOrDefault(config, "VAULT_AUTH_METHOD", "token"),
 		CACert:     config["VAULT_CACERT"],
 		ClientCert: config["VAULT_CLIENT_CERT"],
 		ClientKey:  config["VAULT_CLIENT_KEY"],
+		Bootstrap:  getConfigOrDefault(config, "VAULT_BOOTSTRAP", "false") == "true",
+		ChildTTL:   config["VAULT_CHILD_TTL"],
+		// Opt-in since it needs read access to sys/mounts
+		AutodetectMount: getConfigOrDefault(config, "VAULT_AUTODETECT_MOUNT", "false") == "true",
+		KVVersions:      make(map[string]int),
+		Naming:          naming,
+	}
+	for _, policy := range strings.Split(config["VAULT_CHILD_POLICIES"], ",") {
+		if policy = strings.TrimSpace(policy); policy != "" {
+			v.config.ChildPolicies = append(v.config.ChildPolicies, policy)
+		}
+	}
+	if v.config.Address == "" && isIsolated(config) {
+		return configErrorf("VAULT_ADDR is required")
+	}
+	if v.config.Bootstrap && len(v.config.ChildPolicies) == 0 {
+		return configErrorf("VAULT_CHILD_POLICIES is required with VAULT_BOOTSTRAP")
+	}
+
+	// Route requests through the egress proxy, if any
+	proxy, err := proxyFunc(config)
+	if err != nil {
+		return err
 	}
 
-	// Configure Vault client
-	SecretsConfig := api.DefaultConfig()
-	SecretsConfig.Address = v.config.Address
+	var client *api.Client
+	err = constructClient(config, func() error {
+		var err error
+		client, err = v.newClient(config, proxy)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	v.client = client
+	v.leases = make(map[string]vaultLease)
+
+	// Authenticate with Vault
+	if err := v.authenticate(); err != nil {
+		return fmt.Errorf("failed to authenticate with vault: %w", err)
+	}
+
+	if v.config.AutodetectMount {
+		for _, mount := range v.config.MountPaths {
+			if err := v.detectMount(mount); err != nil {
+				return fmt.Errorf("failed to detect vault mount: %w", err)
+			}
+		}
+	}
+
+	log.Printf("Successfully initialized Vault provider using %s method", v.config.AuthMethod)
+	return nil
+}
+
+// newClient builds the Vault client. Isolated configs start from a
+// configuration built by hand, since DefaultConfig reads the environment.
+func (v *VaultProvider) newClient(config map[string]string, proxy func(*http.Request) (*url.URL, error)) (*api.Client, error) {
+	var clientConfig *api.Config
+	if isIsolated(config) {
+		clientConfig = &api.Config{
+			HttpClient: isolatedHTTPClient(),
+			Timeout:    60 * time.Second,
+			MaxRetries: 2,
+		}
+	} else {
+		clientConfig = api.DefaultConfig()
+	}
+	clientConfig.Address = v.config.Address
 
 	// Configure TLS if certificates are provided
 	if v.config.CACert != "" || v.config.ClientCert != "" {
@@ -55,49 +155,71 @@ func (v *VaultProvider) Initialize(config map[string]string) error {
 			ClientCert: v.config.ClientCert,
 			ClientKey:  v.config.ClientKey,
 		}
-		if err := SecretsConfig.ConfigureTLS(tlsConfig); err != nil {
-			return fmt.Errorf("failed to configure TLS: %v", err)
+		if err := clientConfig.ConfigureTLS(tlsConfig); err != nil {
+			return nil, configErrorf("failed to configure TLS: %w", err)
 		}
 	}
 
-	client, err := api.NewClient(SecretsConfig)
-	if err != nil {
-		return fmt.Errorf("failed to create vault client: %v", err)
+	if err := applyProxy(clientConfig.HttpClient, proxy); err != nil {
+		return nil, fmt.Errorf("failed to configure proxy: %v", err)
 	}
 
-	v.client = client
-
-	// Authenticate with Vault
-	if err := v.authenticate(); err != nil {
-		return fmt.Errorf("failed to authenticate with vault: %v", err)
+	client, err := api.NewClient(clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault client: %v", err)
 	}
-
-	log.Printf("Successfully initialized Vault provider using %s method", v.config.AuthMethod)
-	return nil
+	return client, nil
 }
 
 // GetSecret retrieves a secret value from Vault
 func (v *VaultProvider) GetSecret(ctx context.Context, req secrets.Request) ([]byte, error) {
-	secretPath := v.buildSecretPath(req)
-	log.Printf("Reading secret from Vault/OpenBao path: %s", secretPath)
-
-	// Read secret from Vault
-	secret, err := v.client.Logical().ReadWithContext(ctx, secretPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read secret from vault: %v", err)
+	// Try each candidate mount, starting with the one that held the secret last time
+	var secret *api.Secret
+	var secretPath, secretMount string
+	var tried []string
+	for _, mount := range v.candidateMounts(req) {
+		secretPath = v.buildSecretPathForMount(req, mount)
+		requestLogger(ctx).Printf("Reading secret from Vault/OpenBao path: %s", secretPath)
+
+		var err error
+		secret, err = v.client.Logical().ReadWithContext(ctx, secretPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret from vault: %v", err)
+		}
+		if secret != nil {
+			secretMount = mount
+			break
+		}
+		tried = append(tried, secretPath)
 	}
 
 	if secret == nil {
-		return nil, fmt.Errorf("secret not found at path: %s", secretPath)
+		return nil, notFoundErrorf("secret not found at path: %s", strings.Join(tried, ", "))
 	}
+	v.rememberMount(req, secretMount)
 
 	// Extract the secret value
-	value, err := v.extractSecretValue(secret, req)
+	value, err := v.extractSecretValue(secret, secretMount, req)
+	value, err = allowNullField(value, err, req.SecretLabels)
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract secret value: %v", err)
+		return nil, fmt.Errorf("failed to extract secret value: %w", err)
 	}
 
-	log.Printf("Successfully retrieved secret from Vault")
+	v.recordVersion(secretPath, v.kvVersion(secret))
+
+	// Dynamic engines return a lease, remembered so the driver can renew it
+	v.leaseMutex.Lock()
+	if secret.LeaseID != "" {
+		v.leases[secretPath] = vaultLease{
+			id:       secret.LeaseID,
+			duration: time.Duration(secret.LeaseDuration) * time.Second,
+		}
+	} else {
+		delete(v.leases, secretPath)
+	}
+	v.leaseMutex.Unlock()
+
+	requestLogger(ctx).Printf("Successfully retrieved secret from Vault")
 	return value, nil
 }
 
@@ -115,26 +237,40 @@ func (v *VaultProvider) CheckSecretChanged(ctx context.Context, secretInfo *Secr
 	}
 
 	if secret == nil {
-		return false, fmt.Errorf("secret not found at path: %s", secretInfo.SecretPath)
+		return false, notFoundErrorf("secret not found at path: %s", secretInfo.SecretPath)
 	}
 
 	// Extract current value
-	var data map[string]interface{}
-	if secretData, ok := secret.Data["data"]; ok {
-		data = secretData.(map[string]interface{})
-	} else {
-		data = secret.Data
-	}
+	mount := v.mountOf(secretInfo.SecretPath)
+	data := v.secretData(secret, mount)
 
 	var currentValue []byte
-	if value, ok := data[secretInfo.SecretField]; ok {
-		currentValue = []byte(fmt.Sprintf("%v", value))
+	if key, exists := secretInfo.Labels[vaultMetadataFieldLabel]; exists {
+		currentValue, err = v.customMetadataValue(secret, mount, key)
+		if err != nil {
+			return false, err
+		}
+	} else if len(data) == 0 {
+		currentValue, err = emptySecretValue(secretInfo.Labels)
+		if err != nil {
+			return false, err
+		}
+	} else if secretInfo.AllFields {
+		currentValue, err = encodeJSON(data)
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal secret data: %v", err)
+		}
+	} else if value, ok := data[secretInfo.SecretField]; ok {
+		currentValue, err = formatFieldValue(secretInfo.SecretField, value)
+		if currentValue, err = allowNullField(currentValue, err, secretInfo.Labels); err != nil {
+			return false, err
+		}
 	} else {
 		return false, fmt.Errorf("field %s not found in secret", secretInfo.SecretField)
 	}
 
 	// Calculate current hash
-	currentHash := fmt.Sprintf("%x", sha256.Sum256(currentValue))
+	currentHash := HashValue(currentValue)
 
 	return currentHash != secretInfo.LastHash, nil
 }
@@ -144,6 +280,113 @@ func (v *VaultProvider) GetProviderName() string {
 	return "vault"
 }
 
+// FieldLabelKey returns the secret label selecting the field to extract
+func (v *VaultProvider) FieldLabelKey() string {
+	return "vault_field"
+}
+
+// PathLabelKey returns the secret label overriding the Vault path
+func (v *VaultProvider) PathLabelKey() string {
+	return "vault_path"
+}
+
+// BuildPath returns the Vault path the request resolves to
+func (v *VaultProvider) BuildPath(req secrets.Request) string {
+	return v.buildSecretPath(req)
+}
+
+// LeaseFor returns the lease of the last secret read from path, if it had one
+func (v *VaultProvider) LeaseFor(path string) (string, time.Duration, bool) {
+	v.leaseMutex.Lock()
+	defer v.leaseMutex.Unlock()
+
+	lease, ok := v.leases[path]
+	return lease.id, lease.duration, ok
+}
+
+// RenewLease extends a lease through sys/leases/renew and returns its new duration
+func (v *VaultProvider) RenewLease(ctx context.Context, leaseID string, increment time.Duration) (time.Duration, error) {
+	secret, err := v.client.Sys().RenewWithContext(ctx, leaseID, int(increment.Seconds()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to renew lease %s: %v", leaseID, err)
+	}
+	if secret == nil {
+		return 0, fmt.Errorf("empty response renewing lease %s", leaseID)
+	}
+	return time.Duration(secret.LeaseDuration) * time.Second, nil
+}
+
+// HealthCheck reports whether the Vault server is reachable
+func (v *VaultProvider) HealthCheck(ctx context.Context) error {
+	if _, err := v.client.Sys().HealthWithContext(ctx); err != nil {
+		return fmt.Errorf("vault health check failed: %v", err)
+	}
+	return nil
+}
+
+// VerifyCredentials looks up the plugin's own token, which fails when the
+// token is invalid, expired or revoked
+func (v *VaultProvider) VerifyCredentials(ctx context.Context) error {
+	if _, err := v.client.Auth().Token().LookupSelfWithContext(ctx); err != nil {
+		return fmt.Errorf("vault token lookup failed: %v", err)
+	}
+	return nil
+}
+
+// AuthStats returns the logins made against Vault
+func (v *VaultProvider) AuthStats() AuthStats {
+	return v.auth.snapshot()
+}
+
+// RenewToken renews the token once less than margin of its TTL is left and
+// logs in again when it expired or cannot be renewed. Tokens without a TTL,
+// such as root tokens, are left alone.
+func (v *VaultProvider) RenewToken(ctx context.Context, margin time.Duration) error {
+	self, err := v.client.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		// An expired or revoked token cannot look itself up
+		return v.reauthenticate(fmt.Errorf("failed to look up token: %v", err))
+	}
+	ttl, err := self.TokenTTL()
+	if err != nil || ttl == 0 || ttl > margin {
+		return nil
+	}
+
+	renewable, _ := self.TokenIsRenewable()
+	if !renewable {
+		return v.reauthenticate(fmt.Errorf("token expires in %v and is not renewable", ttl))
+	}
+	if err := v.renewToken(ctx); err != nil {
+		return v.reauthenticate(err)
+	}
+	return nil
+}
+
+// renewToken extends the token through auth/token/renew-self
+func (v *VaultProvider) renewToken(ctx context.Context) (err error) {
+	start := time.Now()
+	defer func() { v.auth.record(start, err) }()
+
+	if _, err := v.client.Auth().Token().RenewSelfWithContext(ctx, 0); err != nil {
+		return fmt.Errorf("failed to renew token: %v", err)
+	}
+	return nil
+}
+
+// reauthenticate logs in again after the token could not be kept alive. Only
+// AppRole can, unless its secret id was dropped after a bootstrap exchange; a
+// static token cannot be replaced by the plugin.
+func (v *VaultProvider) reauthenticate(cause error) error {
+	if v.config.AuthMethod != "approle" || v.config.SecretID == "" {
+		return cause
+	}
+	if err := v.authenticate(); err != nil {
+		return fmt.Errorf("%v, logging in again failed: %w", cause, err)
+	}
+	log.Printf("Logged in to Vault again: %v", cause)
+	return nil
+}
+
 // Close performs cleanup for the Vault provider
 func (v *VaultProvider) Close() error {
 	// Vault client doesn't require explicit cleanup
@@ -151,17 +394,20 @@ func (v *VaultProvider) Close() error {
 }
 
 // authenticate handles various Vault authentication methods
-func (v *VaultProvider) authenticate() error {
+func (v *VaultProvider) authenticate() (err error) {
+	start := time.Now()
+	defer func() { v.auth.record(start, err) }()
+
 	switch v.config.AuthMethod {
 	case "token":
 		if v.config.Token == "" {
-			return fmt.Errorf("VAULT_TOKEN is required for token authentication")
+			return configErrorf("VAULT_TOKEN is required for token authentication")
 		}
 		v.client.SetToken(v.config.Token)
 
 	case "approle":
 		if v.config.RoleID == "" || v.config.SecretID == "" {
-			return fmt.Errorf("VAULT_ROLE_ID and VAULT_SECRET_ID are required for approle authentication")
+			return configErrorf("VAULT_ROLE_ID and VAULT_SECRET_ID are required for approle authentication")
 		}
 
 		data := map[string]interface{}{
@@ -181,82 +427,208 @@ func (v *VaultProvider) authenticate() error {
 		v.client.SetToken(resp.Auth.ClientToken)
 
 	default:
-		return fmt.Errorf("unsupported authentication method: %s", v.config.AuthMethod)
+		return configErrorf("unsupported authentication method: %s", v.config.AuthMethod)
 	}
 
+	if v.config.Bootstrap {
+		return v.exchangeBootstrapToken()
+	}
 	return nil
 }
 
-// buildSecretPath constructs the Vault secret path based on request labels and service information
-func (v *VaultProvider) buildSecretPath(req secrets.Request) string {
-	// Use custom path from labels if provided
-	if customPath, exists := req.SecretLabels["vault_path"]; exists {
-		// For KV v2, ensure we have the /data/ prefix
-		if v.config.MountPath == "secret" {
-			return fmt.Sprintf("%s/data/%s", v.config.MountPath, customPath)
+// exchangeBootstrapToken replaces the broad token the plugin logged in with by
+// a child token limited to the configured policies. The bootstrap token is
+// dropped from memory but not revoked, as revoking it would revoke the child.
+func (v *VaultProvider) exchangeBootstrapToken() error {
+	secret, err := v.client.Auth().Token().Create(&api.TokenCreateRequest{
+		Policies:    v.config.ChildPolicies,
+		TTL:         v.config.ChildTTL,
+		DisplayName: "swarm-external-secrets",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create child token from bootstrap token: %v", err)
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return fmt.Errorf("no auth info returned when creating child token")
+	}
+
+	v.client.SetToken(secret.Auth.ClientToken)
+	v.config.Token = ""
+	v.config.SecretID = ""
+
+	log.Printf("Exchanged bootstrap token for a child token with policies %v", secret.Auth.Policies)
+	return nil
+}
+
+// detectMount looks up a mount in sys/mounts and caches its KV version
+func (v *VaultProvider) detectMount(mountPath string) error {
+	mounts, err := v.client.Sys().ListMounts()
+	if err != nil {
+		return fmt.Errorf("failed to list mounts: %v", err)
+	}
+
+	mountKey := strings.Trim(mountPath, "/") + "/"
+	mount, ok := mounts[mountKey]
+	if !ok {
+		return fmt.Errorf("mount %s not found", mountPath)
+	}
+
+	switch mount.Type {
+	case "kv":
+		if mount.Options["version"] == "2" {
+			v.config.KVVersions[mountPath] = 2
+		} else {
+			v.config.KVVersions[mountPath] = 1
 		}
-		return fmt.Sprintf("%s/%s", v.config.MountPath, customPath)
+	case "generic":
+		v.config.KVVersions[mountPath] = 1
+	default:
+		return configErrorf("mount %s is a %s engine, expected kv", mountPath, mount.Type)
 	}
 
-	// Default path structure for KV v2
-	if v.config.MountPath == "secret" {
-		if req.ServiceName != "" {
-			return fmt.Sprintf("%s/data/%s/%s", v.config.MountPath, req.ServiceName, req.SecretName)
+	log.Printf("Detected KV v%d engine at mount %s", v.config.KVVersions[mountPath], mountPath)
+	return nil
+}
+
+// usesKVv2 reports whether paths under the mount need the KV v2 data/ prefix
+func (v *VaultProvider) usesKVv2(mount string) bool {
+	if version, ok := v.config.KVVersions[mount]; ok {
+		return version == 2
+	}
+	// Without detection only the default mount is assumed to be KV v2
+	return mount == "secret"
+}
+
+// candidateMounts returns the mounts to try for a request, the one that held
+// the secret last time first
+func (v *VaultProvider) candidateMounts(req secrets.Request) []string {
+	return v.mounts.candidates(v.config.MountPaths, v.relativeSecretPath(req))
+}
+
+// rememberMount records the mount a request's secret was found under, so
+// later reads and rotation go straight to it
+func (v *VaultProvider) rememberMount(req secrets.Request, mount string) {
+	v.mounts.remember(v.relativeSecretPath(req), mount)
+}
+
+// mountOf returns the configured mount a full secret path lives under
+func (v *VaultProvider) mountOf(secretPath string) string {
+	match := v.config.MountPath
+	longest := -1
+	for _, mount := range v.config.MountPaths {
+		if strings.HasPrefix(secretPath, mount+"/") && len(mount) > longest {
+			match, longest = mount, len(mount)
 		}
-		return fmt.Sprintf("%s/data/%s", v.config.MountPath, req.SecretName)
 	}
+	return match
+}
 
-	// For other mount paths
-	if req.ServiceName != "" {
-		return fmt.Sprintf("%s/%s/%s", v.config.MountPath, req.ServiceName, req.SecretName)
+// kvVersion returns the KV v2 version of a secret, empty for other engines
+func (v *VaultProvider) kvVersion(secret *api.Secret) string {
+	metadata, ok := secret.Data["metadata"].(map[string]interface{})
+	if !ok || metadata["version"] == nil {
+		return ""
 	}
-	return fmt.Sprintf("%s/%s", v.config.MountPath, req.SecretName)
+	return fmt.Sprintf("%v", metadata["version"])
 }
 
-// extractSecretValue extracts the appropriate value from the Vault response
-func (v *VaultProvider) extractSecretValue(secret *api.Secret, req secrets.Request) ([]byte, error) {
-	// For KV v2, data is nested under "data"
-	var data map[string]interface{}
-	if secretData, ok := secret.Data["data"]; ok {
-		data = secretData.(map[string]interface{})
-	} else {
-		data = secret.Data
+// secretData returns the key/value pairs of a secret, unwrapping the KV v2 envelope
+func (v *VaultProvider) secretData(secret *api.Secret, mount string) map[string]interface{} {
+	if v.config.KVVersions[mount] == 1 {
+		return secret.Data
+	}
+	if data, ok := secret.Data["data"].(map[string]interface{}); ok {
+		return data
+	}
+	// A deleted or destroyed KV v2 version has a null data field next to its metadata
+	if raw, exists := secret.Data["data"]; exists && raw == nil && secret.Data["metadata"] != nil {
+		return map[string]interface{}{}
 	}
+	return secret.Data
+}
 
-	// Check for specific field in labels
-	if field, exists := req.SecretLabels["vault_field"]; exists {
-		if value, ok := data[field]; ok {
-			return []byte(fmt.Sprintf("%v", value)), nil
-		}
-		return nil, fmt.Errorf("field %s not found in secret", field)
+// buildSecretPath constructs the Vault secret path under the mount that last
+// held the secret, or the first configured mount
+func (v *VaultProvider) buildSecretPath(req secrets.Request) string {
+	return v.buildSecretPathForMount(req, v.candidateMounts(req)[0])
+}
+
+// buildSecretPathForMount constructs the secret path under a given mount
+func (v *VaultProvider) buildSecretPathForMount(req secrets.Request, mount string) string {
+	// For KV v2, ensure we have the /data/ prefix
+	if v.usesKVv2(mount) {
+		return fmt.Sprintf("%s/data/%s", mount, v.relativeSecretPath(req))
 	}
+	return fmt.Sprintf("%s/%s", mount, v.relativeSecretPath(req))
+}
 
-	// Default field names to try
-	defaultFields := []string{"value", "password", "secret", "data"}
+// relativeSecretPath returns the secret path below the mount based on request
+// labels and service information
+func (v *VaultProvider) relativeSecretPath(req secrets.Request) string {
+	// Use custom path from labels if provided
+	if customPath, exists := req.SecretLabels["vault_path"]; exists {
+		return customPath
+	}
+	return v.config.Naming.join(req.ServiceName, req.SecretName, "/")
+}
 
-	// Try to find a value using default field names
-	for _, field := range defaultFields {
-		if value, ok := data[field]; ok {
-			return []byte(fmt.Sprintf("%v", value)), nil
+// customMetadataValue returns a key of the KV v2 custom_metadata delivered
+// with the secret, which changes without creating a new version
+func (v *VaultProvider) customMetadataValue(secret *api.Secret, mount, key string) ([]byte, error) {
+	if !v.usesKVv2(mount) {
+		return nil, configErrorf("%s requires a KV v2 mount, %s is not one", vaultMetadataFieldLabel, mount)
+	}
+	metadata, _ := secret.Data["metadata"].(map[string]interface{})
+	custom, _ := metadata["custom_metadata"].(map[string]interface{})
+	value, ok := custom[key]
+	if !ok {
+		return nil, notFoundErrorf("custom metadata %s not found in secret; available keys: %v", key, fieldNames(custom))
+	}
+	return formatFieldValue(key, value)
+}
+
+// extractSecretValue extracts the appropriate value from the Vault response
+func (v *VaultProvider) extractSecretValue(secret *api.Secret, mount string, req secrets.Request) ([]byte, error) {
+	// Hints kept in custom_metadata are read instead of the data body
+	if key, exists := req.SecretLabels[vaultMetadataFieldLabel]; exists {
+		if strings.ToLower(req.SecretLabels["all_fields"]) == "true" {
+			return nil, configErrorf("%s cannot be combined with all_fields", vaultMetadataFieldLabel)
 		}
+		return v.customMetadataValue(secret, mount, key)
+	}
+
+	// For KV v2, data is nested under "data"
+	data := v.secretData(secret, mount)
+	if len(data) == 0 {
+		return emptySecretValue(req.SecretLabels)
+	}
+
+	// Deliver the whole secret object in the stable encodeJSON form
+	if strings.ToLower(req.SecretLabels["all_fields"]) == "true" {
+		return encodeJSON(data)
 	}
 
-	// If no specific field found, return the first string value
-	for _, value := range data {
-		if strValue, ok := value.(string); ok {
-			return []byte(strValue), nil
+	// Check for specific field in labels
+	if field, exists := req.SecretLabels["vault_field"]; exists {
+		if value, ok := data[field]; ok {
+			return formatFieldValue(field, value)
 		}
+		return nil, notFoundErrorf("field %s not found in secret", field)
 	}
 
-	return nil, fmt.Errorf("no suitable secret value found")
+	return defaultFieldValue(data, strictField(req))
 }
 
-// getConfigOrDefault returns config value or environment variable or default
+// getConfigOrDefault returns config value or environment variable or default.
+// Isolated configs never fall back to the environment.
 func getConfigOrDefault(config map[string]string, key, defaultValue string) string {
 	if value, exists := config[key]; exists && value != "" {
 		return value
 	}
-	if value := os.Getenv(key); value != "" {
+	if isIsolated(config) {
+		return defaultValue
+	}
+	if value, _ := lookupEnv(key); value != "" {
 		return value
 	}
 	return defaultValue
@@ -0,0 +1,449 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	"github.com/hashicorp/vault/api"
+)
+
+// fakeVault serves canned JSON bodies by request path, answering 404 for the
+// paths it does not hold, and records the paths requested
+type fakeVault struct {
+	mutex     sync.Mutex
+	responses map[string]string
+	requests  []string
+}
+
+func newFakeVault(t *testing.T, responses map[string]string) (*fakeVault, *httptest.Server) {
+	t.Helper()
+	vault := &fakeVault{responses: responses}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vault.mutex.Lock()
+		body, exists := vault.responses[r.URL.Path]
+		vault.requests = append(vault.requests, r.URL.Path)
+		vault.mutex.Unlock()
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[]}`)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return vault, server
+}
+
+// set changes the body served for path
+func (f *fakeVault) set(path, body string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.responses[path] = body
+}
+
+// newTestVault initializes a token-authenticated provider against a fake server
+func newTestVault(t *testing.T, address string, settings map[string]string) *VaultProvider {
+	t.Helper()
+	config := map[string]string{"VAULT_ADDR": address, "VAULT_TOKEN": "token"}
+	for key, value := range settings {
+		config[key] = value
+	}
+	v := &VaultProvider{}
+	if err := v.Initialize(Isolated(config)); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	return v
+}
+
+// kvV2 wraps secret data in a KV v2 read response
+func kvV2(data string) string {
+	return fmt.Sprintf(`{"data":{"data":%s,"metadata":{"version":1}}}`, data)
+}
+
+func TestVaultAllFields(t *testing.T) {
+	vault, server := newFakeVault(t, map[string]string{
+		"/v1/secret/data/app/db": kvV2(`{"username":"app","password":"first","port":5432}`),
+	})
+	v := newTestVault(t, server.URL, nil)
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_path": "app/db", "all_fields": "true"}}
+
+	value, err := v.GetSecret(context.Background(), req)
+	if err != nil {
+		t.Fatalf("GetSecret() error = %v", err)
+	}
+	want := `{"password":"first","port":5432,"username":"app"}`
+	if string(value) != want {
+		t.Errorf("GetSecret() = %s, expected %s", value, want)
+	}
+	for range 5 {
+		again, _ := v.GetSecret(context.Background(), req)
+		if string(again) != want {
+			t.Fatalf("key order changed between reads: %s", again)
+		}
+	}
+
+	// Rotation hashes the whole object, so any field changing counts
+	secretInfo := &SecretInfo{SecretPath: "secret/data/app/db", AllFields: true, LastHash: HashValue(value)}
+	if changed, err := v.CheckSecretChanged(context.Background(), secretInfo); err != nil || changed {
+		t.Fatalf("CheckSecretChanged() = %v, %v before any change", changed, err)
+	}
+	vault.set("/v1/secret/data/app/db", kvV2(`{"username":"app","password":"first","port":6432}`))
+	if changed, err := v.CheckSecretChanged(context.Background(), secretInfo); err != nil || !changed {
+		t.Errorf("CheckSecretChanged() = %v, %v after the port changed", changed, err)
+	}
+}
+
+func TestVaultDetectMount(t *testing.T) {
+	mounts := `{"data":{
+		"legacy/": {"type": "kv", "options": {"version": "1"}},
+		"apps/": {"type": "kv", "options": {"version": "2"}},
+		"database/": {"type": "database", "options": null}
+	}}`
+	_, server := newFakeVault(t, map[string]string{
+		"/v1/sys/mounts":         mounts,
+		"/v1/legacy/db":          `{"data":{"password":"from-v1"}}`,
+		"/v1/apps/data/api/db":   kvV2(`{"password":"from-v2"}`),
+		"/v1/legacy/data/api/db": `{"data":{"password":"wrong-path"}}`,
+	})
+
+	v := newTestVault(t, server.URL, map[string]string{"VAULT_AUTODETECT_MOUNT": "true", "VAULT_MOUNT_PATH": "legacy,apps"})
+	if v.config.KVVersions["legacy"] != 1 || v.config.KVVersions["apps"] != 2 {
+		t.Fatalf("detected KV versions %v, expected legacy v1 and apps v2", v.config.KVVersions)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"db", "from-v1"},
+		{"api/db", "from-v2"},
+	}
+	for _, tt := range tests {
+		req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_path": tt.path, "vault_field": "password"}}
+		value, err := v.GetSecret(context.Background(), req)
+		if err != nil {
+			t.Errorf("GetSecret(%s) error = %v", tt.path, err)
+			continue
+		}
+		if string(value) != tt.want {
+			t.Errorf("GetSecret(%s) = %q, expected %q", tt.path, value, tt.want)
+		}
+	}
+
+	for _, mount := range []string{"database", "missing"} {
+		err := (&VaultProvider{}).Initialize(Isolated(map[string]string{
+			"VAULT_ADDR":             server.URL,
+			"VAULT_TOKEN":            "token",
+			"VAULT_AUTODETECT_MOUNT": "true",
+			"VAULT_MOUNT_PATH":       mount,
+		}))
+		if err == nil {
+			t.Errorf("Initialize() accepted the %s mount", mount)
+		}
+	}
+}
+
+func TestVaultVerifyCredentials(t *testing.T) {
+	var lookups []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups = append(lookups, r.URL.Path)
+		if r.URL.Path != "/v1/auth/token/lookup-self" || r.Header.Get("X-Vault-Token") != "valid" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"id":"valid","policies":["default"],"ttl":3600}}`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid token", "valid", false},
+		{"revoked token", "revoked", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookups = nil
+			v := newTestVault(t, server.URL, map[string]string{"VAULT_TOKEN": tt.token})
+
+			err := v.VerifyCredentials(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyCredentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(lookups, []string{"/v1/auth/token/lookup-self"}) {
+				t.Errorf("requested %v, expected only the token lookup", lookups)
+			}
+		})
+	}
+}
+
+func TestVaultCustomMetadataField(t *testing.T) {
+	withMetadata := func(password, owner string) string {
+		return fmt.Sprintf(`{"data":{"data":{"password":%q},"metadata":{"version":1,"custom_metadata":{"owner":%q,"rotation_hint":"weekly"}}}}`, password, owner)
+	}
+	vault, server := newFakeVault(t, map[string]string{
+		"/v1/secret/data/app/db": withMetadata("hunter2", "team-db"),
+		"/v1/kv/app/db":          `{"data":{"password":"hunter2"}}`,
+	})
+	v := newTestVault(t, server.URL, nil)
+
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		want     string
+		wantKind ErrorKind
+	}{
+		{"metadata key", map[string]string{"vault_path": "app/db", vaultMetadataFieldLabel: "owner"}, "team-db", ""},
+		{"another metadata key", map[string]string{"vault_path": "app/db", vaultMetadataFieldLabel: "rotation_hint"}, "weekly", ""},
+		{"data field unaffected", map[string]string{"vault_path": "app/db", "vault_field": "password"}, "hunter2", ""},
+		{"missing metadata key", map[string]string{"vault_path": "app/db", vaultMetadataFieldLabel: "team"}, "", ErrorKindNotFound},
+		{"with all_fields", map[string]string{"vault_path": "app/db", vaultMetadataFieldLabel: "owner", "all_fields": "true"}, "", ErrorKindConfig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := v.GetSecret(context.Background(), secrets.Request{SecretName: "db", SecretLabels: tt.labels})
+			if tt.wantKind != "" {
+				if KindOf(err) != tt.wantKind {
+					t.Errorf("GetSecret() = %q, %v, expected a %s error", value, err, tt.wantKind)
+				}
+				return
+			}
+			if err != nil || string(value) != tt.want {
+				t.Errorf("GetSecret() = %q, %v, expected %q", value, err, tt.want)
+			}
+		})
+	}
+
+	kvV1 := newTestVault(t, server.URL, map[string]string{"VAULT_MOUNT_PATH": "kv"})
+	value, err := kvV1.GetSecret(context.Background(), secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_path": "app/db", vaultMetadataFieldLabel: "owner"}})
+	if KindOf(err) != ErrorKindConfig {
+		t.Errorf("GetSecret() from a KV v1 mount = %q, %v, expected a config error", value, err)
+	}
+
+	// Rotation checks watch the metadata key, not the data body
+	secretInfo := &SecretInfo{
+		SecretPath:  "secret/data/app/db",
+		SecretField: "value",
+		Labels:      map[string]string{"vault_path": "app/db", vaultMetadataFieldLabel: "owner"},
+		LastHash:    HashValue([]byte("team-db")),
+	}
+	steps := []struct {
+		body        string
+		wantChanged bool
+	}{
+		{withMetadata("hunter2", "team-db"), false},
+		{withMetadata("hunter3", "team-db"), false},
+		{withMetadata("hunter3", "team-payments"), true},
+	}
+	for _, step := range steps {
+		vault.set("/v1/secret/data/app/db", step.body)
+		changed, err := v.CheckSecretChanged(context.Background(), secretInfo)
+		if err != nil {
+			t.Fatalf("CheckSecretChanged() error = %v", err)
+		}
+		if changed != step.wantChanged {
+			t.Errorf("CheckSecretChanged() = %v after serving %s, expected %v", changed, step.body, step.wantChanged)
+		}
+	}
+}
+
+func TestVaultLeaseRenewal(t *testing.T) {
+	vault, server := newFakeVault(t, map[string]string{
+		"/v1/database/creds/app": `{"lease_id":"database/creds/app/abc","lease_duration":60,"renewable":true,"data":{"username":"v-app","password":"p1"}}`,
+		"/v1/sys/leases/renew":   `{"lease_id":"database/creds/app/abc","lease_duration":120,"renewable":true}`,
+	})
+	v := newTestVault(t, server.URL, map[string]string{"VAULT_MOUNT_PATH": "database"})
+
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_path": "creds/app", "vault_field": "password"}}
+	if _, err := v.GetSecret(context.Background(), req); err != nil {
+		t.Fatalf("GetSecret() error = %v", err)
+	}
+	leaseID, duration, ok := v.LeaseFor("database/creds/app")
+	if !ok || leaseID != "database/creds/app/abc" || duration != time.Minute {
+		t.Fatalf("LeaseFor() = %q, %v, %v, expected the 60s lease", leaseID, duration, ok)
+	}
+
+	renewed, err := v.RenewLease(context.Background(), leaseID, duration)
+	if err != nil {
+		t.Fatalf("RenewLease() error = %v", err)
+	}
+	if renewed != 2*time.Minute {
+		t.Errorf("RenewLease() = %v, expected 2m", renewed)
+	}
+
+	// A read without a lease forgets the previous one
+	vault.set("/v1/database/creds/app", `{"data":{"username":"v-app","password":"p2"}}`)
+	if _, err := v.GetSecret(context.Background(), req); err != nil {
+		t.Fatalf("GetSecret() error = %v", err)
+	}
+	if _, _, ok := v.LeaseFor("database/creds/app"); ok {
+		t.Errorf("lease kept after a read without one")
+	}
+}
+
+func TestVaultCandidateMounts(t *testing.T) {
+	vault, server := newFakeVault(t, map[string]string{
+		"/v1/new/data/api/db": kvV2(`{"value":"from-new"}`),
+	})
+	v := newTestVault(t, server.URL, map[string]string{"VAULT_MOUNT_PATH": "old, new"})
+	// Neither mount is the default secret/, so both are declared KV v2
+	v.config.KVVersions["old"], v.config.KVVersions["new"] = 2, 2
+	req := secrets.Request{SecretName: "db", ServiceName: "api"}
+
+	value, err := v.GetSecret(context.Background(), req)
+	if err != nil {
+		t.Fatalf("GetSecret() error = %v", err)
+	}
+	if string(value) != "from-new" {
+		t.Errorf("GetSecret() = %q, expected %q", value, "from-new")
+	}
+	if got := vault.requests; len(got) != 2 || got[0] != "/v1/old/data/api/db" || got[1] != "/v1/new/data/api/db" {
+		t.Errorf("requests = %v, expected the old mount then the new one", got)
+	}
+
+	// The mount that held the secret is remembered for reads and rotation
+	if path := v.BuildPath(req); path != "new/data/api/db" {
+		t.Errorf("BuildPath() = %q, expected the new mount", path)
+	}
+	vault.requests = nil
+	if _, err := v.GetSecret(context.Background(), req); err != nil {
+		t.Fatalf("GetSecret() error = %v", err)
+	}
+	if got := vault.requests; len(got) != 1 || got[0] != "/v1/new/data/api/db" {
+		t.Errorf("requests = %v, expected only the remembered mount", got)
+	}
+
+	// Moved back to the first mount, the secret is found there again
+	vault.set("/v1/old/data/api/db", kvV2(`{"value":"from-old"}`))
+	delete(vault.responses, "/v1/new/data/api/db")
+	if value, err := v.GetSecret(context.Background(), req); err != nil || string(value) != "from-old" {
+		t.Errorf("GetSecret() = %q, %v, expected %q", value, err, "from-old")
+	}
+
+	if _, err := v.GetSecret(context.Background(), secrets.Request{SecretName: "missing"}); KindOf(err) != ErrorKindNotFound {
+		t.Errorf("GetSecret() of a missing secret error = %v, expected not found", err)
+	}
+}
+
+func TestVaultEmptyData(t *testing.T) {
+	_, server := newFakeVault(t, map[string]string{
+		"/v1/secret/data/app/db": `{"data":{"data":null,"metadata":{"version":3,"deletion_time":"2026-01-01T00:00:00Z"}}}`,
+	})
+	v := newTestVault(t, server.URL, nil)
+
+	tests := []struct {
+		name    string
+		path    string
+		labels  map[string]string
+		wantErr string
+	}{
+		{"empty data", "app/db", nil, "has no data"},
+		{"empty data allowed", "app/db", map[string]string{"allow_empty": "true"}, ""},
+		{"missing secret", "app/missing", map[string]string{"allow_empty": "true"}, "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{"vault_path": tt.path}
+			for key, value := range tt.labels {
+				labels[key] = value
+			}
+			value, err := v.GetSecret(context.Background(), secrets.Request{SecretName: "db", SecretLabels: labels})
+			if tt.wantErr == "" {
+				if err != nil || len(value) != 0 {
+					t.Errorf("GetSecret() = %q, %v, expected an empty value", value, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("GetSecret() error = %v, expected it to mention %q", err, tt.wantErr)
+			}
+			if KindOf(err) != ErrorKindNotFound {
+				t.Errorf("KindOf(%v) = %v, expected %v", err, KindOf(err), ErrorKindNotFound)
+			}
+		})
+	}
+
+	// A tracked secret allowed to be empty is unchanged while it stays empty
+	secretInfo := &SecretInfo{
+		SecretPath:  "secret/data/app/db",
+		SecretField: "value",
+		LastHash:    HashValue(nil),
+		Labels:      map[string]string{"allow_empty": "true"},
+	}
+	if changed, err := v.CheckSecretChanged(context.Background(), secretInfo); err != nil || changed {
+		t.Errorf("CheckSecretChanged() = %v, %v, expected an unchanged empty secret", changed, err)
+	}
+	secretInfo.Labels = map[string]string{}
+	if _, err := v.CheckSecretChanged(context.Background(), secretInfo); KindOf(err) != ErrorKindNotFound {
+		t.Errorf("CheckSecretChanged() error = %v, expected not found without allow_empty", err)
+	}
+}
+
+func TestVaultBootstrapToken(t *testing.T) {
+	var mutex sync.Mutex
+	var readTokens []string
+	var created api.TokenCreateRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch r.URL.Path {
+		case "/v1/auth/token/create":
+			if r.Header.Get("X-Vault-Token") != "bootstrap" {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"errors":["permission denied"]}`)
+				return
+			}
+			_ = json.NewDecoder(r.Body).Decode(&created)
+			fmt.Fprint(w, `{"auth":{"client_token":"child","policies":["default","read-db"]}}`)
+		case "/v1/secret/data/app/db":
+			readTokens = append(readTokens, r.Header.Get("X-Vault-Token"))
+			fmt.Fprint(w, kvV2(`{"value":"hunter2"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[]}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	v := newTestVault(t, server.URL, map[string]string{
+		"VAULT_TOKEN":          "bootstrap",
+		"VAULT_BOOTSTRAP":      "true",
+		"VAULT_CHILD_POLICIES": "read-db, ",
+		"VAULT_CHILD_TTL":      "1h",
+	})
+	if !slices.Equal(created.Policies, []string{"read-db"}) || created.TTL != "1h" {
+		t.Errorf("token create request = %+v, expected the read-db policy with a 1h TTL", created)
+	}
+	if v.config.Token != "" {
+		t.Error("bootstrap token kept in the config after the exchange")
+	}
+
+	req := secrets.Request{SecretName: "db", SecretLabels: map[string]string{"vault_path": "app/db"}}
+	if _, err := v.GetSecret(context.Background(), req); err != nil {
+		t.Fatalf("GetSecret() error = %v", err)
+	}
+	if !slices.Equal(readTokens, []string{"child"}) {
+		t.Errorf("secret read with tokens %v, expected the child token", readTokens)
+	}
+
+	err := (&VaultProvider{}).Initialize(Isolated(map[string]string{
+		"VAULT_ADDR":      server.URL,
+		"VAULT_TOKEN":     "bootstrap",
+		"VAULT_BOOTSTRAP": "true",
+	}))
+	if KindOf(err) != ErrorKindConfig {
+		t.Errorf("Initialize() without VAULT_CHILD_POLICIES error = %v, expected a configuration error", err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// rotationExecLabel is the service label holding a reload command to run in
+// the service's new tasks after rotation
+const rotationExecLabel = "rotation_exec"
+
+// runRotationExec runs a service's rotation_exec command through sh -c in
+// each of its tasks that run with the new secret version. Swarm replaces the
+// tasks when their secret reference changes, so these are the new tasks.
+// Docker can only exec into containers on its own node, tasks on other nodes
+// are skipped.
+func (d *SecretsDriver) runRotationExec(serviceName, secretID, command string) {
+	ctx, cancel := context.WithTimeout(d.monitorCtx, d.config.RotationExecTimeout)
+	defer cancel()
+
+	tasks, err := d.runningTasksWith(ctx, serviceName, secretID)
+	if err != nil {
+		log.Warnf("Not running %s for service %s, no task runs with the new secret: %v", rotationExecLabel, serviceName, err)
+		return
+	}
+
+	for _, task := range tasks {
+		if task.Status.ContainerStatus == nil || task.Status.ContainerStatus.ContainerID == "" {
+			continue
+		}
+		containerID := task.Status.ContainerStatus.ContainerID
+
+		start := time.Now()
+		exitCode, err := d.store.Exec(ctx, containerID, []string{"sh", "-c", command})
+		d.recordDockerAPICall("ContainerExec", err)
+		if err != nil {
+			// Containers of tasks scheduled on other nodes are not found here
+			log.Debugf("Could not run %s in task %s of service %s: %v", rotationExecLabel, task.ID, serviceName, err)
+			continue
+		}
+		if exitCode != 0 {
+			log.Warnf("%s in task %s of service %s exited with code %d", rotationExecLabel, task.ID, serviceName, exitCode)
+			continue
+		}
+		log.Printf("%s in task %s of service %s exited with code 0 after %v", rotationExecLabel, task.ID, serviceName, time.Since(start))
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+func TestRequestIDInDriverAndProviderLogs(t *testing.T) {
+	t.Setenv("APP_DB", "hunter2")
+	provider := &providers.EnvProvider{}
+	if err := provider.Initialize(map[string]string{"ENV_PREFIX": "APP_"}); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	driver := newTestDriver(provider, &fakeDocker{})
+	driver.config.EnableRotation = false
+
+	hook := logtest.NewGlobal()
+	t.Cleanup(func() { log.StandardLogger().ReplaceHooks(make(log.LevelHooks)) })
+
+	if resp := driver.Get(secrets.Request{SecretName: "db"}); resp.Err != "" {
+		t.Fatalf("Get() error = %s", resp.Err)
+	}
+
+	// Every line of the request carries one id, from the driver and the provider
+	requestID := ""
+	var driverLine, providerLine bool
+	for _, entry := range hook.AllEntries() {
+		id, ok := entry.Data["request_id"].(string)
+		if !ok {
+			continue
+		}
+		if requestID == "" {
+			requestID = id
+		} else if id != requestID {
+			t.Errorf("line %q has request_id %q, expected %q", entry.Message, id, requestID)
+		}
+		driverLine = driverLine || strings.HasPrefix(entry.Message, "Received secret request")
+		providerLine = providerLine || strings.HasPrefix(entry.Message, "Reading secret from environment variable")
+	}
+	if !driverLine || !providerLine {
+		t.Errorf("driver line logged = %v, provider line logged = %v, expected both tagged", driverLine, providerLine)
+	}
+
+	// A second request gets its own id, surfaced in the error response
+	hook.Reset()
+	resp := driver.Get(secrets.Request{SecretName: "missing"})
+	if resp.Err == "" {
+		t.Fatal("Get() of a missing variable succeeded")
+	}
+	entry := hook.LastEntry()
+	if entry == nil {
+		t.Fatal("no lines logged for the failing request")
+	}
+	id, _ := entry.Data["request_id"].(string)
+	if id == "" || id == requestID {
+		t.Errorf("failing request logged request_id %q, expected a new id", id)
+	}
+	if !strings.Contains(resp.Err, "request_id="+id) {
+		t.Errorf("Get() error = %q, expected it to carry request_id=%s", resp.Err, id)
+	}
+}
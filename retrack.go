@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-plugins-helpers/secrets"
+	log "github.com/sirupsen/logrus"
+)
+
+// startRetracking periodically refreshes the label-derived configuration of
+// tracked secrets, which otherwise only changes when a secret is requested
+func (d *SecretsDriver) startRetracking() {
+	ticker := time.NewTicker(d.config.RetrackInterval)
+	defer ticker.Stop()
+
+	log.Printf("Refreshing tracked secret labels every %v", d.config.RetrackInterval)
+
+	for {
+		select {
+		case <-d.monitorCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		d.trackerMutex.RLock()
+		names := make([]string, 0, len(d.secretTracker))
+		for name := range d.secretTracker {
+			names = append(names, name)
+		}
+		d.trackerMutex.RUnlock()
+
+		updated := false
+		for _, name := range names {
+			changed, err := d.retrackSecret(name)
+			if err != nil {
+				log.Warnf("Failed to refresh labels of tracked secret %s: %v", name, err)
+				continue
+			}
+			updated = updated || changed
+		}
+		if updated {
+			d.saveTrackerState()
+		}
+	}
+}
+
+// retrackSecret rebuilds the request of a tracked secret from the current
+// labels of the secret and its first service, as Get would see it, and
+// updates the tracked path, field and labels. It reports whether they changed.
+// A changed field reads a different value, so the next check rotates it.
+func (d *SecretsDriver) retrackSecret(secretName string) (bool, error) {
+	ctx, cancel := context.WithTimeout(d.monitorCtx, d.config.RequestTimeout)
+	defer cancel()
+
+	d.trackerMutex.RLock()
+	secretInfo, exists := d.secretTracker[secretName]
+	var serviceName string
+	if exists && len(secretInfo.ServiceNames) > 0 {
+		serviceName = secretInfo.ServiceNames[0]
+	}
+	d.trackerMutex.RUnlock()
+	if !exists {
+		return false, nil
+	}
+
+	secret, err := d.latestSecretVersion(ctx, secretName)
+	if err != nil {
+		return false, err
+	}
+	req := secrets.Request{
+		SecretName:   secretName,
+		SecretLabels: resolveLabels(copyLabels(secret.Spec.Labels), d.config.LabelPrefix),
+		ServiceName:  serviceName,
+	}
+	if serviceName != "" {
+		service, err := d.findService(ctx, serviceName)
+		if err != nil {
+			return false, err
+		}
+		req.ServiceID = service.ID
+		req.ServiceLabels = service.Spec.Labels
+	}
+
+	req, requestScoped, err := withRequestMetadata(req, d.config.LabelPrefix)
+	if err != nil {
+		return false, err
+	}
+	// The service now supplies labels of the secret, Get no longer tracks it
+	if requestScoped {
+		d.trackerMutex.Lock()
+		delete(d.secretTracker, secretName)
+		d.trackerMutex.Unlock()
+		log.Warnf("Secret %s now resolves its labels per request, no longer rotating it", secretName)
+		return true, nil
+	}
+	req = templateRequest(req)
+	provider, instance, err := d.providerFor(ctx, req)
+	if err != nil {
+		return false, err
+	}
+	if d.untrackMovedSecret(secretName, instance) {
+		return false, nil
+	}
+	if req, err = d.resolvePathFrom(ctx, req, nil); err != nil {
+		return false, err
+	}
+	if req, err = d.withEnvSelect(req, provider); err != nil {
+		return false, err
+	}
+	req = d.withDefaultField(req, provider)
+
+	secretField := req.SecretLabels[provider.FieldLabelKey()]
+	if secretField == "" {
+		secretField = "value"
+	}
+	secretPath := provider.BuildPath(req)
+
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	changed := secretInfo.SecretPath != secretPath || secretInfo.SecretField != secretField
+	if changed {
+		log.Printf("Labels of secret %s changed, tracking %s field %s instead of %s field %s",
+			secretName, secretPath, secretField, secretInfo.SecretPath, secretInfo.SecretField)
+	}
+	secretInfo.SecretPath = secretPath
+	secretInfo.SecretField = secretField
+	secretInfo.Labels = copyLabels(req.SecretLabels)
+	secretInfo.AllFields = strings.ToLower(req.SecretLabels["all_fields"]) == "true"
+	secretInfo.WatchFields = parseWatchFields(req.SecretLabels[watchFieldsLabel])
+	return changed, nil
+}
+
+// latestSecretVersion returns the secret or, once rotated, its newest version
+func (d *SecretsDriver) latestSecretVersion(ctx context.Context, secretName string) (*swarm.Secret, error) {
+	secretList, err := d.store.ListSecrets(ctx, secretName)
+	d.recordDockerAPICall("SecretList", err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %v", err)
+	}
+
+	var latest *swarm.Secret
+	for i, secret := range secretList {
+		if secret.Spec.Name != secretName && !isSecretVersion(secretName, secret) {
+			continue
+		}
+		if latest == nil || secret.CreatedAt.After(latest.CreatedAt) {
+			latest = &secretList[i]
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("secret %s not found", secretName)
+	}
+	return latest, nil
+}
+
+// findService returns the service with exactly the given name
+func (d *SecretsDriver) findService(ctx context.Context, serviceName string) (swarm.Service, error) {
+	services, err := d.store.ListServices(ctx, []string{serviceName})
+	d.recordDockerAPICall("ServiceList", err)
+	if err != nil {
+		return swarm.Service{}, fmt.Errorf("failed to list services: %v", err)
+	}
+	for _, service := range services {
+		if service.Spec.Name == serviceName {
+			return service, nil
+		}
+	}
+	return swarm.Service{}, fmt.Errorf("service %s not found", serviceName)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	log "github.com/sirupsen/logrus"
+)
+
+// rolloutPollInterval is how often a gradual rollout is checked for completion
+const rolloutPollInterval = 5 * time.Second
+
+// rolloutOverride is the update policy a rotation rolls out with, from the
+// rotation_update_parallelism and rotation_update_delay secret labels
+type rolloutOverride struct {
+	parallelism *uint64
+	delay       *time.Duration
+}
+
+// parseRolloutLabels reads the rollout labels of a secret, returning nil
+// when it sets neither
+func parseRolloutLabels(labels map[string]string) (*rolloutOverride, error) {
+	var override rolloutOverride
+	if value, exists := labels["rotation_update_parallelism"]; exists {
+		parallelism, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rotation_update_parallelism %q: %v", value, err)
+		}
+		override.parallelism = &parallelism
+	}
+	if value, exists := labels["rotation_update_delay"]; exists {
+		delay, err := time.ParseDuration(value)
+		if err != nil || delay < 0 {
+			return nil, fmt.Errorf("invalid rotation_update_delay %q", value)
+		}
+		override.delay = &delay
+	}
+	if override.parallelism == nil && override.delay == nil {
+		return nil, nil
+	}
+	return &override, nil
+}
+
+// apply returns the service's update policy with the override set, keeping
+// the failure action, order and other settings of the service
+func (o *rolloutOverride) apply(current *swarm.UpdateConfig) *swarm.UpdateConfig {
+	updated := swarm.UpdateConfig{Parallelism: 1}
+	if current != nil {
+		updated = *current
+	}
+	if o.parallelism != nil {
+		updated.Parallelism = *o.parallelism
+	}
+	if o.delay != nil {
+		updated.Delay = *o.delay
+	}
+	return &updated
+}
+
+// claimRollout records the update policy a rotation rollout overrides on a
+// service and returns it. While an earlier rollout is still being restored the
+// service shows that override, so the policy recorded by it is returned and
+// the bool reports that the rollout joins it.
+func (d *SecretsDriver) claimRollout(serviceName string, current *swarm.UpdateConfig) (*swarm.UpdateConfig, bool) {
+	d.rolloutMutex.Lock()
+	defer d.rolloutMutex.Unlock()
+	if original, exists := d.rolloutOriginals[serviceName]; exists {
+		return original, true
+	}
+	if d.rolloutOriginals == nil {
+		d.rolloutOriginals = make(map[string]*swarm.UpdateConfig)
+	}
+	d.rolloutOriginals[serviceName] = current
+	return current, false
+}
+
+// releaseRollout forgets the recorded update policy of a service
+func (d *SecretsDriver) releaseRollout(serviceName string) {
+	d.rolloutMutex.Lock()
+	defer d.rolloutMutex.Unlock()
+	delete(d.rolloutOriginals, serviceName)
+}
+
+// restoreUpdateConfig puts a service's own update policy back once the
+// rollout of a rotation finished. Changing it earlier would make Swarm
+// continue the running update with the restored policy. Rollouts joining
+// this one are restored with it.
+func (d *SecretsDriver) restoreUpdateConfig(serviceName string, original *swarm.UpdateConfig) {
+	defer d.releaseRollout(serviceName)
+
+	ticker := time.NewTicker(rolloutPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.monitorCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(d.monitorCtx, 30*time.Second)
+		done, err := d.restoreWhenRolledOut(ctx, serviceName, original)
+		cancel()
+		if err != nil {
+			log.Warnf("Failed to restore the update config of service %s: %v", serviceName, err)
+			return
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// restoreWhenRolledOut restores the update policy if the service's update is
+// no longer running, and reports whether it did
+func (d *SecretsDriver) restoreWhenRolledOut(ctx context.Context, serviceName string, original *swarm.UpdateConfig) (bool, error) {
+	services, err := d.store.ListServices(ctx, []string{serviceName})
+	d.recordDockerAPICall("ServiceList", err)
+	if err != nil {
+		return false, err
+	}
+
+	for _, service := range services {
+		if service.Spec.Name != serviceName {
+			continue
+		}
+		if status := service.UpdateStatus; status != nil &&
+			(status.State == swarm.UpdateStateUpdating || status.State == swarm.UpdateStateRollbackStarted) {
+			return false, nil
+		}
+
+		spec := service.Spec
+		spec.UpdateConfig = original
+		_, err := d.store.UpdateService(ctx, service, spec)
+		d.recordDockerAPICall("ServiceUpdate", err)
+		if err != nil {
+			return false, err
+		}
+		log.Printf("Restored the update config of service %s after rotation", serviceName)
+		return true, nil
+	}
+	return false, fmt.Errorf("service %s not found", serviceName)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestParseRolloutLabels(t *testing.T) {
+	tests := []struct {
+		name            string
+		labels          map[string]string
+		wantNil         bool
+		wantParallelism uint64
+		wantDelay       time.Duration
+		wantErr         bool
+	}{
+		{"no rollout labels", map[string]string{"fake_path": "db"}, true, 0, 0, false},
+		{"parallelism", map[string]string{"rotation_update_parallelism": "2"}, false, 2, 0, false},
+		{"delay", map[string]string{"rotation_update_delay": "30s"}, false, 0, 30 * time.Second, false},
+		{"both", map[string]string{"rotation_update_parallelism": "1", "rotation_update_delay": "1m"}, false, 1, time.Minute, false},
+		{"invalid parallelism", map[string]string{"rotation_update_parallelism": "-1"}, false, 0, 0, true},
+		{"negative delay", map[string]string{"rotation_update_delay": "-5s"}, false, 0, 0, true},
+		{"delay without a unit", map[string]string{"rotation_update_delay": "30"}, false, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			override, err := parseRolloutLabels(tt.labels)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRolloutLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (override == nil) != tt.wantNil {
+				t.Fatalf("parseRolloutLabels() = %+v, expected nil = %v", override, tt.wantNil)
+			}
+			if override == nil {
+				return
+			}
+			// Unset values keep the service's own, apply shows what changes
+			updated := override.apply(&swarm.UpdateConfig{})
+			if updated.Parallelism != tt.wantParallelism || updated.Delay != tt.wantDelay {
+				t.Errorf("applied parallelism %d and delay %v, expected %d and %v", updated.Parallelism, updated.Delay, tt.wantParallelism, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestRotationRollout(t *testing.T) {
+	labels := map[string]string{"fake_path": "db", "rotation_update_parallelism": "1", "rotation_update_delay": "30s"}
+	original := &swarm.UpdateConfig{Parallelism: 5, Delay: time.Second, FailureAction: swarm.UpdateFailureActionRollback, Order: swarm.UpdateOrderStartFirst}
+	service := testService("svc", "api", nil, secretRef("old", "db_password"))
+	service.Spec.UpdateConfig = original
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", labels)},
+		services: []swarm.Service{service},
+	}
+	provider := &fakeProvider{values: map[string]string{"db": "first"}}
+	driver := newTestDriver(provider, docker)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	driver.monitorCtx = ctx
+
+	if response := driver.Get(secrets.Request{SecretName: "db_password", SecretLabels: labels}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	provider.set("db", "second")
+	driver.checkForSecretChanges()
+
+	want := swarm.UpdateConfig{Parallelism: 1, Delay: 30 * time.Second, FailureAction: swarm.UpdateFailureActionRollback, Order: swarm.UpdateOrderStartFirst}
+	if applied := docker.serviceNamed(t, "api").Spec.UpdateConfig; applied == nil || *applied != want {
+		t.Fatalf("rotation rolled out with %+v, expected %+v", applied, want)
+	}
+
+	// The service's own policy comes back only once the update finished
+	setUpdateState := func(state swarm.UpdateState) {
+		docker.mutex.Lock()
+		defer docker.mutex.Unlock()
+		docker.services[0].UpdateStatus = &swarm.UpdateStatus{State: state}
+	}
+	setUpdateState(swarm.UpdateStateUpdating)
+	if done, err := driver.restoreWhenRolledOut(ctx, "api", original); done || err != nil {
+		t.Fatalf("restoreWhenRolledOut() = %v, %v during the rollout", done, err)
+	}
+	if applied := docker.serviceNamed(t, "api").Spec.UpdateConfig; *applied != want {
+		t.Errorf("update config changed to %+v during the rollout", applied)
+	}
+
+	setUpdateState(swarm.UpdateStateCompleted)
+	if done, err := driver.restoreWhenRolledOut(ctx, "api", original); !done || err != nil {
+		t.Fatalf("restoreWhenRolledOut() = %v, %v after the rollout", done, err)
+	}
+	if restored := docker.serviceNamed(t, "api").Spec.UpdateConfig; restored == nil || *restored != *original {
+		t.Errorf("update config restored to %+v, expected %+v", restored, original)
+	}
+}
+
+func TestOverlappingRotationRollouts(t *testing.T) {
+	labels := map[string]string{"fake_path": "db", "rotation_update_parallelism": "1"}
+	original := &swarm.UpdateConfig{Parallelism: 5, Delay: time.Second}
+	service := testService("svc", "api", nil, secretRef("old", "db_password"))
+	service.Spec.UpdateConfig = original
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", labels)},
+		services: []swarm.Service{service},
+	}
+	provider := &fakeProvider{values: map[string]string{"db": "first"}}
+	driver := newTestDriver(provider, docker)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	driver.monitorCtx = ctx
+
+	if response := driver.Get(secrets.Request{SecretName: "db_password", SecretLabels: labels}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	provider.set("db", "second")
+	driver.checkForSecretChanges()
+
+	// The second rotation starts before the first one was restored, while
+	// the service still shows the override
+	provider.set("db", "third")
+	driver.checkForSecretChanges()
+
+	want := swarm.UpdateConfig{Parallelism: 1, Delay: time.Second}
+	if applied := docker.serviceNamed(t, "api").Spec.UpdateConfig; applied == nil || *applied != want {
+		t.Fatalf("second rotation rolled out with %+v, expected %+v", applied, want)
+	}
+	driver.rolloutMutex.Lock()
+	recorded := driver.rolloutOriginals["api"]
+	driver.rolloutMutex.Unlock()
+	if recorded == nil || *recorded != *original {
+		t.Fatalf("recorded update config %+v, expected the service's own %+v", recorded, original)
+	}
+
+	if done, err := driver.restoreWhenRolledOut(ctx, "api", recorded); !done || err != nil {
+		t.Fatalf("restoreWhenRolledOut() = %v, %v after the rollouts", done, err)
+	}
+	if restored := docker.serviceNamed(t, "api").Spec.UpdateConfig; restored == nil || *restored != *original {
+		t.Errorf("update config restored to %+v, expected %+v", restored, original)
+	}
+}
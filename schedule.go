@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// applySchedule aligns the check interval of a tracked secret to the rotation
+// cadence declared in the backend, with FOLLOW_BACKEND_SCHEDULE set. Secrets
+// without a declared cadence keep the global rotation interval.
+func (d *SecretsDriver) applySchedule(ctx context.Context, secretName string, provider providers.SecretsProvider) {
+	if !d.config.FollowBackendSchedule {
+		return
+	}
+	reporter, ok := provider.(providers.ScheduleReporter)
+	if !ok {
+		return
+	}
+
+	d.trackerMutex.RLock()
+	secretInfo, exists := d.secretTracker[secretName]
+	var secretPath string
+	if exists {
+		secretPath = secretInfo.SecretPath
+	}
+	d.trackerMutex.RUnlock()
+	if !exists {
+		return
+	}
+
+	period, scheduled, err := reporter.RotationSchedule(ctx, secretPath)
+	if err != nil {
+		log.Warnf("Cannot read rotation schedule of secret %s, checking it every %v: %v", secretName, d.config.RotationInterval, err)
+		return
+	}
+
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	if !scheduled {
+		secretInfo.CheckInterval = 0
+		secretInfo.NextCheck = time.Time{}
+		return
+	}
+
+	// Never poll more often than the global interval would
+	interval := max(period, d.config.RotationInterval)
+	if secretInfo.CheckInterval != interval {
+		log.Printf("Secret %s rotates every %v in the backend, checking it on that schedule", secretName, interval)
+	}
+	secretInfo.CheckInterval = interval
+	if secretInfo.NextCheck.IsZero() {
+		secretInfo.NextCheck = time.Now().Add(interval)
+	}
+}
+
+// errBackendRotating defers the rotation of a secret the backend is still rotating
+var errBackendRotating = errors.New("backend rotation in progress")
+
+// backendRotating reports whether the backend is in the middle of its own
+// rotation of a secret, whose value may still change. The change stays
+// pending and is rotated once the backend settles, or after
+// BACKEND_ROTATION_MAX_DEFER when a failed backend rotation never does.
+func (d *SecretsDriver) backendRotating(secretInfo *providers.SecretInfo) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.ChangeCheckTimeout)
+	defer cancel()
+
+	provider, err := d.trackedProvider(ctx, secretInfo)
+	if err != nil {
+		return false
+	}
+	reporter, ok := provider.(providers.RotationStateReporter)
+	if !ok {
+		return false
+	}
+
+	d.trackerMutex.RLock()
+	secretName, secretPath, detectedAt := secretInfo.DockerSecretName, secretInfo.SecretPath, secretInfo.ChangeDetectedAt
+	d.trackerMutex.RUnlock()
+
+	rotating, err := reporter.RotationInProgress(ctx, secretPath)
+	if err != nil {
+		log.Warnf("Cannot read backend rotation state of secret %s, rotating it: %v", secretName, err)
+		return false
+	}
+	if !rotating {
+		return false
+	}
+	if waited := time.Since(detectedAt); waited >= d.config.BackendRotationMaxDefer {
+		log.Warnf("Backend rotation of secret %s has not finished after %v, rotating it anyway", secretName, waited.Round(time.Second))
+		return false
+	}
+
+	log.Printf("Backend is rotating secret %s, deferring its rotation until it settles", secretName)
+	return true
+}
+
+// scheduleDue reports whether a secret is due for a change check. Secrets
+// without a backend schedule are checked on every rotation interval.
+func (d *SecretsDriver) scheduleDue(secretInfo *providers.SecretInfo) bool {
+	d.trackerMutex.RLock()
+	defer d.trackerMutex.RUnlock()
+	return secretInfo.CheckInterval == 0 || !time.Now().Before(secretInfo.NextCheck)
+}
+
+// advanceSchedule moves a scheduled secret to its next check
+func (d *SecretsDriver) advanceSchedule(secretInfo *providers.SecretInfo) {
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	if secretInfo.CheckInterval > 0 {
+		secretInfo.NextCheck = time.Now().Add(secretInfo.CheckInterval)
+	}
+}
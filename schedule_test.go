@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-plugins-helpers/secrets"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// rotatingProvider is a fakeProvider whose backend may be mid-rotation
+type rotatingProvider struct {
+	*fakeProvider
+	rotating bool
+}
+
+var _ providers.RotationStateReporter = (*rotatingProvider)(nil)
+
+func (p *rotatingProvider) RotationInProgress(ctx context.Context, path string) (bool, error) {
+	return p.rotating, nil
+}
+
+func TestDeferredRotationKeepsSchedule(t *testing.T) {
+	tests := []struct {
+		name         string
+		rotating     bool
+		wantRotated  bool
+		wantAdvanced bool
+	}{
+		{"backend settled", false, true, true},
+		{"backend rotating", true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := &fakeDocker{
+				secrets:  []swarm.Secret{testSecret("old", "db_password", nil)},
+				services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+			}
+			provider := &rotatingProvider{fakeProvider: &fakeProvider{values: map[string]string{"db_password": "first"}}}
+			driver := newTestDriver(provider, docker)
+			driver.config.BackendRotationMaxDefer = time.Hour
+
+			driver.trackSecret(secrets.Request{SecretName: "db_password", ServiceName: "api", SecretLabels: map[string]string{}}, []byte("first"), driver.provider, "fake")
+			secretInfo := driver.secretTracker["db_password"]
+			dueAt := time.Now().Add(-time.Minute)
+			secretInfo.CheckInterval = 24 * time.Hour
+			secretInfo.NextCheck = dueAt
+
+			provider.set("db_password", "second")
+			provider.rotating = tt.rotating
+			driver.checkForSecretChanges()
+
+			rotated := len(docker.secretsWithPrefix("db_password-")) > 0
+			if rotated != tt.wantRotated {
+				t.Errorf("rotated = %v, expected %v", rotated, tt.wantRotated)
+			}
+			advanced := secretInfo.NextCheck.After(time.Now())
+			if advanced != tt.wantAdvanced {
+				t.Errorf("schedule advanced = %v (next check %v), expected %v", advanced, secretInfo.NextCheck, tt.wantAdvanced)
+			}
+			if !tt.wantAdvanced && !driver.scheduleDue(secretInfo) {
+				t.Error("deferred secret is not due on the next check")
+			}
+		})
+	}
+}
+
+// scheduledProvider is a fakeProvider whose backend declares a rotation cadence
+type scheduledProvider struct {
+	*fakeProvider
+	period time.Duration
+}
+
+var _ providers.ScheduleReporter = (*scheduledProvider)(nil)
+
+func (p *scheduledProvider) RotationSchedule(ctx context.Context, path string) (time.Duration, bool, error) {
+	return p.period, p.period > 0, nil
+}
+
+func TestApplySchedule(t *testing.T) {
+	tests := []struct {
+		name         string
+		follow       bool
+		period       time.Duration
+		wantInterval time.Duration
+	}{
+		{"weekly rotation rule", true, 7 * 24 * time.Hour, 7 * 24 * time.Hour},
+		{"faster than the global interval", true, time.Second, time.Minute},
+		{"no rotation rule", true, 0, 0},
+		{"schedule not followed", false, 7 * 24 * time.Hour, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &scheduledProvider{fakeProvider: &fakeProvider{values: map[string]string{"db_password": "first"}}, period: tt.period}
+			driver := newTestDriver(provider, &fakeDocker{})
+			driver.config.FollowBackendSchedule = tt.follow
+
+			driver.trackSecret(secrets.Request{SecretName: "db_password", SecretLabels: map[string]string{}}, []byte("first"), driver.provider, "fake")
+			driver.applySchedule(context.Background(), "db_password", provider)
+
+			secretInfo := driver.secretTracker["db_password"]
+			if secretInfo.CheckInterval != tt.wantInterval {
+				t.Errorf("CheckInterval = %v, expected %v", secretInfo.CheckInterval, tt.wantInterval)
+			}
+			// A scheduled secret is first checked one interval from now
+			if due := driver.scheduleDue(secretInfo); due != (tt.wantInterval == 0) {
+				t.Errorf("scheduleDue() = %v, expected %v", due, tt.wantInterval == 0)
+			}
+		})
+	}
+}
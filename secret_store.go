@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// SecretStore is where the driver writes rotated secret versions and the
+// services consuming them; Swarm is the default, other orchestrators can
+// implement it
+type SecretStore interface {
+	// ListSecrets returns the secrets whose name starts with name
+	ListSecrets(ctx context.Context, name string) ([]swarm.Secret, error)
+	// CreateSecret creates a secret and returns its ID
+	CreateSecret(ctx context.Context, spec swarm.SecretSpec) (string, error)
+	RemoveSecret(ctx context.Context, id string) error
+	// ListServices returns the named services, or every service when none are given
+	ListServices(ctx context.Context, serviceNames []string) ([]swarm.Service, error)
+	// ListLabeledServices returns the services carrying label, given as
+	// key=value or a bare key, or every service when label is empty
+	ListLabeledServices(ctx context.Context, label string) ([]swarm.Service, error)
+	// UpdateService applies spec to the service and returns any warnings
+	UpdateService(ctx context.Context, service swarm.Service, spec swarm.ServiceSpec) ([]string, error)
+	// ListTasks returns the tasks of the named service that should be running
+	ListTasks(ctx context.Context, serviceName string) ([]swarm.Task, error)
+	// Exec runs a command in a task's container and returns its exit code
+	Exec(ctx context.Context, containerID string, cmd []string) (int, error)
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// dockerSecretStore implements SecretStore on top of the Docker Swarm API
+type dockerSecretStore struct {
+	client dockerAPI
+}
+
+// newDockerSecretStore wraps a Docker client as a SecretStore
+func newDockerSecretStore(client dockerAPI) *dockerSecretStore {
+	return &dockerSecretStore{client: client}
+}
+
+// ListSecrets lists secrets with the name filter, which matches by prefix
+func (s *dockerSecretStore) ListSecrets(ctx context.Context, name string) ([]swarm.Secret, error) {
+	return s.client.SecretList(ctx, swarm.SecretListOptions{
+		Filters: filters.NewArgs(filters.Arg("name", name)),
+	})
+}
+
+// CreateSecret creates a Swarm secret
+func (s *dockerSecretStore) CreateSecret(ctx context.Context, spec swarm.SecretSpec) (string, error) {
+	response, err := s.client.SecretCreate(ctx, spec)
+	if err != nil {
+		return "", err
+	}
+	return response.ID, nil
+}
+
+// RemoveSecret removes a Swarm secret by ID
+func (s *dockerSecretStore) RemoveSecret(ctx context.Context, id string) error {
+	return s.client.SecretRemove(ctx, id)
+}
+
+// ListServices lists the named Swarm services
+func (s *dockerSecretStore) ListServices(ctx context.Context, serviceNames []string) ([]swarm.Service, error) {
+	return s.client.ServiceList(ctx, serviceListOptions(serviceNames))
+}
+
+// ListLabeledServices lists the Swarm services carrying a label
+func (s *dockerSecretStore) ListLabeledServices(ctx context.Context, label string) ([]swarm.Service, error) {
+	return s.client.ServiceList(ctx, serviceLabelOptions(label))
+}
+
+// UpdateService updates a Swarm service at the version it was listed with
+func (s *dockerSecretStore) UpdateService(ctx context.Context, service swarm.Service, spec swarm.ServiceSpec) ([]string, error) {
+	response, err := s.client.ServiceUpdate(ctx, service.ID, service.Version, spec, swarm.ServiceUpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return response.Warnings, nil
+}
+
+// ListTasks lists the tasks of a Swarm service whose desired state is running
+func (s *dockerSecretStore) ListTasks(ctx context.Context, serviceName string) ([]swarm.Task, error) {
+	return s.client.TaskList(ctx, swarm.TaskListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("service", serviceName),
+			filters.Arg("desired-state", "running"),
+		),
+	})
+}
+
+// Exec runs a command in a local container and waits for it to exit
+func (s *dockerSecretStore) Exec(ctx context.Context, containerID string, cmd []string) (int, error) {
+	created, err := s.client.ContainerExecCreate(ctx, containerID, container.ExecOptions{Cmd: cmd})
+	if err != nil {
+		return 0, err
+	}
+	if err := s.client.ContainerExecStart(ctx, created.ID, container.ExecStartOptions{Detach: true}); err != nil {
+		return 0, err
+	}
+
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		inspected, err := s.client.ContainerExecInspect(ctx, created.ID)
+		if err != nil {
+			return 0, err
+		}
+		if !inspected.Running {
+			return inspected.ExitCode, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Ping checks that the Docker daemon is reachable
+func (s *dockerSecretStore) Ping(ctx context.Context) error {
+	_, err := s.client.Ping(ctx)
+	return err
+}
+
+// Close releases the Docker client
+func (s *dockerSecretStore) Close() error {
+	return s.client.Close()
+}
+
+// serviceListOptions filters a service listing down to the given service names
+func serviceListOptions(serviceNames []string) swarm.ServiceListOptions {
+	args := filters.NewArgs()
+	for _, name := range serviceNames {
+		if name != "" {
+			args.Add("name", name)
+		}
+	}
+	return swarm.ServiceListOptions{Filters: args}
+}
+
+// serviceLabelOptions filters a service listing down to the services carrying label
+func serviceLabelOptions(label string) swarm.ServiceListOptions {
+	args := filters.NewArgs()
+	if label != "" {
+		args.Add("label", label)
+	}
+	return swarm.ServiceListOptions{Filters: args}
+}
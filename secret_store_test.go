@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+func TestDockerSecretStoreListServices(t *testing.T) {
+	docker := &fakeDocker{
+		services: []swarm.Service{
+			testService("1", "api", map[string]string{"tier": "web"}),
+			testService("2", "worker", map[string]string{"tier": "batch", "rotate": "true"}),
+			testService("3", "api-canary", map[string]string{"rotate": "true"}),
+		},
+	}
+	store := newDockerSecretStore(docker)
+
+	tests := []struct {
+		name  string
+		list  func() ([]swarm.Service, error)
+		names []string
+	}{
+		{"all services", func() ([]swarm.Service, error) {
+			return store.ListServices(context.Background(), nil)
+		}, []string{"api", "api-canary", "worker"}},
+		{"by name", func() ([]swarm.Service, error) {
+			return store.ListServices(context.Background(), []string{"api", ""})
+		}, []string{"api"}},
+		{"every service without a label", func() ([]swarm.Service, error) {
+			return store.ListLabeledServices(context.Background(), "")
+		}, []string{"api", "api-canary", "worker"}},
+		{"bare label", func() ([]swarm.Service, error) {
+			return store.ListLabeledServices(context.Background(), "rotate")
+		}, []string{"api-canary", "worker"}},
+		{"label with value", func() ([]swarm.Service, error) {
+			return store.ListLabeledServices(context.Background(), "tier=web")
+		}, []string{"api"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services, err := tt.list()
+			if err != nil {
+				t.Fatalf("listing failed: %v", err)
+			}
+			var names []string
+			for _, service := range services {
+				names = append(names, service.Spec.Name)
+			}
+			sort.Strings(names)
+			if !slices.Equal(names, tt.names) {
+				t.Errorf("listed %v, expected %v", names, tt.names)
+			}
+		})
+	}
+}
+
+func TestDockerSecretStoreSecrets(t *testing.T) {
+	docker := &fakeDocker{
+		secrets: []swarm.Secret{
+			testSecret("1", "db_password", nil),
+			testSecret("2", "db_password-1760000000000000000", nil),
+			testSecret("3", "api_key", nil),
+		},
+	}
+	store := newDockerSecretStore(docker)
+	ctx := context.Background()
+
+	// The name filter matches by prefix, callers check exact names
+	listed, err := store.ListSecrets(ctx, "db_password")
+	if err != nil {
+		t.Fatalf("ListSecrets() error = %v", err)
+	}
+	if len(listed) != 2 {
+		t.Errorf("ListSecrets() returned %d secrets, expected 2", len(listed))
+	}
+
+	id, err := store.CreateSecret(ctx, swarm.SecretSpec{Annotations: swarm.Annotations{Name: "token"}, Data: []byte("value")})
+	if err != nil {
+		t.Fatalf("CreateSecret() error = %v", err)
+	}
+	if created, exists := docker.secretNamed("token"); !exists || created.ID != id {
+		t.Errorf("CreateSecret() returned ID %q, the daemon holds %+v", id, created)
+	}
+
+	if err := store.RemoveSecret(ctx, "3"); err != nil {
+		t.Fatalf("RemoveSecret() error = %v", err)
+	}
+	if _, exists := docker.secretNamed("api_key"); exists {
+		t.Errorf("api_key was not removed")
+	}
+}
+
+func TestDockerSecretStoreUpdateService(t *testing.T) {
+	docker := &fakeDocker{services: []swarm.Service{testService("svc", "api", nil)}}
+	store := newDockerSecretStore(docker)
+	ctx := context.Background()
+
+	listed := docker.serviceNamed(t, "api")
+	spec := listed.Spec
+	spec.Labels = map[string]string{"updated": "true"}
+	if _, err := store.UpdateService(ctx, listed, spec); err != nil {
+		t.Fatalf("UpdateService() error = %v", err)
+	}
+	if docker.serviceNamed(t, "api").Spec.Labels["updated"] != "true" {
+		t.Errorf("service spec was not updated")
+	}
+
+	// The update is made at the listed version, so a stale listing fails
+	// instead of overwriting a concurrent change
+	if _, err := store.UpdateService(ctx, listed, spec); err == nil {
+		t.Errorf("UpdateService() with a stale version succeeded")
+	}
+}
+
+func TestUpdateServicesSecretReference(t *testing.T) {
+	tests := []struct {
+		name        string
+		service     swarm.Service
+		activeGroup string
+		markRotated bool
+		wantMoved   bool
+		wantMarked  bool
+	}{
+		{"referencing service", testService("svc", "api", nil, secretRef("old", "db_password")), "", true, true, true},
+		{"without rotation label", testService("svc", "api", nil, secretRef("old", "db_password")), "", false, true, false},
+		{"unrelated service", testService("svc", "api", nil, secretRef("other", "api_key")), "", true, false, false},
+		{"same name, other secret", testService("svc", "api", nil, secretRef("other", "db_password")), "", true, false, false},
+		{"active group", testService("svc", "api", map[string]string{"rotation_group": "blue"}, secretRef("old", "db_password")), "blue", true, true, true},
+		{"inactive group", testService("svc", "api", map[string]string{"rotation_group": "green"}, secretRef("old", "db_password")), "blue", true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := &fakeDocker{services: []swarm.Service{tt.service}}
+			driver := newTestDriver(&fakeProvider{}, docker)
+			driver.config.RotationActiveGroup = tt.activeGroup
+
+			err := driver.updateServicesSecretReference(map[string]bool{"old": true}, "db_password-1760000000000000000", "new", tt.markRotated, nil)
+			if err != nil {
+				t.Fatalf("updateServicesSecretReference() error = %v", err)
+			}
+
+			service := docker.serviceNamed(t, "api")
+			ref := service.Spec.TaskTemplate.ContainerSpec.Secrets[0]
+			if moved := ref.SecretID == "new"; moved != tt.wantMoved {
+				t.Errorf("service references %s (%s), expected moved = %v", ref.SecretName, ref.SecretID, tt.wantMoved)
+			}
+			if tt.wantMoved && (ref.File == nil || ref.File.Name != tt.service.Spec.TaskTemplate.ContainerSpec.Secrets[0].File.Name) {
+				t.Errorf("secret target changed to %+v", ref.File)
+			}
+			if _, marked := service.Spec.Labels["vault.secret.rotated"]; marked != tt.wantMarked {
+				t.Errorf("rotation label present = %v, expected %v", marked, tt.wantMarked)
+			}
+		})
+	}
+}
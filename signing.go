@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/api/types/swarm"
+	log "github.com/sirupsen/logrus"
+)
+
+// signatureSuffix names the companion secret holding the signature of a
+// secret with emit_signature=true, e.g. db_password-sig
+const signatureSuffix = "-sig"
+
+// signedSecretLabel is set on signature secrets to the secret they sign
+const signedSecretLabel = "secrets.signature.of"
+
+// loadSigningKey reads an Ed25519 private key in PKCS #8 PEM form, as written
+// by openssl genpkey -algorithm ed25519
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s does not contain a PEM encoded private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	signingKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is a %T, not Ed25519", key)
+	}
+	return signingKey, nil
+}
+
+// wantsSignature reports whether the secret asks for a signature secret
+func (d *SecretsDriver) wantsSignature(labels map[string]string) bool {
+	return d.signingKey != nil && strings.ToLower(labels["emit_signature"]) == "true"
+}
+
+// publishSignature signs the delivered value of a secret and stores the
+// detached signature as the <name>-sig secret. Ed25519 signatures are
+// deterministic, so an unchanged value leaves the signature secret alone.
+func (d *SecretsDriver) publishSignature(ctx context.Context, secretName string, value []byte) error {
+	signature := ed25519.Sign(d.signingKey, value)
+	checksum := contentChecksum(signature)
+	signatureName := secretName + signatureSuffix
+
+	secrets, err := d.store.ListSecrets(ctx, signatureName)
+	d.recordDockerAPICall("SecretList", err)
+	if err != nil {
+		return fmt.Errorf("failed to list secrets: %v", err)
+	}
+
+	var current *swarm.Secret
+	for i, secret := range secrets {
+		if secret.Spec.Name != signatureName && !isSecretVersion(signatureName, secret) {
+			continue
+		}
+		if current == nil || secret.CreatedAt.After(current.CreatedAt) {
+			current = &secrets[i]
+		}
+	}
+
+	if current != nil {
+		if current.Spec.Labels[checksumLabel] == checksum {
+			return nil
+		}
+		// Rotating keeps the services using the signature on the value they get
+		return d.updateDockerSecret(signatureName, signature)
+	}
+
+	// The checksum label lets later requests see whether the signature changed
+	labels := map[string]string{
+		signedSecretLabel: secretName,
+		"emit_checksum":   "true",
+		checksumLabel:     checksum,
+	}
+	if d.config.ManagedSecretLabel != "" {
+		key, value, _ := strings.Cut(d.config.ManagedSecretLabel, "=")
+		labels[key] = value
+	}
+
+	_, err = d.store.CreateSecret(ctx, swarm.SecretSpec{
+		Annotations: swarm.Annotations{
+			Name:   signatureName,
+			Labels: labels,
+		},
+		Data: signature,
+	})
+	d.recordDockerAPICall("SecretCreate", err)
+	if err != nil {
+		return fmt.Errorf("failed to create signature secret %s: %v", signatureName, err)
+	}
+	log.Printf("Created signature secret %s for %s", signatureName, secretName)
+	return nil
+}
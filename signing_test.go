@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// writeKey stores a private key as PKCS #8 PEM and returns its path
+func writeKey(t *testing.T, key any) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "signing.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+	ecdsaKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	notPEM := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(notPEM, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{"ed25519", writeKey(t, ed25519Key), false},
+		{"ecdsa", writeKey(t, ecdsaKey), true},
+		{"not PEM", notPEM, true},
+		{"missing file", filepath.Join(t.TempDir(), "missing.pem"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := loadSigningKey(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadSigningKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !key.Equal(ed25519Key) {
+				t.Errorf("loadSigningKey() returned another key")
+			}
+		})
+	}
+}
+
+func TestSignatureVerifies(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	signingKey, err := loadSigningKey(writeKey(t, privateKey))
+	if err != nil {
+		t.Fatalf("loadSigningKey() error = %v", err)
+	}
+
+	docker := &fakeDocker{}
+	provider := &fakeProvider{values: map[string]string{"db": "first", "api": "key"}}
+	driver := newTestDriver(provider, docker)
+	driver.signingKey = signingKey
+
+	// verify checks the current signature secret of name against value
+	verify := func(name, value string) {
+		t.Helper()
+		var signature *swarm.Secret
+		for _, secret := range docker.secretsWithPrefix(name + signatureSuffix) {
+			if signature == nil || secret.CreatedAt.After(signature.CreatedAt) {
+				signature = &secret
+			}
+		}
+		if signature == nil {
+			t.Fatalf("no signature secret for %s", name)
+		}
+		if !ed25519.Verify(publicKey, []byte(value), signature.Spec.Data) {
+			t.Errorf("signature in %s does not verify %q", signature.Spec.Name, value)
+		}
+		if of := signature.Spec.Labels[signedSecretLabel]; of != name {
+			t.Errorf("%s=%q, expected %q", signedSecretLabel, of, name)
+		}
+	}
+
+	labels := map[string]string{"fake_path": "db", "emit_signature": "true"}
+	if response := driver.Get(secrets.Request{SecretName: "db_password", SecretLabels: labels}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	verify("db_password", "first")
+
+	// An unchanged value keeps its signature secret
+	if response := driver.Get(secrets.Request{SecretName: "db_password", SecretLabels: labels}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	if docker.created != 1 {
+		t.Errorf("created %d secrets for an unchanged value, expected 1", docker.created)
+	}
+
+	provider.set("db", "second")
+	if response := driver.Get(secrets.Request{SecretName: "db_password", SecretLabels: labels}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	verify("db_password", "second")
+
+	if response := driver.Get(secrets.Request{SecretName: "api_key", SecretLabels: map[string]string{"fake_path": "api"}}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	if signatures := docker.secretsWithPrefix("api_key" + signatureSuffix); len(signatures) != 0 {
+		t.Errorf("signed a secret without emit_signature: %v", signatures)
+	}
+}
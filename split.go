@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// parseSplitLabel parses the split label, a comma separated list of
+// field:companion_secret pairs, into a map of companion secret name to field
+func parseSplitLabel(label string) (map[string]string, error) {
+	targets := make(map[string]string)
+	for _, pair := range strings.Split(label, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid split entry %q, expected field:secret_name", pair)
+		}
+		targets[strings.TrimSpace(parts[1])] = strings.TrimSpace(parts[0])
+	}
+	return targets, nil
+}
+
+// readSplitValues reads every companion field of a split secret from its provider
+func (d *SecretsDriver) readSplitValues(ctx context.Context, req secrets.Request, targets map[string]string, provider providers.SecretsProvider) (map[string][]byte, error) {
+	fieldLabel := provider.FieldLabelKey()
+	values := make(map[string][]byte, len(targets))
+
+	for companion, field := range targets {
+		companionReq := secrets.Request{
+			SecretName:   req.SecretName,
+			ServiceName:  req.ServiceName,
+			SecretLabels: copyLabels(req.SecretLabels),
+		}
+		delete(companionReq.SecretLabels, "all_fields")
+		companionReq.SecretLabels[fieldLabel] = field
+
+		value, err := provider.GetSecret(ctx, companionReq)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read field %s for companion secret %s: %v", field, companion, err)
+		}
+		values[companion] = value
+	}
+
+	return values, nil
+}
+
+// splitHashes hashes companion values for change detection
+func splitHashes(values map[string][]byte) map[string]string {
+	hashes := make(map[string]string, len(values))
+	for companion, value := range values {
+		hashes[companion] = providers.HashValue(value)
+	}
+	return hashes
+}
+
+// hasSplitChanged reports whether any companion field of a split secret changed
+func (d *SecretsDriver) hasSplitChanged(ctx context.Context, secretInfo *providers.SecretInfo, provider providers.SecretsProvider) bool {
+	d.trackerMutex.RLock()
+	companions := make([]providers.SecretInfo, 0, len(secretInfo.SplitTargets))
+	for companion, field := range secretInfo.SplitTargets {
+		companionInfo := *secretInfo
+		companionInfo.DockerSecretName = companion
+		companionInfo.SecretField = field
+		companionInfo.LastHash = secretInfo.SplitHashes[companion]
+		companionInfo.AllFields = false
+		companions = append(companions, companionInfo)
+	}
+	d.trackerMutex.RUnlock()
+
+	for i := range companions {
+		changed, err := provider.CheckSecretChanged(ctx, &companions[i])
+		if err != nil {
+			log.Errorf("Error checking companion secret %s of %s: %v", companions[i].DockerSecretName, secretInfo.DockerSecretName, err)
+			continue
+		}
+		if changed {
+			return true
+		}
+	}
+	return false
+}
+
+// rotateSplitSecrets updates every companion Docker secret from the source secret
+func (d *SecretsDriver) rotateSplitSecrets(ctx context.Context, req secrets.Request, secretInfo *providers.SecretInfo, provider providers.SecretsProvider) error {
+	values, err := d.readSplitValues(ctx, req, secretInfo.SplitTargets, provider)
+	if err != nil {
+		return err
+	}
+
+	for companion, value := range values {
+		if err := d.updateDockerSecret(companion, value); err != nil {
+			return fmt.Errorf("failed to update companion secret %s: %v", companion, err)
+		}
+		log.Printf("Rotated companion secret %s from %s", companion, secretInfo.DockerSecretName)
+	}
+
+	d.trackerMutex.Lock()
+	secretInfo.SplitHashes = splitHashes(values)
+	d.trackerMutex.Unlock()
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-plugins-helpers/secrets"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// fieldProvider is a fakeProvider holding JSON objects, it serves the field
+// named by the fake_field label or the whole object without one
+type fieldProvider struct {
+	*fakeProvider
+}
+
+func (p *fieldProvider) GetSecret(ctx context.Context, req secrets.Request) ([]byte, error) {
+	value, err := p.fakeProvider.GetSecret(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return jsonField(value, req.SecretLabels[p.FieldLabelKey()])
+}
+
+func (p *fieldProvider) CheckSecretChanged(ctx context.Context, secretInfo *providers.SecretInfo) (bool, error) {
+	p.mutex.Lock()
+	value, exists := p.values[secretInfo.SecretPath]
+	p.mutex.Unlock()
+	if !exists {
+		return false, fmt.Errorf("secret %s not found", secretInfo.SecretPath)
+	}
+	current, err := jsonField([]byte(value), secretInfo.SecretField)
+	if err != nil {
+		return false, err
+	}
+	return providers.HashValue(current) != secretInfo.LastHash, nil
+}
+
+// jsonField returns one field of a JSON object, or the whole value for the default field
+func jsonField(value []byte, field string) ([]byte, error) {
+	if field == "" || field == "value" {
+		return value, nil
+	}
+	var data map[string]string
+	if err := json.Unmarshal(value, &data); err != nil {
+		return nil, err
+	}
+	fieldValue, exists := data[field]
+	if !exists {
+		return nil, fmt.Errorf("field %s not found", field)
+	}
+	return []byte(fieldValue), nil
+}
+
+func TestSplitCertificatePair(t *testing.T) {
+	labels := map[string]string{"fake_path": "tls", "split": "cert:tls_cert, key:tls_key"}
+	docker := &fakeDocker{
+		secrets: []swarm.Secret{
+			testSecret("source", "tls", labels),
+			testSecret("cert", "tls_cert", nil),
+			testSecret("key", "tls_key", nil),
+		},
+		services: []swarm.Service{testService("svc", "proxy", nil,
+			secretRef("cert", "tls_cert"), secretRef("key", "tls_key"))},
+	}
+	provider := &fieldProvider{&fakeProvider{values: map[string]string{"tls": `{"cert": "cert-1", "key": "key-1"}`}}}
+	driver := newTestDriver(provider, docker)
+
+	if response := driver.Get(secrets.Request{SecretName: "tls", ServiceName: "proxy", SecretLabels: labels}); response.Err != "" {
+		t.Fatalf("Get failed: %s", response.Err)
+	}
+	secretInfo := driver.secretTracker["tls"]
+	if len(secretInfo.SplitTargets) != 2 || secretInfo.SplitTargets["tls_cert"] != "cert" || secretInfo.SplitTargets["tls_key"] != "key" {
+		t.Fatalf("split targets = %v, expected tls_cert from cert and tls_key from key", secretInfo.SplitTargets)
+	}
+
+	provider.set("tls", `{"cert": "cert-2", "key": "key-2"}`)
+	driver.checkForSecretChanges()
+
+	tests := []struct {
+		companion string
+		want      string
+	}{
+		{"tls_cert", "cert-2"},
+		{"tls_key", "key-2"},
+	}
+	refs := docker.serviceNamed(t, "proxy").Spec.TaskTemplate.ContainerSpec.Secrets
+	for _, tt := range tests {
+		versions := docker.secretsWithPrefix(tt.companion + "-")
+		if len(versions) != 1 {
+			t.Fatalf("expected one new version of %s, found %d", tt.companion, len(versions))
+		}
+		if string(versions[0].Spec.Data) != tt.want {
+			t.Errorf("%s holds %q, expected %q", versions[0].Spec.Name, versions[0].Spec.Data, tt.want)
+		}
+		if !slices.ContainsFunc(refs, func(ref *swarm.SecretReference) bool { return ref.SecretID == versions[0].ID }) {
+			t.Errorf("proxy does not reference the new %s version", tt.companion)
+		}
+	}
+}
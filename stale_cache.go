@@ -0,0 +1,151 @@
+package main
+
+import (
+	"container/list"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// staleCache keeps the last value read for each secret in memory, so Get can
+// serve it while the backend is unreachable. Values are never persisted and
+// expire ttl after they were read. When a size limit is set the least
+// recently used values are evicted first.
+type staleCache struct {
+	mu         sync.Mutex
+	maxEntries int           // 0 means no entry limit
+	maxBytes   int64         // 0 means no size limit
+	ttl        time.Duration // 0 means values never expire
+	bytes      int64
+	evictions  int64
+	order      *list.List               // most recently used first
+	entries    map[string]*list.Element // key: secret name, service and labels
+}
+
+// staleEntry is one cached value
+type staleEntry struct {
+	key       string
+	value     []byte
+	fetchedAt time.Time
+}
+
+// newStaleCache creates an empty last-known value cache with the given limits
+func newStaleCache(maxEntries int, maxBytes int64, ttl time.Duration) *staleCache {
+	return &staleCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ttl:        ttl,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// staleCacheKey identifies a request by the secret, the service and the
+// labels it resolved to, since labels from the service or task may change the
+// backend path
+func staleCacheKey(req secrets.Request) string {
+	keys := make([]string, 0, len(req.SecretLabels))
+	for key := range req.SecretLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(req.SecretName + "\x00" + req.ServiceName)
+	for _, key := range keys {
+		b.WriteString("\x00" + key + "=" + req.SecretLabels[key])
+	}
+	return b.String()
+}
+
+// store remembers the value just read for a request
+func (c *staleCache) store(req secrets.Request, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeExpired()
+	key := staleCacheKey(req)
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	// A value larger than the whole cache would evict everything else
+	if c.maxBytes > 0 && int64(len(value)) > c.maxBytes {
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&staleEntry{key: key, value: append([]byte(nil), value...), fetchedAt: time.Now()})
+	c.bytes += int64(len(value))
+
+	for (c.maxEntries > 0 && c.order.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+}
+
+// load returns the last value read for a request, unless it has expired
+func (c *staleCache) load(req secrets.Request) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[staleCacheKey(req)]
+	if !ok {
+		return nil, false
+	}
+	if c.expired(elem.Value.(*staleEntry)) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*staleEntry).value, true
+}
+
+// forget drops the values of a secret for every service and reports whether
+// any was cached
+func (c *staleCache) forget(secretName string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	found := false
+	for key, elem := range c.entries {
+		if name, _, _ := strings.Cut(key, "\x00"); name == secretName {
+			c.remove(elem)
+			found = true
+		}
+	}
+	return found
+}
+
+// stats returns the number of cached values, their total size and how many
+// values were evicted so far
+func (c *staleCache) stats() (int, int64, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len(), c.bytes, c.evictions
+}
+
+// expired reports whether an entry is older than the ttl
+func (c *staleCache) expired(entry *staleEntry) bool {
+	return c.ttl > 0 && time.Since(entry.fetchedAt) > c.ttl
+}
+
+// removeExpired drops every expired entry, the caller must hold mu
+func (c *staleCache) removeExpired() {
+	if c.ttl <= 0 {
+		return
+	}
+	for _, elem := range c.entries {
+		if c.expired(elem.Value.(*staleEntry)) {
+			c.remove(elem)
+		}
+	}
+}
+
+// remove drops an entry, the caller must hold mu
+func (c *staleCache) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*staleEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= int64(len(entry.value))
+}
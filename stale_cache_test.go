@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+func TestStaleCache(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxEntries int
+		maxBytes   int64
+		ttl        time.Duration
+		age        time.Duration // how long ago db_password was read
+		wantValue  bool
+		wantCached int
+	}{
+		{"fresh value", 0, 0, time.Hour, time.Minute, true, 2},
+		{"expired value is refused and evicted", 0, 0, time.Hour, 2 * time.Hour, false, 1},
+		{"no ttl keeps values", 0, 0, 0, 48 * time.Hour, true, 2},
+		{"entry limit evicts least recently used", 1, 0, 0, 0, false, 1},
+		{"size limit evicts least recently used", 0, 8, 0, 0, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newStaleCache(tt.maxEntries, tt.maxBytes, tt.ttl)
+			req := secrets.Request{SecretName: "db_password", ServiceName: "api"}
+			other := secrets.Request{SecretName: "api_key", ServiceName: "api"}
+
+			cache.store(req, []byte("first"))
+			cache.entries[staleCacheKey(req)].Value.(*staleEntry).fetchedAt = time.Now().Add(-tt.age)
+			cache.store(other, []byte("other"))
+
+			value, ok := cache.load(req)
+			if ok != tt.wantValue {
+				t.Fatalf("load() found = %v, expected %v", ok, tt.wantValue)
+			}
+			if ok && string(value) != "first" {
+				t.Errorf("load() = %q, expected %q", value, "first")
+			}
+			if entries, _, _ := cache.stats(); entries != tt.wantCached {
+				t.Errorf("%d values cached, expected %d", entries, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestStaleCacheStoreDropsExpired(t *testing.T) {
+	cache := newStaleCache(0, 0, time.Hour)
+	req := secrets.Request{SecretName: "db_password"}
+	cache.store(req, []byte("first"))
+	cache.entries[staleCacheKey(req)].Value.(*staleEntry).fetchedAt = time.Now().Add(-2 * time.Hour)
+
+	// Expired values are dropped even when they are never requested again
+	cache.store(secrets.Request{SecretName: "api_key"}, []byte("other"))
+	if entries, bytes, _ := cache.stats(); entries != 1 || bytes != int64(len("other")) {
+		t.Errorf("cache holds %d values of %d bytes, expected only api_key", entries, bytes)
+	}
+}
+
+func TestStaleValueServedOnError(t *testing.T) {
+	tests := []struct {
+		name      string
+		cache     bool
+		err       error
+		wantStale bool
+	}{
+		{"backend unreachable", true, errors.New("connection refused"), true},
+		{"secret deleted", true, &providers.ProviderError{Kind: providers.ErrorKindNotFound, Err: errors.New("secret not found")}, false},
+		{"stale values disabled", false, errors.New("connection refused"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &failingProvider{fakeProvider: &fakeProvider{values: map[string]string{"db_password": "first"}}}
+			driver := newTestDriver(provider, &fakeDocker{})
+			if tt.cache {
+				driver.staleValues = newStaleCache(0, 0, time.Hour)
+			}
+			req := secrets.Request{SecretName: "db_password", ServiceName: "api"}
+			if response := driver.Get(req); response.Err != "" {
+				t.Fatalf("Get failed: %s", response.Err)
+			}
+			trackedHash := driver.secretTracker["db_password"].LastHash
+
+			provider.err = tt.err
+			response := driver.Get(req)
+			if tt.wantStale {
+				if response.Err != "" || string(response.Value) != "first" {
+					t.Errorf("Get() = %q, %q, expected the last known value", response.Value, response.Err)
+				}
+			} else if response.Err == "" {
+				t.Errorf("Get() = %q, expected the provider error", response.Value)
+			}
+			if hash := driver.secretTracker["db_password"].LastHash; hash != trackedHash {
+				t.Error("failed read changed the tracked hash")
+			}
+		})
+	}
+}
+
+func TestStaleValuePerResolvedPath(t *testing.T) {
+	provider := &failingProvider{fakeProvider: &fakeProvider{values: map[string]string{"prod/db": "prod", "dev/db": "dev"}}}
+	driver := newTestDriver(provider, &fakeDocker{})
+	driver.staleValues = newStaleCache(0, 0, time.Hour)
+
+	// Both services read db_password, each from the path its labels select
+	requests := map[string]secrets.Request{
+		"prod": {SecretName: "db_password", ServiceName: "api", ServiceLabels: map[string]string{"secrets.db_password.fake_path": "prod/db"}},
+		"dev":  {SecretName: "db_password", ServiceName: "api", ServiceLabels: map[string]string{"secrets.db_password.fake_path": "dev/db"}},
+	}
+	for want, req := range requests {
+		if response := driver.Get(req); response.Err != "" || string(response.Value) != want {
+			t.Fatalf("Get() = %q, %q, expected %q", response.Value, response.Err, want)
+		}
+	}
+
+	provider.err = errors.New("connection refused")
+	for want, req := range requests {
+		if response := driver.Get(req); response.Err != "" || string(response.Value) != want {
+			t.Errorf("Get() = %q, %q, expected the last known value %q", response.Value, response.Err, want)
+		}
+	}
+	if _, tracked := driver.secretTracker["db_password"]; tracked {
+		t.Errorf("secret resolved per service is tracked for rotation")
+	}
+}
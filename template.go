@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// templateLabel holds a text/template rendered from the fields of the secret,
+// e.g. "{{.username}}:{{.password}}@{{.host}}"
+const templateLabel = "secret_template"
+
+// templateRequest returns the request to send to the provider. A templated
+// secret needs the whole object, not a single field.
+func templateRequest(req secrets.Request) secrets.Request {
+	if _, exists := req.SecretLabels[templateLabel]; !exists {
+		return req
+	}
+	fullReq := req
+	fullReq.SecretLabels = copyLabels(req.SecretLabels)
+	fullReq.SecretLabels["all_fields"] = "true"
+	return fullReq
+}
+
+// renderSecretTemplate renders the template label of req with the fields of
+// the secret object. Without a template the value is returned unchanged.
+func renderSecretTemplate(req secrets.Request, value []byte) ([]byte, error) {
+	text, exists := req.SecretLabels[templateLabel]
+	if !exists {
+		return value, nil
+	}
+
+	// Referencing a field the secret does not have is an error rather than "<no value>"
+	tmpl, err := template.New(req.SecretName).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s label: %v", templateLabel, err)
+	}
+
+	// Keep numbers as written instead of rendering them as floats
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("secret is not a JSON object, cannot render %s: %v", templateLabel, err)
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, fields); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %v", templateLabel, err)
+	}
+	return rendered.Bytes(), nil
+}
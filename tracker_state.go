@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// encryptedStateMagic prefixes tracker state files written with TRACKER_STATE_KEY
+var encryptedStateMagic = []byte("SESTATE1")
+
+// newStateCipher derives an AES-256-GCM cipher from the configured key
+func newStateCipher(key string) (cipher.AEAD, error) {
+	derived := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(derived[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encodeTrackerState serializes tracked secrets, encrypting them when a key is set
+func encodeTrackerState(tracker map[string]*providers.SecretInfo, key string) ([]byte, error) {
+	data, err := json.Marshal(tracker)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode tracker state: %v", err)
+	}
+	if key == "" {
+		return data, nil
+	}
+
+	gcm, err := newStateCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracker state cipher: %v", err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate tracker state nonce: %v", err)
+	}
+
+	out := append([]byte{}, encryptedStateMagic...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, encryptedStateMagic), nil
+}
+
+// decodeTrackerState parses a tracker state file, decrypting it when it was written encrypted
+func decodeTrackerState(raw []byte, key string) (map[string]*providers.SecretInfo, error) {
+	data := raw
+	if bytes.HasPrefix(raw, encryptedStateMagic) {
+		if key == "" {
+			return nil, errors.New("tracker state is encrypted but TRACKER_STATE_KEY is not set")
+		}
+		gcm, err := newStateCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tracker state cipher: %v", err)
+		}
+		body := raw[len(encryptedStateMagic):]
+		if len(body) < gcm.NonceSize() {
+			return nil, errors.New("tracker state file is truncated")
+		}
+		nonce, ciphertext := body[:gcm.NonceSize()], body[gcm.NonceSize():]
+		data, err = gcm.Open(nil, nonce, ciphertext, encryptedStateMagic)
+		if err != nil {
+			return nil, errors.New("failed to decrypt tracker state: wrong TRACKER_STATE_KEY or corrupted file")
+		}
+	} else if key != "" {
+		// Plain files from before encryption was enabled are re-written encrypted on next save
+		log.Warnf("Tracker state file is not encrypted, it will be encrypted on the next save")
+	}
+
+	tracker := make(map[string]*providers.SecretInfo)
+	if err := json.Unmarshal(data, &tracker); err != nil {
+		return nil, fmt.Errorf("failed to parse tracker state: %v", err)
+	}
+	return tracker, nil
+}
+
+// loadTrackerState restores tracked secrets from the configured state file
+func (d *SecretsDriver) loadTrackerState() error {
+	if d.config.TrackerStateFile == "" {
+		return nil
+	}
+
+	raw, err := os.ReadFile(d.config.TrackerStateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read tracker state: %v", err)
+	}
+
+	tracker, err := decodeTrackerState(raw, d.config.TrackerStateKey)
+	if err != nil {
+		return err
+	}
+
+	// Checking them with another provider would read the wrong backend
+	for name, secretInfo := range tracker {
+		if instance := d.providerInstance(secretInfo.Labels); secretInfo.Provider != "" && secretInfo.Provider != instance {
+			log.Warnf("Dropping tracked secret %s of the %s provider, its labels now select %s",
+				name, secretInfo.Provider, instance)
+			delete(tracker, name)
+		}
+	}
+
+	d.trackerMutex.Lock()
+	d.secretTracker = tracker
+	d.trackerMutex.Unlock()
+
+	log.Printf("Restored %d tracked secrets from %s", len(tracker), d.config.TrackerStateFile)
+	return nil
+}
+
+// saveTrackerState writes tracked secrets to the configured state file
+func (d *SecretsDriver) saveTrackerState() {
+	if d.config.TrackerStateFile == "" {
+		return
+	}
+
+	d.trackerMutex.RLock()
+	raw, err := encodeTrackerState(d.secretTracker, d.config.TrackerStateKey)
+	d.trackerMutex.RUnlock()
+	if err != nil {
+		log.Errorf("Failed to save tracker state: %v", err)
+		return
+	}
+
+	// Write through a temp file so a crash never leaves a half written state
+	tmp, err := os.CreateTemp(filepath.Dir(d.config.TrackerStateFile), ".tracker-state-*")
+	if err != nil {
+		log.Errorf("Failed to save tracker state: %v", err)
+		return
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(raw); err != nil {
+		_ = tmp.Close()
+		log.Errorf("Failed to save tracker state: %v", err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		log.Errorf("Failed to save tracker state: %v", err)
+		return
+	}
+	if err := os.Rename(tmp.Name(), d.config.TrackerStateFile); err != nil {
+		log.Errorf("Failed to save tracker state: %v", err)
+	}
+}
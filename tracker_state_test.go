@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+func TestEncryptedTrackerState(t *testing.T) {
+	docker := &fakeDocker{}
+	driver := newTestDriver(&fakeProvider{values: map[string]string{}}, docker)
+	driver.config.TrackerStateFile = filepath.Join(t.TempDir(), "tracker.json")
+	driver.config.TrackerStateKey = "state-key"
+	driver.secretTracker["db_password"] = &providers.SecretInfo{
+		DockerSecretName: "db_password",
+		SecretPath:       "database/prod/password",
+		LastHash:         "3b4c5d",
+		Provider:         "fake",
+	}
+	driver.saveTrackerState()
+
+	raw, err := os.ReadFile(driver.config.TrackerStateFile)
+	if err != nil {
+		t.Fatalf("state file was not written: %v", err)
+	}
+	if !bytes.HasPrefix(raw, encryptedStateMagic) {
+		t.Errorf("state file is not marked as encrypted")
+	}
+	for _, plain := range []string{"db_password", "database/prod/password", "3b4c5d"} {
+		if bytes.Contains(raw, []byte(plain)) {
+			t.Errorf("state file contains %q in plain text", plain)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{"same key", "state-key", false},
+		{"wrong key", "other-key", true},
+		{"no key", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restored := newTestDriver(&fakeProvider{values: map[string]string{}}, docker)
+			restored.config.TrackerStateFile = driver.config.TrackerStateFile
+			restored.config.TrackerStateKey = tt.key
+
+			err := restored.loadTrackerState()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadTrackerState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			secretInfo, tracked := restored.secretTracker["db_password"]
+			if !tracked || secretInfo.SecretPath != "database/prod/password" || secretInfo.LastHash != "3b4c5d" {
+				t.Errorf("restored %+v, expected the saved db_password", secretInfo)
+			}
+		})
+	}
+}
@@ -3,7 +3,11 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
 // getEnvOrDefault returns environment variable value or default
@@ -14,6 +18,18 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// environmentSettings collects all environment variables for provider configuration
+func environmentSettings() map[string]string {
+	settings := make(map[string]string)
+	for _, env := range os.Environ() {
+		pair := strings.SplitN(env, "=", 2)
+		if len(pair) == 2 {
+			settings[pair[0]] = pair[1]
+		}
+	}
+	return settings
+}
+
 // parseDurationOrDefault parses duration string or returns default
 func parseDurationOrDefault(durationStr string) time.Duration {
 	if duration, err := time.ParseDuration(durationStr); err == nil {
@@ -22,6 +38,22 @@ func parseDurationOrDefault(durationStr string) time.Duration {
 	return 5 * time.Minute // Default to 5 minutes
 }
 
+// parseDurationWithDefault parses duration string or returns the given default
+func parseDurationWithDefault(durationStr string, defaultValue time.Duration) time.Duration {
+	if duration, err := time.ParseDuration(durationStr); err == nil && duration >= 0 {
+		return duration
+	}
+	return defaultValue
+}
+
+// parseIntWithDefault parses a non-negative integer string or returns the given default
+func parseIntWithDefault(intStr string, defaultValue int) int {
+	if value, err := strconv.Atoi(strings.TrimSpace(intStr)); err == nil && value >= 0 {
+		return value
+	}
+	return defaultValue
+}
+
 // parseIntOrDefault parses integer string or returns default
 func parseIntOrDefault(intStr string) int {
 	if val, err := fmt.Sscanf(intStr, "%d", new(int)); err == nil && val == 1 {
@@ -36,3 +68,21 @@ func parseIntOrDefault(intStr string) int {
 	}
 	return 8080 // Default port
 }
+
+// parseLogLevel maps a LOG_LEVEL value to the corresponding logrus level
+func parseLogLevel(levelStr string) (log.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(levelStr)) {
+	case "trace":
+		return log.TraceLevel, nil
+	case "debug":
+		return log.DebugLevel, nil
+	case "info", "":
+		return log.InfoLevel, nil
+	case "warn", "warning":
+		return log.WarnLevel, nil
+	case "error":
+		return log.ErrorLevel, nil
+	default:
+		return log.InfoLevel, fmt.Errorf("unsupported log level %q, expected one of: trace, debug, info, warn, error", levelStr)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    log.Level
+		wantErr bool
+	}{
+		{"trace", log.TraceLevel, false},
+		{"debug", log.DebugLevel, false},
+		{"info", log.InfoLevel, false},
+		{"", log.InfoLevel, false},
+		{"warn", log.WarnLevel, false},
+		{"warning", log.WarnLevel, false},
+		{"error", log.ErrorLevel, false},
+		{" ERROR ", log.ErrorLevel, false},
+		{"fatal", log.InfoLevel, true},
+		{"verbose", log.InfoLevel, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			level, err := parseLogLevel(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLogLevel(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if level != tt.want {
+				t.Errorf("parseLogLevel(%q) = %v, expected %v", tt.value, level, tt.want)
+			}
+		})
+	}
+}
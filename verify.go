@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sugar-org/vault-swarm-plugin/monitoring"
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// Statuses of a tracked secret in a verify report
+const (
+	verifyInSync  = "in_sync"
+	verifyDrifted = "drifted"
+	verifySkipped = "skipped"
+	verifyError   = "error"
+)
+
+// verifyTrackedSecrets compares every tracked secret with its backend and
+// reports which ones drifted, without rotating or updating tracked state
+func (d *SecretsDriver) verifyTrackedSecrets(ctx context.Context) []monitoring.SecretDrift {
+	d.trackerMutex.RLock()
+	tracked := make([]*providers.SecretInfo, 0, len(d.secretTracker))
+	for _, secretInfo := range d.secretTracker {
+		tracked = append(tracked, secretInfo)
+	}
+	d.trackerMutex.RUnlock()
+	sort.Slice(tracked, func(i, j int) bool {
+		return tracked[i].DockerSecretName < tracked[j].DockerSecretName
+	})
+
+	report := make([]monitoring.SecretDrift, 0, len(tracked))
+	for _, secretInfo := range tracked {
+		report = append(report, d.verifySecret(ctx, secretInfo))
+	}
+	return report
+}
+
+// verifySecret checks one tracked secret the way the monitor would
+func (d *SecretsDriver) verifySecret(ctx context.Context, secretInfo *providers.SecretInfo) monitoring.SecretDrift {
+	d.trackerMutex.RLock()
+	drift := monitoring.SecretDrift{Name: secretInfo.DockerSecretName}
+	leased := secretInfo.LeaseID != ""
+	watched := secretInfo.WatchHash != ""
+	split := len(secretInfo.SplitTargets) > 0
+	d.trackerMutex.RUnlock()
+
+	// Every read of a dynamic secret issues new credentials
+	if leased {
+		drift.Status = verifySkipped
+		return drift
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.config.ChangeCheckTimeout)
+	defer cancel()
+
+	provider, err := d.trackedProvider(ctx, secretInfo)
+	if err != nil {
+		drift.Status = verifyError
+		drift.Error = err.Error()
+		return drift
+	}
+
+	var changed bool
+	if watched {
+		changed, err = d.hasWatchedFieldChanged(ctx, secretInfo, provider)
+	} else {
+		changed, err = provider.CheckSecretChanged(ctx, secretInfo)
+	}
+	if err != nil {
+		drift.Status = verifyError
+		drift.Error = err.Error()
+		return drift
+	}
+	if !changed && split {
+		changed = d.hasSplitChanged(ctx, secretInfo, provider)
+	}
+
+	drift.Status = verifyInSync
+	if changed {
+		drift.Status = verifyDrifted
+	}
+	return drift
+}
+
+// runVerify is the --verify mode: it prints the verify report of the tracked
+// secrets restored from TRACKER_STATE_FILE as JSON and returns the exit code,
+// 1 when a secret drifted or could not be checked
+func runVerify() int {
+	// Only the provider and the tracker state are needed, nothing may rotate
+	for _, name := range []string{"ENABLE_ROTATION", "ENABLE_MONITORING"} {
+		_ = os.Setenv(name, "false")
+	}
+	for _, name := range []string{"METRICS_PORT", "INVENTORY_EXPORT_PATH"} {
+		_ = os.Unsetenv(name)
+	}
+
+	driver, err := NewDriver()
+	if err != nil {
+		log.Errorf("Failed to initialize driver: %v", err)
+		return 2
+	}
+	defer func() { _ = driver.Stop() }()
+
+	report := driver.verifyTrackedSecrets(context.Background())
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Errorf("Failed to write verify report: %v", err)
+		return 2
+	}
+
+	for _, drift := range report {
+		if drift.Status == verifyDrifted || drift.Status == verifyError {
+			return 1
+		}
+	}
+	return 0
+}
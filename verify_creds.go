@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// verifyCredsTimeout bounds the whole --verify-creds check
+const verifyCredsTimeout = 30 * time.Second
+
+// runVerifyCreds is the --verify-creds mode: it sets up the configured
+// provider and checks its credentials against the backend. It returns 0 when
+// they are accepted, 1 when they are rejected and 2 when the provider could
+// not be set up or cannot verify credentials.
+func runVerifyCreds() int {
+	providerType := getEnvOrDefault("SECRETS_PROVIDER", "vault")
+	provider, err := providers.CreateProvider(providerType)
+	if err != nil {
+		log.Errorf("Failed to create provider: %v", err)
+		return 2
+	}
+
+	verifier, ok := provider.(providers.CredentialVerifier)
+	if !ok {
+		log.Errorf("The %s provider does not support credential verification", provider.GetProviderName())
+		return 2
+	}
+
+	// A login that fails here is a credential failure too, e.g. a bad AppRole secret
+	if err := provider.Initialize(environmentSettings()); err != nil {
+		log.Errorf("Failed to initialize %s provider: %v", provider.GetProviderName(), err)
+		var configErr *providers.ConfigError
+		if errors.As(err, &configErr) {
+			return 2
+		}
+		return 1
+	}
+	defer func() { _ = provider.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), verifyCredsTimeout)
+	defer cancel()
+	if err := verifier.VerifyCredentials(ctx); err != nil {
+		log.Errorf("Credentials rejected: %v", err)
+		return 1
+	}
+
+	log.Printf("Credentials for the %s provider are valid", provider.GetProviderName())
+	return 0
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRunVerifyCreds(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/token/lookup-self" || r.Header.Get("X-Vault-Token") != "valid" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"id":"valid","policies":["default"],"ttl":3600}}`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		provider string
+		token    string
+		want     int
+	}{
+		{"valid credentials", "vault", "valid", 0},
+		{"rejected credentials", "vault", "revoked", 1},
+		{"missing credentials", "vault", "", 2},
+		{"provider without verification", "env", "", 2},
+		{"unknown provider", "keepass", "", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SECRETS_PROVIDER", tt.provider)
+			t.Setenv("VAULT_ADDR", server.URL)
+			t.Setenv("VAULT_TOKEN", tt.token)
+
+			if code := runVerifyCreds(); code != tt.want {
+				t.Errorf("runVerifyCreds() = %d, expected %d", code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// pluginVersion is the released version of the plugin
+const pluginVersion = "v1.0.0"
+
+// sdkModules are the backend SDKs reported by --version, in display order
+var sdkModules = []struct {
+	name string
+	path string
+}{
+	{"Vault", "github.com/hashicorp/vault/api"},
+	{"OpenBao", "github.com/openbao/openbao/api/v2"},
+	{"AWS", "github.com/aws/aws-sdk-go-v2/service/secretsmanager"},
+	{"GCP", "cloud.google.com/go/secretmanager"},
+	{"Azure", "github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"},
+	{"Docker", "github.com/docker/docker"},
+}
+
+// versionInfo describes the plugin build for support tickets: the plugin and
+// Go versions, the platform, and the SDK versions compiled in
+func versionInfo() string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "Vault Secrets Provider %s\n", pluginVersion)
+	_, _ = fmt.Fprintf(&b, "Go version: %s\n", runtime.Version())
+	_, _ = fmt.Fprintf(&b, "OS/Arch: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		b.WriteString("SDK versions: unavailable (binary built without module support)\n")
+		return b.String()
+	}
+
+	versions := make(map[string]string, len(buildInfo.Deps))
+	for _, dep := range buildInfo.Deps {
+		version := dep.Version
+		if dep.Replace != nil {
+			version = dep.Replace.Version + " (replaced)"
+		}
+		versions[dep.Path] = version
+	}
+
+	b.WriteString("SDK versions:\n")
+	for _, sdk := range sdkModules {
+		version, found := versions[sdk.path]
+		if !found {
+			version = "not compiled in"
+		}
+		_, _ = fmt.Fprintf(&b, "  %-8s %s %s\n", sdk.name+":", sdk.path, version)
+	}
+	return b.String()
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestVersionInfo(t *testing.T) {
+	info := versionInfo()
+	for _, want := range []string{
+		"Vault Secrets Provider " + pluginVersion,
+		"Go version: " + runtime.Version(),
+		"OS/Arch: " + runtime.GOOS + "/" + runtime.GOARCH,
+	} {
+		if !strings.Contains(info, want) {
+			t.Errorf("versionInfo() = %q, expected it to contain %q", info, want)
+		}
+	}
+	// The test binary links every provider, so each SDK reports a version
+	for _, sdk := range sdkModules {
+		if !strings.Contains(info, sdk.name+":") || !strings.Contains(info, sdk.path+" v") {
+			t.Errorf("versionInfo() = %q, expected the version of the %s SDK", info, sdk.name)
+		}
+	}
+	if strings.Contains(info, "not compiled in") {
+		t.Errorf("versionInfo() = %q, expected no SDK to be missing", info)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// warmUpRestoredSecrets runs the first change check of the secrets restored
+// from the tracker state one at a time, spread evenly over WARMUP_WINDOW, so a
+// restart with many tracked secrets does not read them all at once. Periodic
+// checks start once it is done.
+func (d *SecretsDriver) warmUpRestoredSecrets() {
+	d.trackerMutex.RLock()
+	restored := make([]*providers.SecretInfo, 0, len(d.secretTracker))
+	for _, secretInfo := range d.secretTracker {
+		// Leases are renewed without a read, the periodic check handles them
+		if secretInfo.LeaseID == "" && d.isManagedSecret(secretInfo.Labels) {
+			restored = append(restored, secretInfo)
+		}
+	}
+	d.trackerMutex.RUnlock()
+
+	if len(restored) == 0 {
+		return
+	}
+	sort.Slice(restored, func(i, j int) bool {
+		return restored[i].DockerSecretName < restored[j].DockerSecretName
+	})
+
+	spacing := d.config.WarmupWindow / time.Duration(len(restored))
+	log.Printf("Warming up %d restored secrets over %v", len(restored), d.config.WarmupWindow)
+
+	for i, secretInfo := range restored {
+		if i > 0 {
+			select {
+			case <-d.monitorCtx.Done():
+				return
+			case <-d.after(spacing):
+			}
+		}
+		d.warmUpSecret(secretInfo)
+	}
+
+	log.Printf("Warm-up of restored secrets finished")
+}
+
+// warmUpSecret primes the last-known value of a restored secret and rotates
+// it if it changed while the plugin was down, the same way a periodic check
+// would. A panic costs the warm-up of this secret only.
+func (d *SecretsDriver) warmUpSecret(secretInfo *providers.SecretInfo) {
+	defer d.recoverCheckPanic("warming up secret " + secretInfo.DockerSecretName)
+
+	if d.staleValues != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), d.config.RequestTimeout)
+		d.trackerMutex.RLock()
+		req := replayRequest(secretInfo)
+		d.trackerMutex.RUnlock()
+		provider, instance, err := d.providerFor(ctx, req)
+		var value []byte
+		if err == nil {
+			value, err = provider.GetSecret(ctx, req)
+			if d.monitor != nil {
+				d.monitor.RecordProviderRead(instance)
+			}
+		}
+		cancel()
+		if err != nil {
+			log.Warnf("Failed to warm up secret %s: %v", secretInfo.DockerSecretName, err)
+		} else {
+			d.staleValues.store(req, value)
+			d.reportCacheStats()
+		}
+	}
+
+	if !d.scheduleDue(secretInfo) {
+		return
+	}
+	_ = d.checkDueSecret(secretInfo, nil)
+}
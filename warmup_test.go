@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-plugins-helpers/secrets"
+
+	"github.com/sugar-org/vault-swarm-plugin/monitoring"
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// checkRecorder is a fakeProvider that logs every change check and can panic
+// on the checks of one secret
+type checkRecorder struct {
+	*fakeProvider
+	events  *[]string
+	eventMu *sync.Mutex
+	panicOn string
+}
+
+func (p *checkRecorder) CheckSecretChanged(ctx context.Context, secretInfo *providers.SecretInfo) (bool, error) {
+	p.eventMu.Lock()
+	*p.events = append(*p.events, "check "+secretInfo.DockerSecretName)
+	p.eventMu.Unlock()
+	if secretInfo.DockerSecretName == p.panicOn {
+		panic("provider bug")
+	}
+	return p.fakeProvider.CheckSecretChanged(ctx, secretInfo)
+}
+
+// newWarmUpDriver tracks the given secrets as if restored from the tracker
+// state and records the checks and the waits between them
+func newWarmUpDriver(t *testing.T, names []string, panicOn string) (*SecretsDriver, *[]string) {
+	t.Helper()
+	var events []string
+	var eventMu sync.Mutex
+	values := make(map[string]string)
+	for _, name := range names {
+		values[name] = "first"
+	}
+	provider := &checkRecorder{fakeProvider: &fakeProvider{values: values}, events: &events, eventMu: &eventMu, panicOn: panicOn}
+
+	driver := newTestDriver(provider, &fakeDocker{})
+	driver.monitorCtx = context.Background()
+	driver.config.WarmupWindow = 4 * time.Minute
+	driver.after = func(d time.Duration) <-chan time.Time {
+		eventMu.Lock()
+		events = append(events, fmt.Sprintf("wait %v", d))
+		eventMu.Unlock()
+		ready := make(chan time.Time, 1)
+		ready <- time.Now()
+		return ready
+	}
+	for _, name := range names {
+		driver.trackSecret(secrets.Request{SecretName: name, SecretLabels: map[string]string{}}, []byte("first"), provider, "fake")
+	}
+	return driver, &events
+}
+
+func TestWarmUpSpreadsChecksOverWindow(t *testing.T) {
+	driver, events := newWarmUpDriver(t, []string{"d", "c", "b", "a"}, "")
+	driver.warmUpRestoredSecrets()
+
+	want := []string{"check a", "wait 1m0s", "check b", "wait 1m0s", "check c", "wait 1m0s", "check d"}
+	if fmt.Sprint(*events) != fmt.Sprint(want) {
+		t.Errorf("warm-up ran %v, expected %v", *events, want)
+	}
+}
+
+func TestWarmUpRecoversFromPanic(t *testing.T) {
+	driver, events := newWarmUpDriver(t, []string{"a", "b", "c"}, "b")
+	driver.monitor = monitoring.NewMonitor(time.Minute)
+	driver.warmUpRestoredSecrets()
+
+	// The panic costs the warm-up of b only
+	if last := (*events)[len(*events)-1]; last != "check c" {
+		t.Errorf("warm-up stopped at %q, expected it to go on to c", last)
+	}
+	if panics := driver.monitor.GetMetrics().MonitorPanics; panics != 1 {
+		t.Errorf("recorded %d panics, expected 1", panics)
+	}
+}
+
+func TestWarmUpKeepsDeferredSchedule(t *testing.T) {
+	docker := &fakeDocker{
+		secrets:  []swarm.Secret{testSecret("old", "db_password", nil)},
+		services: []swarm.Service{testService("svc", "api", nil, secretRef("old", "db_password"))},
+	}
+	provider := &rotatingProvider{fakeProvider: &fakeProvider{values: map[string]string{"db_password": "first"}}, rotating: true}
+	driver := newTestDriver(provider, docker)
+	driver.config.BackendRotationMaxDefer = time.Hour
+
+	driver.trackSecret(secrets.Request{SecretName: "db_password", ServiceName: "api", SecretLabels: map[string]string{}}, []byte("first"), provider, "fake")
+	secretInfo := driver.secretTracker["db_password"]
+	dueAt := time.Now().Add(-time.Minute)
+	secretInfo.CheckInterval = 24 * time.Hour
+	secretInfo.NextCheck = dueAt
+
+	provider.set("db_password", "second")
+	driver.warmUpSecret(secretInfo)
+
+	if len(docker.secretsWithPrefix("db_password-")) > 0 {
+		t.Errorf("secret rotated while the backend was rotating")
+	}
+	if !secretInfo.NextCheck.Equal(dueAt) {
+		t.Errorf("next check moved to %v, expected the deferred rotation to be retried on the next check", secretInfo.NextCheck)
+	}
+}
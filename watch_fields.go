@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/go-plugins-helpers/secrets"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// watchFieldsLabel lists the fields whose changes trigger rotation, so
+// volatile fields such as a last-updated timestamp do not
+const watchFieldsLabel = "rotation_watch_fields"
+
+// parseWatchFields parses the comma separated rotation_watch_fields label
+func parseWatchFields(label string) []string {
+	var fields []string
+	for _, field := range strings.Split(label, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// readWatchHash hashes only the watched fields of a secret. A watched field
+// that disappears changes the hash as well.
+func (d *SecretsDriver) readWatchHash(ctx context.Context, req secrets.Request, fields []string, provider providers.SecretsProvider) (string, error) {
+	hashes, err := d.readFieldHashes(ctx, req, provider)
+	if err != nil {
+		return "", err
+	}
+
+	var digest strings.Builder
+	for _, field := range fields {
+		digest.WriteString(field + "=" + hashes[field] + "\n")
+	}
+	return providers.HashValue([]byte(digest.String())), nil
+}
+
+// trackWatchHash records the watched field hash of a tracked secret
+func (d *SecretsDriver) trackWatchHash(ctx context.Context, req secrets.Request, provider providers.SecretsProvider) {
+	d.trackerMutex.RLock()
+	secretInfo, exists := d.secretTracker[req.SecretName]
+	var fields []string
+	if exists {
+		fields = secretInfo.WatchFields
+	}
+	d.trackerMutex.RUnlock()
+	if len(fields) == 0 {
+		return
+	}
+
+	hash, err := d.readWatchHash(ctx, req, fields, provider)
+	if err != nil {
+		log.Warnf("Cannot watch fields %v of secret %s, falling back to whole value changes: %v", fields, req.SecretName, err)
+		return
+	}
+
+	d.trackerMutex.Lock()
+	defer d.trackerMutex.Unlock()
+	secretInfo.WatchHash = hash
+}
+
+// hasWatchedFieldChanged reports whether any watched field of a secret changed
+func (d *SecretsDriver) hasWatchedFieldChanged(ctx context.Context, secretInfo *providers.SecretInfo, provider providers.SecretsProvider) (bool, error) {
+	d.trackerMutex.RLock()
+	fields := secretInfo.WatchFields
+	lastHash := secretInfo.WatchHash
+	d.trackerMutex.RUnlock()
+
+	hash, err := d.readWatchHash(ctx, replayRequest(secretInfo), fields, provider)
+	if err != nil {
+		return false, fmt.Errorf("failed to read watched fields: %v", err)
+	}
+	return hash != lastHash, nil
+}
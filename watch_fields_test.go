@@ -0,0 +1,62 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+func TestParseWatchFields(t *testing.T) {
+	tests := []struct {
+		label string
+		want  []string
+	}{
+		{"", nil},
+		{"password", []string{"password"}},
+		{" username , password,,", []string{"password", "username"}},
+	}
+	for _, tt := range tests {
+		if got := parseWatchFields(tt.label); !slices.Equal(got, tt.want) {
+			t.Errorf("parseWatchFields(%q) = %v, expected %v", tt.label, got, tt.want)
+		}
+	}
+}
+
+func TestRotationWatchFields(t *testing.T) {
+	tests := []struct {
+		name        string
+		watch       string
+		update      string
+		wantRotated bool
+	}{
+		{"unwatched field changes", "password", `{"password": "first", "updated_at": "2"}`, false},
+		{"watched field changes", "password", `{"password": "second", "updated_at": "1"}`, true},
+		{"whole value without the label", "", `{"password": "first", "updated_at": "2"}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{"fake_path": "db"}
+			if tt.watch != "" {
+				labels[watchFieldsLabel] = tt.watch
+			}
+			docker := &fakeDocker{secrets: []swarm.Secret{testSecret("db-1", "db", labels)}}
+			provider := &fieldProvider{&fakeProvider{values: map[string]string{"db": `{"password": "first", "updated_at": "1"}`}}}
+			driver := newTestDriver(provider, docker)
+
+			if response := driver.Get(secrets.Request{SecretName: "db", SecretLabels: labels}); response.Err != "" {
+				t.Fatalf("Get failed: %s", response.Err)
+			}
+			if watched := driver.secretTracker["db"].WatchHash != ""; watched != (tt.watch != "") {
+				t.Fatalf("watch hash recorded = %v, expected %v", watched, tt.watch != "")
+			}
+			provider.set("db", tt.update)
+			driver.checkForSecretChanges()
+
+			if rotated := docker.created > 0; rotated != tt.wantRotated {
+				t.Errorf("rotated = %v, expected %v", rotated, tt.wantRotated)
+			}
+		})
+	}
+}
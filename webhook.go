@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sugar-org/vault-swarm-plugin/providers"
+)
+
+// rotationEvent is the payload posted to rotation webhooks
+type rotationEvent struct {
+	SecretName string    `json:"secret_name"`
+	SecretPath string    `json:"secret_path"`
+	Provider   string    `json:"provider"`
+	Services   []string  `json:"services"`
+	RotatedAt  time.Time `json:"rotated_at"`
+	// Names of the fields that changed, sent when ROTATION_FIELD_DIFF is enabled
+	ChangedFields []string `json:"changed_fields,omitempty"`
+}
+
+// validateWebhookURL checks that a webhook target is an absolute http(s) URL
+func validateWebhookURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL %q: %v", rawURL, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q: must be an absolute http or https URL", rawURL)
+	}
+	return nil
+}
+
+// parseWebhookHeaders decodes the JSON object given in the rotation_webhook_headers label
+func parseWebhookHeaders(rawHeaders string) (map[string]string, error) {
+	headers := make(map[string]string)
+	if err := json.Unmarshal([]byte(rawHeaders), &headers); err != nil {
+		return nil, fmt.Errorf("invalid webhook headers: %v", err)
+	}
+	return headers, nil
+}
+
+// notifyRotation posts a rotation event to the secret's webhook, falling back to the global one
+func (d *SecretsDriver) notifyRotation(secretInfo *providers.SecretInfo) {
+	webhookURL := secretInfo.WebhookURL
+	if webhookURL == "" {
+		webhookURL = d.config.RotationWebhookURL
+	}
+	if webhookURL == "" {
+		return
+	}
+
+	d.trackerMutex.RLock()
+	event := rotationEvent{
+		SecretName: secretInfo.DockerSecretName,
+		SecretPath: secretInfo.SecretPath,
+		Provider:   secretInfo.Provider,
+		Services:   append([]string(nil), secretInfo.ServiceNames...),
+		RotatedAt:  secretInfo.LastUpdated,
+	}
+	event.ChangedFields = append([]string(nil), secretInfo.ChangedFields...)
+	d.trackerMutex.RUnlock()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Errorf("Failed to encode rotation webhook payload for %s: %v", secretInfo.DockerSecretName, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Errorf("Failed to build rotation webhook request for %s: %v", secretInfo.DockerSecretName, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Per-secret headers only apply to the per-secret webhook
+	if secretInfo.WebhookURL != "" {
+		for key, value := range secretInfo.WebhookHeaders {
+			req.Header.Set(key, value)
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Errorf("Failed to send rotation webhook for %s: %v", secretInfo.DockerSecretName, err)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		log.Warnf("Rotation webhook for %s returned status %d", secretInfo.DockerSecretName, resp.StatusCode)
+		return
+	}
+	log.Debugf("Sent rotation webhook for %s", secretInfo.DockerSecretName)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-plugins-helpers/secrets"
+)
+
+// webhookRecorder is a webhook target that records the Authorization header of each call
+type webhookRecorder struct {
+	mutex sync.Mutex
+	calls []string
+}
+
+func newWebhookRecorder(t *testing.T) (*webhookRecorder, *httptest.Server) {
+	recorder := &webhookRecorder{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder.mutex.Lock()
+		defer recorder.mutex.Unlock()
+		recorder.calls = append(recorder.calls, r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(server.Close)
+	return recorder, server
+}
+
+func (r *webhookRecorder) received() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func TestPerSecretWebhook(t *testing.T) {
+	global, globalServer := newWebhookRecorder(t)
+	perSecret, perSecretServer := newWebhookRecorder(t)
+
+	tests := []struct {
+		name                   string
+		labels                 map[string]string
+		wantGlobal, wantSecret []string
+	}{
+		{"global webhook", map[string]string{}, []string{""}, nil},
+		{"per-secret webhook", map[string]string{
+			"rotation_webhook":         perSecretServer.URL,
+			"rotation_webhook_headers": `{"Authorization": "Bearer team-token"}`,
+		}, nil, []string{"Bearer team-token"}},
+		{"invalid per-secret webhook", map[string]string{"rotation_webhook": "ftp://hooks.internal"}, []string{""}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			global.calls, perSecret.calls = nil, nil
+			docker := &fakeDocker{secrets: []swarm.Secret{testSecret("old", "db_password", tt.labels)}}
+			driver := newTestDriver(&fakeProvider{values: map[string]string{"db_password": "first"}}, docker)
+			driver.config.RotationWebhookURL = globalServer.URL
+
+			if response := driver.Get(secrets.Request{SecretName: "db_password", SecretLabels: tt.labels}); response.Err != "" {
+				t.Fatalf("Get failed: %s", response.Err)
+			}
+			driver.notifyRotation(driver.secretTracker["db_password"])
+
+			if got := global.received(); !slices.Equal(got, tt.wantGlobal) {
+				t.Errorf("global webhook received %q, expected %q", got, tt.wantGlobal)
+			}
+			if got := perSecret.received(); !slices.Equal(got, tt.wantSecret) {
+				t.Errorf("per-secret webhook received %q, expected %q", got, tt.wantSecret)
+			}
+		})
+	}
+}